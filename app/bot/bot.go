@@ -25,6 +25,8 @@ type Response struct {
 	ReplyTo       int                  // message to reply to, if 0 then no reply but common message
 	DeleteReplyTo bool                 // delete message what bot replays to
 	CheckResults  []spamcheck.Response // check results for the message
+	Score         float64              // aggregated spam score of the check results
+	PendingLLM    bool                 // openai check deferred, the final verdict is made by SpamFilter.VerifyLLM
 }
 
 // SenderChat is the sender of the message, sent on behalf of a chat. The
@@ -34,6 +36,8 @@ type Response struct {
 type SenderChat struct {
 	// ID is a unique identifier for this chat
 	ID int64 `json:"id"`
+	// Type of the chat, "channel", "group", "supergroup" or "private", optional
+	Type string `json:"type,omitempty"`
 	// the field below used only for logging purposes
 	// UserName for private chats, supergroups and channels if available, optional
 	UserName string `json:"username,omitempty"`
@@ -50,7 +54,16 @@ type Message struct {
 	Text       string    `json:",omitempty"`
 	Entities   *[]Entity `json:",omitempty"`
 	Image      *Image    `json:",omitempty"`
-	ReplyTo    struct {
+	Document   *Document `json:",omitempty"` // document, video, animation, audio or voice attached to the message
+	Poll       *Poll     `json:",omitempty"`
+	Contact    *Contact  `json:",omitempty"` // contact card shared in the message
+	Sticker    *Sticker  `json:",omitempty"`
+	Edited     bool      `json:",omitempty"` // edited version of the previously sent message
+	ButtonURLs []string  `json:",omitempty"` // urls of inline keyboard buttons attached to the message
+
+	ForwardFromChat SenderChat `json:"forward_from_chat,omitempty"` // channel (chat) the message forwarded from
+
+	ReplyTo struct {
 		From       User
 		Text       string `json:",omitempty"`
 		Sent       time.Time
@@ -76,6 +89,38 @@ type Image struct {
 	Height   int
 	Caption  string    `json:",omitempty"`
 	Entities *[]Entity `json:",omitempty"`
+	Hash     *uint64   `json:",omitempty"` // perceptual hash of the image, set if image hashed
+}
+
+// Document represents a file attached to the message. Not only documents, but also videos, animations, audios
+// and voice messages are represented as documents with the corresponding type
+type Document struct {
+	FileID   string
+	Type     string // document, video, animation, audio, voice or video_note
+	FileName string `json:",omitempty"`
+	MimeType string `json:",omitempty"`
+	Title    string `json:",omitempty"` // title of the audio
+}
+
+// Poll represents a poll with its question and options
+type Poll struct {
+	Question string
+	Options  []string
+}
+
+// Contact represents a contact card
+type Contact struct {
+	PhoneNumber string
+	Name        string
+	UserID      int64  `json:",omitempty"` // telegram user id of the contact, if known
+	VCard       string `json:",omitempty"`
+}
+
+// Sticker represents a sticker
+type Sticker struct {
+	FileID  string
+	Emoji   string `json:",omitempty"` // emoji associated with the sticker
+	SetName string `json:",omitempty"` // name of the sticker set
 }
 
 // User defines user info of the Message
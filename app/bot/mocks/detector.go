@@ -20,15 +20,36 @@ import (
 //			AddApprovedUserFunc: func(user approved.UserInfo) error {
 //				panic("mock out the AddApprovedUser method")
 //			},
+//			ApproveUserFunc: func(user approved.UserInfo)  {
+//				panic("mock out the ApproveUser method")
+//			},
 //			ApprovedUsersFunc: func() []approved.UserInfo {
 //				panic("mock out the ApprovedUsers method")
 //			},
-//			CheckFunc: func(request spamcheck.Request) (bool, []spamcheck.Response) {
-//				panic("mock out the Check method")
+//			CheckLLMFunc: func(request spamcheck.Request) (bool, float64, spamcheck.Response) {
+//				panic("mock out the CheckLLM method")
+//			},
+//			CheckWithScoreFunc: func(request spamcheck.Request) (bool, float64, []spamcheck.Response) {
+//				panic("mock out the CheckWithScore method")
+//			},
+//			DisapproveUserFunc: func(id string)  {
+//				panic("mock out the DisapproveUser method")
 //			},
 //			IsApprovedUserFunc: func(userID string) bool {
 //				panic("mock out the IsApprovedUser method")
 //			},
+//			LearnHamFunc: func(msg string)  {
+//				panic("mock out the LearnHam method")
+//			},
+//			LearnSpamFunc: func(msg string)  {
+//				panic("mock out the LearnSpam method")
+//			},
+//			LoadDomainsFunc: func(allowReader io.Reader, blockReader io.Reader) (tgspam.LoadResult, error) {
+//				panic("mock out the LoadDomains method")
+//			},
+//			LoadModelFunc: func(r io.Reader, fingerprint string) (tgspam.LoadResult, error) {
+//				panic("mock out the LoadModel method")
+//			},
 //			LoadSamplesFunc: func(exclReader io.Reader, spamReaders []io.Reader, hamReaders []io.Reader) (tgspam.LoadResult, error) {
 //				panic("mock out the LoadSamples method")
 //			},
@@ -38,6 +59,15 @@ import (
 //			RemoveApprovedUserFunc: func(id string) error {
 //				panic("mock out the RemoveApprovedUser method")
 //			},
+//			SaveModelFunc: func(w io.Writer, fingerprint string) error {
+//				panic("mock out the SaveModel method")
+//			},
+//			SetThresholdsFunc: func(similarity float64, minSpamProbability float64)  {
+//				panic("mock out the SetThresholds method")
+//			},
+//			ThresholdsFunc: func() (float64, float64) {
+//				panic("mock out the Thresholds method")
+//			},
 //			UpdateHamFunc: func(msg string) error {
 //				panic("mock out the UpdateHam method")
 //			},
@@ -54,15 +84,36 @@ type DetectorMock struct {
 	// AddApprovedUserFunc mocks the AddApprovedUser method.
 	AddApprovedUserFunc func(user approved.UserInfo) error
 
+	// ApproveUserFunc mocks the ApproveUser method.
+	ApproveUserFunc func(user approved.UserInfo)
+
 	// ApprovedUsersFunc mocks the ApprovedUsers method.
 	ApprovedUsersFunc func() []approved.UserInfo
 
-	// CheckFunc mocks the Check method.
-	CheckFunc func(request spamcheck.Request) (bool, []spamcheck.Response)
+	// CheckLLMFunc mocks the CheckLLM method.
+	CheckLLMFunc func(request spamcheck.Request) (bool, float64, spamcheck.Response)
+
+	// CheckWithScoreFunc mocks the CheckWithScore method.
+	CheckWithScoreFunc func(request spamcheck.Request) (bool, float64, []spamcheck.Response)
+
+	// DisapproveUserFunc mocks the DisapproveUser method.
+	DisapproveUserFunc func(id string)
 
 	// IsApprovedUserFunc mocks the IsApprovedUser method.
 	IsApprovedUserFunc func(userID string) bool
 
+	// LearnHamFunc mocks the LearnHam method.
+	LearnHamFunc func(msg string)
+
+	// LearnSpamFunc mocks the LearnSpam method.
+	LearnSpamFunc func(msg string)
+
+	// LoadDomainsFunc mocks the LoadDomains method.
+	LoadDomainsFunc func(allowReader io.Reader, blockReader io.Reader) (tgspam.LoadResult, error)
+
+	// LoadModelFunc mocks the LoadModel method.
+	LoadModelFunc func(r io.Reader, fingerprint string) (tgspam.LoadResult, error)
+
 	// LoadSamplesFunc mocks the LoadSamples method.
 	LoadSamplesFunc func(exclReader io.Reader, spamReaders []io.Reader, hamReaders []io.Reader) (tgspam.LoadResult, error)
 
@@ -72,6 +123,15 @@ type DetectorMock struct {
 	// RemoveApprovedUserFunc mocks the RemoveApprovedUser method.
 	RemoveApprovedUserFunc func(id string) error
 
+	// SaveModelFunc mocks the SaveModel method.
+	SaveModelFunc func(w io.Writer, fingerprint string) error
+
+	// SetThresholdsFunc mocks the SetThresholds method.
+	SetThresholdsFunc func(similarity float64, minSpamProbability float64)
+
+	// ThresholdsFunc mocks the Thresholds method.
+	ThresholdsFunc func() (float64, float64)
+
 	// UpdateHamFunc mocks the UpdateHam method.
 	UpdateHamFunc func(msg string) error
 
@@ -85,19 +145,58 @@ type DetectorMock struct {
 			// User is the user argument value.
 			User approved.UserInfo
 		}
+		// ApproveUser holds details about calls to the ApproveUser method.
+		ApproveUser []struct {
+			// User is the user argument value.
+			User approved.UserInfo
+		}
 		// ApprovedUsers holds details about calls to the ApprovedUsers method.
 		ApprovedUsers []struct {
 		}
-		// Check holds details about calls to the Check method.
-		Check []struct {
+		// CheckLLM holds details about calls to the CheckLLM method.
+		CheckLLM []struct {
+			// Request is the request argument value.
+			Request spamcheck.Request
+		}
+		// CheckWithScore holds details about calls to the CheckWithScore method.
+		CheckWithScore []struct {
 			// Request is the request argument value.
 			Request spamcheck.Request
 		}
+		// DisapproveUser holds details about calls to the DisapproveUser method.
+		DisapproveUser []struct {
+			// ID is the id argument value.
+			ID string
+		}
 		// IsApprovedUser holds details about calls to the IsApprovedUser method.
 		IsApprovedUser []struct {
 			// UserID is the userID argument value.
 			UserID string
 		}
+		// LearnHam holds details about calls to the LearnHam method.
+		LearnHam []struct {
+			// Msg is the msg argument value.
+			Msg string
+		}
+		// LearnSpam holds details about calls to the LearnSpam method.
+		LearnSpam []struct {
+			// Msg is the msg argument value.
+			Msg string
+		}
+		// LoadDomains holds details about calls to the LoadDomains method.
+		LoadDomains []struct {
+			// AllowReader is the allowReader argument value.
+			AllowReader io.Reader
+			// BlockReader is the blockReader argument value.
+			BlockReader io.Reader
+		}
+		// LoadModel holds details about calls to the LoadModel method.
+		LoadModel []struct {
+			// R is the r argument value.
+			R io.Reader
+			// Fingerprint is the fingerprint argument value.
+			Fingerprint string
+		}
 		// LoadSamples holds details about calls to the LoadSamples method.
 		LoadSamples []struct {
 			// ExclReader is the exclReader argument value.
@@ -117,6 +216,23 @@ type DetectorMock struct {
 			// ID is the id argument value.
 			ID string
 		}
+		// SaveModel holds details about calls to the SaveModel method.
+		SaveModel []struct {
+			// W is the w argument value.
+			W io.Writer
+			// Fingerprint is the fingerprint argument value.
+			Fingerprint string
+		}
+		// SetThresholds holds details about calls to the SetThresholds method.
+		SetThresholds []struct {
+			// Similarity is the similarity argument value.
+			Similarity float64
+			// MinSpamProbability is the minSpamProbability argument value.
+			MinSpamProbability float64
+		}
+		// Thresholds holds details about calls to the Thresholds method.
+		Thresholds []struct {
+		}
 		// UpdateHam holds details about calls to the UpdateHam method.
 		UpdateHam []struct {
 			// Msg is the msg argument value.
@@ -129,12 +245,22 @@ type DetectorMock struct {
 		}
 	}
 	lockAddApprovedUser    sync.RWMutex
+	lockApproveUser        sync.RWMutex
 	lockApprovedUsers      sync.RWMutex
-	lockCheck              sync.RWMutex
+	lockCheckLLM           sync.RWMutex
+	lockCheckWithScore     sync.RWMutex
+	lockDisapproveUser     sync.RWMutex
 	lockIsApprovedUser     sync.RWMutex
+	lockLearnHam           sync.RWMutex
+	lockLearnSpam          sync.RWMutex
+	lockLoadDomains        sync.RWMutex
+	lockLoadModel          sync.RWMutex
 	lockLoadSamples        sync.RWMutex
 	lockLoadStopWords      sync.RWMutex
 	lockRemoveApprovedUser sync.RWMutex
+	lockSaveModel          sync.RWMutex
+	lockSetThresholds      sync.RWMutex
+	lockThresholds         sync.RWMutex
 	lockUpdateHam          sync.RWMutex
 	lockUpdateSpam         sync.RWMutex
 }
@@ -178,6 +304,45 @@ func (mock *DetectorMock) ResetAddApprovedUserCalls() {
 	mock.lockAddApprovedUser.Unlock()
 }
 
+// ApproveUser calls ApproveUserFunc.
+func (mock *DetectorMock) ApproveUser(user approved.UserInfo) {
+	if mock.ApproveUserFunc == nil {
+		panic("DetectorMock.ApproveUserFunc: method is nil but Detector.ApproveUser was just called")
+	}
+	callInfo := struct {
+		User approved.UserInfo
+	}{
+		User: user,
+	}
+	mock.lockApproveUser.Lock()
+	mock.calls.ApproveUser = append(mock.calls.ApproveUser, callInfo)
+	mock.lockApproveUser.Unlock()
+	mock.ApproveUserFunc(user)
+}
+
+// ApproveUserCalls gets all the calls that were made to ApproveUser.
+// Check the length with:
+//
+//	len(mockedDetector.ApproveUserCalls())
+func (mock *DetectorMock) ApproveUserCalls() []struct {
+	User approved.UserInfo
+} {
+	var calls []struct {
+		User approved.UserInfo
+	}
+	mock.lockApproveUser.RLock()
+	calls = mock.calls.ApproveUser
+	mock.lockApproveUser.RUnlock()
+	return calls
+}
+
+// ResetApproveUserCalls reset all the calls that were made to ApproveUser.
+func (mock *DetectorMock) ResetApproveUserCalls() {
+	mock.lockApproveUser.Lock()
+	mock.calls.ApproveUser = nil
+	mock.lockApproveUser.Unlock()
+}
+
 // ApprovedUsers calls ApprovedUsersFunc.
 func (mock *DetectorMock) ApprovedUsers() []approved.UserInfo {
 	if mock.ApprovedUsersFunc == nil {
@@ -212,43 +377,121 @@ func (mock *DetectorMock) ResetApprovedUsersCalls() {
 	mock.lockApprovedUsers.Unlock()
 }
 
-// Check calls CheckFunc.
-func (mock *DetectorMock) Check(request spamcheck.Request) (bool, []spamcheck.Response) {
-	if mock.CheckFunc == nil {
-		panic("DetectorMock.CheckFunc: method is nil but Detector.Check was just called")
+// CheckLLM calls CheckLLMFunc.
+func (mock *DetectorMock) CheckLLM(request spamcheck.Request) (bool, float64, spamcheck.Response) {
+	if mock.CheckLLMFunc == nil {
+		panic("DetectorMock.CheckLLMFunc: method is nil but Detector.CheckLLM was just called")
 	}
 	callInfo := struct {
 		Request spamcheck.Request
 	}{
 		Request: request,
 	}
-	mock.lockCheck.Lock()
-	mock.calls.Check = append(mock.calls.Check, callInfo)
-	mock.lockCheck.Unlock()
-	return mock.CheckFunc(request)
+	mock.lockCheckLLM.Lock()
+	mock.calls.CheckLLM = append(mock.calls.CheckLLM, callInfo)
+	mock.lockCheckLLM.Unlock()
+	return mock.CheckLLMFunc(request)
 }
 
-// CheckCalls gets all the calls that were made to Check.
+// CheckLLMCalls gets all the calls that were made to CheckLLM.
 // Check the length with:
 //
-//	len(mockedDetector.CheckCalls())
-func (mock *DetectorMock) CheckCalls() []struct {
+//	len(mockedDetector.CheckLLMCalls())
+func (mock *DetectorMock) CheckLLMCalls() []struct {
 	Request spamcheck.Request
 } {
 	var calls []struct {
 		Request spamcheck.Request
 	}
-	mock.lockCheck.RLock()
-	calls = mock.calls.Check
-	mock.lockCheck.RUnlock()
+	mock.lockCheckLLM.RLock()
+	calls = mock.calls.CheckLLM
+	mock.lockCheckLLM.RUnlock()
 	return calls
 }
 
-// ResetCheckCalls reset all the calls that were made to Check.
-func (mock *DetectorMock) ResetCheckCalls() {
-	mock.lockCheck.Lock()
-	mock.calls.Check = nil
-	mock.lockCheck.Unlock()
+// ResetCheckLLMCalls reset all the calls that were made to CheckLLM.
+func (mock *DetectorMock) ResetCheckLLMCalls() {
+	mock.lockCheckLLM.Lock()
+	mock.calls.CheckLLM = nil
+	mock.lockCheckLLM.Unlock()
+}
+
+// CheckWithScore calls CheckWithScoreFunc.
+func (mock *DetectorMock) CheckWithScore(request spamcheck.Request) (bool, float64, []spamcheck.Response) {
+	if mock.CheckWithScoreFunc == nil {
+		panic("DetectorMock.CheckWithScoreFunc: method is nil but Detector.CheckWithScore was just called")
+	}
+	callInfo := struct {
+		Request spamcheck.Request
+	}{
+		Request: request,
+	}
+	mock.lockCheckWithScore.Lock()
+	mock.calls.CheckWithScore = append(mock.calls.CheckWithScore, callInfo)
+	mock.lockCheckWithScore.Unlock()
+	return mock.CheckWithScoreFunc(request)
+}
+
+// CheckWithScoreCalls gets all the calls that were made to CheckWithScore.
+// Check the length with:
+//
+//	len(mockedDetector.CheckWithScoreCalls())
+func (mock *DetectorMock) CheckWithScoreCalls() []struct {
+	Request spamcheck.Request
+} {
+	var calls []struct {
+		Request spamcheck.Request
+	}
+	mock.lockCheckWithScore.RLock()
+	calls = mock.calls.CheckWithScore
+	mock.lockCheckWithScore.RUnlock()
+	return calls
+}
+
+// ResetCheckWithScoreCalls reset all the calls that were made to CheckWithScore.
+func (mock *DetectorMock) ResetCheckWithScoreCalls() {
+	mock.lockCheckWithScore.Lock()
+	mock.calls.CheckWithScore = nil
+	mock.lockCheckWithScore.Unlock()
+}
+
+// DisapproveUser calls DisapproveUserFunc.
+func (mock *DetectorMock) DisapproveUser(id string) {
+	if mock.DisapproveUserFunc == nil {
+		panic("DetectorMock.DisapproveUserFunc: method is nil but Detector.DisapproveUser was just called")
+	}
+	callInfo := struct {
+		ID string
+	}{
+		ID: id,
+	}
+	mock.lockDisapproveUser.Lock()
+	mock.calls.DisapproveUser = append(mock.calls.DisapproveUser, callInfo)
+	mock.lockDisapproveUser.Unlock()
+	mock.DisapproveUserFunc(id)
+}
+
+// DisapproveUserCalls gets all the calls that were made to DisapproveUser.
+// Check the length with:
+//
+//	len(mockedDetector.DisapproveUserCalls())
+func (mock *DetectorMock) DisapproveUserCalls() []struct {
+	ID string
+} {
+	var calls []struct {
+		ID string
+	}
+	mock.lockDisapproveUser.RLock()
+	calls = mock.calls.DisapproveUser
+	mock.lockDisapproveUser.RUnlock()
+	return calls
+}
+
+// ResetDisapproveUserCalls reset all the calls that were made to DisapproveUser.
+func (mock *DetectorMock) ResetDisapproveUserCalls() {
+	mock.lockDisapproveUser.Lock()
+	mock.calls.DisapproveUser = nil
+	mock.lockDisapproveUser.Unlock()
 }
 
 // IsApprovedUser calls IsApprovedUserFunc.
@@ -290,6 +533,170 @@ func (mock *DetectorMock) ResetIsApprovedUserCalls() {
 	mock.lockIsApprovedUser.Unlock()
 }
 
+// LearnHam calls LearnHamFunc.
+func (mock *DetectorMock) LearnHam(msg string) {
+	if mock.LearnHamFunc == nil {
+		panic("DetectorMock.LearnHamFunc: method is nil but Detector.LearnHam was just called")
+	}
+	callInfo := struct {
+		Msg string
+	}{
+		Msg: msg,
+	}
+	mock.lockLearnHam.Lock()
+	mock.calls.LearnHam = append(mock.calls.LearnHam, callInfo)
+	mock.lockLearnHam.Unlock()
+	mock.LearnHamFunc(msg)
+}
+
+// LearnHamCalls gets all the calls that were made to LearnHam.
+// Check the length with:
+//
+//	len(mockedDetector.LearnHamCalls())
+func (mock *DetectorMock) LearnHamCalls() []struct {
+	Msg string
+} {
+	var calls []struct {
+		Msg string
+	}
+	mock.lockLearnHam.RLock()
+	calls = mock.calls.LearnHam
+	mock.lockLearnHam.RUnlock()
+	return calls
+}
+
+// ResetLearnHamCalls reset all the calls that were made to LearnHam.
+func (mock *DetectorMock) ResetLearnHamCalls() {
+	mock.lockLearnHam.Lock()
+	mock.calls.LearnHam = nil
+	mock.lockLearnHam.Unlock()
+}
+
+// LearnSpam calls LearnSpamFunc.
+func (mock *DetectorMock) LearnSpam(msg string) {
+	if mock.LearnSpamFunc == nil {
+		panic("DetectorMock.LearnSpamFunc: method is nil but Detector.LearnSpam was just called")
+	}
+	callInfo := struct {
+		Msg string
+	}{
+		Msg: msg,
+	}
+	mock.lockLearnSpam.Lock()
+	mock.calls.LearnSpam = append(mock.calls.LearnSpam, callInfo)
+	mock.lockLearnSpam.Unlock()
+	mock.LearnSpamFunc(msg)
+}
+
+// LearnSpamCalls gets all the calls that were made to LearnSpam.
+// Check the length with:
+//
+//	len(mockedDetector.LearnSpamCalls())
+func (mock *DetectorMock) LearnSpamCalls() []struct {
+	Msg string
+} {
+	var calls []struct {
+		Msg string
+	}
+	mock.lockLearnSpam.RLock()
+	calls = mock.calls.LearnSpam
+	mock.lockLearnSpam.RUnlock()
+	return calls
+}
+
+// ResetLearnSpamCalls reset all the calls that were made to LearnSpam.
+func (mock *DetectorMock) ResetLearnSpamCalls() {
+	mock.lockLearnSpam.Lock()
+	mock.calls.LearnSpam = nil
+	mock.lockLearnSpam.Unlock()
+}
+
+// LoadDomains calls LoadDomainsFunc.
+func (mock *DetectorMock) LoadDomains(allowReader io.Reader, blockReader io.Reader) (tgspam.LoadResult, error) {
+	if mock.LoadDomainsFunc == nil {
+		panic("DetectorMock.LoadDomainsFunc: method is nil but Detector.LoadDomains was just called")
+	}
+	callInfo := struct {
+		AllowReader io.Reader
+		BlockReader io.Reader
+	}{
+		AllowReader: allowReader,
+		BlockReader: blockReader,
+	}
+	mock.lockLoadDomains.Lock()
+	mock.calls.LoadDomains = append(mock.calls.LoadDomains, callInfo)
+	mock.lockLoadDomains.Unlock()
+	return mock.LoadDomainsFunc(allowReader, blockReader)
+}
+
+// LoadDomainsCalls gets all the calls that were made to LoadDomains.
+// Check the length with:
+//
+//	len(mockedDetector.LoadDomainsCalls())
+func (mock *DetectorMock) LoadDomainsCalls() []struct {
+	AllowReader io.Reader
+	BlockReader io.Reader
+} {
+	var calls []struct {
+		AllowReader io.Reader
+		BlockReader io.Reader
+	}
+	mock.lockLoadDomains.RLock()
+	calls = mock.calls.LoadDomains
+	mock.lockLoadDomains.RUnlock()
+	return calls
+}
+
+// ResetLoadDomainsCalls reset all the calls that were made to LoadDomains.
+func (mock *DetectorMock) ResetLoadDomainsCalls() {
+	mock.lockLoadDomains.Lock()
+	mock.calls.LoadDomains = nil
+	mock.lockLoadDomains.Unlock()
+}
+
+// LoadModel calls LoadModelFunc.
+func (mock *DetectorMock) LoadModel(r io.Reader, fingerprint string) (tgspam.LoadResult, error) {
+	if mock.LoadModelFunc == nil {
+		panic("DetectorMock.LoadModelFunc: method is nil but Detector.LoadModel was just called")
+	}
+	callInfo := struct {
+		R           io.Reader
+		Fingerprint string
+	}{
+		R:           r,
+		Fingerprint: fingerprint,
+	}
+	mock.lockLoadModel.Lock()
+	mock.calls.LoadModel = append(mock.calls.LoadModel, callInfo)
+	mock.lockLoadModel.Unlock()
+	return mock.LoadModelFunc(r, fingerprint)
+}
+
+// LoadModelCalls gets all the calls that were made to LoadModel.
+// Check the length with:
+//
+//	len(mockedDetector.LoadModelCalls())
+func (mock *DetectorMock) LoadModelCalls() []struct {
+	R           io.Reader
+	Fingerprint string
+} {
+	var calls []struct {
+		R           io.Reader
+		Fingerprint string
+	}
+	mock.lockLoadModel.RLock()
+	calls = mock.calls.LoadModel
+	mock.lockLoadModel.RUnlock()
+	return calls
+}
+
+// ResetLoadModelCalls reset all the calls that were made to LoadModel.
+func (mock *DetectorMock) ResetLoadModelCalls() {
+	mock.lockLoadModel.Lock()
+	mock.calls.LoadModel = nil
+	mock.lockLoadModel.Unlock()
+}
+
 // LoadSamples calls LoadSamplesFunc.
 func (mock *DetectorMock) LoadSamples(exclReader io.Reader, spamReaders []io.Reader, hamReaders []io.Reader) (tgspam.LoadResult, error) {
 	if mock.LoadSamplesFunc == nil {
@@ -415,6 +822,126 @@ func (mock *DetectorMock) ResetRemoveApprovedUserCalls() {
 	mock.lockRemoveApprovedUser.Unlock()
 }
 
+// SaveModel calls SaveModelFunc.
+func (mock *DetectorMock) SaveModel(w io.Writer, fingerprint string) error {
+	if mock.SaveModelFunc == nil {
+		panic("DetectorMock.SaveModelFunc: method is nil but Detector.SaveModel was just called")
+	}
+	callInfo := struct {
+		W           io.Writer
+		Fingerprint string
+	}{
+		W:           w,
+		Fingerprint: fingerprint,
+	}
+	mock.lockSaveModel.Lock()
+	mock.calls.SaveModel = append(mock.calls.SaveModel, callInfo)
+	mock.lockSaveModel.Unlock()
+	return mock.SaveModelFunc(w, fingerprint)
+}
+
+// SaveModelCalls gets all the calls that were made to SaveModel.
+// Check the length with:
+//
+//	len(mockedDetector.SaveModelCalls())
+func (mock *DetectorMock) SaveModelCalls() []struct {
+	W           io.Writer
+	Fingerprint string
+} {
+	var calls []struct {
+		W           io.Writer
+		Fingerprint string
+	}
+	mock.lockSaveModel.RLock()
+	calls = mock.calls.SaveModel
+	mock.lockSaveModel.RUnlock()
+	return calls
+}
+
+// ResetSaveModelCalls reset all the calls that were made to SaveModel.
+func (mock *DetectorMock) ResetSaveModelCalls() {
+	mock.lockSaveModel.Lock()
+	mock.calls.SaveModel = nil
+	mock.lockSaveModel.Unlock()
+}
+
+// SetThresholds calls SetThresholdsFunc.
+func (mock *DetectorMock) SetThresholds(similarity float64, minSpamProbability float64) {
+	if mock.SetThresholdsFunc == nil {
+		panic("DetectorMock.SetThresholdsFunc: method is nil but Detector.SetThresholds was just called")
+	}
+	callInfo := struct {
+		Similarity         float64
+		MinSpamProbability float64
+	}{
+		Similarity:         similarity,
+		MinSpamProbability: minSpamProbability,
+	}
+	mock.lockSetThresholds.Lock()
+	mock.calls.SetThresholds = append(mock.calls.SetThresholds, callInfo)
+	mock.lockSetThresholds.Unlock()
+	mock.SetThresholdsFunc(similarity, minSpamProbability)
+}
+
+// SetThresholdsCalls gets all the calls that were made to SetThresholds.
+// Check the length with:
+//
+//	len(mockedDetector.SetThresholdsCalls())
+func (mock *DetectorMock) SetThresholdsCalls() []struct {
+	Similarity         float64
+	MinSpamProbability float64
+} {
+	var calls []struct {
+		Similarity         float64
+		MinSpamProbability float64
+	}
+	mock.lockSetThresholds.RLock()
+	calls = mock.calls.SetThresholds
+	mock.lockSetThresholds.RUnlock()
+	return calls
+}
+
+// ResetSetThresholdsCalls reset all the calls that were made to SetThresholds.
+func (mock *DetectorMock) ResetSetThresholdsCalls() {
+	mock.lockSetThresholds.Lock()
+	mock.calls.SetThresholds = nil
+	mock.lockSetThresholds.Unlock()
+}
+
+// Thresholds calls ThresholdsFunc.
+func (mock *DetectorMock) Thresholds() (float64, float64) {
+	if mock.ThresholdsFunc == nil {
+		panic("DetectorMock.ThresholdsFunc: method is nil but Detector.Thresholds was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockThresholds.Lock()
+	mock.calls.Thresholds = append(mock.calls.Thresholds, callInfo)
+	mock.lockThresholds.Unlock()
+	return mock.ThresholdsFunc()
+}
+
+// ThresholdsCalls gets all the calls that were made to Thresholds.
+// Check the length with:
+//
+//	len(mockedDetector.ThresholdsCalls())
+func (mock *DetectorMock) ThresholdsCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockThresholds.RLock()
+	calls = mock.calls.Thresholds
+	mock.lockThresholds.RUnlock()
+	return calls
+}
+
+// ResetThresholdsCalls reset all the calls that were made to Thresholds.
+func (mock *DetectorMock) ResetThresholdsCalls() {
+	mock.lockThresholds.Lock()
+	mock.calls.Thresholds = nil
+	mock.lockThresholds.Unlock()
+}
+
 // UpdateHam calls UpdateHamFunc.
 func (mock *DetectorMock) UpdateHam(msg string) error {
 	if mock.UpdateHamFunc == nil {
@@ -499,18 +1026,46 @@ func (mock *DetectorMock) ResetCalls() {
 	mock.calls.AddApprovedUser = nil
 	mock.lockAddApprovedUser.Unlock()
 
+	mock.lockApproveUser.Lock()
+	mock.calls.ApproveUser = nil
+	mock.lockApproveUser.Unlock()
+
 	mock.lockApprovedUsers.Lock()
 	mock.calls.ApprovedUsers = nil
 	mock.lockApprovedUsers.Unlock()
 
-	mock.lockCheck.Lock()
-	mock.calls.Check = nil
-	mock.lockCheck.Unlock()
+	mock.lockCheckLLM.Lock()
+	mock.calls.CheckLLM = nil
+	mock.lockCheckLLM.Unlock()
+
+	mock.lockCheckWithScore.Lock()
+	mock.calls.CheckWithScore = nil
+	mock.lockCheckWithScore.Unlock()
+
+	mock.lockDisapproveUser.Lock()
+	mock.calls.DisapproveUser = nil
+	mock.lockDisapproveUser.Unlock()
 
 	mock.lockIsApprovedUser.Lock()
 	mock.calls.IsApprovedUser = nil
 	mock.lockIsApprovedUser.Unlock()
 
+	mock.lockLearnHam.Lock()
+	mock.calls.LearnHam = nil
+	mock.lockLearnHam.Unlock()
+
+	mock.lockLearnSpam.Lock()
+	mock.calls.LearnSpam = nil
+	mock.lockLearnSpam.Unlock()
+
+	mock.lockLoadDomains.Lock()
+	mock.calls.LoadDomains = nil
+	mock.lockLoadDomains.Unlock()
+
+	mock.lockLoadModel.Lock()
+	mock.calls.LoadModel = nil
+	mock.lockLoadModel.Unlock()
+
 	mock.lockLoadSamples.Lock()
 	mock.calls.LoadSamples = nil
 	mock.lockLoadSamples.Unlock()
@@ -523,6 +1078,18 @@ func (mock *DetectorMock) ResetCalls() {
 	mock.calls.RemoveApprovedUser = nil
 	mock.lockRemoveApprovedUser.Unlock()
 
+	mock.lockSaveModel.Lock()
+	mock.calls.SaveModel = nil
+	mock.lockSaveModel.Unlock()
+
+	mock.lockSetThresholds.Lock()
+	mock.calls.SetThresholds = nil
+	mock.lockSetThresholds.Unlock()
+
+	mock.lockThresholds.Lock()
+	mock.calls.Thresholds = nil
+	mock.lockThresholds.Unlock()
+
 	mock.lockUpdateHam.Lock()
 	mock.calls.UpdateHam = nil
 	mock.lockUpdateHam.Unlock()
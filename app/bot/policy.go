@@ -0,0 +1,90 @@
+package bot
+
+import (
+	"fmt"
+	"time"
+)
+
+// Action is an enforcement action taken on detected spam
+type Action int
+
+// enforcement actions, from the mildest to the strictest
+const (
+	ActionDelete   Action = iota // delete the message only
+	ActionRestrict               // restrict the user for RestrictDuration
+	ActionTempBan                // ban the user for TempBanDuration
+	ActionBan                    // ban the user permanently
+)
+
+// String returns action's name
+func (a Action) String() string {
+	switch a {
+	case ActionDelete:
+		return "delete"
+	case ActionRestrict:
+		return "restrict"
+	case ActionTempBan:
+		return "temp-ban"
+	case ActionBan:
+		return "ban"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(a))
+	}
+}
+
+// Policy is a graduated enforcement policy. It maps the spam score and the number of the user's previous
+// offenses to an action on the ladder: delete, restrict, temporary ban and permanent ban.
+// The score sets the initial action, and each previous offense escalates it by one step.
+type Policy struct {
+	RestrictScore    float64       // min score to restrict the user, delete only below it
+	TempBanScore     float64       // min score to ban the user temporarily
+	BanScore         float64       // min score to ban the user permanently
+	RestrictDuration time.Duration // duration of restriction
+	TempBanDuration  time.Duration // duration of temporary ban
+}
+
+// Enforcement returns the action and its duration for the given spam score and the number of previous offenses.
+// Duration is 0 for ActionDelete and PermanentBanDuration for ActionBan.
+func (p Policy) Enforcement(score float64, offenses int) (Action, time.Duration) {
+	action := ActionDelete
+	switch {
+	case score >= p.BanScore:
+		action = ActionBan
+	case score >= p.TempBanScore:
+		action = ActionTempBan
+	case score >= p.RestrictScore:
+		action = ActionRestrict
+	}
+
+	if offenses > 0 {
+		action += Action(offenses)
+	}
+	if action > ActionBan {
+		action = ActionBan
+	}
+
+	switch action {
+	case ActionRestrict:
+		return action, p.RestrictDuration
+	case ActionTempBan:
+		return action, p.TempBanDuration
+	case ActionBan:
+		return action, PermanentBanDuration
+	default:
+		return action, 0
+	}
+}
+
+// Describe returns a human-readable description of the action with the given duration, like "restricted for 1h0m0s"
+func (a Action) Describe(duration time.Duration) string {
+	switch a {
+	case ActionDelete:
+		return "message deleted"
+	case ActionRestrict:
+		return fmt.Sprintf("restricted for %v", duration)
+	case ActionTempBan:
+		return fmt.Sprintf("banned for %v", duration)
+	default:
+		return "permanently banned"
+	}
+}
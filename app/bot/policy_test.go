@@ -0,0 +1,46 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_Enforcement(t *testing.T) {
+	p := Policy{RestrictScore: 1, TempBanScore: 2, BanScore: 3, RestrictDuration: time.Hour, TempBanDuration: 24 * time.Hour}
+
+	tests := []struct {
+		name     string
+		score    float64
+		offenses int
+		action   Action
+		duration time.Duration
+	}{
+		{"low score, first offense", 0.5, 0, ActionDelete, 0},
+		{"restrict score", 1, 0, ActionRestrict, time.Hour},
+		{"temp ban score", 2.5, 0, ActionTempBan, 24 * time.Hour},
+		{"ban score", 3, 0, ActionBan, PermanentBanDuration},
+		{"low score, second offense", 0.5, 1, ActionRestrict, time.Hour},
+		{"restrict score, second offense", 1, 1, ActionTempBan, 24 * time.Hour},
+		{"restrict score, many offenses", 1, 5, ActionBan, PermanentBanDuration},
+		{"ban score, more offenses", 10, 2, ActionBan, PermanentBanDuration},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, duration := p.Enforcement(tt.score, tt.offenses)
+			assert.Equal(t, tt.action, action)
+			assert.Equal(t, tt.duration, duration)
+		})
+	}
+}
+
+func TestAction_Describe(t *testing.T) {
+	assert.Equal(t, "message deleted", ActionDelete.Describe(0))
+	assert.Equal(t, "restricted for 1h0m0s", ActionRestrict.Describe(time.Hour))
+	assert.Equal(t, "banned for 24h0m0s", ActionTempBan.Describe(24*time.Hour))
+	assert.Equal(t, "permanently banned", ActionBan.Describe(PermanentBanDuration))
+	assert.Equal(t, "temp-ban", ActionTempBan.String())
+	assert.Equal(t, "unknown(10)", Action(10).String())
+}
@@ -4,13 +4,19 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf16"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/hashicorp/go-multierror"
@@ -23,10 +29,29 @@ import (
 //go:generate moq --out mocks/detector.go --pkg mocks --skip-ensure --with-resets . Detector
 
 // SpamFilter bot checks if a user is a spammer using lib.Detector
-// Reloads spam samples, stop words and excluded tokens on file change.
+// Reloads spam samples, stop words, excluded tokens and domain lists on file change.
+// Optional per-chat profiles allow using a different detector (config and samples) for particular chats.
+// Optional shadow filter checks the same messages with a candidate detector, never acting on its verdict,
+// and records messages the verdicts differ on.
+// The learned model can be saved to the model file, to skip relearning from samples if they are not changed.
 type SpamFilter struct {
 	Detector
-	params SpamConfig
+	params   SpamConfig
+	profiles map[int64]*SpamFilter // per-chat spam filters, keyed by chat ID
+
+	shadow       *SpamFilter    // candidate spam filter, checked without acting on the result
+	shadowLogger ShadowLogger   // records messages the shadow filter disagreed on
+	shadowJobs   chan shadowJob // messages waiting for the shadow check with AsyncLLM, made by the shadow worker
+
+	watcher *fsnotify.Watcher // samples files watcher, nil for profiles and the shadow made by NewChildSpamFilter
+	watched map[string]bool   // files added to the watcher
+
+	history     MessageHistory // previous messages of users, sent to openai check as a context
+	historySize int            // number of previous messages sent
+
+	modelLock        sync.Mutex
+	modelFingerprint string            // fingerprint of samples the current model learned from
+	modelResult      tgspam.LoadResult // samples loaded to the current model
 }
 
 // SpamConfig is a full set of parameters for spam bot
@@ -39,188 +64,540 @@ type SpamConfig struct {
 	ExcludedTokensFile string
 	SpamDynamicFile    string
 	HamDynamicFile     string
+	AllowedDomainsFile string
+	BlockedDomainsFile string
+
+	// learned model file, saved after learning and updates, and loaded instead of relearning if samples not changed.
+	// optional, the model is learned from samples on each reload if not set.
+	ModelFile string
 
 	SpamMsg    string
 	SpamDryMsg string
 
 	WatchDelay time.Duration
 
+	CheckEditedApproved bool // check edited messages from approved users as well
+
+	// AsyncLLM defers the openai check, OnMessage responds with the verdict of the fast checks and marks
+	// the response as pending. The final verdict is made by VerifyLLM.
+	AsyncLLM bool
+
 	Dry bool
 }
 
 // Detector is a spam detector interface
 type Detector interface {
-	Check(request spamcheck.Request) (spam bool, cr []spamcheck.Response)
+	CheckWithScore(request spamcheck.Request) (spam bool, score float64, cr []spamcheck.Response)
+	CheckLLM(request spamcheck.Request) (spam bool, score float64, cr spamcheck.Response)
 	LoadSamples(exclReader io.Reader, spamReaders, hamReaders []io.Reader) (tgspam.LoadResult, error)
 	LoadStopWords(readers ...io.Reader) (tgspam.LoadResult, error)
+	LoadDomains(allowReader, blockReader io.Reader) (tgspam.LoadResult, error)
 	UpdateSpam(msg string) error
 	UpdateHam(msg string) error
+	LearnSpam(msg string)
+	LearnHam(msg string)
+	SaveModel(w io.Writer, fingerprint string) error
+	LoadModel(r io.Reader, fingerprint string) (tgspam.LoadResult, error)
 	AddApprovedUser(user approved.UserInfo) error
 	RemoveApprovedUser(id string) error
+	ApproveUser(user approved.UserInfo)
+	DisapproveUser(id string)
 	ApprovedUsers() (res []approved.UserInfo)
 	IsApprovedUser(userID string) bool
+	Thresholds() (similarity, minSpamProbability float64)
+	SetThresholds(similarity, minSpamProbability float64)
+}
+
+// Verdict is a result of the spam check made by a detector
+type Verdict struct {
+	Spam   bool
+	Score  float64
+	Checks []spamcheck.Response
+}
+
+// ShadowLogger records messages the shadow detector disagreed on with the active one
+type ShadowLogger interface {
+	Save(msg Message, active, shadow Verdict)
+}
+
+// ShadowLoggerFunc is a function that implements ShadowLogger interface
+type ShadowLoggerFunc func(msg Message, active, shadow Verdict)
+
+// Save is a function that implements ShadowLogger interface
+func (f ShadowLoggerFunc) Save(msg Message, active, shadow Verdict) {
+	f(msg, active, shadow)
+}
+
+// shadowJob is a message waiting for the shadow check, with the active verdict to compare to
+type shadowJob struct {
+	msg    Message
+	req    spamcheck.Request
+	active Verdict
+}
+
+// shadowQueueSize is the size of the queue of messages waiting for the shadow check with AsyncLLM.
+// Messages not fitting the queue are not checked by the shadow filter.
+const shadowQueueSize = 100
+
+// MessageHistory provides previous messages of the user
+type MessageHistory interface {
+	UserMessages(userID int64, limit int) []string
+}
+
+// MessageHistoryFunc is a function that implements MessageHistory interface
+type MessageHistoryFunc func(userID int64, limit int) []string
+
+// UserMessages is a function that implements MessageHistory interface
+func (f MessageHistoryFunc) UserMessages(userID int64, limit int) []string {
+	return f(userID, limit)
 }
 
-// NewSpamFilter creates new spam filter
+// NewSpamFilter creates new spam filter, watching samples files for changes
 func NewSpamFilter(ctx context.Context, detector Detector, params SpamConfig) *SpamFilter {
 	res := &SpamFilter{Detector: detector, params: params}
-	go func() {
-		if err := res.watch(ctx, params.WatchDelay); err != nil {
-			log.Printf("[WARN] samples file watcher failed: %v", err)
-		}
-	}()
+	if err := res.startWatcher(ctx); err != nil {
+		log.Printf("[WARN] samples file watcher failed: %v", err)
+	}
+	if params.AsyncLLM {
+		// the shadow check includes the slow openai check, made by the worker instead of the caller
+		res.shadowJobs = make(chan shadowJob, shadowQueueSize)
+		go res.shadowWorker(ctx)
+	}
+	return res
+}
+
+// NewChildSpamFilter creates a spam filter to be set as a profile or the shadow of another filter. Unlike NewSpamFilter,
+// it doesn't watch samples files and doesn't start background workers, as its samples files are watched and reloaded
+// by the parent filter, and the shadow check is made by the parent's worker.
+func NewChildSpamFilter(detector Detector, params SpamConfig) *SpamFilter {
+	return &SpamFilter{Detector: detector, params: params}
+}
+
+// WithProfile sets a spam filter to use for messages from the given chat instead of the default one.
+// Samples files of the profile are watched along with the filter's own ones.
+// Profiles should be set before the filter is used, this method is not thread-safe.
+func (s *SpamFilter) WithProfile(chatID int64, sf *SpamFilter) {
+	if s.profiles == nil {
+		s.profiles = make(map[int64]*SpamFilter)
+	}
+	s.profiles[chatID] = sf
+	if sf == nil {
+		return
+	}
+	if err := s.watchFiles(sf.params); err != nil {
+		log.Printf("[WARN] samples file watcher failed for profile %d: %v", chatID, err)
+	}
+}
+
+// WithShadow sets a shadow spam filter checking messages along with the default detector. The shadow verdict is
+// never acted on, messages it differs on are passed to the logger. Messages checked by profiles are not shadowed.
+// With AsyncLLM set, the shadow check is made in background and compared to the final verdict of the default detector.
+// Samples files of the shadow are watched along with the filter's own ones.
+// Shadow should be set before the filter is used, this method is not thread-safe.
+func (s *SpamFilter) WithShadow(sf *SpamFilter, logger ShadowLogger) {
+	s.shadow, s.shadowLogger = sf, logger
+	if sf == nil {
+		return
+	}
+	if err := s.watchFiles(sf.params); err != nil {
+		log.Printf("[WARN] samples file watcher failed for shadow: %v", err)
+	}
+}
+
+// WithHistory sets the source of users' previous messages, up to size of them added to the check request.
+// The history is set for the profiles and the shadow filter as well, so it should be called after they are set.
+// This method is not thread-safe.
+func (s *SpamFilter) WithHistory(h MessageHistory, size int) {
+	s.history, s.historySize = h, size
+	for _, p := range s.profiles {
+		p.WithHistory(h, size)
+	}
+	if s.shadow != nil {
+		s.shadow.WithHistory(h, size)
+	}
+}
+
+// Profile returns a spam filter for the given chat, the default one if no profile set for the chat
+func (s *SpamFilter) Profile(chatID int64) *SpamFilter {
+	if p, ok := s.profiles[chatID]; ok && p != nil {
+		return p
+	}
+	return s
+}
+
+// Profiles returns all per-chat spam filters, keyed by chat ID
+func (s *SpamFilter) Profiles() map[int64]*SpamFilter {
+	res := make(map[int64]*SpamFilter, len(s.profiles))
+	for k, v := range s.profiles {
+		res[k] = v
+	}
 	return res
 }
 
-// OnMessage checks if user already approved and if not checks if user is a spammer
+// OnMessage checks if user already approved and if not checks if user is a spammer.
+// The message is checked by the profile set for the message's chat, or by the default detector.
+// With AsyncLLM set, the openai check is not made and the response is marked with PendingLLM if the check is needed.
 func (s *SpamFilter) OnMessage(msg Message) (response Response) {
 	if msg.From.ID == 0 { // don't check system messages
 		return Response{}
 	}
-	displayUsername := DisplayName(msg)
+	if p := s.Profile(msg.ChatID); p != s {
+		return p.OnMessage(msg)
+	}
 
-	spamReq := spamcheck.Request{Msg: msg.Text, UserID: strconv.FormatInt(msg.From.ID, 10), UserName: msg.From.Username}
-	if msg.Image != nil {
-		spamReq.Meta.Images = 1
+	spamReq := s.spamRequest(msg)
+	isSpam, score, checkResults := s.CheckWithScore(spamReq)
+	resp := s.spamResponse(msg, isSpam, score, checkResults)
+	for _, cr := range checkResults {
+		resp.PendingLLM = resp.PendingLLM || cr.Pending
+	}
+	if !resp.PendingLLM { // otherwise the shadow is compared to the final verdict by VerifyLLM
+		s.compareShadow(msg, spamReq, Verdict{Spam: isSpam, Score: score, Checks: checkResults})
+	}
+	return resp
+}
+
+// VerifyLLM makes the openai check deferred by OnMessage for the response with PendingLLM set, and returns
+// the response with the final verdict. The check result replaces the pending one in the check results.
+// The detector is not locked for the time of the check, so it can be called concurrently with OnMessage.
+func (s *SpamFilter) VerifyLLM(msg Message, resp Response) Response {
+	if !resp.PendingLLM {
+		return resp
 	}
-	spamReq.Meta.Links = strings.Count(msg.Text, "http://") + strings.Count(msg.Text, "https://")
-	isSpam, checkResults := s.Check(spamReq)
+	if p := s.Profile(msg.ChatID); p != s {
+		return p.VerifyLLM(msg, resp)
+	}
+
+	spamReq := s.spamRequest(msg)
+	isSpam, score, llmResult := s.CheckLLM(spamReq)
+	checkResults := make([]spamcheck.Response, 0, len(resp.CheckResults))
+	for _, cr := range resp.CheckResults {
+		if cr.Pending {
+			cr = llmResult
+		}
+		checkResults = append(checkResults, cr)
+	}
+	s.compareShadow(msg, spamReq, Verdict{Spam: isSpam, Score: score, Checks: checkResults})
+	return s.spamResponse(msg, isSpam, score, checkResults)
+}
+
+// spamRequest makes the spam check request from the message
+func (s *SpamFilter) spamRequest(msg Message) spamcheck.Request {
+	spamReq := spamcheck.Request{Msg: msg.Text, UserID: strconv.FormatInt(msg.From.ID, 10), UserName: msg.From.Username,
+		DisplayName: msg.From.DisplayName, DeferLLM: s.params.AsyncLLM}
+	if msg.Edited {
+		// approved user could post an innocent message and edit it to spam later
+		spamReq.CheckApproved = s.params.CheckEditedApproved
+		// edits are not new messages, so they don't count toward approval
+		spamReq.SkipApproval = true
+	}
+	spamReq.Meta = messageMeta(msg)
+	spamReq.History = s.userHistory(msg)
+	return spamReq
+}
+
+// spamResponse makes the response to the message from the spam check results
+func (s *SpamFilter) spamResponse(msg Message, isSpam bool, score float64, checkResults []spamcheck.Response) Response {
+	displayUsername := DisplayName(msg)
 	crs := []string{}
 	for _, cr := range checkResults {
 		crs = append(crs, fmt.Sprintf("{name: %s, spam: %v, details: %s}", cr.Name, cr.Spam, cr.Details))
 	}
 	checkResultStr := strings.Join(crs, ", ")
 	if isSpam {
-		log.Printf("[INFO] user %s detected as spammer: %s, %q", displayUsername, checkResultStr, msg.Text)
+		log.Printf("[INFO] user %s detected as spammer (score %.2f): %s, %q", displayUsername, score, checkResultStr, msg.Text)
 		msgPrefix := s.params.SpamMsg
 		if s.params.Dry {
 			msgPrefix = s.params.SpamDryMsg
 		}
 		spamRespMsg := fmt.Sprintf("%s: %q (%d)", msgPrefix, displayUsername, msg.From.ID)
 		return Response{Text: spamRespMsg, Send: true, ReplyTo: msg.ID, BanInterval: PermanentBanDuration, CheckResults: checkResults,
-			DeleteReplyTo: true, User: User{Username: msg.From.Username, ID: msg.From.ID, DisplayName: msg.From.DisplayName},
+			Score: score, DeleteReplyTo: true, User: User{Username: msg.From.Username, ID: msg.From.ID, DisplayName: msg.From.DisplayName},
+		}
+	}
+	log.Printf("[DEBUG] user %s is not a spammer (score %.2f), %s", displayUsername, score, checkResultStr)
+	return Response{CheckResults: checkResults, Score: score} // not a spam
+}
+
+// userHistory returns previous messages of the message's author, oldest first. The message itself is excluded,
+// as it may be already recorded by the history.
+func (s *SpamFilter) userHistory(msg Message) []string {
+	if s.history == nil || s.historySize <= 0 {
+		return nil
+	}
+	res := []string{}
+	for _, m := range s.history.UserMessages(msg.From.ID, s.historySize+1) {
+		if m != msg.Text {
+			res = append(res, m)
+		}
+	}
+	if len(res) > s.historySize {
+		res = res[len(res)-s.historySize:]
+	}
+	return res
+}
+
+// compareShadow checks the message with the shadow filter, if set, and saves both verdicts if they differ.
+// With AsyncLLM set, the check is queued for the shadow worker, and skipped if the queue is full.
+func (s *SpamFilter) compareShadow(msg Message, req spamcheck.Request, active Verdict) {
+	if s.shadow == nil || s.shadowLogger == nil {
+		return
+	}
+	if s.shadowJobs == nil {
+		s.checkShadow(msg, req, active)
+		return
+	}
+	select {
+	case s.shadowJobs <- shadowJob{msg: msg, req: req, active: active}:
+	default:
+		log.Printf("[WARN] shadow check queue is full, message from %s not checked by shadow", DisplayName(msg))
+	}
+}
+
+// shadowWorker makes the shadow checks queued by compareShadow
+func (s *SpamFilter) shadowWorker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-s.shadowJobs:
+			s.checkShadow(job.msg, job.req, job.active)
+		}
+	}
+}
+
+// checkShadow checks the message with the shadow filter and saves both verdicts if they differ.
+// Messages from users approved by the active detector are not checked. The shadow check is made with CheckApproved
+// set, so the shadow detector doesn't count and approve users on its own. The openai check is never deferred
+// for the shadow, as its verdict is compared to the final one.
+func (s *SpamFilter) checkShadow(msg Message, req spamcheck.Request, active Verdict) {
+	if len(active.Checks) == 1 && active.Checks[0].Name == "pre-approved" {
+		return
+	}
+	req.CheckApproved, req.DeferLLM = true, false
+	spam, score, checks := s.shadow.CheckWithScore(req)
+	if spam == active.Spam {
+		return
+	}
+	log.Printf("[INFO] shadow detector disagrees on message from %s, active spam: %v (score %.2f), shadow spam: %v (score %.2f)",
+		DisplayName(msg), active.Spam, active.Score, spam, score)
+	s.shadowLogger.Save(msg, active, Verdict{Spam: spam, Score: score, Checks: checks})
+}
+
+// messageMeta makes meta-info for the spam check from the message. Links are counted by the message entities,
+// with text links counted as hidden links and the text of url entities passed as urls, as telegram marks links
+// without scheme as well. Falls back to counting links in the text if there are no entities.
+func messageMeta(msg Message) spamcheck.MetaData {
+	res := spamcheck.MetaData{ButtonLinks: msg.ButtonURLs}
+	if msg.ForwardFromChat.Type == "channel" { // forwards from groups and users are ordinary, not checked
+		res.ForwardedFrom = msg.ForwardFromChat.ID
+	}
+	entities, text := msg.Entities, msg.Text
+	if msg.Image != nil {
+		res.Images = 1
+		res.ImageHash = msg.Image.Hash
+		if entities == nil {
+			entities = msg.Image.Entities
+			if msg.Image.Caption != "" {
+				text = msg.Image.Caption
+			}
+		}
+	}
+	if entities == nil {
+		res.Links = strings.Count(msg.Text, "http://") + strings.Count(msg.Text, "https://")
+		return res
+	}
+	textUTF16 := utf16.Encode([]rune(text)) // entity offsets and lengths are in utf-16 code units
+	for _, e := range *entities {
+		switch e.Type {
+		case "url":
+			res.Links++
+			if e.Offset >= 0 && e.Length > 0 && e.Offset+e.Length <= len(textUTF16) {
+				res.URLs = append(res.URLs, string(utf16.Decode(textUTF16[e.Offset:e.Offset+e.Length])))
+			}
+		case "text_link":
+			res.Links++
+			res.HiddenLinks = append(res.HiddenLinks, e.URL)
 		}
 	}
-	log.Printf("[DEBUG] user %s is not a spammer, %s", displayUsername, checkResultStr)
-	return Response{CheckResults: checkResults} // not a spam
+	return res
 }
 
-// UpdateSpam appends a message to the spam samples file and updates the classifier
+// UpdateSpam appends a message to the spam samples file and updates the classifier.
+// Profiles and the shadow filter share the dynamic samples file with the default detector, so they only learn the message.
 func (s *SpamFilter) UpdateSpam(msg string) error {
 	cleanMsg := strings.ReplaceAll(msg, "\n", " ")
 	log.Printf("[DEBUG] update spam samples with %q", cleanMsg)
 	if err := s.Detector.UpdateSpam(cleanMsg); err != nil {
 		return fmt.Errorf("can't update spam samples: %w", err)
 	}
+	s.updateModel()
+	for _, p := range s.profiles {
+		p.Detector.LearnSpam(cleanMsg)
+		p.updateModel()
+	}
+	if s.shadow != nil {
+		s.shadow.Detector.LearnSpam(cleanMsg)
+		s.shadow.updateModel()
+	}
 	return nil
 }
 
-// UpdateHam appends a message to the ham samples file and updates the classifier
+// UpdateHam appends a message to the ham samples file and updates the classifier.
+// Profiles and the shadow filter share the dynamic samples file with the default detector, so they only learn the message.
 func (s *SpamFilter) UpdateHam(msg string) error {
 	cleanMsg := strings.ReplaceAll(msg, "\n", " ")
 	log.Printf("[DEBUG] update ham samples with %q", cleanMsg)
 	if err := s.Detector.UpdateHam(cleanMsg); err != nil {
 		return fmt.Errorf("can't update ham samples: %w", err)
 	}
+	s.updateModel()
+	for _, p := range s.profiles {
+		p.Detector.LearnHam(cleanMsg)
+		p.updateModel()
+	}
+	if s.shadow != nil {
+		s.shadow.Detector.LearnHam(cleanMsg)
+		s.shadow.updateModel()
+	}
 	return nil
 }
 
-// IsApprovedUser checks if user is in the list of approved users
-func (s *SpamFilter) IsApprovedUser(userID int64) bool {
-	return s.Detector.IsApprovedUser(fmt.Sprintf("%d", userID))
+// IsApprovedUser checks if user is in the list of approved users of the profile set for the chat,
+// or of the default detector if no profile set
+func (s *SpamFilter) IsApprovedUser(chatID, userID int64) bool {
+	return s.Profile(chatID).Detector.IsApprovedUser(fmt.Sprintf("%d", userID))
 }
 
-// AddApprovedUser adds users to the list of approved users, to both the detector and the storage
+// AddApprovedUser adds users to the list of approved users, to both the detector and the storage.
+// Profiles share the storage with the default detector, so they only get the user in memory.
 func (s *SpamFilter) AddApprovedUser(id int64, name string) error {
 	log.Printf("[INFO] add aproved user: id:%d, name:%q", id, name)
-	if err := s.Detector.AddApprovedUser(approved.UserInfo{UserID: fmt.Sprintf("%d", id), UserName: name}); err != nil {
+	user := approved.UserInfo{UserID: fmt.Sprintf("%d", id), UserName: name}
+	if err := s.Detector.AddApprovedUser(user); err != nil {
 		return fmt.Errorf("failed to write approved user to storage: %w", err)
 	}
+	for _, p := range s.profiles {
+		p.Detector.ApproveUser(user)
+	}
 	return nil
 }
 
-// RemoveApprovedUser removes users from the list of approved users in both the detector and the storage
+// RemoveApprovedUser removes users from the list of approved users in both the detector and the storage.
+// Profiles share the storage with the default detector, so the user is removed from their memory only.
 func (s *SpamFilter) RemoveApprovedUser(id int64) error {
 	log.Printf("[INFO] remove aproved user: %d", id)
 	if err := s.Detector.RemoveApprovedUser(fmt.Sprintf("%d", id)); err != nil {
 		return fmt.Errorf("failed to delete approved user from storage: %w", err)
 	}
+	for _, p := range s.profiles {
+		p.Detector.DisapproveUser(fmt.Sprintf("%d", id))
+	}
 	return nil
 }
 
-// watch watches for changes in samples files and reloads them
-// delay is a time to wait after the last change before reloading to avoid multiple reloads
-func (s *SpamFilter) watch(ctx context.Context, delay time.Duration) error {
+// startWatcher starts watching samples files for changes. Nothing is watched if some of the files can't be added.
+func (s *SpamFilter) startWatcher(ctx context.Context) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return fmt.Errorf("failed to create watcher: %w", err)
 	}
-	defer watcher.Close()
+	s.watcher, s.watched = watcher, make(map[string]bool)
+	if err := s.watchFiles(s.params); err != nil {
+		s.watcher, s.watched = nil, nil
+		_ = watcher.Close()
+		return err
+	}
+	go s.watch(ctx, s.params.WatchDelay)
+	return nil
+}
+
+// watch watches for changes in samples files and reloads them
+// delay is a time to wait after the last change before reloading to avoid multiple reloads
+func (s *SpamFilter) watch(ctx context.Context, delay time.Duration) {
+	defer s.watcher.Close()
 
-	done := make(chan bool)
 	reloadTimer := time.NewTimer(delay)
 	reloadPending := false
-
-	go func() {
-		defer close(done)
-		for {
-			select {
-			case <-ctx.Done():
-				log.Printf("[INFO] stopping watcher for samples: %v", ctx.Err())
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("[INFO] stopping watcher for samples: %v", ctx.Err())
+			return
+		case event, ok := <-s.watcher.Events:
+			if !ok {
 				return
-			case event, ok := <-watcher.Events:
-				if !ok {
-					return
-				}
-				if event.Op == fsnotify.Remove {
-					// may happen when the file is renamed, ignore
-					continue
-				}
-				log.Printf("[DEBUG] file %q updated, op: %v", event.Name, event.Op)
-				if !reloadPending {
-					reloadPending = true
-					reloadTimer.Reset(delay)
-				}
-			case <-reloadTimer.C:
-				if reloadPending {
-					reloadPending = false
-					if err := s.ReloadSamples(); err != nil {
-						log.Printf("[WARN] %v", err)
-					}
-				}
-			case e, ok := <-watcher.Errors:
-				if !ok {
-					return
+			}
+			if event.Op == fsnotify.Remove {
+				// may happen when the file is renamed, ignore
+				continue
+			}
+			log.Printf("[DEBUG] file %q updated, op: %v", event.Name, event.Op)
+			if !reloadPending {
+				reloadPending = true
+				reloadTimer.Reset(delay)
+			}
+		case <-reloadTimer.C:
+			if reloadPending {
+				reloadPending = false
+				if err := s.ReloadSamples(); err != nil {
+					log.Printf("[WARN] %v", err)
 				}
-				log.Printf("[WARN] watcher error: %v", e)
 			}
+		case e, ok := <-s.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("[WARN] watcher error: %v", e)
 		}
-	}()
+	}
+}
 
+// watchFiles adds samples files of the given config to the watcher, domain lists only if exist.
+// Files of profiles and the shadow are watched by the parent filter, as ReloadSamples reloads them all.
+// Does nothing for the filter without the watcher.
+func (s *SpamFilter) watchFiles(params SpamConfig) error {
+	if s.watcher == nil {
+		return nil
+	}
 	errs := new(multierror.Error)
 	addToWatcher := func(file string) error {
+		if s.watched[file] {
+			return nil
+		}
 		if _, err := os.Stat(file); err != nil {
 			return fmt.Errorf("failed to stat file %q: %w", file, err)
 		}
 		log.Printf("[DEBUG] add file %q to watcher", file)
-		return watcher.Add(file)
+		if err := s.watcher.Add(file); err != nil {
+			return err
+		}
+		s.watched[file] = true
+		return nil
+	}
+	errs = multierror.Append(errs, addToWatcher(params.ExcludedTokensFile))
+	errs = multierror.Append(errs, addToWatcher(params.SpamSamplesFile))
+	errs = multierror.Append(errs, addToWatcher(params.HamSamplesFile))
+	errs = multierror.Append(errs, addToWatcher(params.StopWordsFile))
+	// domain lists are optional, watched only if exist
+	for _, file := range []string{params.AllowedDomainsFile, params.BlockedDomainsFile} {
+		if _, err := os.Stat(file); err == nil {
+			errs = multierror.Append(errs, addToWatcher(file))
+		}
 	}
-	errs = multierror.Append(errs, addToWatcher(s.params.ExcludedTokensFile))
-	errs = multierror.Append(errs, addToWatcher(s.params.SpamSamplesFile))
-	errs = multierror.Append(errs, addToWatcher(s.params.HamSamplesFile))
-	errs = multierror.Append(errs, addToWatcher(s.params.StopWordsFile))
 	if err := errs.ErrorOrNil(); err != nil {
 		return fmt.Errorf("failed to add some files to watcher: %w", err)
 	}
-	<-done
 	return nil
 }
 
-// ReloadSamples reloads samples and stop-words
+// ReloadSamples reloads samples, stop-words and domain lists.
+// With the model file set, samples are relearned only if changed, see learnModel.
 func (s *SpamFilter) ReloadSamples() (err error) {
 	log.Printf("[DEBUG] reloading samples")
 
 	var exclReader, spamReader, hamReader, stopWordsReader, spamDynamicReader, hamDynamicReader io.ReadCloser
+	var allowedDomainsReader, blockedDomainsReader io.ReadCloser
 
 	// open mandatory spam and ham samples files
 	if spamReader, err = os.Open(s.params.SpamSamplesFile); err != nil {
@@ -256,8 +633,19 @@ func (s *SpamFilter) ReloadSamples() (err error) {
 	}
 	defer hamDynamicReader.Close()
 
+	// domain lists are optional
+	if allowedDomainsReader, err = os.Open(s.params.AllowedDomainsFile); err != nil {
+		allowedDomainsReader = io.NopCloser(bytes.NewReader([]byte("")))
+	}
+	defer allowedDomainsReader.Close()
+
+	if blockedDomainsReader, err = os.Open(s.params.BlockedDomainsFile); err != nil {
+		blockedDomainsReader = io.NopCloser(bytes.NewReader([]byte("")))
+	}
+	defer blockedDomainsReader.Close()
+
 	// reload samples and stop-words. note: we don't need reset as LoadSamples and LoadStopWords clear the state first
-	lr, err := s.LoadSamples(exclReader, []io.Reader{spamReader, spamDynamicReader},
+	lr, err := s.learnModel(exclReader, []io.Reader{spamReader, spamDynamicReader},
 		[]io.Reader{hamReader, hamDynamicReader})
 	if err != nil {
 		return fmt.Errorf("failed to reload samples: %w", err)
@@ -267,13 +655,147 @@ func (s *SpamFilter) ReloadSamples() (err error) {
 	if err != nil {
 		return fmt.Errorf("failed to reload stop words: %w", err)
 	}
+	for _, e := range ls.StopWordsErrors {
+		log.Printf("[WARN] invalid stop word skipped, %s", e)
+	}
+
+	ld, err := s.LoadDomains(allowedDomainsReader, blockedDomainsReader)
+	if err != nil {
+		return fmt.Errorf("failed to reload domains: %w", err)
+	}
+
+	log.Printf("[INFO] loaded samples - spam: %d, ham: %d, excluded tokens: %d, stop-words: %d, allowed domains: %d, blocked domains: %d",
+		lr.SpamSamples, lr.HamSamples, lr.ExcludedTokens, ls.StopWords, ld.AllowedDomains, ld.BlockedDomains)
+
+	for chatID, p := range s.profiles {
+		if err := p.ReloadSamples(); err != nil {
+			return fmt.Errorf("failed to reload samples for profile %d: %w", chatID, err)
+		}
+	}
+	if s.shadow != nil {
+		if err := s.shadow.ReloadSamples(); err != nil {
+			return fmt.Errorf("failed to reload samples for shadow: %w", err)
+		}
+	}
+	return nil
+}
+
+// learnModel loads samples to the detector. If the model file set, samples are not relearned if not changed
+// since the last load, and the model is loaded from the file if saved for the same samples. Otherwise, the model
+// learned from samples and saved to the file.
+func (s *SpamFilter) learnModel(exclReader io.Reader, spamReaders, hamReaders []io.Reader) (tgspam.LoadResult, error) {
+	if s.params.ModelFile == "" {
+		return s.LoadSamples(exclReader, spamReaders, hamReaders)
+	}
+
+	s.modelLock.Lock()
+	defer s.modelLock.Unlock()
+
+	fingerprint, err := s.samplesFingerprint()
+	if err != nil {
+		return tgspam.LoadResult{}, fmt.Errorf("failed to get samples fingerprint: %w", err)
+	}
+	if fingerprint == s.modelFingerprint {
+		log.Printf("[DEBUG] samples not changed, skip learning")
+		return s.modelResult, nil
+	}
+
+	lr, err := s.loadModel(fingerprint)
+	if err == nil {
+		log.Printf("[INFO] model loaded from %s", s.params.ModelFile)
+		s.modelFingerprint, s.modelResult = fingerprint, lr
+		return lr, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		log.Printf("[INFO] model not loaded, learning from samples: %v", err)
+	}
+
+	if lr, err = s.LoadSamples(exclReader, spamReaders, hamReaders); err != nil {
+		return lr, err
+	}
+	s.modelFingerprint, s.modelResult = fingerprint, lr
+	if err := s.saveModel(fingerprint); err != nil {
+		log.Printf("[WARN] can't save model: %v", err)
+	}
+	return lr, nil
+}
+
+// updateModel saves the model updated with a new sample. Does nothing if the model file not set.
+func (s *SpamFilter) updateModel() {
+	if s.params.ModelFile == "" {
+		return
+	}
+
+	s.modelLock.Lock()
+	defer s.modelLock.Unlock()
+
+	fingerprint, err := s.samplesFingerprint()
+	if err != nil {
+		log.Printf("[WARN] can't get samples fingerprint: %v", err)
+		return
+	}
+	if err := s.saveModel(fingerprint); err != nil {
+		log.Printf("[WARN] can't save model: %v", err)
+		return
+	}
+	s.modelFingerprint = fingerprint
+}
+
+// loadModel loads the model saved for samples with the given fingerprint from the model file
+func (s *SpamFilter) loadModel(fingerprint string) (tgspam.LoadResult, error) {
+	fh, err := os.Open(s.params.ModelFile)
+	if err != nil {
+		return tgspam.LoadResult{}, fmt.Errorf("failed to open model file: %w", err)
+	}
+	defer fh.Close()
+	return s.LoadModel(fh, fingerprint)
+}
 
-	log.Printf("[INFO] loaded samples - spam: %d, ham: %d, excluded tokens: %d, stop-words: %d",
-		lr.SpamSamples, lr.HamSamples, lr.ExcludedTokens, ls.StopWords)
+// saveModel saves the model to the model file. The file is written to a temporary file first and renamed,
+// so the model file is never left partially written.
+func (s *SpamFilter) saveModel(fingerprint string) error {
+	fh, err := os.CreateTemp(filepath.Dir(s.params.ModelFile), filepath.Base(s.params.ModelFile)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create model file: %w", err)
+	}
+	defer os.Remove(fh.Name()) // no-op if renamed
 
+	if err := s.SaveModel(fh, fingerprint); err != nil {
+		fh.Close()
+		return fmt.Errorf("failed to write model file: %w", err)
+	}
+	if err := fh.Close(); err != nil {
+		return fmt.Errorf("failed to close model file: %w", err)
+	}
+	if err := os.Rename(fh.Name(), s.params.ModelFile); err != nil {
+		return fmt.Errorf("failed to rename model file: %w", err)
+	}
 	return nil
 }
 
+// samplesFingerprint returns a hash of all files the model learned from. Missing files hashed as empty.
+func (s *SpamFilter) samplesFingerprint() (string, error) {
+	h := sha256.New()
+	for _, file := range []string{s.params.ExcludedTokensFile, s.params.SpamSamplesFile, s.params.HamSamplesFile,
+		s.params.SpamDynamicFile, s.params.HamDynamicFile} {
+		fh, err := os.Open(file) //nolint:gosec // file set by the config
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to open %s: %w", file, err)
+		}
+		var n int64
+		if err == nil {
+			n, err = io.Copy(h, fh)
+			fh.Close()
+			if err != nil {
+				return "", fmt.Errorf("failed to read %s: %w", file, err)
+			}
+		}
+		// size separates files, so the same lines moved between files change the fingerprint
+		fmt.Fprintf(h, ":%d;", n)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 // DynamicSamples returns dynamic spam and ham samples. both are optional
 func (s *SpamFilter) DynamicSamples() (spam, ham []string, err error) {
 	errs := new(multierror.Error)
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -24,11 +25,11 @@ func TestSpamFilter_OnMessage(t *testing.T) {
 	defer cancel()
 
 	det := &mocks.DetectorMock{
-		CheckFunc: func(req spamcheck.Request) (bool, []spamcheck.Response) {
+		CheckWithScoreFunc: func(req spamcheck.Request) (bool, float64, []spamcheck.Response) {
 			if req.Msg == "spam" {
-				return true, []spamcheck.Response{{Name: "something", Spam: true, Details: "some spam"}}
+				return true, 1.5, []spamcheck.Response{{Name: "something", Spam: true, Details: "some spam"}}
 			}
-			return false, []spamcheck.Response{{Name: "already approved", Spam: false, Details: "some ham"}}
+			return false, 0, []spamcheck.Response{{Name: "already approved", Spam: false, Details: "some ham"}}
 		},
 	}
 
@@ -37,11 +38,11 @@ func TestSpamFilter_OnMessage(t *testing.T) {
 		s := NewSpamFilter(ctx, det, SpamConfig{SpamMsg: "detected", SpamDryMsg: "detected dry"})
 		resp := s.OnMessage(Message{Text: "spam", From: User{ID: 1, Username: "john"}, Image: &Image{FileID: "123"}})
 		assert.Equal(t, Response{Text: `detected: "john" (1)`, Send: true, BanInterval: PermanentBanDuration,
-			User: User{ID: 1, Username: "john"}, DeleteReplyTo: true,
+			User: User{ID: 1, Username: "john"}, DeleteReplyTo: true, Score: 1.5,
 			CheckResults: []spamcheck.Response{{Name: "something", Spam: true, Details: "some spam"}}}, resp)
-		assert.Equal(t, 1, len(det.CheckCalls()))
+		assert.Equal(t, 1, len(det.CheckWithScoreCalls()))
 		assert.Equal(t, spamcheck.Request{Msg: "spam", UserID: "1", UserName: "john", Meta: spamcheck.MetaData{Images: 1, Links: 0}},
-			det.CheckCalls()[0].Request)
+			det.CheckWithScoreCalls()[0].Request)
 		t.Logf("resp: %+v", resp)
 	})
 
@@ -59,6 +60,406 @@ func TestSpamFilter_OnMessage(t *testing.T) {
 		assert.Equal(t, Response{CheckResults: []spamcheck.Response{{Name: "already approved", Spam: false, Details: "some ham"}}}, resp)
 	})
 
+	t.Run("edited message", func(t *testing.T) {
+		det.ResetCalls()
+		s := NewSpamFilter(ctx, det, SpamConfig{SpamMsg: "detected", SpamDryMsg: "detected dry"})
+		s.OnMessage(Message{Text: "good", From: User{ID: 1, Username: "john"}, Edited: true})
+		require.Equal(t, 1, len(det.CheckWithScoreCalls()))
+		assert.False(t, det.CheckWithScoreCalls()[0].Request.CheckApproved, "approved users not checked by default")
+		assert.True(t, det.CheckWithScoreCalls()[0].Request.SkipApproval, "edits don't count toward approval")
+
+		s = NewSpamFilter(ctx, det, SpamConfig{SpamMsg: "detected", SpamDryMsg: "detected dry", CheckEditedApproved: true})
+		s.OnMessage(Message{Text: "good", From: User{ID: 1, Username: "john"}, Edited: true})
+		s.OnMessage(Message{Text: "good", From: User{ID: 1, Username: "john"}})
+		require.Equal(t, 3, len(det.CheckWithScoreCalls()))
+		assert.True(t, det.CheckWithScoreCalls()[1].Request.CheckApproved, "edited message checked for approved users")
+		assert.False(t, det.CheckWithScoreCalls()[2].Request.CheckApproved, "not edited message")
+		assert.False(t, det.CheckWithScoreCalls()[2].Request.SkipApproval, "not edited message counted")
+	})
+}
+
+func TestSpamFilter_messageMeta(t *testing.T) {
+	imgHash := uint64(0xff00)
+	tests := []struct {
+		name string
+		msg  Message
+		want spamcheck.MetaData
+	}{
+		{"no entities, links counted in text", Message{Text: "see http://a.com and https://b.com"},
+			spamcheck.MetaData{Links: 2}},
+		{"links counted by entities", Message{Text: "see http://a.com and link", Entities: &[]Entity{
+			{Type: "url", Offset: 4, Length: 12}, {Type: "bold", Offset: 0, Length: 3},
+			{Type: "text_link", Offset: 21, Length: 4, URL: "https://hidden.com"}}},
+			spamcheck.MetaData{Links: 2, URLs: []string{"http://a.com"}, HiddenLinks: []string{"https://hidden.com"}}},
+		{"url entities without scheme", Message{Text: "привет 👋 bit.ly/x and example.com/promo", Entities: &[]Entity{
+			{Type: "url", Offset: 10, Length: 8}, {Type: "url", Offset: 23, Length: 17}, {Type: "url", Offset: 40, Length: 5}}},
+			spamcheck.MetaData{Links: 3, URLs: []string{"bit.ly/x", "example.com/promo"}}},
+		{"image with caption url entity", Message{Text: "text", Image: &Image{Caption: "go to a.com", Entities: &[]Entity{
+			{Type: "url", Offset: 6, Length: 5}}}},
+			spamcheck.MetaData{Images: 1, Links: 1, URLs: []string{"a.com"}}},
+		{"entities without links", Message{Text: "some http://a.com text", Entities: &[]Entity{{Type: "bold", Offset: 0, Length: 4}}},
+			spamcheck.MetaData{Links: 0}},
+		{"image with caption entities", Message{Text: "caption", Image: &Image{Entities: &[]Entity{
+			{Type: "text_link", Offset: 0, Length: 7, URL: "https://hidden.com"}}}},
+			spamcheck.MetaData{Images: 1, Links: 1, HiddenLinks: []string{"https://hidden.com"}}},
+		{"hashed image", Message{Image: &Image{FileID: "f1", Hash: &imgHash}},
+			spamcheck.MetaData{Images: 1, ImageHash: &imgHash}},
+		{"forward and buttons", Message{Text: "text", ForwardFromChat: SenderChat{ID: -100123, Type: "channel"},
+			ButtonURLs: []string{"https://t.me/spam"}},
+			spamcheck.MetaData{ForwardedFrom: -100123, ButtonLinks: []string{"https://t.me/spam"}}},
+		{"forward from group", Message{Text: "text", ForwardFromChat: SenderChat{ID: -100456, Type: "supergroup"}},
+			spamcheck.MetaData{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, messageMeta(tt.msg))
+		})
+	}
+}
+
+func TestSpamFilter_OnMessageWithProfiles(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	defDet := &mocks.DetectorMock{
+		CheckWithScoreFunc: func(req spamcheck.Request) (bool, float64, []spamcheck.Response) {
+			return false, 0, []spamcheck.Response{{Name: "default", Spam: false, Details: "ham"}}
+		},
+		AddApprovedUserFunc:    func(user approved.UserInfo) error { return nil },
+		RemoveApprovedUserFunc: func(id string) error { return nil },
+		UpdateSpamFunc:         func(msg string) error { return nil },
+		UpdateHamFunc:          func(msg string) error { return nil },
+		IsApprovedUserFunc:     func(userID string) bool { return userID == "1" },
+	}
+	profDet := &mocks.DetectorMock{
+		CheckWithScoreFunc: func(req spamcheck.Request) (bool, float64, []spamcheck.Response) {
+			return true, 0, []spamcheck.Response{{Name: "profile", Spam: true, Details: "spam"}}
+		},
+		ApproveUserFunc:    func(user approved.UserInfo) {},
+		DisapproveUserFunc: func(id string) {},
+		LearnSpamFunc:      func(msg string) {},
+		LearnHamFunc:       func(msg string) {},
+		IsApprovedUserFunc: func(userID string) bool { return userID == "2" },
+	}
+
+	s := NewSpamFilter(ctx, defDet, SpamConfig{SpamMsg: "detected"})
+	prof := NewSpamFilter(ctx, profDet, SpamConfig{SpamMsg: "detected in profile"})
+	s.WithProfile(-100123, prof)
+	assert.Equal(t, map[int64]*SpamFilter{-100123: prof}, s.Profiles())
+	assert.Equal(t, prof, s.Profile(-100123))
+	assert.Equal(t, s, s.Profile(-100999))
+
+	// approval checked by the detector of the chat's profile
+	assert.True(t, s.IsApprovedUser(-100999, 1))
+	assert.False(t, s.IsApprovedUser(-100999, 2))
+	assert.False(t, s.IsApprovedUser(-100123, 1))
+	assert.True(t, s.IsApprovedUser(-100123, 2))
+
+	resp := s.OnMessage(Message{Text: "text", ChatID: -100999, From: User{ID: 1, Username: "john"}})
+	assert.False(t, resp.Send)
+	assert.Equal(t, 1, len(defDet.CheckWithScoreCalls()))
+	assert.Equal(t, 0, len(profDet.CheckWithScoreCalls()))
+
+	resp = s.OnMessage(Message{Text: "text", ChatID: -100123, From: User{ID: 1, Username: "john"}})
+	assert.True(t, resp.Send)
+	assert.Equal(t, `detected in profile: "john" (1)`, resp.Text)
+	assert.Equal(t, 1, len(defDet.CheckWithScoreCalls()))
+	assert.Equal(t, 1, len(profDet.CheckWithScoreCalls()))
+
+	// profiles share the approved users storage and dynamic samples with the default detector, written once
+	require.NoError(t, s.AddApprovedUser(1, "john"))
+	assert.Equal(t, 1, len(defDet.AddApprovedUserCalls()))
+	assert.Equal(t, 0, len(profDet.AddApprovedUserCalls()))
+	require.Equal(t, 1, len(profDet.ApproveUserCalls()))
+	assert.Equal(t, approved.UserInfo{UserID: "1", UserName: "john"}, profDet.ApproveUserCalls()[0].User)
+
+	require.NoError(t, s.RemoveApprovedUser(1))
+	assert.Equal(t, 1, len(defDet.RemoveApprovedUserCalls()))
+	assert.Equal(t, 0, len(profDet.RemoveApprovedUserCalls()))
+	assert.Equal(t, 1, len(profDet.DisapproveUserCalls()))
+
+	require.NoError(t, s.UpdateSpam("spam\nmsg"))
+	require.NoError(t, s.UpdateHam("ham msg"))
+	assert.Equal(t, 1, len(defDet.UpdateSpamCalls()))
+	assert.Equal(t, 0, len(profDet.UpdateSpamCalls()))
+	require.Equal(t, 1, len(profDet.LearnSpamCalls()))
+	assert.Equal(t, "spam msg", profDet.LearnSpamCalls()[0].Msg)
+	require.Equal(t, 1, len(profDet.LearnHamCalls()))
+	assert.Equal(t, 0, len(profDet.UpdateHamCalls()))
+}
+
+func TestSpamFilter_OnMessageWithHistory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	newDetector := func() *mocks.DetectorMock {
+		return &mocks.DetectorMock{
+			CheckWithScoreFunc: func(req spamcheck.Request) (bool, float64, []spamcheck.Response) { return false, 0, nil },
+		}
+	}
+	det, profDet, shadowDet := newDetector(), newDetector(), newDetector()
+	s := NewSpamFilter(ctx, det, SpamConfig{})
+	s.WithProfile(-100123, NewSpamFilter(ctx, profDet, SpamConfig{}))
+	s.WithShadow(NewSpamFilter(ctx, shadowDet, SpamConfig{}), ShadowLoggerFunc(func(Message, Verdict, Verdict) {}))
+
+	t.Run("no history", func(t *testing.T) {
+		s.OnMessage(Message{Text: "msg 4", From: User{ID: 1, Username: "john", DisplayName: "John Doe"}})
+		req := det.CheckWithScoreCalls()[0].Request
+		assert.Equal(t, "John Doe", req.DisplayName)
+		assert.Nil(t, req.History)
+	})
+
+	var histCalls []int
+	s.WithHistory(MessageHistoryFunc(func(userID int64, limit int) []string {
+		histCalls = append(histCalls, limit)
+		return []string{"msg 1", "msg 2", "msg 3", "msg 4"}[4-limit:]
+	}), 2)
+
+	t.Run("current message in history", func(t *testing.T) {
+		det.ResetCalls()
+		s.OnMessage(Message{Text: "msg 4", From: User{ID: 1}})
+		assert.Equal(t, []string{"msg 2", "msg 3"}, det.CheckWithScoreCalls()[0].Request.History)
+		assert.Equal(t, []int{3}, histCalls)
+		assert.Equal(t, []string{"msg 2", "msg 3"}, shadowDet.CheckWithScoreCalls()[1].Request.History, "shadow gets the same request")
+	})
+
+	t.Run("current message not in history", func(t *testing.T) {
+		det.ResetCalls()
+		s.OnMessage(Message{Text: "new msg", From: User{ID: 1}})
+		assert.Equal(t, []string{"msg 3", "msg 4"}, det.CheckWithScoreCalls()[0].Request.History)
+	})
+
+	t.Run("profile", func(t *testing.T) {
+		s.OnMessage(Message{Text: "new msg", From: User{ID: 1}, ChatID: -100123})
+		require.Len(t, profDet.CheckWithScoreCalls(), 1)
+		assert.Equal(t, []string{"msg 3", "msg 4"}, profDet.CheckWithScoreCalls()[0].Request.History)
+	})
+}
+
+func TestSpamFilter_VerifyLLM(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	det := &mocks.DetectorMock{
+		CheckWithScoreFunc: func(req spamcheck.Request) (bool, float64, []spamcheck.Response) {
+			pending := spamcheck.Response{Name: "openai", Details: "pending", Pending: req.DeferLLM}
+			if req.Msg == "spam" {
+				return true, 1, []spamcheck.Response{{Name: "stopword", Spam: true, Details: "spam"}, pending}
+			}
+			return false, 0, []spamcheck.Response{{Name: "stopword", Spam: false, Details: "not found"}, pending}
+		},
+		CheckLLMFunc: func(req spamcheck.Request) (bool, float64, spamcheck.Response) {
+			if req.Msg == "llm spam" {
+				return true, 0.9, spamcheck.Response{Name: "openai", Spam: true, Details: "bad text", Score: 0.9}
+			}
+			return false, 0, spamcheck.Response{Name: "openai", Spam: false, Details: "good text"}
+		},
+		RemoveApprovedUserFunc: func(id string) error { return nil },
+	}
+	s := NewSpamFilter(ctx, det, SpamConfig{SpamMsg: "detected", AsyncLLM: true})
+
+	t.Run("not pending without async", func(t *testing.T) {
+		sf := NewSpamFilter(ctx, det, SpamConfig{SpamMsg: "detected"})
+		resp := sf.OnMessage(Message{Text: "llm spam", From: User{ID: 1}})
+		assert.False(t, resp.PendingLLM)
+		assert.False(t, det.CheckWithScoreCalls()[0].Request.DeferLLM)
+		assert.Equal(t, resp, sf.VerifyLLM(Message{Text: "llm spam", From: User{ID: 1}}, resp))
+		assert.Empty(t, det.CheckLLMCalls())
+	})
+
+	t.Run("ham detected as spam by llm", func(t *testing.T) {
+		det.ResetCalls()
+		msg := Message{Text: "llm spam", ID: 10, From: User{ID: 1, Username: "john"}}
+		resp := s.OnMessage(msg)
+		assert.True(t, resp.PendingLLM)
+		assert.False(t, resp.Send)
+		assert.True(t, det.CheckWithScoreCalls()[0].Request.DeferLLM)
+
+		resp = s.VerifyLLM(msg, resp)
+		assert.Equal(t, Response{Text: `detected: "john" (1)`, Send: true, ReplyTo: 10, BanInterval: PermanentBanDuration,
+			DeleteReplyTo: true, User: User{ID: 1, Username: "john"}, Score: 0.9,
+			CheckResults: []spamcheck.Response{{Name: "stopword", Spam: false, Details: "not found"},
+				{Name: "openai", Spam: true, Details: "bad text", Score: 0.9}}}, resp)
+		require.Len(t, det.CheckLLMCalls(), 1)
+		assert.Equal(t, "llm spam", det.CheckLLMCalls()[0].Request.Msg)
+		assert.Empty(t, det.RemoveApprovedUserCalls(), "not approved before the verdict")
+	})
+
+	t.Run("spam vetoed by llm", func(t *testing.T) {
+		det.ResetCalls()
+		msg := Message{Text: "spam", ID: 11, From: User{ID: 2}}
+		resp := s.OnMessage(msg)
+		assert.True(t, resp.PendingLLM)
+		assert.True(t, resp.Send)
+
+		resp = s.VerifyLLM(msg, resp)
+		assert.Equal(t, Response{CheckResults: []spamcheck.Response{{Name: "stopword", Spam: true, Details: "spam"},
+			{Name: "openai", Spam: false, Details: "good text"}}}, resp)
+	})
+
+	t.Run("profile", func(t *testing.T) {
+		profDet := &mocks.DetectorMock{CheckLLMFunc: det.CheckLLMFunc}
+		s.WithProfile(-100123, NewSpamFilter(ctx, profDet, SpamConfig{AsyncLLM: true}))
+		det.ResetCalls()
+		s.VerifyLLM(Message{Text: "ham", ChatID: -100123, From: User{ID: 3}},
+			Response{PendingLLM: true, CheckResults: []spamcheck.Response{{Name: "openai", Pending: true}}})
+		assert.Empty(t, det.CheckLLMCalls())
+		require.Len(t, profDet.CheckLLMCalls(), 1)
+	})
+}
+
+func TestSpamFilter_OnMessageWithShadow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	activeDet := &mocks.DetectorMock{
+		CheckWithScoreFunc: func(req spamcheck.Request) (bool, float64, []spamcheck.Response) {
+			switch req.Msg {
+			case "spam":
+				return true, 1, []spamcheck.Response{{Name: "stopword", Spam: true, Details: "spam"}}
+			case "approved":
+				return false, 0, []spamcheck.Response{{Name: "pre-approved", Spam: false, Details: "user already approved"}}
+			}
+			return false, 0, []spamcheck.Response{{Name: "stopword", Spam: false, Details: "not found"}}
+		},
+	}
+	shadowDet := &mocks.DetectorMock{
+		CheckWithScoreFunc: func(req spamcheck.Request) (bool, float64, []spamcheck.Response) {
+			if req.Msg == "ham" || req.Msg == "spam" {
+				return false, 0, []spamcheck.Response{{Name: "similarity", Spam: false, Details: "0.10/0.40"}}
+			}
+			return true, 2, []spamcheck.Response{{Name: "similarity", Spam: true, Details: "0.45/0.40"}}
+		},
+	}
+
+	type saved struct {
+		msg            Message
+		active, shadow Verdict
+	}
+	var res []saved
+	s := NewSpamFilter(ctx, activeDet, SpamConfig{SpamMsg: "detected"})
+	s.WithShadow(NewSpamFilter(ctx, shadowDet, SpamConfig{}), ShadowLoggerFunc(func(msg Message, active, shadow Verdict) {
+		res = append(res, saved{msg: msg, active: active, shadow: shadow})
+	}))
+	prof := NewSpamFilter(ctx, &mocks.DetectorMock{
+		CheckWithScoreFunc: func(req spamcheck.Request) (bool, float64, []spamcheck.Response) { return false, 0, nil },
+		LearnSpamFunc:      func(msg string) {},
+		LearnHamFunc:       func(msg string) {},
+	}, SpamConfig{})
+	s.WithProfile(-100123, prof)
+
+	t.Run("shadow detects spam missed by active", func(t *testing.T) {
+		res = nil
+		resp := s.OnMessage(Message{Text: "new spam", From: User{ID: 1, Username: "john"}})
+		assert.False(t, resp.Send, "shadow verdict not acted on")
+		require.Len(t, res, 1)
+		assert.Equal(t, "new spam", res[0].msg.Text)
+		assert.Equal(t, Verdict{Spam: false, Checks: []spamcheck.Response{{Name: "stopword", Spam: false, Details: "not found"}}},
+			res[0].active)
+		assert.Equal(t, Verdict{Spam: true, Score: 2, Checks: []spamcheck.Response{{Name: "similarity", Spam: true,
+			Details: "0.45/0.40"}}}, res[0].shadow)
+		calls := shadowDet.CheckWithScoreCalls()
+		require.NotEmpty(t, calls)
+		assert.True(t, calls[len(calls)-1].Request.CheckApproved, "shadow doesn't approve users")
+	})
+
+	t.Run("active detects spam missed by shadow", func(t *testing.T) {
+		res = nil
+		resp := s.OnMessage(Message{Text: "spam", From: User{ID: 1, Username: "john"}})
+		assert.True(t, resp.Send)
+		require.Len(t, res, 1)
+		assert.True(t, res[0].active.Spam)
+		assert.False(t, res[0].shadow.Spam)
+	})
+
+	t.Run("both agree", func(t *testing.T) {
+		res = nil
+		s.OnMessage(Message{Text: "ham", From: User{ID: 1, Username: "john"}})
+		assert.Empty(t, res)
+	})
+
+	t.Run("approved user not shadowed", func(t *testing.T) {
+		res = nil
+		shadowDet.ResetCalls()
+		s.OnMessage(Message{Text: "approved", From: User{ID: 1, Username: "john"}})
+		assert.Empty(t, res)
+		assert.Empty(t, shadowDet.CheckWithScoreCalls())
+	})
+
+	t.Run("profile not shadowed", func(t *testing.T) {
+		res = nil
+		shadowDet.ResetCalls()
+		s.OnMessage(Message{Text: "new spam", ChatID: -100123, From: User{ID: 1, Username: "john"}})
+		assert.Empty(t, res)
+		assert.Empty(t, shadowDet.CheckWithScoreCalls())
+	})
+
+	t.Run("shadow learns updated samples", func(t *testing.T) {
+		activeDet.UpdateSpamFunc = func(msg string) error { return nil }
+		activeDet.UpdateHamFunc = func(msg string) error { return nil }
+		shadowDet.LearnSpamFunc = func(msg string) {}
+		shadowDet.LearnHamFunc = func(msg string) {}
+		require.NoError(t, s.UpdateSpam("spam msg"))
+		require.NoError(t, s.UpdateHam("ham msg"))
+		require.Len(t, shadowDet.LearnSpamCalls(), 1)
+		assert.Equal(t, "spam msg", shadowDet.LearnSpamCalls()[0].Msg)
+		require.Len(t, shadowDet.LearnHamCalls(), 1)
+		assert.Equal(t, "ham msg", shadowDet.LearnHamCalls()[0].Msg)
+		assert.Empty(t, shadowDet.UpdateSpamCalls(), "dynamic samples written once, by the active detector")
+	})
+
+	t.Run("async llm", func(t *testing.T) {
+		asyncDet := &mocks.DetectorMock{
+			CheckWithScoreFunc: func(req spamcheck.Request) (bool, float64, []spamcheck.Response) {
+				if req.Msg == "fast ham" {
+					return false, 0, []spamcheck.Response{{Name: "stopword", Spam: false, Details: "not found"}}
+				}
+				return false, 0, []spamcheck.Response{{Name: "openai", Details: "pending", Pending: true}}
+			},
+			CheckLLMFunc: func(req spamcheck.Request) (bool, float64, spamcheck.Response) {
+				return true, 0.9, spamcheck.Response{Name: "openai", Spam: true, Details: "bad text", Score: 0.9}
+			},
+			RemoveApprovedUserFunc: func(id string) error { return nil },
+		}
+		saves := make(chan saved, 2)
+		sf := NewSpamFilter(ctx, asyncDet, SpamConfig{SpamMsg: "detected", AsyncLLM: true})
+		shadowSf := NewChildSpamFilter(shadowDet, SpamConfig{AsyncLLM: true})
+		assert.Nil(t, shadowSf.shadowJobs, "no worker for the shadow, its check is made by the parent's worker")
+		sf.WithShadow(shadowSf, ShadowLoggerFunc(func(msg Message, active, shadow Verdict) {
+			saves <- saved{msg: msg, active: active, shadow: shadow}
+		}))
+		shadowDet.ResetCalls()
+
+		msg := Message{Text: "ham", From: User{ID: 1, Username: "john"}}
+		resp := sf.OnMessage(msg)
+		require.True(t, resp.PendingLLM)
+		assert.Empty(t, shadowDet.CheckWithScoreCalls(), "shadow waits for the final verdict")
+
+		resp = sf.VerifyLLM(msg, resp)
+		require.True(t, resp.Send)
+		select {
+		case rec := <-saves:
+			assert.Equal(t, "ham", rec.msg.Text)
+			assert.True(t, rec.active.Spam, "shadow compared to the final verdict")
+			assert.False(t, rec.shadow.Spam)
+		case <-time.After(time.Second):
+			t.Fatal("shadow verdict not saved")
+		}
+		require.Len(t, shadowDet.CheckWithScoreCalls(), 1)
+		assert.False(t, shadowDet.CheckWithScoreCalls()[0].Request.DeferLLM, "shadow makes its own openai check")
+
+		// not pending verdict compared in background as well
+		sf.OnMessage(Message{Text: "fast ham", From: User{ID: 1, Username: "john"}})
+		select {
+		case rec := <-saves:
+			assert.Equal(t, "fast ham", rec.msg.Text)
+			assert.True(t, rec.shadow.Spam)
+		case <-time.After(time.Second):
+			t.Fatal("shadow verdict not saved")
+		}
+		require.Len(t, shadowDet.CheckWithScoreCalls(), 2)
+		assert.False(t, shadowDet.CheckWithScoreCalls()[1].Request.DeferLLM)
+	})
 }
 
 func TestSpamFilter_reloadSamples(t *testing.T) {
@@ -69,6 +470,9 @@ func TestSpamFilter_reloadSamples(t *testing.T) {
 		LoadStopWordsFunc: func(readers ...io.Reader) (tgspam.LoadResult, error) {
 			return tgspam.LoadResult{}, nil
 		},
+		LoadDomainsFunc: func(allowReader, blockReader io.Reader) (tgspam.LoadResult, error) {
+			return tgspam.LoadResult{}, nil
+		},
 	}
 
 	tests := []struct {
@@ -187,6 +591,9 @@ func TestSpamFilter_watch(t *testing.T) {
 		LoadStopWordsFunc: func(readers ...io.Reader) (tgspam.LoadResult, error) {
 			return tgspam.LoadResult{}, nil
 		},
+		LoadDomainsFunc: func(allowReader, blockReader io.Reader) (tgspam.LoadResult, error) {
+			return tgspam.LoadResult{}, nil
+		},
 	}
 
 	tmpDir, err := os.MkdirTemp("", "spamfilter_test")
@@ -245,6 +652,103 @@ func TestSpamFilter_watch(t *testing.T) {
 	assert.Equal(t, 1, len(mockDetector.LoadStopWordsCalls()))
 }
 
+func TestSpamFilter_watchDomains(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var blocked []string
+	var lock sync.Mutex
+	mockDetector := &mocks.DetectorMock{
+		LoadSamplesFunc: func(exclReader io.Reader, spamReaders []io.Reader, hamReaders []io.Reader) (tgspam.LoadResult, error) {
+			return tgspam.LoadResult{}, nil
+		},
+		LoadStopWordsFunc: func(readers ...io.Reader) (tgspam.LoadResult, error) {
+			return tgspam.LoadResult{}, nil
+		},
+		LoadDomainsFunc: func(allowReader, blockReader io.Reader) (tgspam.LoadResult, error) {
+			data, err := io.ReadAll(blockReader)
+			require.NoError(t, err)
+			lock.Lock()
+			blocked = append(blocked, string(data))
+			lock.Unlock()
+			return tgspam.LoadResult{BlockedDomains: 1}, nil
+		},
+	}
+
+	tmpDir := t.TempDir()
+	params := SpamConfig{
+		ExcludedTokensFile: filepath.Join(tmpDir, "excluded_tokens.txt"),
+		SpamSamplesFile:    filepath.Join(tmpDir, "spam_samples.txt"),
+		HamSamplesFile:     filepath.Join(tmpDir, "ham_samples.txt"),
+		StopWordsFile:      filepath.Join(tmpDir, "stop_words.txt"),
+		AllowedDomainsFile: filepath.Join(tmpDir, "allowed_domains.txt"), // not created, optional
+		BlockedDomainsFile: filepath.Join(tmpDir, "blocked_domains.txt"),
+		WatchDelay:         time.Millisecond * 100,
+	}
+	for _, f := range []string{params.ExcludedTokensFile, params.SpamSamplesFile, params.HamSamplesFile,
+		params.StopWordsFile, params.BlockedDomainsFile} {
+		require.NoError(t, os.WriteFile(f, []byte(""), 0o600))
+	}
+
+	NewSpamFilter(ctx, mockDetector, params)
+	time.Sleep(200 * time.Millisecond) // let it start
+	assert.Empty(t, mockDetector.LoadDomainsCalls())
+
+	require.NoError(t, os.WriteFile(params.BlockedDomainsFile, []byte("spam.com"), 0o600))
+	require.Eventually(t, func() bool { return len(mockDetector.LoadDomainsCalls()) == 1 }, time.Second, 10*time.Millisecond)
+	lock.Lock()
+	assert.Equal(t, []string{"spam.com"}, blocked)
+	lock.Unlock()
+}
+
+func TestSpamFilter_watchProfile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	newDetector := func() *mocks.DetectorMock {
+		return &mocks.DetectorMock{
+			LoadSamplesFunc: func(exclReader io.Reader, spamReaders []io.Reader, hamReaders []io.Reader) (tgspam.LoadResult, error) {
+				return tgspam.LoadResult{}, nil
+			},
+			LoadStopWordsFunc: func(readers ...io.Reader) (tgspam.LoadResult, error) {
+				return tgspam.LoadResult{}, nil
+			},
+			LoadDomainsFunc: func(allowReader, blockReader io.Reader) (tgspam.LoadResult, error) {
+				return tgspam.LoadResult{}, nil
+			},
+		}
+	}
+	makeParams := func(dir string) SpamConfig {
+		params := SpamConfig{
+			ExcludedTokensFile: filepath.Join(dir, "excluded_tokens.txt"),
+			SpamSamplesFile:    filepath.Join(dir, "spam_samples.txt"),
+			HamSamplesFile:     filepath.Join(dir, "ham_samples.txt"),
+			StopWordsFile:      filepath.Join(dir, "stop_words.txt"),
+			WatchDelay:         time.Millisecond * 100,
+		}
+		for _, f := range []string{params.ExcludedTokensFile, params.SpamSamplesFile, params.HamSamplesFile, params.StopWordsFile} {
+			require.NoError(t, os.WriteFile(f, []byte(""), 0o600))
+		}
+		return params
+	}
+
+	defDet, profDet := newDetector(), newDetector()
+	params, profParams := makeParams(t.TempDir()), makeParams(t.TempDir())
+	profParams.HamSamplesFile = params.HamSamplesFile // shared with the parent
+	sf := NewSpamFilter(ctx, defDet, params)
+	sf.WithProfile(-100123, NewChildSpamFilter(profDet, profParams))
+	assert.Len(t, sf.watched, 7, "own files and the profile's files not shared with the parent")
+	time.Sleep(200 * time.Millisecond) // let it start
+
+	// profile's file change reloads the profile by the parent's cascade, once
+	require.NoError(t, os.WriteFile(profParams.SpamSamplesFile, []byte("spam message"), 0o600))
+	require.Eventually(t, func() bool { return len(profDet.LoadSamplesCalls()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Nil(t, sf.Profile(-100123).watcher, "profile doesn't watch files itself")
+	time.Sleep(300 * time.Millisecond) // make sure no more reloads happen
+	assert.Len(t, profDet.LoadSamplesCalls(), 1)
+	assert.Len(t, defDet.LoadSamplesCalls(), 1)
+}
+
 func TestSpamFilter_WatchMultipleUpdates(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -256,6 +760,9 @@ func TestSpamFilter_WatchMultipleUpdates(t *testing.T) {
 		LoadStopWordsFunc: func(readers ...io.Reader) (tgspam.LoadResult, error) {
 			return tgspam.LoadResult{}, nil
 		},
+		LoadDomainsFunc: func(allowReader, blockReader io.Reader) (tgspam.LoadResult, error) {
+			return tgspam.LoadResult{}, nil
+		},
 	}
 
 	tmpDir, err := os.MkdirTemp("", "spamfilter_test")
@@ -361,6 +868,114 @@ func TestSpamFilter_Update(t *testing.T) {
 	})
 }
 
+func TestSpamFilter_ReloadSamplesWithModel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mockDetector := &mocks.DetectorMock{
+		LoadSamplesFunc: func(exclReader io.Reader, spamReaders []io.Reader, hamReaders []io.Reader) (tgspam.LoadResult, error) {
+			return tgspam.LoadResult{SpamSamples: 1, HamSamples: 1}, nil
+		},
+		LoadStopWordsFunc: func(readers ...io.Reader) (tgspam.LoadResult, error) {
+			return tgspam.LoadResult{}, nil
+		},
+		LoadDomainsFunc: func(allowReader, blockReader io.Reader) (tgspam.LoadResult, error) {
+			return tgspam.LoadResult{}, nil
+		},
+		SaveModelFunc: func(w io.Writer, fingerprint string) error {
+			_, err := w.Write([]byte(fingerprint))
+			return err
+		},
+		LoadModelFunc: func(r io.Reader, fingerprint string) (tgspam.LoadResult, error) {
+			data, err := io.ReadAll(r)
+			require.NoError(t, err)
+			if string(data) != fingerprint {
+				return tgspam.LoadResult{}, tgspam.ErrModelOutdated
+			}
+			return tgspam.LoadResult{SpamSamples: 1, HamSamples: 1}, nil
+		},
+		UpdateSpamFunc: func(msg string) error { return nil },
+	}
+
+	tmpDir := t.TempDir()
+	params := SpamConfig{
+		ExcludedTokensFile: filepath.Join(tmpDir, "excluded_tokens.txt"),
+		SpamSamplesFile:    filepath.Join(tmpDir, "spam_samples.txt"),
+		HamSamplesFile:     filepath.Join(tmpDir, "ham_samples.txt"),
+		StopWordsFile:      filepath.Join(tmpDir, "stop_words.txt"),
+		SpamDynamicFile:    filepath.Join(tmpDir, "spam_dynamic.txt"),
+		HamDynamicFile:     filepath.Join(tmpDir, "ham_dynamic.txt"),
+		ModelFile:          filepath.Join(tmpDir, "classifier.model"),
+	}
+	require.NoError(t, os.WriteFile(params.SpamSamplesFile, []byte("spam"), 0o600))
+	require.NoError(t, os.WriteFile(params.HamSamplesFile, []byte("ham"), 0o600))
+
+	sf := NewSpamFilter(ctx, mockDetector, params)
+
+	// no model file, learned from samples and saved
+	require.NoError(t, sf.ReloadSamples())
+	assert.Equal(t, 1, len(mockDetector.LoadSamplesCalls()))
+	assert.Equal(t, 0, len(mockDetector.LoadModelCalls()))
+	require.Equal(t, 1, len(mockDetector.SaveModelCalls()))
+	fingerprint := mockDetector.SaveModelCalls()[0].Fingerprint
+	data, err := os.ReadFile(params.ModelFile)
+	require.NoError(t, err)
+	assert.Equal(t, fingerprint, string(data))
+
+	// samples not changed, nothing relearned, stop words reloaded
+	require.NoError(t, sf.ReloadSamples())
+	assert.Equal(t, 1, len(mockDetector.LoadSamplesCalls()))
+	assert.Equal(t, 0, len(mockDetector.LoadModelCalls()))
+	assert.Equal(t, 2, len(mockDetector.LoadStopWordsCalls()))
+
+	// new filter, i.e. restart, loads the saved model
+	sf2 := NewSpamFilter(ctx, mockDetector, params)
+	require.NoError(t, sf2.ReloadSamples())
+	assert.Equal(t, 1, len(mockDetector.LoadSamplesCalls()))
+	assert.Equal(t, 1, len(mockDetector.LoadModelCalls()))
+
+	// update saves the model with the new fingerprint of dynamic samples
+	require.NoError(t, os.WriteFile(params.SpamDynamicFile, []byte("new spam"), 0o600))
+	require.NoError(t, sf.UpdateSpam("new spam"))
+	require.Equal(t, 2, len(mockDetector.SaveModelCalls()))
+	assert.NotEqual(t, fingerprint, mockDetector.SaveModelCalls()[1].Fingerprint)
+	require.NoError(t, sf.ReloadSamples())
+	assert.Equal(t, 1, len(mockDetector.LoadSamplesCalls()), "updated model matches samples")
+
+	// static samples changed, saved model outdated, relearned
+	require.NoError(t, os.WriteFile(params.SpamSamplesFile, []byte("spam\nmore spam"), 0o600))
+	sf3 := NewSpamFilter(ctx, mockDetector, params)
+	require.NoError(t, sf3.ReloadSamples())
+	assert.Equal(t, 2, len(mockDetector.LoadModelCalls()))
+	assert.Equal(t, 2, len(mockDetector.LoadSamplesCalls()))
+	assert.Equal(t, 3, len(mockDetector.SaveModelCalls()))
+}
+
+func TestSpamFilter_samplesFingerprint(t *testing.T) {
+	tmpDir := t.TempDir()
+	params := SpamConfig{
+		SpamSamplesFile: filepath.Join(tmpDir, "spam_samples.txt"),
+		HamSamplesFile:  filepath.Join(tmpDir, "ham_samples.txt"),
+		SpamDynamicFile: filepath.Join(tmpDir, "spam_dynamic.txt"), // not created, optional
+	}
+	sf := SpamFilter{params: params}
+
+	require.NoError(t, os.WriteFile(params.SpamSamplesFile, []byte("spam1\nspam2"), 0o600))
+	require.NoError(t, os.WriteFile(params.HamSamplesFile, []byte("ham1"), 0o600))
+	fp1, err := sf.samplesFingerprint()
+	require.NoError(t, err)
+	fp2, err := sf.samplesFingerprint()
+	require.NoError(t, err)
+	assert.Equal(t, fp1, fp2, "same samples")
+
+	// the same content moved between files changes fingerprint
+	require.NoError(t, os.WriteFile(params.SpamSamplesFile, []byte("spam1\n"), 0o600))
+	require.NoError(t, os.WriteFile(params.HamSamplesFile, []byte("spam2ham1"), 0o600))
+	fp3, err := sf.samplesFingerprint()
+	require.NoError(t, err)
+	assert.NotEqual(t, fp1, fp3)
+}
+
 func TestSpamFilter_AddApprovedUsers(t *testing.T) {
 	mockDirector := &mocks.DetectorMock{
 		AddApprovedUserFunc: func(user approved.UserInfo) error {
@@ -469,6 +1084,9 @@ func TestSpamFilter_RemoveDynamicSample(t *testing.T) {
 		LoadStopWordsFunc: func(readers ...io.Reader) (tgspam.LoadResult, error) {
 			return tgspam.LoadResult{}, nil
 		},
+		LoadDomainsFunc: func(allowReader, blockReader io.Reader) (tgspam.LoadResult, error) {
+			return tgspam.LoadResult{}, nil
+		},
 	}
 
 	prep := func() (res *SpamFilter, teardown func()) {
@@ -581,6 +1199,9 @@ func TestSpamFilter_RemoveDynamicSampleReal(t *testing.T) {
 		LoadStopWordsFunc: func(readers ...io.Reader) (tgspam.LoadResult, error) {
 			return tgspam.LoadResult{}, nil
 		},
+		LoadDomainsFunc: func(allowReader, blockReader io.Reader) (tgspam.LoadResult, error) {
+			return tgspam.LoadResult{}, nil
+		},
 	}
 
 	// make a temp file from testdata/spam.txt
@@ -0,0 +1,197 @@
+package bot
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+	"github.com/umputun/tg-spam/lib/tgspam"
+)
+
+// Thresholds are detector thresholds tuned by Tuner
+type Thresholds struct {
+	Similarity         float64 // similarity threshold, 0.0 - 1.0
+	MinSpamProbability float64 // min spam probability percent of the classifier, 0 - 100
+}
+
+// Decision is a moderator decision on detected spam, with the original check results
+type Decision struct {
+	ChatID int64                // chat the message was posted to
+	Spam   bool                 // true if the ban confirmed, false if the user unbanned (false positive)
+	Checks []spamcheck.Response // results of checks made on detection
+}
+
+// TuneResult is a result of thresholds tuning, with the number of errors on moderator decisions
+// for the current and suggested thresholds.
+type TuneResult struct {
+	Time      time.Time  // time of tuning
+	Decisions int        // number of decisions used for tuning
+	Current   Thresholds // thresholds of the spam filter on tuning
+	Suggested Thresholds // suggested thresholds, the same as current if they can't be improved
+
+	FalsePositives          int // unbanned users detected with current thresholds
+	MissedSpam              int // confirmed spam not detected with current thresholds
+	SuggestedFalsePositives int // unbanned users detected with suggested thresholds
+	SuggestedMissedSpam     int // confirmed spam not detected with suggested thresholds
+
+	Applied bool // suggested thresholds applied to the spam filter
+}
+
+// TunerConfig is a set of parameters for Tuner
+type TunerConfig struct {
+	MinDecisions   int     // min number of decisions to suggest thresholds
+	Apply          bool    // apply suggested thresholds to the spam filter, suggest only if false
+	ScoreThreshold float64 // score threshold of the spam filter, thresholds are not tuned if set
+}
+
+// Tuner suggests similarity and classifier thresholds of the spam filter, minimizing false positives
+// on moderator decisions, and optionally applies them. Decisions are made on detected spam only, so thresholds
+// are raised to avoid false positives, as long as it doesn't make more confirmed spam missed.
+// Only the default filter is tuned, decisions for chats with own profiles are ignored.
+// Detection is replayed as "any check detected spam", so thresholds are not tuned with the score threshold set,
+// as the weighted score of checks decides then.
+type Tuner struct {
+	filter *SpamFilter
+	params TunerConfig
+
+	lock  sync.RWMutex
+	last  TuneResult
+	tuned bool
+}
+
+// NewTuner makes a thresholds tuner for the spam filter
+func NewTuner(filter *SpamFilter, params TunerConfig) *Tuner {
+	return &Tuner{filter: filter, params: params}
+}
+
+// Tune suggests thresholds from moderator decisions, and applies them if Apply set.
+// Returns the result and true if new thresholds suggested, i.e., they differ from the current ones and
+// from the previous suggestion. Returns false if there are not enough decisions to tune, or the score threshold set.
+func (t *Tuner) Tune(decisions []Decision) (TuneResult, bool) {
+	if t.params.ScoreThreshold > 0 {
+		return TuneResult{}, false
+	}
+	used := make([]Decision, 0, len(decisions))
+	for _, d := range decisions {
+		if len(d.Checks) == 0 || t.filter.Profile(d.ChatID) != t.filter {
+			continue
+		}
+		used = append(used, d)
+	}
+	if len(used) == 0 || len(used) < t.params.MinDecisions {
+		return TuneResult{}, false
+	}
+
+	sim, prob := t.filter.Thresholds()
+	res := suggestThresholds(used, Thresholds{Similarity: sim, MinSpamProbability: prob})
+	res.Time = time.Now()
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	isNew := res.Changed() && (!t.tuned || !t.last.Changed() || t.last.Suggested != res.Suggested)
+	if res.Changed() && t.params.Apply {
+		t.filter.SetThresholds(res.Suggested.Similarity, res.Suggested.MinSpamProbability)
+		res.Applied = true
+		isNew = true
+	}
+	t.last, t.tuned = res, true
+	return res, isNew
+}
+
+// Last returns the result of the last tuning, false if not tuned yet
+func (t *Tuner) Last() (TuneResult, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.last, t.tuned
+}
+
+// Changed checks if suggested thresholds differ from the current ones
+func (r TuneResult) Changed() bool {
+	return r.Suggested != r.Current
+}
+
+// String returns the result in a human-readable form
+func (r TuneResult) String() string {
+	return fmt.Sprintf("similarity threshold: %.2f -> %.2f, min spam probability: %.0f%% -> %.0f%%, "+
+		"false positives: %d -> %d, missed spam: %d -> %d, decisions: %d",
+		r.Current.Similarity, r.Suggested.Similarity, r.Current.MinSpamProbability, r.Suggested.MinSpamProbability,
+		r.FalsePositives, r.SuggestedFalsePositives, r.MissedSpam, r.SuggestedMissedSpam, r.Decisions)
+}
+
+// tuneSample is a decision reduced to values affecting detection with different thresholds
+type tuneSample struct {
+	spam  bool    // moderator decision
+	other bool    // detected by checks not depending on tuned thresholds
+	sim   float64 // similarity, -1 if not checked
+	prob  float64 // spam probability of the classifier, -1 if not checked or classified as ham
+}
+
+// suggestThresholds finds thresholds with the least number of errors, false positives and missed spam,
+// on the decisions. Ties resolved in favor of fewer false positives, then the closest to the current thresholds.
+// Thresholds are checked on a grid with 0.01 step for similarity and 1% for probability.
+func suggestThresholds(decisions []Decision, current Thresholds) TuneResult {
+	samples := make([]tuneSample, 0, len(decisions))
+	for _, d := range decisions {
+		samples = append(samples, newTuneSample(d))
+	}
+
+	errorsOf := func(th Thresholds) (fp, missed int) {
+		for _, s := range samples {
+			detected := s.other || (s.sim >= 0 && s.sim >= th.Similarity-1e-9) ||
+				(s.prob >= 0 && s.prob >= th.MinSpamProbability-1e-9)
+			switch {
+			case detected && !s.spam:
+				fp++
+			case !detected && s.spam:
+				missed++
+			}
+		}
+		return fp, missed
+	}
+
+	res := TuneResult{Decisions: len(decisions), Current: current, Suggested: current}
+	res.FalsePositives, res.MissedSpam = errorsOf(current)
+	res.SuggestedFalsePositives, res.SuggestedMissedSpam = res.FalsePositives, res.MissedSpam
+
+	bestDist := 0.0
+	for simStep := 1; simStep <= 100; simStep++ {
+		for prob := 0; prob <= 100; prob++ {
+			th := Thresholds{Similarity: float64(simStep) / 100, MinSpamProbability: float64(prob)}
+			fp, missed := errorsOf(th)
+			bestErrors := res.SuggestedFalsePositives + res.SuggestedMissedSpam
+			dist := math.Abs(th.Similarity-current.Similarity) + math.Abs(th.MinSpamProbability-current.MinSpamProbability)/100
+			better := fp+missed < bestErrors ||
+				(fp+missed == bestErrors && fp < res.SuggestedFalsePositives) ||
+				(fp+missed == bestErrors && fp == res.SuggestedFalsePositives && res.Suggested != current && dist < bestDist)
+			if !better {
+				continue
+			}
+			res.Suggested, res.SuggestedFalsePositives, res.SuggestedMissedSpam, bestDist = th, fp, missed, dist
+		}
+	}
+	return res
+}
+
+// newTuneSample makes a tune sample from the decision, with similarity and probability values of the checks
+func newTuneSample(d Decision) tuneSample {
+	res := tuneSample{spam: d.Spam, sim: -1, prob: -1}
+	for _, r := range d.Checks {
+		switch r.Name {
+		case tgspam.CheckerSimilarity:
+			res.sim = r.Value
+		case tgspam.CheckerClassifier:
+			if r.Value > 0 { // not set if classified as ham, not detected with any threshold
+				res.prob = r.Value
+			}
+		case tgspam.CheckerMsgLength:
+			continue
+		default:
+			if r.Spam {
+				res.other = true
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,183 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/bot/mocks"
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+// decision makes a decision with similarity and classifier checks, negative values skip the check.
+// Zero classifier value means the message classified as ham.
+func decision(spam bool, similarity, classifier float64, other ...spamcheck.Response) Decision {
+	res := Decision{Spam: spam, Checks: other}
+	if similarity >= 0 {
+		res.Checks = append(res.Checks, spamcheck.Response{Name: "similarity", Value: similarity})
+	}
+	if classifier >= 0 {
+		res.Checks = append(res.Checks, spamcheck.Response{Name: "classifier", Value: classifier})
+	}
+	return res
+}
+
+func Test_suggestThresholds(t *testing.T) {
+	current := Thresholds{Similarity: 0.5, MinSpamProbability: 50}
+	stopWord := spamcheck.Response{Name: "stopword", Spam: true, Details: "buy now"}
+
+	tests := []struct {
+		name                         string
+		decisions                    []Decision
+		suggested                    Thresholds
+		fp, missed                   int
+		suggestedFp, suggestedMissed int
+	}{
+		{
+			name: "no false positives, not changed",
+			decisions: []Decision{decision(true, 0.80, -1), decision(true, 0.55, -1),
+				decision(true, 0.10, -1, stopWord)},
+			suggested: current,
+		},
+		{
+			name: "similarity raised above false positives",
+			decisions: []Decision{decision(true, 0.80, -1), decision(true, 0.70, -1),
+				decision(false, 0.55, -1), decision(false, 0.60, -1)},
+			suggested: Thresholds{Similarity: 0.61, MinSpamProbability: 50},
+			fp:        2,
+		},
+		{
+			name: "probability raised above false positives",
+			decisions: []Decision{decision(true, 0.20, 90.00),
+				decision(false, 0.20, 60.50),
+				decision(false, 0.20, 55.00),
+				decision(false, 0.20, 0)},
+			suggested: Thresholds{Similarity: 0.5, MinSpamProbability: 61},
+			fp:        2,
+		},
+		{
+			name: "false positives by other checks can't be fixed",
+			decisions: []Decision{decision(true, 0.80, -1), decision(false, 0.30, -1, stopWord),
+				decision(false, 0.10, -1, stopWord)},
+			suggested:   current,
+			fp:          2,
+			suggestedFp: 2,
+		},
+		{
+			name: "fewer errors with some spam missed",
+			decisions: []Decision{decision(true, 0.90, -1), decision(true, 0.65, -1),
+				decision(false, 0.70, -1), decision(false, 0.70, -1)},
+			suggested:       Thresholds{Similarity: 0.71, MinSpamProbability: 50},
+			fp:              2,
+			suggestedMissed: 1,
+		},
+		{
+			name: "more spam missed than false positives fixed, not changed",
+			decisions: []Decision{decision(true, 0.90, -1), decision(true, 0.65, -1),
+				decision(true, 0.66, -1), decision(false, 0.70, -1)},
+			suggested:   current,
+			fp:          1,
+			suggestedFp: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := suggestThresholds(tt.decisions, current)
+			assert.Equal(t, len(tt.decisions), res.Decisions)
+			assert.Equal(t, current, res.Current)
+			assert.InDelta(t, tt.suggested.Similarity, res.Suggested.Similarity, 0.0001)
+			assert.InDelta(t, tt.suggested.MinSpamProbability, res.Suggested.MinSpamProbability, 0.0001)
+			assert.Equal(t, tt.fp, res.FalsePositives, "false positives")
+			assert.Equal(t, tt.missed, res.MissedSpam, "missed spam")
+			assert.Equal(t, tt.suggestedFp, res.SuggestedFalsePositives, "suggested false positives")
+			assert.Equal(t, tt.suggestedMissed, res.SuggestedMissedSpam, "suggested missed spam")
+		})
+	}
+}
+
+func TestTuner_Tune(t *testing.T) {
+	decisions := []Decision{decision(true, 0.80, -1), decision(true, 0.70, -1),
+		decision(false, 0.60, -1), {Spam: false}}
+
+	makeFilter := func() (*SpamFilter, *mocks.DetectorMock) {
+		sim, prob := 0.5, 50.0
+		det := &mocks.DetectorMock{
+			ThresholdsFunc:    func() (float64, float64) { return sim, prob },
+			SetThresholdsFunc: func(s, p float64) { sim, prob = s, p },
+		}
+		return &SpamFilter{Detector: det}, det
+	}
+
+	t.Run("suggest only", func(t *testing.T) {
+		sf, det := makeFilter()
+		tuner := NewTuner(sf, TunerConfig{MinDecisions: 3})
+		_, ok := tuner.Last()
+		assert.False(t, ok, "not tuned yet")
+
+		res, isNew := tuner.Tune(decisions)
+		assert.True(t, isNew)
+		assert.Equal(t, 3, res.Decisions, "decision without checks ignored")
+		assert.True(t, res.Changed())
+		assert.False(t, res.Applied)
+		assert.InDelta(t, 0.61, res.Suggested.Similarity, 0.0001)
+		assert.Empty(t, det.SetThresholdsCalls())
+		assert.Equal(t, "similarity threshold: 0.50 -> 0.61, min spam probability: 50% -> 50%, "+
+			"false positives: 1 -> 0, missed spam: 0 -> 0, decisions: 3", res.String())
+
+		last, ok := tuner.Last()
+		assert.True(t, ok)
+		assert.Equal(t, res, last)
+
+		_, isNew = tuner.Tune(decisions)
+		assert.False(t, isNew, "the same suggestion")
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		sf, det := makeFilter()
+		tuner := NewTuner(sf, TunerConfig{MinDecisions: 3, Apply: true})
+		res, isNew := tuner.Tune(decisions)
+		assert.True(t, isNew)
+		assert.True(t, res.Applied)
+		require.Len(t, det.SetThresholdsCalls(), 1)
+		assert.InDelta(t, 0.61, det.SetThresholdsCalls()[0].Similarity, 0.0001)
+		assert.InDelta(t, 50, det.SetThresholdsCalls()[0].MinSpamProbability, 0.0001)
+
+		res, isNew = tuner.Tune(decisions)
+		assert.False(t, isNew, "already applied")
+		assert.False(t, res.Changed())
+		assert.Len(t, det.SetThresholdsCalls(), 1)
+	})
+
+	t.Run("not enough decisions", func(t *testing.T) {
+		sf, _ := makeFilter()
+		tuner := NewTuner(sf, TunerConfig{MinDecisions: 4})
+		_, isNew := tuner.Tune(decisions)
+		assert.False(t, isNew)
+		_, ok := tuner.Last()
+		assert.False(t, ok)
+	})
+
+	t.Run("not tuned with score threshold", func(t *testing.T) {
+		sf, det := makeFilter()
+		tuner := NewTuner(sf, TunerConfig{MinDecisions: 3, Apply: true, ScoreThreshold: 1.5})
+		_, isNew := tuner.Tune(decisions)
+		assert.False(t, isNew)
+		_, ok := tuner.Last()
+		assert.False(t, ok)
+		assert.Empty(t, det.SetThresholdsCalls())
+	})
+
+	t.Run("decisions for profiles ignored", func(t *testing.T) {
+		sf, _ := makeFilter()
+		sf.WithProfile(-100123, &SpamFilter{})
+		profDecision := decision(false, 0.75, -1)
+		profDecision.ChatID = -100123
+		tuner := NewTuner(sf, TunerConfig{MinDecisions: 3})
+		res, isNew := tuner.Tune(append(decisions, profDecision))
+		assert.True(t, isNew)
+		assert.Equal(t, 3, res.Decisions)
+		assert.InDelta(t, 0.61, res.Suggested.Similarity, 0.0001, "profile's false positive not counted")
+	})
+}
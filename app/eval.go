@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+	"github.com/umputun/tg-spam/lib/tgspam"
+)
+
+// evalCommand defines options of the eval command, measuring detection quality on labelled data
+type evalCommand struct {
+	Data    []string `long:"data" description:"labelled dataset file, json lines with text and spam fields"`
+	SpamLog []string `long:"spam-log" description:"spam log file, all messages considered spam"`
+	Folds   int      `long:"folds" default:"0" description:"number of folds for cross-validation over samples files, 0 - disabled"`
+	LLM     bool     `long:"llm" description:"evaluate openai check as well, makes an api call for each checked message"`
+}
+
+// evalRecord is a labelled message of the dataset. Spam log lines have the same text field and no label.
+type evalRecord struct {
+	Text string `json:"text"`
+	Spam bool   `json:"spam"`
+}
+
+// evalSamples are samples files content used to train the detector
+type evalSamples struct {
+	excluded string   // excluded tokens, as is
+	spam     []string // spam samples, including dynamic ones
+	ham      []string // ham samples, including dynamic ones
+}
+
+// evalReport collects detection results for labelled messages
+type evalReport struct {
+	spam, ham int                    // number of checked spam and ham messages
+	detected  evalCounts             // messages detected as spam by the detector
+	checks    map[string]*evalCounts // messages detected as spam by each check, by check name
+	names     []string               // check names in order of appearance
+}
+
+// evalCounts is a number of spam (true positives) and ham (false positives) messages detected as spam
+type evalCounts struct {
+	tp, fp int
+}
+
+// runEval evaluates the detector made with given options. It checks labelled datasets and spam logs
+// with the detector trained on all samples, and runs k-fold cross-validation over samples files if folds set.
+// Reports with precision, recall, f1 and confusion matrix for each check and overall are written to wr.
+func runEval(opts options, wr io.Writer) error {
+	if len(opts.Eval.Data) == 0 && len(opts.Eval.SpamLog) == 0 && opts.Eval.Folds == 0 {
+		return errors.New("nothing to evaluate, set data, spam log or folds")
+	}
+	if opts.Eval.Folds < 0 || opts.Eval.Folds == 1 {
+		return fmt.Errorf("invalid number of folds %d, should be 0 or at least 2", opts.Eval.Folds)
+	}
+
+	samples, err := readEvalSamples(opts)
+	if err != nil {
+		return fmt.Errorf("can't read samples, %w", err)
+	}
+
+	// CAS check depends on the current status of users, not on messages, so it is not evaluated
+	opts.CAS.API = ""
+	if !opts.Eval.LLM {
+		// openai check makes a paid api call for each message of the dataset and each sample in every fold
+		opts.OpenAI.Token = ""
+	}
+	detector, err := makeEvalDetector(opts)
+	if err != nil {
+		return fmt.Errorf("can't make detector, %w", err)
+	}
+
+	if len(opts.Eval.Data) > 0 || len(opts.Eval.SpamLog) > 0 {
+		records, err := readEvalRecords(opts.Eval.Data, opts.Eval.SpamLog)
+		if err != nil {
+			return fmt.Errorf("can't read dataset, %w", err)
+		}
+		if err := samples.load(detector, samples.spam, samples.ham); err != nil {
+			return fmt.Errorf("can't load samples, %w", err)
+		}
+		report := newEvalReport()
+		for _, rec := range records {
+			report.check(detector, rec)
+		}
+		if err := report.write(wr, "dataset"); err != nil {
+			return fmt.Errorf("can't write dataset report, %w", err)
+		}
+	}
+
+	if opts.Eval.Folds > 0 {
+		report, err := crossValidate(detector, samples, opts.Eval.Folds)
+		if err != nil {
+			return fmt.Errorf("can't cross-validate, %w", err)
+		}
+		if err := report.write(wr, fmt.Sprintf("%d-fold cross-validation", opts.Eval.Folds)); err != nil {
+			return fmt.Errorf("can't write cross-validation report, %w", err)
+		}
+	}
+	return nil
+}
+
+// makeEvalDetector makes detector with given options and loads stop words and domains lists.
+// Samples are not loaded, as they are different for the dataset check and each cross-validation fold.
+func makeEvalDetector(opts options) (*tgspam.Detector, error) {
+	detector := makeDetector(opts)
+
+	stopWords, err := readOptionalFile(filepath.Join(opts.Files.SamplesDataPath, stopWordsFile))
+	if err != nil {
+		return nil, err
+	}
+	ls, err := detector.LoadStopWords(bytes.NewReader(stopWords))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stop words: %w", err)
+	}
+	for _, e := range ls.StopWordsErrors {
+		log.Printf("[WARN] invalid stop word skipped, %s", e)
+	}
+
+	allowed, err := readOptionalFile(filepath.Join(opts.Files.SamplesDataPath, allowedDomains))
+	if err != nil {
+		return nil, err
+	}
+	blocked, err := readOptionalFile(filepath.Join(opts.Files.SamplesDataPath, blockedDomains))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := detector.LoadDomains(bytes.NewReader(allowed), bytes.NewReader(blocked)); err != nil {
+		return nil, fmt.Errorf("failed to load domains: %w", err)
+	}
+	return detector, nil
+}
+
+// readEvalSamples reads spam and ham samples, with dynamic ones, and excluded tokens.
+// Spam and ham samples files are mandatory, others are optional.
+func readEvalSamples(opts options) (res evalSamples, err error) {
+	excluded, err := readOptionalFile(filepath.Join(opts.Files.SamplesDataPath, excludeTokensFile))
+	if err != nil {
+		return res, err
+	}
+	res.excluded = string(excluded)
+
+	readSamples := func(file, dynFile string) ([]string, error) {
+		data, err := os.ReadFile(file) //nolint:gosec // file name from options
+		if err != nil {
+			return nil, fmt.Errorf("failed to read samples file: %w", err)
+		}
+		dynData, err := readOptionalFile(dynFile)
+		if err != nil {
+			return nil, err
+		}
+		lines := []string{}
+		for _, line := range strings.Split(string(data)+"\n"+string(dynData), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		return lines, nil
+	}
+
+	if res.spam, err = readSamples(filepath.Join(opts.Files.SamplesDataPath, samplesSpamFile),
+		filepath.Join(opts.Files.DynamicDataPath, dynamicSpamFile)); err != nil {
+		return res, err
+	}
+	if res.ham, err = readSamples(filepath.Join(opts.Files.SamplesDataPath, samplesHamFile),
+		filepath.Join(opts.Files.DynamicDataPath, dynamicHamFile)); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// readOptionalFile reads the file, returns empty content if the file doesn't exist
+func readOptionalFile(file string) ([]byte, error) {
+	data, err := os.ReadFile(file) //nolint:gosec // file name from options
+	if errors.Is(err, os.ErrNotExist) {
+		return []byte{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	return data, nil
+}
+
+// readEvalRecords reads labelled messages from dataset files and spam messages from spam log files.
+// Both are json lines, dataset lines have text and spam fields, spam log lines are written by the spam logger.
+func readEvalRecords(dataFiles, spamLogFiles []string) ([]evalRecord, error) {
+	res := []evalRecord{}
+	read := func(file string, spamLog bool) error {
+		fh, err := os.Open(file) //nolint:gosec // file name from options
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", file, err)
+		}
+		defer fh.Close()
+		scanner := bufio.NewScanner(fh)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for n := 1; scanner.Scan(); n++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			var rec evalRecord
+			if err := json.Unmarshal([]byte(line), &rec); err != nil {
+				return fmt.Errorf("failed to parse %s line %d: %w", file, n, err)
+			}
+			if spamLog {
+				rec.Spam = true
+			}
+			res = append(res, rec)
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		return nil
+	}
+
+	for _, file := range dataFiles {
+		if err := read(file, false); err != nil {
+			return nil, err
+		}
+	}
+	for _, file := range spamLogFiles {
+		if err := read(file, true); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// crossValidate splits samples into folds, and for each fold checks its samples with the detector
+// trained on samples of other folds. Sample goes to the fold by its position, so splitting is repeatable.
+func crossValidate(detector *tgspam.Detector, samples evalSamples, folds int) (*evalReport, error) {
+	if len(samples.spam) < folds || len(samples.ham) < folds {
+		return nil, fmt.Errorf("not enough samples for %d folds, spam: %d, ham: %d", folds, len(samples.spam), len(samples.ham))
+	}
+
+	split := func(inp []string, fold int) (train, test []string) {
+		for i, s := range inp {
+			if i%folds == fold {
+				test = append(test, s)
+				continue
+			}
+			train = append(train, s)
+		}
+		return train, test
+	}
+
+	report := newEvalReport()
+	for fold := 0; fold < folds; fold++ {
+		trainSpam, testSpam := split(samples.spam, fold)
+		trainHam, testHam := split(samples.ham, fold)
+		if err := samples.load(detector, trainSpam, trainHam); err != nil {
+			return nil, fmt.Errorf("can't load samples for fold %d, %w", fold, err)
+		}
+		for _, msg := range testSpam {
+			report.check(detector, evalRecord{Text: msg, Spam: true})
+		}
+		for _, msg := range testHam {
+			report.check(detector, evalRecord{Text: msg, Spam: false})
+		}
+	}
+	return report, nil
+}
+
+// load trains the detector with given spam and ham samples and excluded tokens
+func (s evalSamples) load(detector *tgspam.Detector, spam, ham []string) error {
+	_, err := detector.LoadSamples(strings.NewReader(s.excluded),
+		[]io.Reader{strings.NewReader(strings.Join(spam, "\n"))}, []io.Reader{strings.NewReader(strings.Join(ham, "\n"))})
+	return err
+}
+
+func newEvalReport() *evalReport {
+	return &evalReport{checks: make(map[string]*evalCounts)}
+}
+
+// check checks the labelled message with the detector and adds results to the report.
+// Approved users logic is skipped, so the result doesn't depend on previously checked messages.
+func (r *evalReport) check(detector *tgspam.Detector, rec evalRecord) {
+	spam, cr := detector.Check(spamcheck.Request{Msg: rec.Text, CheckApproved: true})
+	r.add(rec.Spam, spam, cr)
+}
+
+// add adds the detection result of a message labelled as spam or ham to the report
+func (r *evalReport) add(labelSpam, detectedSpam bool, cr []spamcheck.Response) {
+	count := func(c *evalCounts, detected bool) {
+		switch {
+		case detected && labelSpam:
+			c.tp++
+		case detected:
+			c.fp++
+		}
+	}
+
+	if labelSpam {
+		r.spam++
+	} else {
+		r.ham++
+	}
+	count(&r.detected, detectedSpam)
+
+	for _, resp := range cr {
+		if resp.Name == tgspam.CheckerMsgLength {
+			continue // not a check, reported for short messages only
+		}
+		c, ok := r.checks[resp.Name]
+		if !ok {
+			c = &evalCounts{}
+			r.checks[resp.Name] = c
+			r.names = append(r.names, resp.Name)
+		}
+		count(c, resp.Spam)
+	}
+}
+
+// write writes the report with metrics of each check and overall, and the overall confusion matrix
+func (r *evalReport) write(wr io.Writer, title string) error {
+	fmt.Fprintf(wr, "\n%s: %d messages, spam: %d, ham: %d\n\n", title, r.spam+r.ham, r.spam, r.ham)
+
+	tw := tabwriter.NewWriter(wr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "check\ttp\tfp\tfn\ttn\tprecision\trecall\tf1")
+	row := func(name string, c evalCounts) {
+		precision, recall, f1 := c.metrics(r.spam)
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%.3f\t%.3f\t%.3f\n", name, c.tp, c.fp, r.spam-c.tp, r.ham-c.fp, precision, recall, f1)
+	}
+	for _, name := range r.names {
+		row(name, *r.checks[name])
+	}
+	row("overall", r.detected)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(wr, "\nconfusion matrix:")
+	tw = tabwriter.NewWriter(wr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tdetected spam\tdetected ham")
+	fmt.Fprintf(tw, "spam\t%d\t%d\n", r.detected.tp, r.spam-r.detected.tp)
+	fmt.Fprintf(tw, "ham\t%d\t%d\n", r.detected.fp, r.ham-r.detected.fp)
+	return tw.Flush()
+}
+
+// metrics returns precision, recall and f1 score for the counts, given the total number of spam messages.
+// Metrics with zero denominator are 0.
+func (c evalCounts) metrics(spam int) (precision, recall, f1 float64) {
+	if c.tp+c.fp > 0 {
+		precision = float64(c.tp) / float64(c.tp+c.fp)
+	}
+	if spam > 0 {
+		recall = float64(c.tp) / float64(spam)
+	}
+	if precision+recall > 0 {
+		f1 = 2 * precision * recall / (precision + recall)
+	}
+	return precision, recall, f1
+}
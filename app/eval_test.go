@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+func Test_runEval(t *testing.T) {
+	tmpDir := t.TempDir()
+	write := func(name, data string) string {
+		file := filepath.Join(tmpDir, name)
+		require.NoError(t, os.WriteFile(file, []byte(data), 0o600))
+		return file
+	}
+	write(samplesSpamFile, "win a free iphone now\nfree crypto signals every day\nearn money fast from home\nfree lottery prize today")
+	write(samplesHamFile, "how are you today\nwhat a nice day\nlet's meet at the office\nsee you tomorrow morning")
+	write(dynamicSpamFile, "cheap crypto signals here")
+	write(stopWordsFile, "buy now")
+	data := write("data.jsonl", `{"text":"free iphone now, win it","spam":true}`+"\n\n"+`{"text":"nice to see you today","spam":false}`)
+	spamLog := write("spam.log", `{"ts":"2024-01-01T00:00:00Z","user_id":1,"text":"buy now cheap stuff"}`)
+
+	var opts options
+	opts.Files.SamplesDataPath = tmpDir
+	opts.Files.DynamicDataPath = tmpDir
+	opts.SimilarityThreshold = 0.5
+	opts.MaxEmoji = -1
+	opts.Meta.LinksLimit = -1
+	opts.Meta.HiddenLinksLimit = -1
+	opts.Tokenizer = "words"
+	opts.CAS.API = "http://localhost:1" // not used by eval
+
+	t.Run("dataset and cross-validation", func(t *testing.T) {
+		opts := opts
+		opts.Eval.Data = []string{data}
+		opts.Eval.SpamLog = []string{spamLog}
+		opts.Eval.Folds = 2
+		buf := bytes.Buffer{}
+		require.NoError(t, runEval(opts, &buf))
+		out := buf.String()
+		assert.Contains(t, out, "dataset: 3 messages, spam: 2, ham: 1")
+		assert.Contains(t, out, "2-fold cross-validation: 9 messages, spam: 5, ham: 4")
+		assert.Contains(t, out, "check       tp  fp  fn  tn  precision  recall  f1")
+		assert.Contains(t, out, "stopword    1   0   1   1   1.000      0.500   0.667")
+		assert.Contains(t, out, "confusion matrix:")
+		assert.NotContains(t, out, "cas")
+	})
+
+	t.Run("openai check only with llm flag", func(t *testing.T) {
+		var calls atomic.Int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer ts.Close()
+		opts := opts
+		opts.Eval.Data = []string{data}
+		opts.OpenAI.Token = "secret"
+		opts.OpenAI.BaseURL = ts.URL
+		opts.OpenAI.Timeout = time.Second
+
+		buf := bytes.Buffer{}
+		require.NoError(t, runEval(opts, &buf))
+		assert.Zero(t, calls.Load(), "openai not called by default")
+		assert.NotContains(t, buf.String(), "openai")
+
+		opts.Eval.LLM = true
+		buf.Reset()
+		require.NoError(t, runEval(opts, &buf))
+		assert.NotZero(t, calls.Load(), "openai called with llm flag")
+		assert.Contains(t, buf.String(), "openai")
+	})
+
+	t.Run("nothing to evaluate", func(t *testing.T) {
+		err := runEval(opts, &bytes.Buffer{})
+		require.EqualError(t, err, "nothing to evaluate, set data, spam log or folds")
+	})
+
+	t.Run("invalid folds", func(t *testing.T) {
+		opts := opts
+		opts.Eval.Folds = 1
+		err := runEval(opts, &bytes.Buffer{})
+		require.EqualError(t, err, "invalid number of folds 1, should be 0 or at least 2")
+	})
+
+	t.Run("too many folds", func(t *testing.T) {
+		opts := opts
+		opts.Eval.Folds = 6
+		err := runEval(opts, &bytes.Buffer{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "not enough samples for 6 folds, spam: 5, ham: 4")
+	})
+
+	t.Run("bad dataset", func(t *testing.T) {
+		opts := opts
+		opts.Eval.Data = []string{write("bad.jsonl", `{"text":"ok"}`+"\n"+`{"text":`)}
+		err := runEval(opts, &bytes.Buffer{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "bad.jsonl line 2")
+	})
+
+	t.Run("no samples", func(t *testing.T) {
+		opts := opts
+		opts.Files.SamplesDataPath = t.TempDir()
+		opts.Eval.Folds = 2
+		err := runEval(opts, &bytes.Buffer{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "can't read samples")
+	})
+}
+
+func Test_evalReport(t *testing.T) {
+	r := newEvalReport()
+	r.add(true, true, []spamcheck.Response{{Name: "stopword", Spam: true}, {Name: "similarity", Spam: false}})
+	r.add(true, false, []spamcheck.Response{{Name: "stopword", Spam: false}, {Name: "message length", Spam: false}})
+	r.add(false, true, []spamcheck.Response{{Name: "stopword", Spam: false}, {Name: "similarity", Spam: true}})
+	r.add(false, false, []spamcheck.Response{{Name: "stopword", Spam: false}, {Name: "similarity", Spam: false}})
+
+	assert.Equal(t, 2, r.spam)
+	assert.Equal(t, 2, r.ham)
+	assert.Equal(t, evalCounts{tp: 1, fp: 1}, r.detected)
+	assert.Equal(t, []string{"stopword", "similarity"}, r.names)
+	assert.Equal(t, evalCounts{tp: 1}, *r.checks["stopword"])
+	assert.Equal(t, evalCounts{fp: 1}, *r.checks["similarity"])
+
+	buf := bytes.Buffer{}
+	require.NoError(t, r.write(&buf, "test"))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 11)
+	assert.Equal(t, "test: 4 messages, spam: 2, ham: 2", lines[0])
+	assert.Equal(t, "stopword    1   0   1   2   1.000      0.500   0.667", lines[3])
+	assert.Equal(t, "similarity  0   1   2   1   0.000      0.000   0.000", lines[4])
+	assert.Equal(t, "overall     1   1   1   1   0.500      0.500   0.500", lines[5])
+	assert.Equal(t, "spam  1              1", lines[9])
+	assert.Equal(t, "ham   1              1", lines[10])
+}
+
+func Test_evalCountsMetrics(t *testing.T) {
+	tbl := []struct {
+		name                  string
+		counts                evalCounts
+		spam                  int
+		precision, recall, f1 float64
+	}{
+		{"perfect", evalCounts{tp: 10}, 10, 1, 1, 1},
+		{"nothing detected", evalCounts{}, 10, 0, 0, 0},
+		{"no spam", evalCounts{fp: 2}, 0, 0, 0, 0},
+		{"mixed", evalCounts{tp: 6, fp: 2}, 12, 0.75, 0.5, 0.6},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			precision, recall, f1 := tt.counts.metrics(tt.spam)
+			assert.InDelta(t, tt.precision, precision, 0.0001)
+			assert.InDelta(t, tt.recall, recall, 0.0001)
+			assert.InDelta(t, tt.f1, f1, 0.0001)
+		})
+	}
+}
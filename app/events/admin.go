@@ -14,6 +14,7 @@ import (
 	"github.com/hashicorp/go-multierror"
 
 	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/app/storage"
 )
 
 // admin is a helper to handle all admin-group related stuff, created by listener
@@ -23,12 +24,18 @@ type admin struct {
 	bot          Bot
 	locator      Locator
 	superUsers   SuperUsers
-	primChatID   int64
+	primChatID   int64 // primary chat ID, used as a fallback if the originating chat is unknown
 	adminChatID  int64
 	trainingMode bool
 	softBan      bool // if true, the user not banned automatically, but only restricted
+	graduated    bool // if true, graduated enforcement policy used, the user can be restricted instead of banned
 	dry          bool
 	warnMsg      string
+	warnings     Warnings      // warnings storage, optional
+	maxWarnings  int           // number of active warnings after which the next warning bans the user, 0 - never ban
+	warnExpiry   time.Duration // warnings older than this are not counted, 0 - never expire
+	spamImages   SpamImages    // known spam images storage, images of reported spam added if set
+	decisions    Decisions     // moderator decisions storage, decisions on detected spam recorded if set
 }
 
 const (
@@ -37,12 +44,17 @@ const (
 	infoPrefix         = "!"
 )
 
-// ReportBan a ban message to admin chat with a button to unban the user
-func (a *admin) ReportBan(banUserStr string, msg *bot.Message) {
-	log.Printf("[DEBUG] report to admin chat, ban msgsData for %s, group: %d", banUserStr, a.adminChatID)
+// ReportBan a ban message to admin chat with a button to unban the user.
+// The action is a description of the enforcement action taken, like "permanently banned"
+func (a *admin) ReportBan(banUserStr string, msg *bot.Message, action string) {
+	log.Printf("[DEBUG] report to admin chat, ban msgsData for %s, group: %d, action: %s", banUserStr, a.adminChatID, action)
 	text := strings.ReplaceAll(escapeMarkDownV1Text(msg.Text), "\n", " ")
-	forwardMsg := fmt.Sprintf("**permanently banned [%s](tg://user?id=%d)**\n\n%s\n\n", banUserStr, msg.From.ID, text)
-	if err := a.sendWithUnbanMarkup(forwardMsg, "change ban", msg.From, msg.ID, a.adminChatID); err != nil {
+	forwardMsg := fmt.Sprintf("**%s [%s](tg://user?id=%d)**\n\n%s\n\n", escapeMarkDownV1Text(action), banUserStr, msg.From.ID, text)
+	chatID := msg.ChatID
+	if chatID == 0 {
+		chatID = a.primChatID
+	}
+	if err := a.sendWithUnbanMarkup(forwardMsg, "change ban", msg.From, msg.ID, chatID); err != nil {
 		log.Printf("[WARN] failed to send admin message, %v", err)
 	}
 }
@@ -118,16 +130,23 @@ func (a *admin) MsgHandler(update tbapi.Update) error {
 	if err := a.bot.UpdateSpam(msgTxt); err != nil {
 		return fmt.Errorf("failed to update spam for %q: %w", msgTxt, err)
 	}
+	if err := a.addSpamImage(update.Message, info.UserID); err != nil {
+		errs = multierror.Append(errs, err)
+	}
 
-	// delete message
-	if _, err := a.tbAPI.Request(tbapi.DeleteMessageConfig{ChatID: a.primChatID, MessageID: info.MsgID}); err != nil {
+	// delete message from the chat it was originally posted to
+	chatID := info.ChatID
+	if chatID == 0 {
+		chatID = a.primChatID
+	}
+	if _, err := a.tbAPI.Request(tbapi.DeleteMessageConfig{ChatID: chatID, MessageID: info.MsgID}); err != nil {
 		errs = multierror.Append(errs, fmt.Errorf("failed to delete message %d: %w", info.MsgID, err))
 	} else {
-		log.Printf("[INFO] message %d deleted", info.MsgID)
+		log.Printf("[INFO] message %d deleted from %d", info.MsgID, chatID)
 	}
 
 	// ban user
-	banReq := banRequest{duration: bot.PermanentBanDuration, userID: info.UserID, chatID: a.primChatID,
+	banReq := banRequest{duration: bot.PermanentBanDuration, userID: info.UserID, chatID: chatID,
 		tbAPI: a.tbAPI, dry: a.dry, training: a.trainingMode, userName: update.Message.ForwardSenderName}
 
 	if err := banUserOrChannel(banReq); err != nil {
@@ -154,6 +173,7 @@ func (a *admin) DirectWarnReport(update tbapi.Update) error {
 	log.Printf("[DEBUG] direct warn by admin %q: msg id: %d, from: %q",
 		update.Message.From.UserName, update.Message.ReplyToMessage.MessageID, update.Message.ReplyToMessage.From.UserName)
 	origMsg := update.Message.ReplyToMessage
+	chatID := a.chatOf(update.Message)
 
 	// this is a replayed message, it is an example of something we didn't like and want to issue a warning
 	msgTxt := origMsg.Text
@@ -168,35 +188,84 @@ func (a *admin) DirectWarnReport(update tbapi.Update) error {
 	}
 	errs := new(multierror.Error)
 	// delete original message
-	if _, err := a.tbAPI.Request(tbapi.DeleteMessageConfig{ChatID: a.primChatID, MessageID: origMsg.MessageID}); err != nil {
+	if _, err := a.tbAPI.Request(tbapi.DeleteMessageConfig{ChatID: chatID, MessageID: origMsg.MessageID}); err != nil {
 		errs = multierror.Append(errs, fmt.Errorf("failed to delete message %d: %w", origMsg.MessageID, err))
 	} else {
 		log.Printf("[INFO] warn message %d deleted", origMsg.MessageID)
 	}
 
 	// delete reply message
-	if _, err := a.tbAPI.Request(tbapi.DeleteMessageConfig{ChatID: a.primChatID, MessageID: update.Message.MessageID}); err != nil {
+	if _, err := a.tbAPI.Request(tbapi.DeleteMessageConfig{ChatID: chatID, MessageID: update.Message.MessageID}); err != nil {
 		errs = multierror.Append(errs, fmt.Errorf("failed to delete message %d: %w", update.Message.MessageID, err))
 	} else {
 		log.Printf("[INFO] admin warn reprot message %d deleted", update.Message.MessageID)
 	}
 
+	// record the warning and get the number of active warnings issued before
+	prevWarnings, err := a.registerWarning(origMsg, chatID, msgTxt, update.Message.From.UserName)
+	if err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	// the user already got enough warnings, ban instead of another warning
+	if a.maxWarnings > 0 && prevWarnings >= a.maxWarnings {
+		log.Printf("[INFO] user %q (%d) has %d active warnings, ban", origMsg.From.UserName, origMsg.From.ID, prevWarnings)
+		banReq := banRequest{duration: bot.PermanentBanDuration, userID: origMsg.From.ID, chatID: chatID, tbAPI: a.tbAPI,
+			dry: a.dry, training: a.trainingMode, userName: origMsg.From.UserName, restrict: a.softBan}
+		if err := banUserOrChannel(banReq); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to ban user %d: %w", origMsg.From.ID, err))
+			return errs.ErrorOrNil()
+		}
+		banMsg := fmt.Sprintf("@%s banned by %s after %d warnings", origMsg.From.UserName, update.Message.From.UserName, prevWarnings)
+		if err := send(tbapi.NewMessage(chatID, escapeMarkDownV1Text(banMsg)), a.tbAPI); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to send ban message to main chat: %w", err))
+		}
+		return errs.ErrorOrNil()
+	}
+
 	// make a warning message and replay to origMsg.MessageID
 	warnMsg := fmt.Sprintf("warning from %s\n\n@%s %s", update.Message.From.UserName,
 		origMsg.From.UserName, a.warnMsg)
-	if err := send(tbapi.NewMessage(a.primChatID, escapeMarkDownV1Text(warnMsg)), a.tbAPI); err != nil {
+	if a.maxWarnings > 0 {
+		warnMsg = fmt.Sprintf("warning %d/%d from %s\n\n@%s %s", prevWarnings+1, a.maxWarnings, update.Message.From.UserName,
+			origMsg.From.UserName, a.warnMsg)
+	}
+	if err := send(tbapi.NewMessage(chatID, escapeMarkDownV1Text(warnMsg)), a.tbAPI); err != nil {
 		errs = multierror.Append(errs, fmt.Errorf("failed to send warning to main chat: %w", err))
 	}
 
 	return errs.ErrorOrNil()
 }
 
+// registerWarning records the warning to the storage and returns the number of active (not expired)
+// warnings issued to the user before this one. Does nothing if warnings storage is not set.
+func (a *admin) registerWarning(origMsg *tbapi.Message, chatID int64, msgTxt, adminName string) (int, error) {
+	if a.warnings == nil {
+		return 0, nil
+	}
+	since := time.Time{}
+	if a.warnExpiry > 0 {
+		since = time.Now().Add(-a.warnExpiry)
+	}
+	count, err := a.warnings.Count(origMsg.From.ID, since)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count warnings for user %d: %w", origMsg.From.ID, err)
+	}
+	entry := storage.WarningInfo{UserID: origMsg.From.ID, UserName: origMsg.From.UserName, ChatID: chatID,
+		Text: msgTxt, AdminName: adminName}
+	if err := a.warnings.Add(entry); err != nil {
+		return count, fmt.Errorf("failed to add warning for user %d: %w", origMsg.From.ID, err)
+	}
+	return count, nil
+}
+
 // directReport handles messages replayed with "/spam" or "spam", or "/ban" or "ban" by admin
 func (a *admin) directReport(update tbapi.Update, updateSamples bool) error {
 	log.Printf("[DEBUG] direct ban by admin %q: msg id: %d, from: %q",
 		update.Message.From.UserName, update.Message.ReplyToMessage.MessageID, update.Message.ReplyToMessage.From.UserName)
 
 	origMsg := update.Message.ReplyToMessage
+	chatID := a.chatOf(update.Message)
 
 	// this is a replayed message, it is an example of missed spam
 	// we need to update spam filter with this message
@@ -246,24 +315,27 @@ func (a *admin) directReport(update tbapi.Update, updateSamples bool) error {
 		if err := a.bot.UpdateSpam(msgTxt); err != nil {
 			return fmt.Errorf("failed to update spam for %q: %w", msgTxt, err)
 		}
+		if err := a.addSpamImage(origMsg, origMsg.From.ID); err != nil {
+			errs = multierror.Append(errs, err)
+		}
 	}
 
 	// delete original message
-	if _, err := a.tbAPI.Request(tbapi.DeleteMessageConfig{ChatID: a.primChatID, MessageID: origMsg.MessageID}); err != nil {
+	if _, err := a.tbAPI.Request(tbapi.DeleteMessageConfig{ChatID: chatID, MessageID: origMsg.MessageID}); err != nil {
 		errs = multierror.Append(errs, fmt.Errorf("failed to delete message %d: %w", origMsg.MessageID, err))
 	} else {
 		log.Printf("[INFO] spam message %d deleted", origMsg.MessageID)
 	}
 
 	// delete reply message
-	if _, err := a.tbAPI.Request(tbapi.DeleteMessageConfig{ChatID: a.primChatID, MessageID: update.Message.MessageID}); err != nil {
+	if _, err := a.tbAPI.Request(tbapi.DeleteMessageConfig{ChatID: chatID, MessageID: update.Message.MessageID}); err != nil {
 		errs = multierror.Append(errs, fmt.Errorf("failed to delete message %d: %w", update.Message.MessageID, err))
 	} else {
 		log.Printf("[INFO] admin spam reprot message %d deleted", update.Message.MessageID)
 	}
 
 	// ban user
-	banReq := banRequest{duration: bot.PermanentBanDuration, userID: origMsg.From.ID, chatID: a.primChatID,
+	banReq := banRequest{duration: bot.PermanentBanDuration, userID: origMsg.From.ID, chatID: chatID,
 		tbAPI: a.tbAPI, dry: a.dry, training: a.trainingMode, userName: update.Message.ForwardSenderName}
 
 	if err := banUserOrChannel(banReq); err != nil {
@@ -273,6 +345,22 @@ func (a *admin) directReport(update tbapi.Update, updateSamples bool) error {
 	return errs.ErrorOrNil()
 }
 
+// addSpamImage adds the hash of the message's photo to known spam images, does nothing if the message has no photo
+func (a *admin) addSpamImage(msg *tbapi.Message, userID int64) error {
+	if a.spamImages == nil || len(msg.Photo) == 0 {
+		return nil
+	}
+	fileID := msg.Photo[len(msg.Photo)-1].FileID
+	hash, err := imageHash(a.tbAPI, fileID)
+	if err != nil {
+		return fmt.Errorf("failed to hash spam image: %w", err)
+	}
+	if err := a.spamImages.Add(hash, fileID, userID); err != nil {
+		return fmt.Errorf("failed to add spam image: %w", err)
+	}
+	return nil
+}
+
 // InlineCallbackHandler handles a callback from Telegram, which is a response to a message with inline keyboard.
 // The callback contains user info, which is used to unban the user.
 func (a *admin) InlineCallbackHandler(query *tbapi.CallbackQuery) error {
@@ -366,14 +454,15 @@ func (a *admin) callbackBanConfirmed(query *tbapi.CallbackQuery) error {
 		return fmt.Errorf("failed to update spam for %q: %w", cleanMsg, err)
 	}
 
-	userID, msgID, parseErr := a.parseCallbackData(query.Data)
+	userID, msgID, chatID, parseErr := a.parseCallbackData(query.Data)
 	if parseErr != nil {
 		return fmt.Errorf("failed to parse callback's userID %q: %w", query.Data, parseErr)
 	}
+	a.recordDecision(query, userID, chatID, cleanMsg, true)
 
 	if a.trainingMode {
 		// in training mode, the user is not banned automatically, here we do the real ban & delete the message
-		if err = a.deleteAndBan(query, userID, msgID); err != nil {
+		if err = a.deleteAndBan(query, userID, msgID, chatID); err != nil {
 			return fmt.Errorf("failed to ban user %d: %w", userID, err)
 		}
 	}
@@ -385,7 +474,7 @@ func (a *admin) callbackBanConfirmed(query *tbapi.CallbackQuery) error {
 			log.Printf("[DEBUG] failed to extract username from %q: %v", query.Message.Text, err)
 			userName = ""
 		}
-		banReq := banRequest{duration: bot.PermanentBanDuration, userID: userID, chatID: a.primChatID,
+		banReq := banRequest{duration: bot.PermanentBanDuration, userID: userID, chatID: chatID,
 			tbAPI: a.tbAPI, dry: a.dry, training: a.trainingMode, userName: userName, restrict: false}
 		if err := banUserOrChannel(banReq); err != nil {
 			return fmt.Errorf("failed to ban user %d: %w", userID, err)
@@ -409,7 +498,7 @@ func (a *admin) callbackUnbanConfirmed(query *tbapi.CallbackQuery) error {
 		return fmt.Errorf("failed to send callback response: %w", err)
 	}
 
-	userID, _, err := a.parseCallbackData(callbackData)
+	userID, _, banChatID, err := a.parseCallbackData(callbackData)
 	if err != nil {
 		return fmt.Errorf("failed to parse callback msgsData %q: %w", callbackData, err)
 	}
@@ -422,10 +511,11 @@ func (a *admin) callbackUnbanConfirmed(query *tbapi.CallbackQuery) error {
 	if derr := a.bot.UpdateHam(cleanMsg); derr != nil {
 		return fmt.Errorf("failed to update ham for %q: %w", cleanMsg, derr)
 	}
+	a.recordDecision(query, userID, banChatID, cleanMsg, false)
 
 	// unban user if not in training mode (in training mode, the user is not banned automatically)
 	if !a.trainingMode {
-		if uerr := a.unban(userID); uerr != nil {
+		if uerr := a.unban(userID, banChatID); uerr != nil {
 			return uerr
 		}
 	}
@@ -450,10 +540,11 @@ func (a *admin) callbackUnbanConfirmed(query *tbapi.CallbackQuery) error {
 	return nil
 }
 
-func (a *admin) unban(userID int64) error {
+// unban drops ban or restrictions for the user in the given chat
+func (a *admin) unban(userID, chatID int64) error {
 	if a.softBan { // soft ban, just drop restrictions
 		_, err := a.tbAPI.Request(tbapi.RestrictChatMemberConfig{
-			ChatMemberConfig: tbapi.ChatMemberConfig{UserID: userID, ChatID: a.primChatID},
+			ChatMemberConfig: tbapi.ChatMemberConfig{UserID: userID, ChatID: chatID},
 			Permissions:      &tbapi.ChatPermissions{CanSendMessages: true, CanSendMediaMessages: true, CanSendOtherMessages: true, CanSendPolls: true},
 		})
 		if err != nil {
@@ -464,12 +555,23 @@ func (a *admin) unban(userID int64) error {
 
 	// hard ban, unban the user for real
 	_, err := a.tbAPI.Request(tbapi.UnbanChatMemberConfig{
-		ChatMemberConfig: tbapi.ChatMemberConfig{UserID: userID, ChatID: a.primChatID}, OnlyIfBanned: true})
+		ChatMemberConfig: tbapi.ChatMemberConfig{UserID: userID, ChatID: chatID}, OnlyIfBanned: true})
 	// onlyIfBanned seems to prevent user from being removed from the chat according to this confusing doc:
 	// https://core.telegram.org/bots/api#unbanchatmember
 	if err != nil {
 		return fmt.Errorf("failed to unban user %d: %w", userID, err)
 	}
+
+	// with graduated enforcement the user could be restricted instead of banned, drop restrictions as well
+	if a.graduated {
+		_, err := a.tbAPI.Request(tbapi.RestrictChatMemberConfig{
+			ChatMemberConfig: tbapi.ChatMemberConfig{UserID: userID, ChatID: chatID},
+			Permissions:      &tbapi.ChatPermissions{CanSendMessages: true, CanSendMediaMessages: true, CanSendOtherMessages: true, CanSendPolls: true},
+		})
+		if err != nil {
+			log.Printf("[DEBUG] failed to drop restrictions for user %d: %v", userID, err)
+		}
+	}
 	return nil
 }
 
@@ -479,7 +581,7 @@ func (a *admin) callbackShowInfo(query *tbapi.CallbackQuery) error {
 	callbackData := query.Data
 	spamInfoText := "**can't get spam info**"
 	spamInfo := []string{}
-	userID, _, err := a.parseCallbackData(callbackData)
+	userID, _, _, err := a.parseCallbackData(callbackData)
 	if err != nil {
 		spamInfo = append(spamInfo, fmt.Sprintf("**failed to parse userID from %q: %v**", callbackData[1:], err))
 	}
@@ -512,14 +614,32 @@ func (a *admin) callbackShowInfo(query *tbapi.CallbackQuery) error {
 	return nil
 }
 
-// deleteAndBan deletes the message and bans the user
-func (a *admin) deleteAndBan(query *tbapi.CallbackQuery, userID int64, msgID int) error {
+// recordDecision records the admin decision on detected spam with the original check results, if decisions storage set.
+// Failure to record is not critical and only logged.
+func (a *admin) recordDecision(query *tbapi.CallbackQuery, userID, chatID int64, msg string, spam bool) {
+	if a.decisions == nil {
+		return
+	}
+	entry := storage.DecisionInfo{UserID: userID, ChatID: chatID, Text: msg, Spam: spam, AdminName: query.From.UserName}
+	if info, found := a.locator.Spam(userID); found {
+		entry.Checks = info.Checks
+	}
+	if name, err := a.extractUsername(query.Message.Text); err == nil {
+		entry.UserName = name
+	}
+	if err := a.decisions.Add(entry); err != nil {
+		log.Printf("[WARN] failed to record decision for user %d: %v", userID, err)
+	}
+}
+
+// deleteAndBan deletes the message and bans the user in the given chat
+func (a *admin) deleteAndBan(query *tbapi.CallbackQuery, userID int64, msgID int, chatID int64) error {
 	errs := new(multierror.Error)
 	userName := a.locator.UserNameByID(userID)
 	banReq := banRequest{
 		duration: bot.PermanentBanDuration,
 		userID:   userID,
-		chatID:   a.primChatID,
+		chatID:   chatID,
 		tbAPI:    a.tbAPI,
 		dry:      a.dry,
 		training: false, // reset training flag, ban for real
@@ -535,7 +655,7 @@ func (a *admin) deleteAndBan(query *tbapi.CallbackQuery, userID int64, msgID int
 	}
 
 	// we allow deleting messages from supers. This can be useful if super is training the bot by adding spam messages
-	if _, err := a.tbAPI.Request(tbapi.DeleteMessageConfig{ChatID: a.primChatID, MessageID: msgID}); err != nil {
+	if _, err := a.tbAPI.Request(tbapi.DeleteMessageConfig{ChatID: chatID, MessageID: msgID}); err != nil {
 		return fmt.Errorf("failed to delete message %d: %w", query.Message.MessageID, err)
 	}
 
@@ -588,19 +708,20 @@ func (a *admin) getCleanMessage(msg string) (string, error) {
 
 // sendWithUnbanMarkup sends a message to admin chat and adds buttons to ui.
 // text is message with details and action it for the button label to unban, which is user id prefixed with "?" for confirmation;
-// the second button is to show info about the spam analysis.
-func (a *admin) sendWithUnbanMarkup(text, action string, user bot.User, msgID int, chatID int64) error {
-	log.Printf("[DEBUG] action response %q: user %+v, msgID:%d, text: %q", action, user, msgID, strings.ReplaceAll(text, "\n", "\\n"))
-	tbMsg := tbapi.NewMessage(chatID, text)
+// the second button is to show info about the spam analysis. origChatID is the chat where the spam message was posted.
+func (a *admin) sendWithUnbanMarkup(text, action string, user bot.User, msgID int, origChatID int64) error {
+	log.Printf("[DEBUG] action response %q: user %+v, msgID:%d, chatID:%d, text: %q", action, user, msgID, origChatID,
+		strings.ReplaceAll(text, "\n", "\\n"))
+	tbMsg := tbapi.NewMessage(a.adminChatID, text)
 	tbMsg.ParseMode = tbapi.ModeMarkdown
 	tbMsg.DisableWebPagePreview = true
 
 	tbMsg.ReplyMarkup = tbapi.NewInlineKeyboardMarkup(
 		tbapi.NewInlineKeyboardRow(
 			// ?userID to request confirmation
-			tbapi.NewInlineKeyboardButtonData("⛔︎ "+action, fmt.Sprintf("%s%d:%d", confirmationPrefix, user.ID, msgID)),
+			tbapi.NewInlineKeyboardButtonData("⛔︎ "+action, fmt.Sprintf("%s%d:%d:%d", confirmationPrefix, user.ID, msgID, origChatID)),
 			// !userID to request info
-			tbapi.NewInlineKeyboardButtonData("️⚑ info", fmt.Sprintf("%s%d:%d", infoPrefix, user.ID, msgID)),
+			tbapi.NewInlineKeyboardButtonData("️⚑ info", fmt.Sprintf("%s%d:%d:%d", infoPrefix, user.ID, msgID, origChatID)),
 		),
 	)
 
@@ -610,10 +731,11 @@ func (a *admin) sendWithUnbanMarkup(text, action string, user bot.User, msgID in
 	return nil
 }
 
-// callbackData is a string with userID and msgID separated by ":"
-func (a *admin) parseCallbackData(data string) (userID int64, msgID int, err error) {
+// callbackData is a string with userID, msgID and optional chatID separated by ":"
+// chatID is the chat where the message was posted, if not set (old messages) the primary chat ID is used
+func (a *admin) parseCallbackData(data string) (userID int64, msgID int, chatID int64, err error) {
 	if len(data) < 3 {
-		return 0, 0, fmt.Errorf("unexpected callback data, too short %q", data)
+		return 0, 0, 0, fmt.Errorf("unexpected callback data, too short %q", data)
 	}
 
 	// remove prefix if present from the parsed data
@@ -622,17 +744,32 @@ func (a *admin) parseCallbackData(data string) (userID int64, msgID int, err err
 	}
 
 	parts := strings.Split(data, ":")
-	if len(parts) != 2 {
-		return 0, 0, fmt.Errorf("unexpected callback data, should have both ids %q", data)
+	if len(parts) != 2 && len(parts) != 3 {
+		return 0, 0, 0, fmt.Errorf("unexpected callback data, should have both ids %q", data)
 	}
 	if userID, err = strconv.ParseInt(parts[0], 10, 64); err != nil {
-		return 0, 0, fmt.Errorf("failed to parse userID %q: %w", parts[0], err)
+		return 0, 0, 0, fmt.Errorf("failed to parse userID %q: %w", parts[0], err)
 	}
 	if msgID, err = strconv.Atoi(parts[1]); err != nil {
-		return 0, 0, fmt.Errorf("failed to parse msgID %q: %w", parts[1], err)
+		return 0, 0, 0, fmt.Errorf("failed to parse msgID %q: %w", parts[1], err)
 	}
 
-	return userID, msgID, nil
+	chatID = a.primChatID
+	if len(parts) == 3 {
+		if chatID, err = strconv.ParseInt(parts[2], 10, 64); err != nil {
+			return 0, 0, 0, fmt.Errorf("failed to parse chatID %q: %w", parts[2], err)
+		}
+	}
+
+	return userID, msgID, chatID, nil
+}
+
+// chatOf returns chat ID of the message, falls back to the primary chat ID if the message has no chat
+func (a *admin) chatOf(msg *tbapi.Message) int64 {
+	if msg != nil && msg.Chat != nil && msg.Chat.ID != 0 {
+		return msg.Chat.ID
+	}
+	return a.primChatID
 }
 
 // extractUsername tries to extract the username from a ban message
@@ -1,7 +1,9 @@
 package events
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/stretchr/testify/assert"
@@ -9,6 +11,7 @@ import (
 
 	"github.com/umputun/tg-spam/app/bot"
 	"github.com/umputun/tg-spam/app/events/mocks"
+	"github.com/umputun/tg-spam/app/storage"
 )
 
 func TestAdmin_reportBan(t *testing.T) {
@@ -24,13 +27,15 @@ func TestAdmin_reportBan(t *testing.T) {
 	}
 
 	msg := &bot.Message{
+		ID: 789,
 		From: bot.User{
 			ID: 456,
 		},
-		Text: "Test\n\n_message_",
+		ChatID: -100555,
+		Text:   "Test\n\n_message_",
 	}
 
-	adm.ReportBan("testUser", msg)
+	adm.ReportBan("testUser", msg, "permanently banned")
 
 	require.Equal(t, 1, len(mockAPI.SendCalls()))
 	t.Logf("sent text: %+v", mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
@@ -40,6 +45,123 @@ func TestAdmin_reportBan(t *testing.T) {
 	assert.NotNil(t, mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).ReplyMarkup)
 	assert.Equal(t, "⛔︎ change ban",
 		mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).ReplyMarkup.(tbapi.InlineKeyboardMarkup).InlineKeyboard[0][0].Text)
+	assert.Equal(t, "?456:789:-100555",
+		*mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).ReplyMarkup.(tbapi.InlineKeyboardMarkup).InlineKeyboard[0][0].CallbackData)
+}
+
+func TestAdmin_reportBanWithPolicy(t *testing.T) {
+	mockAPI := &mocks.TbAPIMock{
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			return tbapi.Message{}, nil
+		},
+	}
+	adm := admin{tbAPI: mockAPI, adminChatID: 123, primChatID: 100}
+	msg := &bot.Message{ID: 789, From: bot.User{ID: 456}, Text: "spam text"}
+
+	adm.ReportBan("testUser", msg, "restricted for 1h0m0s, score: 1.00, previous offenses: 0")
+	require.Equal(t, 1, len(mockAPI.SendCalls()))
+	text := mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text
+	assert.Contains(t, text, "**restricted for 1h0m0s, score: 1.00, previous offenses: 0 [testUser](tg://user?id=456)**")
+
+	cleanMsg, err := adm.getCleanMessage(text)
+	require.NoError(t, err)
+	assert.Equal(t, "spam text", strings.TrimSpace(cleanMsg))
+}
+
+func TestAdmin_DirectWarnReportWithWarnings(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxWarnings  int
+		prevWarnings int
+		banned       bool
+		text         string
+	}{
+		{"no limit", 0, 5, false, "warning from admin\n\n@user warn text"},
+		{"first warning", 2, 0, false, "warning 1/2 from admin\n\n@user warn text"},
+		{"last warning", 2, 1, false, "warning 2/2 from admin\n\n@user warn text"},
+		{"limit reached", 2, 2, true, "@user banned by admin after 2 warnings"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAPI := &mocks.TbAPIMock{
+				SendFunc:    func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{}, nil },
+				RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) { return &tbapi.APIResponse{Ok: true}, nil },
+			}
+			warnings := &mocks.WarningsMock{
+				AddFunc:   func(entry storage.WarningInfo) error { return nil },
+				CountFunc: func(userID int64, since time.Time) (int, error) { return tt.prevWarnings, nil },
+			}
+			adm := admin{tbAPI: mockAPI, primChatID: 100, warnMsg: "warn text", warnings: warnings,
+				maxWarnings: tt.maxWarnings, warnExpiry: time.Hour}
+
+			upd := tbapi.Update{Message: &tbapi.Message{MessageID: 1, Chat: &tbapi.Chat{ID: 100}, Text: "/warn",
+				From:           &tbapi.User{UserName: "admin", ID: 1},
+				ReplyToMessage: &tbapi.Message{MessageID: 2, From: &tbapi.User{ID: 666, UserName: "user"}, Text: "bad text"}}}
+			require.NoError(t, adm.DirectWarnReport(upd))
+
+			require.Len(t, warnings.AddCalls(), 1)
+			assert.Equal(t, storage.WarningInfo{UserID: 666, UserName: "user", ChatID: 100, Text: "bad text", AdminName: "admin"},
+				warnings.AddCalls()[0].Entry)
+			require.Len(t, warnings.CountCalls(), 1)
+			assert.Equal(t, int64(666), warnings.CountCalls()[0].UserID)
+			assert.WithinDuration(t, time.Now().Add(-time.Hour), warnings.CountCalls()[0].Since, time.Minute)
+
+			require.Len(t, mockAPI.SendCalls(), 1)
+			assert.Equal(t, escapeMarkDownV1Text(tt.text), mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
+
+			requests := mockAPI.RequestCalls()
+			if tt.banned {
+				require.Len(t, requests, 3, "two deletes and ban")
+				banReq, ok := requests[2].C.(tbapi.BanChatMemberConfig)
+				require.True(t, ok)
+				assert.Equal(t, int64(666), banReq.UserID)
+				return
+			}
+			require.Len(t, requests, 2, "two deletes")
+		})
+	}
+}
+
+func TestAdmin_DirectSpamReportWithImage(t *testing.T) {
+	ts := testImageServer(t)
+	mockAPI := &mocks.TbAPIMock{
+		SendFunc:             func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{}, nil },
+		RequestFunc:          func(c tbapi.Chattable) (*tbapi.APIResponse, error) { return &tbapi.APIResponse{Ok: true}, nil },
+		GetFileDirectURLFunc: func(fileID string) (string, error) { return ts.URL + "/" + fileID, nil },
+	}
+	b := &mocks.BotMock{
+		RemoveApprovedUserFunc: func(id int64) error { return nil },
+		OnMessageFunc:          func(msg bot.Message) bot.Response { return bot.Response{} },
+		UpdateSpamFunc:         func(msg string) error { return nil },
+	}
+	spamImages := &mocks.SpamImagesMock{AddFunc: func(hash uint64, fileID string, userID int64) error { return nil }}
+	adm := admin{tbAPI: mockAPI, bot: b, primChatID: 100, spamImages: spamImages}
+
+	upd := tbapi.Update{Message: &tbapi.Message{MessageID: 1, Chat: &tbapi.Chat{ID: 100}, Text: "/spam",
+		From: &tbapi.User{UserName: "admin", ID: 1},
+		ReplyToMessage: &tbapi.Message{MessageID: 2, From: &tbapi.User{ID: 666, UserName: "user"}, Caption: "buy now",
+			Photo: []tbapi.PhotoSize{{FileID: "small.png"}, {FileID: "img.png"}}}}}
+	require.NoError(t, adm.DirectSpamReport(upd))
+
+	require.Len(t, spamImages.AddCalls(), 1)
+	assert.NotZero(t, spamImages.AddCalls()[0].Hash)
+	assert.Equal(t, "img.png", spamImages.AddCalls()[0].FileID, "the largest photo size used")
+	assert.Equal(t, int64(666), spamImages.AddCalls()[0].UserID)
+
+	t.Run("ban report doesn't add image", func(t *testing.T) {
+		spamImages.ResetCalls()
+		require.NoError(t, adm.DirectBanReport(upd))
+		assert.Empty(t, spamImages.AddCalls())
+	})
+
+	t.Run("no photo", func(t *testing.T) {
+		spamImages.ResetCalls()
+		upd.Message.ReplyToMessage.Photo = nil
+		upd.Message.ReplyToMessage.Text = "buy now"
+		require.NoError(t, adm.DirectSpamReport(upd))
+		assert.Empty(t, spamImages.AddCalls())
+	})
 }
 
 func TestAdmin_getCleanMessage(t *testing.T) {
@@ -122,29 +244,35 @@ func TestAdmin_parseCallbackData(t *testing.T) {
 		data       string
 		wantUserID int64
 		wantMsgID  int
+		wantChatID int64
 		wantErr    bool
 	}{
-		{"Valid data", "12345:678", 12345, 678, false},
-		{"Data too short", "12", 0, 0, true},
-		{"No colon separator", "12345678", 0, 0, true},
-		{"Invalid userID", "abc:678", 0, 0, true},
-		{"Invalid msgID", "12345:xyz", 0, 0, true},
-		{"wrong prefix with valid data", "c12345:678", 0, 0, true},
-		{"valid prefix+ with valid data", "+12345:678", 12345, 678, false},
-		{"valid prefix! with valid data", "!12345:678", 12345, 678, false},
-		{"valid prefix? with valid data", "?12345:678", 12345, 678, false},
+		{"Valid data", "12345:678", 12345, 678, 100, false},
+		{"Valid data with chat id", "12345:678:-100200", 12345, 678, -100200, false},
+		{"Data too short", "12", 0, 0, 0, true},
+		{"No colon separator", "12345678", 0, 0, 0, true},
+		{"Invalid userID", "abc:678", 0, 0, 0, true},
+		{"Invalid msgID", "12345:xyz", 0, 0, 0, true},
+		{"Invalid chatID", "12345:678:xyz", 0, 0, 0, true},
+		{"Too many parts", "12345:678:1:2", 0, 0, 0, true},
+		{"wrong prefix with valid data", "c12345:678", 0, 0, 0, true},
+		{"valid prefix+ with valid data", "+12345:678", 12345, 678, 100, false},
+		{"valid prefix! with valid data", "!12345:678", 12345, 678, 100, false},
+		{"valid prefix? with valid data", "?12345:678", 12345, 678, 100, false},
+		{"valid prefix? with valid data and chat id", "?12345:678:200", 12345, 678, 200, false},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			a := admin{}
-			gotUserID, gotMsgID, err := a.parseCallbackData(tt.data)
+			a := admin{primChatID: 100}
+			gotUserID, gotMsgID, gotChatID, err := a.parseCallbackData(tt.data)
 			if tt.wantErr {
 				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
 				assert.Equal(t, tt.wantUserID, gotUserID)
 				assert.Equal(t, tt.wantMsgID, gotMsgID)
+				assert.Equal(t, tt.wantChatID, gotChatID)
 			}
 		})
 	}
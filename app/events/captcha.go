@@ -0,0 +1,288 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+// captchaPrefix marks callback data of captcha challenge buttons, callback data: ~userID:answer
+const captchaPrefix = "~"
+
+// captcha is a helper to challenge new chat members before they can post, created by listener.
+// A new member is restricted and gets a challenge message with inline buttons. The correct answer lifts
+// the restriction, the wrong answer or no answer within the timeout kicks the member out of the chat.
+// Pending challenges are saved to the store, if set, and finished by restore after restart.
+type captcha struct {
+	tbAPI    TbAPI
+	bot      Bot
+	store    Challenges    // pending challenges storage, challenges kept in memory only if nil
+	timeout  time.Duration // time to answer the challenge
+	math     bool          // ask a simple math question instead of a single button press
+	approve  bool          // add members passed the challenge to approved users
+	dry      bool
+	training bool
+
+	lock    sync.Mutex
+	pending map[string]*challenge // pending challenges by chatID:userID
+}
+
+// challenge is a pending captcha challenge for a new member
+type challenge struct {
+	chatID   int64
+	userID   int64
+	userName string
+	msgID    int       // challenge message, deleted on answer or timeout
+	answer   string    // expected callback answer
+	expires  time.Time // the member is kicked at this time if not answered
+	timer    *time.Timer
+}
+
+// challengeKey returns the key of the challenge in pending map
+func challengeKey(chatID, userID int64) string {
+	return fmt.Sprintf("%d:%d", chatID, userID)
+}
+
+// NewMembers restricts new chat members and sends each of them a challenge, bots are skipped
+func (c *captcha) NewMembers(chatID int64, members []tbapi.User) error {
+	errs := new(multierror.Error)
+	for _, m := range members {
+		if m.IsBot {
+			continue
+		}
+		if err := c.challenge(chatID, m); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to challenge user %d: %w", m.ID, err))
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// challenge restricts the user and posts a challenge message with inline keyboard
+func (c *captcha) challenge(chatID int64, user tbapi.User) error {
+	userName := user.UserName
+	if userName == "" {
+		userName = strings.TrimSpace(user.FirstName + " " + user.LastName)
+	}
+	log.Printf("[INFO] captcha challenge for %q (%d) in %d", userName, user.ID, chatID)
+
+	if c.dry || c.training {
+		log.Printf("[INFO] dry run or training mode, captcha challenge for %d skipped", user.ID)
+		return nil
+	}
+
+	if err := c.restrict(chatID, user.ID, true); err != nil {
+		return fmt.Errorf("failed to restrict: %w", err)
+	}
+
+	question, answer, keyboard := c.makeChallenge(user.ID)
+	text := fmt.Sprintf("[%s](tg://user?id=%d), %s\n\nanswer within %v or you will be removed from the chat",
+		escapeMarkDownV1Text(userName), user.ID, question, c.timeout)
+	tbMsg := tbapi.NewMessage(chatID, text)
+	tbMsg.ParseMode = tbapi.ModeMarkdown
+	tbMsg.ReplyMarkup = keyboard
+	resp, err := c.tbAPI.Send(tbMsg)
+	if err != nil {
+		return fmt.Errorf("failed to send challenge: %w", err)
+	}
+
+	ch := &challenge{chatID: chatID, userID: user.ID, userName: userName, msgID: resp.MessageID, answer: answer,
+		expires: time.Now().Add(c.timeout)}
+	if c.store != nil {
+		if err := c.store.Add(storage.ChallengeInfo{ChatID: chatID, UserID: user.ID, UserName: userName, MsgID: ch.msgID,
+			Answer: answer, Expires: ch.expires}); err != nil {
+			log.Printf("[WARN] failed to save captcha challenge for %d: %v", user.ID, err)
+		}
+	}
+	if prev := c.arm(ch); prev != nil {
+		// rejoined before the previous challenge expired, its message is not needed anymore
+		if _, err := c.tbAPI.Request(tbapi.DeleteMessageConfig{ChatID: chatID, MessageID: prev.msgID}); err != nil {
+			log.Printf("[WARN] failed to delete previous challenge message %d: %v", prev.msgID, err)
+		}
+	}
+	return nil
+}
+
+// arm sets the timer of the challenge and adds it to pending ones.
+// Returns the previous pending challenge of the same user in the same chat, nil if there was none.
+func (c *captcha) arm(ch *challenge) (prev *challenge) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.pending == nil {
+		c.pending = make(map[string]*challenge)
+	}
+	if p, ok := c.pending[challengeKey(ch.chatID, ch.userID)]; ok {
+		p.timer.Stop()
+		prev = p
+	}
+	ch.timer = time.AfterFunc(time.Until(ch.expires), func() { c.expire(ch) })
+	c.pending[challengeKey(ch.chatID, ch.userID)] = ch
+	return prev
+}
+
+// restore re-arms challenges saved before restart, the expired ones are finished right away
+func (c *captcha) restore() error {
+	if c.store == nil {
+		return nil
+	}
+	entries, err := c.store.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read pending challenges: %w", err)
+	}
+	for _, e := range entries {
+		c.arm(&challenge{chatID: e.ChatID, userID: e.UserID, userName: e.UserName, msgID: e.MsgID, answer: e.Answer,
+			expires: e.Expires})
+	}
+	if len(entries) > 0 {
+		log.Printf("[INFO] restored %d pending captcha challenges", len(entries))
+	}
+	return nil
+}
+
+// forget removes the finished challenge from the store. The stored challenge is removed only if it is the same one,
+// as the user could rejoin and get a new challenge after this one was finished.
+func (c *captcha) forget(ch *challenge) {
+	if c.store == nil {
+		return
+	}
+	if err := c.store.Delete(ch.chatID, ch.userID, ch.msgID); err != nil {
+		log.Printf("[WARN] failed to delete captcha challenge for %d: %v", ch.userID, err)
+	}
+}
+
+// makeChallenge returns the question, expected answer and keyboard for the user.
+// In math mode the question is a sum of two numbers with a few answer options, otherwise a single button.
+func (c *captcha) makeChallenge(userID int64) (question, answer string, keyboard tbapi.InlineKeyboardMarkup) {
+	button := func(text, ans string) tbapi.InlineKeyboardButton {
+		return tbapi.NewInlineKeyboardButtonData(text, fmt.Sprintf("%s%d:%s", captchaPrefix, userID, ans))
+	}
+
+	if !c.math {
+		return "please press the button to confirm you are not a bot", "ok",
+			tbapi.NewInlineKeyboardMarkup(tbapi.NewInlineKeyboardRow(button("I'm not a bot", "ok")))
+	}
+
+	a, b := rand.IntN(9)+2, rand.IntN(9)+2 //nolint:gosec // no need for crypto rand here
+	sum := a + b
+	options := []int{sum, sum + 1 + rand.IntN(3), sum - 1 - rand.IntN(3), sum + 4 + rand.IntN(3)} //nolint:gosec
+	rand.Shuffle(len(options), func(i, j int) { options[i], options[j] = options[j], options[i] })
+	row := make([]tbapi.InlineKeyboardButton, 0, len(options))
+	for _, o := range options {
+		row = append(row, button(strconv.Itoa(o), strconv.Itoa(o)))
+	}
+	return fmt.Sprintf("please answer: %d + %d = ?", a, b), strconv.Itoa(sum), tbapi.NewInlineKeyboardMarkup(row)
+}
+
+// CallbackHandler handles the answer to the challenge, callback data: ~userID:answer
+func (c *captcha) CallbackHandler(query *tbapi.CallbackQuery) error {
+	userIDStr, answer, found := strings.Cut(strings.TrimPrefix(query.Data, captchaPrefix), ":")
+	if !found {
+		return fmt.Errorf("unexpected captcha callback data %q", query.Data)
+	}
+	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse user id %q: %w", userIDStr, err)
+	}
+
+	if query.From == nil || query.From.ID != userID { // someone else pressed the button
+		if _, err := c.tbAPI.Request(tbapi.NewCallback(query.ID, "this challenge is not for you")); err != nil {
+			log.Printf("[DEBUG] failed to answer callback: %v", err)
+		}
+		return nil
+	}
+
+	if query.Message == nil { // the challenge message is too old or inaccessible, can't find the chat
+		return fmt.Errorf("no message in captcha callback from user %d", userID)
+	}
+	chatID := query.Message.Chat.ID
+	c.lock.Lock()
+	ch, ok := c.pending[challengeKey(chatID, userID)]
+	if ok {
+		ch.timer.Stop()
+		delete(c.pending, challengeKey(chatID, userID))
+	}
+	c.lock.Unlock()
+	if !ok {
+		return fmt.Errorf("no pending challenge for user %d in %d", userID, chatID)
+	}
+	c.forget(ch)
+
+	if answer != ch.answer {
+		log.Printf("[INFO] captcha failed by %q (%d), wrong answer %q", ch.userName, userID, answer)
+		if _, err := c.tbAPI.Request(tbapi.NewCallback(query.ID, "wrong answer")); err != nil {
+			log.Printf("[DEBUG] failed to answer callback: %v", err)
+		}
+		return c.kick(ch)
+	}
+
+	log.Printf("[INFO] captcha passed by %q (%d)", ch.userName, userID)
+	errs := new(multierror.Error)
+	if _, err := c.tbAPI.Request(tbapi.NewCallback(query.ID, "welcome!")); err != nil {
+		log.Printf("[DEBUG] failed to answer callback: %v", err)
+	}
+	if err := c.restrict(chatID, userID, false); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("failed to lift restrictions for user %d: %w", userID, err))
+	}
+	if _, err := c.tbAPI.Request(tbapi.DeleteMessageConfig{ChatID: chatID, MessageID: ch.msgID}); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("failed to delete challenge message %d: %w", ch.msgID, err))
+	}
+	if c.approve {
+		if err := c.bot.AddApprovedUser(userID, ch.userName); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to approve user %d: %w", userID, err))
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// expire kicks the user who didn't answer the challenge in time
+func (c *captcha) expire(ch *challenge) {
+	c.lock.Lock()
+	if c.pending[challengeKey(ch.chatID, ch.userID)] != ch { // answered or replaced by a new challenge
+		c.lock.Unlock()
+		return
+	}
+	delete(c.pending, challengeKey(ch.chatID, ch.userID))
+	c.lock.Unlock()
+	c.forget(ch)
+
+	log.Printf("[INFO] captcha timeout for %q (%d)", ch.userName, ch.userID)
+	if err := c.kick(ch); err != nil {
+		log.Printf("[WARN] failed to kick user %d: %v", ch.userID, err)
+	}
+}
+
+// kick removes the user from the chat without a permanent ban and deletes the challenge message
+func (c *captcha) kick(ch *challenge) error {
+	errs := new(multierror.Error)
+	if _, err := c.tbAPI.Request(tbapi.DeleteMessageConfig{ChatID: ch.chatID, MessageID: ch.msgID}); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("failed to delete challenge message %d: %w", ch.msgID, err))
+	}
+	// ban with immediate unban removes the user from the chat but allows to join again
+	member := tbapi.ChatMemberConfig{ChatID: ch.chatID, UserID: ch.userID}
+	if _, err := c.tbAPI.Request(tbapi.BanChatMemberConfig{ChatMemberConfig: member, UntilDate: time.Now().Add(time.Minute).Unix()}); err != nil {
+		return multierror.Append(errs, fmt.Errorf("failed to kick user %d: %w", ch.userID, err)).ErrorOrNil()
+	}
+	if _, err := c.tbAPI.Request(tbapi.UnbanChatMemberConfig{ChatMemberConfig: member, OnlyIfBanned: true}); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("failed to unban kicked user %d: %w", ch.userID, err))
+	}
+	log.Printf("[INFO] user %q (%d) kicked from %d", ch.userName, ch.userID, ch.chatID)
+	return errs.ErrorOrNil()
+}
+
+// restrict sets or lifts restrictions for the user in the chat
+func (c *captcha) restrict(chatID, userID int64, restricted bool) error {
+	_, err := c.tbAPI.Request(tbapi.RestrictChatMemberConfig{
+		ChatMemberConfig: tbapi.ChatMemberConfig{ChatID: chatID, UserID: userID},
+		Permissions: &tbapi.ChatPermissions{CanSendMessages: !restricted, CanSendMediaMessages: !restricted,
+			CanSendOtherMessages: !restricted, CanSendPolls: !restricted},
+	})
+	return err
+}
@@ -0,0 +1,214 @@
+package events
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/events/mocks"
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+func TestCaptcha_NewMembersAndPass(t *testing.T) {
+	mockAPI := &mocks.TbAPIMock{
+		SendFunc:    func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{MessageID: 42}, nil },
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) { return &tbapi.APIResponse{Ok: true}, nil },
+	}
+	b := &mocks.BotMock{AddApprovedUserFunc: func(id int64, name string) error { return nil }}
+	c := &captcha{tbAPI: mockAPI, bot: b, timeout: time.Minute, approve: true}
+
+	err := c.NewMembers(100, []tbapi.User{{ID: 1, UserName: "user1"}, {ID: 2, UserName: "bot", IsBot: true}})
+	require.NoError(t, err)
+
+	require.Len(t, mockAPI.RequestCalls(), 1, "restricted, bot skipped")
+	restrict := mockAPI.RequestCalls()[0].C.(tbapi.RestrictChatMemberConfig)
+	assert.Equal(t, int64(1), restrict.UserID)
+	assert.False(t, restrict.Permissions.CanSendMessages)
+
+	require.Len(t, mockAPI.SendCalls(), 1)
+	msg := mockAPI.SendCalls()[0].C.(tbapi.MessageConfig)
+	assert.Equal(t, int64(100), msg.ChatID)
+	assert.Contains(t, msg.Text, "[user1](tg://user?id=1), please press the button")
+	kb := msg.ReplyMarkup.(tbapi.InlineKeyboardMarkup)
+	require.Len(t, kb.InlineKeyboard, 1)
+	require.Len(t, kb.InlineKeyboard[0], 1)
+	assert.Equal(t, "~1:ok", *kb.InlineKeyboard[0][0].CallbackData)
+
+	t.Run("pressed by another user", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		err = c.CallbackHandler(&tbapi.CallbackQuery{ID: "q1", Data: "~1:ok", From: &tbapi.User{ID: 3},
+			Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 100}}})
+		require.NoError(t, err)
+		require.Len(t, mockAPI.RequestCalls(), 1)
+		assert.Equal(t, "this challenge is not for you", mockAPI.RequestCalls()[0].C.(tbapi.CallbackConfig).Text)
+		assert.Empty(t, b.AddApprovedUserCalls())
+	})
+
+	t.Run("passed", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		err = c.CallbackHandler(&tbapi.CallbackQuery{ID: "q2", Data: "~1:ok", From: &tbapi.User{ID: 1},
+			Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 100}}})
+		require.NoError(t, err)
+		require.Len(t, mockAPI.RequestCalls(), 3)
+		assert.Equal(t, "welcome!", mockAPI.RequestCalls()[0].C.(tbapi.CallbackConfig).Text)
+		assert.True(t, mockAPI.RequestCalls()[1].C.(tbapi.RestrictChatMemberConfig).Permissions.CanSendMessages)
+		assert.Equal(t, 42, mockAPI.RequestCalls()[2].C.(tbapi.DeleteMessageConfig).MessageID)
+		require.Len(t, b.AddApprovedUserCalls(), 1)
+		assert.Equal(t, int64(1), b.AddApprovedUserCalls()[0].ID)
+		assert.Equal(t, "user1", b.AddApprovedUserCalls()[0].Name)
+	})
+
+	t.Run("no message", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		err = c.CallbackHandler(&tbapi.CallbackQuery{ID: "q4", Data: "~1:ok", From: &tbapi.User{ID: 1}})
+		assert.EqualError(t, err, "no message in captcha callback from user 1")
+		assert.Empty(t, mockAPI.RequestCalls())
+	})
+
+	t.Run("no pending challenge", func(t *testing.T) {
+		err = c.CallbackHandler(&tbapi.CallbackQuery{ID: "q3", Data: "~1:ok", From: &tbapi.User{ID: 1},
+			Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 100}}})
+		assert.EqualError(t, err, "no pending challenge for user 1 in 100")
+	})
+}
+
+func TestCaptcha_MathWrongAnswer(t *testing.T) {
+	mockAPI := &mocks.TbAPIMock{
+		SendFunc:    func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{MessageID: 42}, nil },
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) { return &tbapi.APIResponse{Ok: true}, nil },
+	}
+	b := &mocks.BotMock{}
+	c := &captcha{tbAPI: mockAPI, bot: b, timeout: time.Minute, math: true, approve: true}
+
+	require.NoError(t, c.NewMembers(100, []tbapi.User{{ID: 1, FirstName: "John", LastName: "Doe"}}))
+	require.Len(t, mockAPI.SendCalls(), 1)
+	msg := mockAPI.SendCalls()[0].C.(tbapi.MessageConfig)
+	assert.Contains(t, msg.Text, "[John Doe](tg://user?id=1), please answer: ")
+	kb := msg.ReplyMarkup.(tbapi.InlineKeyboardMarkup)
+	require.Len(t, kb.InlineKeyboard[0], 4)
+
+	wrong := ""
+	for _, btn := range kb.InlineKeyboard[0] {
+		if !strings.HasSuffix(*btn.CallbackData, ":"+c.pending["100:1"].answer) {
+			wrong = *btn.CallbackData
+			break
+		}
+	}
+	require.NotEmpty(t, wrong)
+
+	mockAPI.ResetCalls()
+	err := c.CallbackHandler(&tbapi.CallbackQuery{ID: "q1", Data: wrong, From: &tbapi.User{ID: 1},
+		Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 100}}})
+	require.NoError(t, err)
+	require.Len(t, mockAPI.RequestCalls(), 4, "answer callback, delete challenge, ban and unban")
+	assert.Equal(t, "wrong answer", mockAPI.RequestCalls()[0].C.(tbapi.CallbackConfig).Text)
+	assert.Equal(t, 42, mockAPI.RequestCalls()[1].C.(tbapi.DeleteMessageConfig).MessageID)
+	assert.Equal(t, int64(1), mockAPI.RequestCalls()[2].C.(tbapi.BanChatMemberConfig).UserID)
+	assert.True(t, mockAPI.RequestCalls()[3].C.(tbapi.UnbanChatMemberConfig).OnlyIfBanned)
+	assert.Empty(t, b.AddApprovedUserCalls())
+}
+
+func TestCaptcha_Rejoin(t *testing.T) {
+	msgID := 41
+	mockAPI := &mocks.TbAPIMock{
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			msgID++
+			return tbapi.Message{MessageID: msgID}, nil
+		},
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) { return &tbapi.APIResponse{Ok: true}, nil },
+	}
+	c := &captcha{tbAPI: mockAPI, bot: &mocks.BotMock{}, timeout: time.Minute}
+
+	require.NoError(t, c.NewMembers(100, []tbapi.User{{ID: 1, UserName: "user1"}}))
+	require.NoError(t, c.NewMembers(100, []tbapi.User{{ID: 1, UserName: "user1"}}))
+	require.Len(t, mockAPI.RequestCalls(), 3, "restrict, restrict again and delete the previous challenge")
+	assert.Equal(t, 42, mockAPI.RequestCalls()[2].C.(tbapi.DeleteMessageConfig).MessageID)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	require.Len(t, c.pending, 1)
+	assert.Equal(t, 43, c.pending["100:1"].msgID)
+}
+
+func TestCaptcha_Store(t *testing.T) {
+	mockAPI := &mocks.TbAPIMock{
+		SendFunc:    func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{MessageID: 42}, nil },
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) { return &tbapi.APIResponse{Ok: true}, nil },
+	}
+	store := &mocks.ChallengesMock{
+		AddFunc:    func(entry storage.ChallengeInfo) error { return nil },
+		DeleteFunc: func(chatID, userID int64, msgID int) error { return nil },
+		ReadFunc: func() ([]storage.ChallengeInfo, error) {
+			return []storage.ChallengeInfo{
+				{ChatID: 100, UserID: 2, UserName: "expired", MsgID: 10, Answer: "ok", Expires: time.Now().Add(-time.Minute)},
+				{ChatID: 100, UserID: 3, UserName: "pending", MsgID: 11, Answer: "ok", Expires: time.Now().Add(time.Minute)},
+			}, nil
+		},
+	}
+	c := &captcha{tbAPI: mockAPI, bot: &mocks.BotMock{}, store: store, timeout: time.Minute}
+
+	t.Run("challenge saved and deleted on answer", func(t *testing.T) {
+		require.NoError(t, c.NewMembers(100, []tbapi.User{{ID: 1, UserName: "user1"}}))
+		require.Len(t, store.AddCalls(), 1)
+		entry := store.AddCalls()[0].Entry
+		assert.Equal(t, storage.ChallengeInfo{ChatID: 100, UserID: 1, UserName: "user1", MsgID: 42, Answer: "ok",
+			Expires: entry.Expires}, entry)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), entry.Expires, time.Second)
+
+		require.NoError(t, c.CallbackHandler(&tbapi.CallbackQuery{ID: "q1", Data: "~1:ok", From: &tbapi.User{ID: 1},
+			Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 100}}}))
+		require.Len(t, store.DeleteCalls(), 1)
+		assert.Equal(t, int64(1), store.DeleteCalls()[0].UserID)
+		assert.Equal(t, 42, store.DeleteCalls()[0].MsgID, "deleted only if not replaced by a new challenge")
+	})
+
+	t.Run("restored after restart", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		store.ResetCalls()
+		require.NoError(t, c.restore())
+		require.Eventually(t, func() bool { return len(store.DeleteCalls()) == 1 }, time.Second, 10*time.Millisecond,
+			"expired challenge finished")
+		assert.Equal(t, int64(2), store.DeleteCalls()[0].UserID)
+		assert.Equal(t, 10, store.DeleteCalls()[0].MsgID)
+		require.Eventually(t, func() bool { return len(mockAPI.RequestCalls()) == 3 }, time.Second, 10*time.Millisecond)
+		assert.Equal(t, 10, mockAPI.RequestCalls()[0].C.(tbapi.DeleteMessageConfig).MessageID)
+		assert.Equal(t, int64(2), mockAPI.RequestCalls()[1].C.(tbapi.BanChatMemberConfig).UserID)
+
+		c.lock.Lock()
+		require.Len(t, c.pending, 1)
+		assert.Equal(t, 11, c.pending["100:3"].msgID)
+		c.lock.Unlock()
+
+		require.NoError(t, c.CallbackHandler(&tbapi.CallbackQuery{ID: "q2", Data: "~3:ok", From: &tbapi.User{ID: 3},
+			Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 100}}}), "restored challenge answered")
+	})
+}
+
+func TestCaptcha_Timeout(t *testing.T) {
+	mockAPI := &mocks.TbAPIMock{
+		SendFunc:    func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{MessageID: 42}, nil },
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) { return &tbapi.APIResponse{Ok: true}, nil },
+	}
+	c := &captcha{tbAPI: mockAPI, bot: &mocks.BotMock{}, timeout: 50 * time.Millisecond}
+
+	require.NoError(t, c.NewMembers(100, []tbapi.User{{ID: 1, UserName: "user1"}}))
+	require.Eventually(t, func() bool { return len(mockAPI.RequestCalls()) == 4 }, time.Second, 10*time.Millisecond,
+		"restrict, then delete challenge, ban and unban on timeout")
+	assert.Equal(t, int64(1), mockAPI.RequestCalls()[2].C.(tbapi.BanChatMemberConfig).UserID)
+
+	c.lock.Lock()
+	assert.Empty(t, c.pending)
+	c.lock.Unlock()
+}
+
+func TestCaptcha_DryRun(t *testing.T) {
+	mockAPI := &mocks.TbAPIMock{}
+	c := &captcha{tbAPI: mockAPI, bot: &mocks.BotMock{}, timeout: time.Minute, dry: true}
+	require.NoError(t, c.NewMembers(100, []tbapi.User{{ID: 1, UserName: "user1"}}))
+	assert.Empty(t, mockAPI.RequestCalls())
+	assert.Empty(t, mockAPI.SendCalls())
+}
@@ -2,7 +2,9 @@ package events
 
 import (
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"strings"
 	"time"
 
@@ -11,11 +13,20 @@ import (
 	"github.com/umputun/tg-spam/app/bot"
 	"github.com/umputun/tg-spam/app/storage"
 	"github.com/umputun/tg-spam/lib/spamcheck"
+	"github.com/umputun/tg-spam/lib/tgspam"
 )
 
 //go:generate moq --out mocks/tb_api.go --pkg mocks --with-resets --skip-ensure . TbAPI
 //go:generate moq --out mocks/spam_logger.go --pkg mocks --with-resets --skip-ensure . SpamLogger
 //go:generate moq --out mocks/bot.go --pkg mocks --with-resets --skip-ensure . Bot
+//go:generate moq --out mocks/warnings.go --pkg mocks --with-resets --skip-ensure . Warnings
+//go:generate moq --out mocks/spam_images.go --pkg mocks --with-resets --skip-ensure . SpamImages
+//go:generate moq --out mocks/decisions.go --pkg mocks --with-resets --skip-ensure . Decisions
+//go:generate moq --out mocks/tuner.go --pkg mocks --with-resets --skip-ensure . Tuner
+//go:generate moq --out mocks/challenges.go --pkg mocks --with-resets --skip-ensure . Challenges
+
+// maxImageSize is the maximum size of the image downloaded for hashing
+const maxImageSize = 20 * 1024 * 1024
 
 // TbAPI is an interface for telegram bot API, only subset of methods used
 type TbAPI interface {
@@ -24,6 +35,7 @@ type TbAPI interface {
 	Request(c tbapi.Chattable) (*tbapi.APIResponse, error)
 	GetChat(config tbapi.ChatInfoConfig) (tbapi.Chat, error)
 	GetChatAdministrators(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error)
+	GetFileDirectURL(fileID string) (string, error)
 }
 
 // SpamLogger is an interface for spam logger
@@ -49,14 +61,44 @@ type Locator interface {
 	UserNameByID(userID int64) string
 }
 
+// Warnings is an interface for warnings storage, used to count warnings issued to users
+type Warnings interface {
+	Add(entry storage.WarningInfo) error
+	Count(userID int64, since time.Time) (int, error)
+}
+
+// Challenges is an interface for pending captcha challenges storage, used to finish challenges after restart
+type Challenges interface {
+	Add(entry storage.ChallengeInfo) error
+	Delete(chatID, userID int64, msgID int) error
+	Read() ([]storage.ChallengeInfo, error)
+}
+
+// SpamImages is an interface for known spam images storage, used to add hashes of images reported as spam
+type SpamImages interface {
+	Add(hash uint64, fileID string, userID int64) error
+}
+
+// Decisions is an interface for moderator decisions storage, used to record admin decisions on detected spam
+type Decisions interface {
+	Add(entry storage.DecisionInfo) error
+	Read() ([]storage.DecisionInfo, error)
+}
+
+// Tuner is an interface for detector thresholds tuner, suggesting thresholds from moderator decisions
+type Tuner interface {
+	Tune(decisions []bot.Decision) (bot.TuneResult, bool)
+}
+
 // Bot is an interface for bot events.
 type Bot interface {
 	OnMessage(msg bot.Message) (response bot.Response)
+	VerifyLLM(msg bot.Message, resp bot.Response) bot.Response
 	UpdateSpam(msg string) error
 	UpdateHam(msg string) error
 	AddApprovedUser(id int64, name string) error
 	RemoveApprovedUser(id int64) error
-	IsApprovedUser(userID int64) bool
+	IsApprovedUser(chatID, userID int64) bool
 }
 
 func escapeMarkDownV1Text(text string) string {
@@ -96,6 +138,73 @@ func send(tbMsg tbapi.Chattable, tbAPI TbAPI) error {
 	return nil
 }
 
+// imageHash downloads the image by telegram file id and returns its perceptual hash
+func imageHash(tbAPI TbAPI, fileID string) (uint64, error) {
+	fileURL, err := tbAPI.GetFileDirectURL(fileID)
+	if err != nil {
+		return 0, fmt.Errorf("can't get url of file %s: %w", fileID, err)
+	}
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(fileURL)
+	if err != nil {
+		return 0, fmt.Errorf("can't download file %s: %w", fileID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("can't download file %s, status %d", fileID, resp.StatusCode)
+	}
+	return tgspam.ImageHash(io.LimitReader(resp.Body, maxImageSize))
+}
+
+// transformDocument makes a document from any file attached to the message, except photos and stickers
+func transformDocument(msg *tbapi.Message) *bot.Document {
+	switch {
+	case msg.Document != nil:
+		return &bot.Document{FileID: msg.Document.FileID, Type: "document", FileName: msg.Document.FileName,
+			MimeType: msg.Document.MimeType}
+	case msg.Video != nil:
+		return &bot.Document{FileID: msg.Video.FileID, Type: "video", FileName: msg.Video.FileName, MimeType: msg.Video.MimeType}
+	case msg.Animation != nil:
+		return &bot.Document{FileID: msg.Animation.FileID, Type: "animation", FileName: msg.Animation.FileName,
+			MimeType: msg.Animation.MimeType}
+	case msg.Audio != nil:
+		return &bot.Document{FileID: msg.Audio.FileID, Type: "audio", FileName: msg.Audio.FileName,
+			MimeType: msg.Audio.MimeType, Title: strings.TrimSpace(msg.Audio.Performer + " " + msg.Audio.Title)}
+	case msg.Voice != nil:
+		return &bot.Document{FileID: msg.Voice.FileID, Type: "voice", MimeType: msg.Voice.MimeType}
+	case msg.VideoNote != nil:
+		return &bot.Document{FileID: msg.VideoNote.FileID, Type: "video_note"}
+	}
+	return nil
+}
+
+// withExtractedText returns the message text with the text of the attached document, poll, contact and sticker
+// appended, one per line. This way all the message types are checked for spam and located by the text.
+func withExtractedText(msg bot.Message) string {
+	parts := []string{msg.Text}
+	if msg.Document != nil {
+		parts = append(parts, msg.Document.Title, msg.Document.FileName)
+	}
+	if msg.Poll != nil {
+		parts = append(parts, msg.Poll.Question)
+		parts = append(parts, msg.Poll.Options...)
+	}
+	if msg.Contact != nil {
+		parts = append(parts, msg.Contact.Name, msg.Contact.PhoneNumber)
+	}
+	if msg.Sticker != nil {
+		parts = append(parts, msg.Sticker.Emoji)
+	}
+
+	res := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if strings.TrimSpace(p) != "" {
+			res = append(res, p)
+		}
+	}
+	return strings.Join(res, "\n")
+}
+
 type banRequest struct {
 	tbAPI TbAPI
 
@@ -254,6 +363,25 @@ func transform(msg *tbapi.Message) *bot.Message {
 		}
 	}
 
+	if msg.ForwardFromChat != nil {
+		message.ForwardFromChat = bot.SenderChat{
+			ID:       msg.ForwardFromChat.ID,
+			Type:     msg.ForwardFromChat.Type,
+			UserName: msg.ForwardFromChat.UserName,
+		}
+	}
+
+	// collect urls of inline keyboard buttons, spam sent via inline bots often has links in buttons
+	if msg.ReplyMarkup != nil {
+		for _, row := range msg.ReplyMarkup.InlineKeyboard {
+			for _, btn := range row {
+				if btn.URL != nil && *btn.URL != "" {
+					message.ButtonURLs = append(message.ButtonURLs, *btn.URL)
+				}
+			}
+		}
+	}
+
 	switch {
 	case len(msg.Entities) > 0:
 		message.Entities = transformEntities(msg.Entities)
@@ -273,6 +401,34 @@ func transform(msg *tbapi.Message) *bot.Message {
 		}
 	}
 
+	// media other than photos, the caption used as the message text
+	if message.Document = transformDocument(msg); message.Document != nil && message.Text == "" {
+		message.Text = msg.Caption
+		message.Entities = transformEntities(msg.CaptionEntities)
+	}
+
+	if msg.Poll != nil {
+		message.Poll = &bot.Poll{Question: msg.Poll.Question}
+		for _, o := range msg.Poll.Options {
+			message.Poll.Options = append(message.Poll.Options, o.Text)
+		}
+	}
+
+	if msg.Contact != nil {
+		message.Contact = &bot.Contact{
+			PhoneNumber: msg.Contact.PhoneNumber,
+			Name:        strings.TrimSpace(msg.Contact.FirstName + " " + msg.Contact.LastName),
+			UserID:      msg.Contact.UserID,
+			VCard:       msg.Contact.VCard,
+		}
+	}
+
+	if msg.Sticker != nil {
+		message.Sticker = &bot.Sticker{FileID: msg.Sticker.FileID, Emoji: msg.Sticker.Emoji, SetName: msg.Sticker.SetName}
+	}
+
+	message.Text = withExtractedText(message)
+
 	// fill in the message's reply-to message
 	if msg.ReplyToMessage != nil {
 		message.ReplyTo.Text = msg.ReplyToMessage.Text
@@ -1,12 +1,19 @@
 package events
 
 import (
+	"bytes"
 	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/umputun/tg-spam/app/bot"
 	"github.com/umputun/tg-spam/app/events/mocks"
@@ -210,3 +217,136 @@ func TestTelegramListener__transformEntities(t *testing.T) {
 		),
 	)
 }
+
+func TestTelegramListener_transformForwardAndButtons(t *testing.T) {
+	url1, url2 := "https://example.com/1", "https://example.com/2"
+	assert.Equal(t,
+		&bot.Message{
+			Sent:            time.Unix(1578627415, 0),
+			Text:            "forwarded message",
+			ForwardFromChat: bot.SenderChat{ID: -100123, Type: "channel", UserName: "channel"},
+			ButtonURLs:      []string{url1, url2},
+			Entities:        &[]bot.Entity{{Type: "text_link", Offset: 0, Length: 9, URL: "https://example.com/hidden"}},
+		},
+		transform(
+			&tbapi.Message{
+				Date:            1578627415,
+				Text:            "forwarded message",
+				ForwardFromChat: &tbapi.Chat{ID: -100123, Type: "channel", UserName: "channel"},
+				Entities:        []tbapi.MessageEntity{{Type: "text_link", Offset: 0, Length: 9, URL: "https://example.com/hidden"}},
+				ReplyMarkup: &tbapi.InlineKeyboardMarkup{InlineKeyboard: [][]tbapi.InlineKeyboardButton{
+					{{Text: "btn1", URL: &url1}, {Text: "callback", CallbackData: &url2}},
+					{{Text: "btn2", URL: &url2}},
+				}},
+			},
+		),
+	)
+}
+
+func TestTelegramListener_transformMedia(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *tbapi.Message
+		exp  *bot.Message
+	}{
+		{
+			name: "video with caption",
+			msg: &tbapi.Message{Caption: "watch this", CaptionEntities: []tbapi.MessageEntity{{Type: "url", Offset: 0, Length: 5}},
+				Video: &tbapi.Video{FileID: "v1", FileName: "promo.mp4", MimeType: "video/mp4"}},
+			exp: &bot.Message{Text: "watch this\npromo.mp4", Entities: &[]bot.Entity{{Type: "url", Offset: 0, Length: 5}},
+				Document: &bot.Document{FileID: "v1", Type: "video", FileName: "promo.mp4", MimeType: "video/mp4"}},
+		},
+		{
+			name: "document without caption",
+			msg:  &tbapi.Message{Document: &tbapi.Document{FileID: "d1", FileName: "free-crypto.apk"}},
+			exp:  &bot.Message{Text: "free-crypto.apk", Document: &bot.Document{FileID: "d1", Type: "document", FileName: "free-crypto.apk"}},
+		},
+		{
+			name: "voice with caption",
+			msg:  &tbapi.Message{Caption: "listen", Voice: &tbapi.Voice{FileID: "vc1", MimeType: "audio/ogg"}},
+			exp:  &bot.Message{Text: "listen", Document: &bot.Document{FileID: "vc1", Type: "voice", MimeType: "audio/ogg"}},
+		},
+		{
+			name: "audio",
+			msg:  &tbapi.Message{Audio: &tbapi.Audio{FileID: "a1", Performer: "spammer", Title: "earn $$$"}},
+			exp:  &bot.Message{Text: "spammer earn $$$", Document: &bot.Document{FileID: "a1", Type: "audio", Title: "spammer earn $$$"}},
+		},
+		{
+			name: "poll",
+			msg: &tbapi.Message{Poll: &tbapi.Poll{Question: "want to earn?",
+				Options: []tbapi.PollOption{{Text: "yes, dm me"}, {Text: "no"}}}},
+			exp: &bot.Message{Text: "want to earn?\nyes, dm me\nno",
+				Poll: &bot.Poll{Question: "want to earn?", Options: []string{"yes, dm me", "no"}}},
+		},
+		{
+			name: "contact",
+			msg:  &tbapi.Message{Contact: &tbapi.Contact{PhoneNumber: "+123456", FirstName: "Best", LastName: "Offer", UserID: 42}},
+			exp: &bot.Message{Text: "Best Offer\n+123456",
+				Contact: &bot.Contact{PhoneNumber: "+123456", Name: "Best Offer", UserID: 42}},
+		},
+		{
+			name: "sticker",
+			msg:  &tbapi.Message{Sticker: &tbapi.Sticker{FileID: "s1", Emoji: "🔥", SetName: "hot"}},
+			exp:  &bot.Message{Text: "🔥", Sticker: &bot.Sticker{FileID: "s1", Emoji: "🔥", SetName: "hot"}},
+		},
+		{
+			name: "video note without text",
+			msg:  &tbapi.Message{VideoNote: &tbapi.VideoNote{FileID: "vn1"}},
+			exp:  &bot.Message{Document: &bot.Document{FileID: "vn1", Type: "video_note"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.exp.Sent = time.Unix(0, 0)
+			assert.Equal(t, tt.exp, transform(tt.msg))
+		})
+	}
+}
+
+func TestEvents_imageHash(t *testing.T) {
+	ts := testImageServer(t)
+
+	t.Run("hashed", func(t *testing.T) {
+		mockAPI := &mocks.TbAPIMock{GetFileDirectURLFunc: func(fileID string) (string, error) { return ts.URL + "/" + fileID, nil }}
+		hash, err := imageHash(mockAPI, "img.png")
+		require.NoError(t, err)
+		assert.NotZero(t, hash)
+		require.Len(t, mockAPI.GetFileDirectURLCalls(), 1)
+		assert.Equal(t, "img.png", mockAPI.GetFileDirectURLCalls()[0].FileID)
+	})
+
+	t.Run("no file url", func(t *testing.T) {
+		mockAPI := &mocks.TbAPIMock{GetFileDirectURLFunc: func(fileID string) (string, error) { return "", errors.New("no file") }}
+		_, err := imageHash(mockAPI, "img.png")
+		assert.EqualError(t, err, "can't get url of file img.png: no file")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mockAPI := &mocks.TbAPIMock{GetFileDirectURLFunc: func(fileID string) (string, error) { return ts.URL + "/bad", nil }}
+		_, err := imageHash(mockAPI, "bad")
+		assert.EqualError(t, err, "can't download file bad, status 404")
+	})
+}
+
+// testImageServer makes a test server returning a png image for /img.png and 404 for anything else
+func testImageServer(t *testing.T) *httptest.Server {
+	img := image.NewRGBA(image.Rect(0, 0, 90, 80))
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 90; x++ {
+			img.Set(x, y, color.Gray{Y: uint8((x * y) % 256)})
+		}
+	}
+	buf := bytes.Buffer{}
+	require.NoError(t, png.Encode(&buf, img))
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/img.png" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(buf.Bytes())
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
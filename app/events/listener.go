@@ -29,32 +29,72 @@ type TelegramListener struct {
 	SpamLogger              SpamLogger    // logger to save spam to files and db
 	Bot                     Bot           // bot to handle messages
 	Group                   string        // can be int64 or public group username (without "@" prefix)
+	Groups                  []string      // additional groups to monitor, same format as Group
 	AdminGroup              string        // can be int64 or public group username (without "@" prefix)
 	IdleDuration            time.Duration // idle timeout to send "idle" message to bots
 	SuperUsers              SuperUsers    // list of superusers, can ban and report spam, can't be banned
 	TestingIDs              []int64       // list of chat IDs to test the bot
 	StartupMsg              string        // message to send on startup to the primary chat
 	WarnMsg                 string        // message to send on warning
+	Warnings                Warnings      // warnings storage, warnings not recorded if nil
+	MaxWarnings             int           // number of active warnings after which the next warning bans the user, 0 - never ban
+	WarnExpiry              time.Duration // duration after which the warning is not counted, 0 - never expires
 	NoSpamReply             bool          // do not reply on spam messages in the primary chat
 	TrainingMode            bool          // do not ban users, just report and train spam detector
 	SoftBanMode             bool          // do not ban users, but restrict their actions
+	Policy                  *bot.Policy   // graduated enforcement policy, all detected spammers banned permanently if nil
+	CheckEdited             bool          // check edited messages for spam
+	CaptchaTimeout          time.Duration // time to answer captcha challenge by new members, captcha disabled if 0
+	CaptchaMath             bool          // captcha asks a simple math question instead of a button press
+	CaptchaApprove          bool          // add new members passed captcha to approved users
+	Challenges              Challenges    // pending captcha challenges storage, challenges kept in memory only if nil
 	Locator                 Locator       // message locator to get info about messages
+	SpamImages              SpamImages    // known spam images storage, photos hashed and reported ones added if set
+	Decisions               Decisions     // moderator decisions storage, decisions not recorded if nil
+	Tuner                   Tuner         // thresholds tuner, runs on decisions every TuneInterval if set
+	TuneInterval            time.Duration // interval of thresholds tuning, tuning disabled if 0
 	DisableAdminSpamForward bool          // disable forwarding spam reports to admin chat support
+	LLMWorkers              int           // number of workers making deferred openai checks, checked inline if 0
+	LLMTimeout              time.Duration // deadline of a deferred openai check, including retries
 	Dry                     bool          // dry run, do not ban or send messages
 
 	adminHandler *admin
-	chatID       int64
+	captcha      *captcha         // captcha for new members, nil if disabled
+	chatID       int64            // primary chat ID, resolved from Group
+	chatIDs      map[int64]string // all monitored chat IDs, primary and additional, mapped to the group name
 	adminChatID  int64
 
 	msgs struct {
 		once sync.Once
 		ch   chan bot.Response
 	}
+
+	llm struct {
+		jobs    chan llmCheck // messages waiting for the deferred openai check
+		results chan llmCheck // checked messages, handled by the update loop
+	}
+}
+
+// llmCheck is a message with the deferred openai check, see bot.Response.PendingLLM
+type llmCheck struct {
+	update     tbapi.Update
+	msg        *bot.Message
+	resp       bot.Response // response of the fast checks
+	final      bot.Response // response with the final verdict, set by the check
+	restricted bool         // the user is restricted until the final verdict
 }
 
+// llmQueueSize is the size of the queue of messages waiting for the deferred openai check.
+// The verdict of the fast checks is kept for messages not fitting the queue.
+const llmQueueSize = 100
+
+// llmRestrictionMargin is added to the restriction of the user until the openai verdict, to cover the handling
+// of the verdict. It also keeps the restriction above telegram's minimum of 30s, shorter ones are permanent.
+const llmRestrictionMargin = time.Minute
+
 // Do process all events, blocked call
 func (l *TelegramListener) Do(ctx context.Context) error {
-	log.Printf("[INFO] start telegram listener for %q", l.Group)
+	log.Printf("[INFO] start telegram listener for %q", strings.Join(l.groups(), ", "))
 
 	if l.TrainingMode {
 		log.Printf("[WARN] training mode, no bans")
@@ -64,10 +104,18 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 		log.Printf("[INFO] soft ban mode, no bans but restrictions")
 	}
 
-	// get chat ID for the group we are monitoring
-	var getChatErr error
-	if l.chatID, getChatErr = l.getChatID(l.Group); getChatErr != nil {
-		return fmt.Errorf("failed to get chat ID for group %q: %w", l.Group, getChatErr)
+	// get chat IDs for all the groups we are monitoring, the first one is the primary group
+	l.chatIDs = make(map[int64]string)
+	for i, group := range l.groups() {
+		chatID, err := l.getChatID(group)
+		if err != nil {
+			return fmt.Errorf("failed to get chat ID for group %q: %w", group, err)
+		}
+		if i == 0 {
+			l.chatID = chatID
+		}
+		l.chatIDs[chatID] = group
+		log.Printf("[INFO] monitored chat ID: %d, group: %q", chatID, group)
 	}
 
 	if err := l.updateSupers(); err != nil {
@@ -76,6 +124,7 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 
 	if l.AdminGroup != "" {
 		// get chat ID for the admin group
+		var getChatErr error
 		if l.adminChatID, getChatErr = l.getChatID(l.AdminGroup); getChatErr != nil {
 			return fmt.Errorf("failed to get chat ID for admin group %q: %w", l.AdminGroup, getChatErr)
 		}
@@ -89,15 +138,33 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 		}
 	})
 
-	// send startup message if any set
+	// send startup message to all monitored groups if any set
 	if l.StartupMsg != "" && !l.TrainingMode && !l.Dry {
-		if err := l.sendBotResponse(bot.Response{Send: true, Text: l.StartupMsg}, l.chatID); err != nil {
-			log.Printf("[WARN] failed to send startup message, %v", err)
+		for chatID := range l.chatIDs {
+			if err := l.sendBotResponse(bot.Response{Send: true, Text: l.StartupMsg}, chatID); err != nil {
+				log.Printf("[WARN] failed to send startup message to %d, %v", chatID, err)
+			}
 		}
 	}
 
 	l.adminHandler = &admin{tbAPI: l.TbAPI, bot: l.Bot, locator: l.Locator, primChatID: l.chatID, adminChatID: l.adminChatID,
-		superUsers: l.SuperUsers, trainingMode: l.TrainingMode, softBan: l.SoftBanMode, dry: l.Dry, warnMsg: l.WarnMsg}
+		superUsers: l.SuperUsers, trainingMode: l.TrainingMode, softBan: l.SoftBanMode, dry: l.Dry, warnMsg: l.WarnMsg,
+		graduated: l.Policy != nil, warnings: l.Warnings, maxWarnings: l.MaxWarnings, warnExpiry: l.WarnExpiry,
+		spamImages: l.SpamImages, decisions: l.Decisions}
+
+	if l.Tuner != nil && l.Decisions != nil && l.TuneInterval > 0 {
+		go l.tuneThresholds(ctx)
+		log.Printf("[INFO] thresholds tuning enabled, interval: %v", l.TuneInterval)
+	}
+
+	if l.CaptchaTimeout > 0 {
+		l.captcha = &captcha{tbAPI: l.TbAPI, bot: l.Bot, store: l.Challenges, timeout: l.CaptchaTimeout, math: l.CaptchaMath,
+			approve: l.CaptchaApprove, dry: l.Dry, training: l.TrainingMode}
+		if err := l.captcha.restore(); err != nil {
+			log.Printf("[WARN] failed to restore captcha challenges: %v", err)
+		}
+		log.Printf("[INFO] captcha for new members enabled, timeout: %v, math: %v", l.CaptchaTimeout, l.CaptchaMath)
+	}
 
 	adminForwardStatus := "enabled"
 	if l.DisableAdminSpamForward {
@@ -105,6 +172,15 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 	}
 	log.Printf("[DEBUG] admin handler created, spam forvarding %s, %+v", adminForwardStatus, l.adminHandler)
 
+	if l.LLMWorkers > 0 {
+		// slow openai checks are made by the workers, results are handled by the update loop
+		l.llm.jobs, l.llm.results = make(chan llmCheck, llmQueueSize), make(chan llmCheck, llmQueueSize)
+		for i := 0; i < l.LLMWorkers; i++ {
+			go l.llmWorker(ctx)
+		}
+		log.Printf("[INFO] deferred openai checks enabled, workers: %d", l.LLMWorkers)
+	}
+
 	u := tbapi.NewUpdate(0)
 	u.Timeout = 60
 
@@ -133,6 +209,14 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 				continue
 			}
 
+			// handle captcha answers
+			if update.CallbackQuery != nil && l.captcha != nil && strings.HasPrefix(update.CallbackQuery.Data, captchaPrefix) {
+				if err := l.captcha.CallbackHandler(update.CallbackQuery); err != nil {
+					log.Printf("[WARN] failed to process captcha answer: %v", err)
+				}
+				continue
+			}
+
 			// handle admin chat inline buttons
 			if update.CallbackQuery != nil {
 				if err := l.adminHandler.InlineCallbackHandler(update.CallbackQuery); err != nil {
@@ -142,6 +226,18 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 				continue
 			}
 
+			// check edited messages the same way as new ones, if enabled
+			if update.EditedMessage != nil && update.EditedMessage.Chat != nil {
+				if !l.CheckEdited {
+					continue
+				}
+				update.Message = update.EditedMessage
+				if err := l.procEvents(update); err != nil {
+					log.Printf("[WARN] failed to process edited message: %v", err)
+				}
+				continue
+			}
+
 			if update.Message == nil {
 				continue
 			}
@@ -150,6 +246,14 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 				continue
 			}
 
+			// challenge new members
+			if len(update.Message.NewChatMembers) > 0 && l.captcha != nil && l.isChatAllowed(update.Message.Chat.ID) {
+				if err := l.captcha.NewMembers(update.Message.Chat.ID, l.captchaMembers(update.Message.Chat.ID, update.Message.NewChatMembers)); err != nil {
+					log.Printf("[WARN] failed to challenge new members: %v", err)
+				}
+				continue
+			}
+
 			// handle spam reports from superusers
 			if update.Message.ReplyToMessage != nil && l.SuperUsers.IsSuper(update.Message.From.UserName) {
 				if strings.EqualFold(update.Message.Text, "/spam") || strings.EqualFold(update.Message.Text, "spam") {
@@ -180,6 +284,11 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 				continue
 			}
 
+		case chk := <-l.llm.results: // nil channel if deferred checks made inline
+			if err := l.procLLMVerdict(chk); err != nil {
+				log.Printf("[WARN] failed to process openai verdict: %v", err)
+			}
+
 		case <-time.After(l.IdleDuration): // hit bots on idle timeout
 			resp := l.Bot.OnMessage(bot.Message{Text: "idle"})
 			if err := l.sendBotResponse(resp, l.chatID); err != nil {
@@ -202,21 +311,45 @@ func (l *TelegramListener) procEvents(update tbapi.Update) error {
 
 	log.Printf("[DEBUG] %s", string(msgJSON))
 	msg := transform(update.Message)
+	msg.Edited = update.EditedMessage != nil
 
 	// ignore empty messages
 	if strings.TrimSpace(msg.Text) == "" && msg.Image == nil {
 		return nil
 	}
 
+	// hash the image to compare it with known spam images. Skipped for superusers and approved users,
+	// as their messages are not checked, except for edited ones
+	if msg.Image != nil && l.SpamImages != nil && !l.SuperUsers.IsSuper(msg.From.Username) &&
+		(msg.Edited || !l.Bot.IsApprovedUser(msg.ChatID, msg.From.ID)) {
+		hash, err := imageHash(l.TbAPI, msg.Image.FileID)
+		if err != nil {
+			log.Printf("[WARN] failed to hash image: %v", err)
+		} else {
+			msg.Image.Hash = &hash
+		}
+	}
+
 	log.Printf("[DEBUG] incoming msg: %+v", strings.ReplaceAll(msg.Text, "\n", " "))
+	// edited message added with the new text, so admin's forward of the edited message can be located as well
 	if err := l.Locator.AddMessage(msg.Text, fromChat, msg.From.ID, msg.From.Username, msg.ID); err != nil {
 		log.Printf("[WARN] failed to add message to locator: %v", err)
 	}
 	resp := l.Bot.OnMessage(*msg)
+	if resp.PendingLLM {
+		return l.deferLLM(update, msg, resp)
+	}
+	_, err := l.procSpam(update, msg, resp)
+	return err
+}
 
+// procSpam handles the bot's response with the final verdict, sends the reply, bans the spammer and deletes the message.
+// It reports whether the user was banned or restricted, as the enforcement policy may only delete the message.
+func (l *TelegramListener) procSpam(update tbapi.Update, msg *bot.Message, resp bot.Response) (banned bool, err error) {
 	if !resp.Send { // not spam
-		return nil
+		return false, nil
 	}
+	fromChat := msg.ChatID
 
 	// send response to the channel if allowed
 	if resp.Send && !l.NoSpamReply && !l.TrainingMode {
@@ -231,6 +364,7 @@ func (l *TelegramListener) procEvents(update tbapi.Update) error {
 	if resp.Send && resp.BanInterval > 0 {
 		log.Printf("[DEBUG] ban initiated for %+v", resp)
 		l.SpamLogger.Save(msg, &resp)
+		action, report := l.enforcement(&resp, msg.From.ID)
 		if err := l.Locator.AddSpam(msg.From.ID, resp.CheckResults); err != nil {
 			log.Printf("[WARN] failed to add spam to locator: %v", err)
 		}
@@ -238,35 +372,165 @@ func (l *TelegramListener) procEvents(update tbapi.Update) error {
 
 		if l.SuperUsers.IsSuper(msg.From.Username) {
 			if l.TrainingMode {
-				l.adminHandler.ReportBan(banUserStr, msg)
+				l.adminHandler.ReportBan(banUserStr, msg, report)
 			}
 			log.Printf("[DEBUG] superuser %s requested ban, ignored", banUserStr)
-			return nil
+			return false, nil
 		}
 
-		banReq := banRequest{duration: resp.BanInterval, userID: resp.User.ID, channelID: resp.ChannelID, userName: banUserStr,
-			chatID: fromChat, dry: l.Dry, training: l.TrainingMode, tbAPI: l.TbAPI, restrict: l.SoftBanMode}
-		if err := banUserOrChannel(banReq); err != nil {
-			errs = multierror.Append(errs, fmt.Errorf("failed to ban %s: %w", banUserStr, err))
+		var banErr error
+		if action != bot.ActionDelete {
+			banReq := banRequest{duration: resp.BanInterval, userID: resp.User.ID, channelID: resp.ChannelID, userName: banUserStr,
+				chatID: fromChat, dry: l.Dry, training: l.TrainingMode, tbAPI: l.TbAPI,
+				restrict: l.SoftBanMode || action == bot.ActionRestrict}
+			banErr = banUserOrChannel(banReq)
+			banned = banErr == nil
+		}
+		if banErr != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to ban %s: %w", banUserStr, banErr))
 		} else if l.adminChatID != 0 && msg.From.ID != 0 {
-			l.adminHandler.ReportBan(banUserStr, msg)
+			l.adminHandler.ReportBan(banUserStr, msg, report)
 		}
 	}
 
 	// delete message if requested by bot
 	if resp.DeleteReplyTo && resp.ReplyTo != 0 && !l.Dry && !l.SuperUsers.IsSuper(msg.From.Username) && !l.TrainingMode {
-		if _, err := l.TbAPI.Request(tbapi.DeleteMessageConfig{ChatID: l.chatID, MessageID: resp.ReplyTo}); err != nil {
+		if _, err := l.TbAPI.Request(tbapi.DeleteMessageConfig{ChatID: fromChat, MessageID: resp.ReplyTo}); err != nil {
 			errs = multierror.Append(errs, fmt.Errorf("failed to delete message %d: %w", resp.ReplyTo, err))
 		}
 	}
 
+	return banned, errs.ErrorOrNil()
+}
+
+// deferLLM queues the message for the deferred openai check. A user detected as spammer by the fast checks
+// is restricted until the final verdict, so the message is not acted on before the check confirms it.
+// The message is checked inline if there are no workers. If the queue is full, the message is handled
+// with the verdict of the fast checks, as blocking the update loop on the check is worse than skipping it.
+func (l *TelegramListener) deferLLM(update tbapi.Update, msg *bot.Message, resp bot.Response) error {
+	chk := llmCheck{update: update, msg: msg, resp: resp}
+	if l.llm.jobs == nil {
+		chk.final = l.Bot.VerifyLLM(*msg, resp)
+		return l.procLLMVerdict(chk)
+	}
+
+	chk.restricted = resp.Send && resp.ChannelID == 0 && !l.SuperUsers.IsSuper(msg.From.Username) && !l.Dry && !l.TrainingMode
+	select {
+	case l.llm.jobs <- chk:
+	default:
+		log.Printf("[WARN] openai check queue is full, message %d handled by the fast checks verdict", msg.ID)
+		_, err := l.procSpam(update, msg, resp)
+		return err
+	}
+
+	// restricted after the job is queued, it is safe as the verdict is handled by the update loop as well
+	if chk.restricted {
+		banReq := banRequest{duration: l.llmRestriction(), userID: resp.User.ID, userName: fmt.Sprintf("%v", resp.User),
+			chatID: msg.ChatID, tbAPI: l.TbAPI, restrict: true}
+		if err := banUserOrChannel(banReq); err != nil {
+			log.Printf("[WARN] failed to restrict %v until openai verdict: %v", resp.User, err)
+		}
+	}
+	return nil
+}
+
+// llmRestriction returns the duration of the restriction of the user until the openai verdict. It covers the wait
+// for all the checks queued before, made by the workers in parallel, and the check itself, each up to LLMTimeout.
+func (l *TelegramListener) llmRestriction() time.Duration {
+	rounds := (llmQueueSize+l.LLMWorkers-1)/l.LLMWorkers + 1
+	return time.Duration(rounds)*l.LLMTimeout + llmRestrictionMargin
+}
+
+// llmWorker makes deferred openai checks and passes the results to the update loop
+func (l *TelegramListener) llmWorker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case chk := <-l.llm.jobs:
+			chk.final = l.Bot.VerifyLLM(*chk.msg, chk.resp)
+			select {
+			case <-ctx.Done():
+				return
+			case l.llm.results <- chk:
+			}
+		}
+	}
+}
+
+// procLLMVerdict handles the final verdict of the deferred openai check. Spam is handled as usual, so the message
+// is deleted and the user is banned retroactively. If the user is not banned, because the verdict of the fast checks
+// is vetoed or the enforcement policy only deletes the message, the pending restriction of the user is released.
+func (l *TelegramListener) procLLMVerdict(chk llmCheck) error {
+	log.Printf("[DEBUG] openai verdict for message %d from %v, spam: %v, fast checks spam: %v",
+		chk.msg.ID, chk.msg.From.ID, chk.final.Send, chk.resp.Send)
+	banned, err := l.procSpam(chk.update, chk.msg, chk.final)
+	if !chk.restricted || banned {
+		return err
+	}
+
+	errs := multierror.Append(new(multierror.Error), err)
+	_, errRelease := l.TbAPI.Request(tbapi.RestrictChatMemberConfig{
+		ChatMemberConfig: tbapi.ChatMemberConfig{UserID: chk.msg.From.ID, ChatID: chk.msg.ChatID},
+		Permissions:      l.chatPermissions(chk.msg.ChatID),
+	})
+	if errRelease != nil {
+		errs = multierror.Append(errs, fmt.Errorf("failed to drop pending restriction for user %d: %w", chk.msg.From.ID, errRelease))
+		return errs.ErrorOrNil()
+	}
+	log.Printf("[INFO] user %d not banned after openai verdict, pending restriction dropped", chk.msg.From.ID)
 	return errs.ErrorOrNil()
 }
 
+// chatPermissions returns the default permissions of the chat members, so the user released from the restriction
+// gets the same permissions as everyone else. Falls back to the basic permissions if the chat can't be read.
+func (l *TelegramListener) chatPermissions(chatID int64) *tbapi.ChatPermissions {
+	chat, err := l.TbAPI.GetChat(tbapi.ChatInfoConfig{ChatConfig: tbapi.ChatConfig{ChatID: chatID}})
+	if err != nil {
+		log.Printf("[WARN] failed to get permissions of chat %d: %v", chatID, err)
+	}
+	if err != nil || chat.Permissions == nil {
+		return &tbapi.ChatPermissions{CanSendMessages: true, CanSendMediaMessages: true, CanSendOtherMessages: true, CanSendPolls: true}
+	}
+	return chat.Permissions
+}
+
+// enforcement applies the enforcement policy, if set, to the bot's response for detected spam.
+// It sets the response's ban interval and returns the action with its description for the admin report.
+// Without the policy all the spammers are banned permanently.
+func (l *TelegramListener) enforcement(resp *bot.Response, userID int64) (action bot.Action, report string) {
+	if l.Policy == nil {
+		return bot.ActionBan, bot.ActionBan.Describe(resp.BanInterval)
+	}
+	offenses := 0
+	if sd, ok := l.Locator.Spam(userID); ok {
+		offenses = sd.Count
+	}
+	action, resp.BanInterval = l.Policy.Enforcement(resp.Score, offenses)
+	log.Printf("[DEBUG] enforcement for %d: %s, duration: %v, score: %.2f, previous offenses: %d",
+		userID, action, resp.BanInterval, resp.Score, offenses)
+	return action, fmt.Sprintf("%s, score: %.2f, previous offenses: %d", action.Describe(resp.BanInterval), resp.Score, offenses)
+}
+
+// captchaMembers returns new members of the chat to challenge, superusers and approved users are not challenged
+func (l *TelegramListener) captchaMembers(chatID int64, members []tbapi.User) []tbapi.User {
+	res := make([]tbapi.User, 0, len(members))
+	for _, m := range members {
+		if l.SuperUsers.IsSuper(m.UserName) || l.Bot.IsApprovedUser(chatID, m.ID) {
+			continue
+		}
+		res = append(res, m)
+	}
+	return res
+}
+
 func (l *TelegramListener) isChatAllowed(fromChat int64) bool {
 	if fromChat == l.chatID {
 		return true
 	}
+	if _, ok := l.chatIDs[fromChat]; ok {
+		return true
+	}
 	for _, id := range l.TestingIDs {
 		if id == fromChat {
 			return true
@@ -324,6 +588,68 @@ func (l *TelegramListener) sendBotResponse(resp bot.Response, chatID int64) erro
 	return nil
 }
 
+// tuneThresholds runs thresholds tuning every TuneInterval, until the context is canceled
+func (l *TelegramListener) tuneThresholds(ctx context.Context) {
+	ticker := time.NewTicker(l.TuneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.tune(); err != nil {
+				log.Printf("[WARN] failed to tune thresholds: %v", err)
+			}
+		}
+	}
+}
+
+// tune suggests detector thresholds from moderator decisions, and reports new suggestion to admin chat
+func (l *TelegramListener) tune() error {
+	entries, err := l.Decisions.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read decisions: %w", err)
+	}
+	decisions := make([]bot.Decision, 0, len(entries))
+	for _, e := range entries {
+		decisions = append(decisions, bot.Decision{ChatID: e.ChatID, Spam: e.Spam, Checks: e.Checks})
+	}
+
+	res, isNew := l.Tuner.Tune(decisions)
+	if !isNew {
+		return nil
+	}
+	log.Printf("[INFO] thresholds tuned, applied: %v, %s", res.Applied, res)
+	if l.adminChatID == 0 {
+		return nil
+	}
+
+	title := "suggested detector thresholds"
+	if res.Applied {
+		title = "applied detector thresholds"
+	}
+	text := fmt.Sprintf("**%s**\n\n- similarity threshold: %.2f -> %.2f\n- min spam probability: %.0f%% -> %.0f%%\n"+
+		"- false positives: %d -> %d\n- missed spam: %d -> %d\n\nbased on %d moderator decisions", title,
+		res.Current.Similarity, res.Suggested.Similarity, res.Current.MinSpamProbability, res.Suggested.MinSpamProbability,
+		res.FalsePositives, res.SuggestedFalsePositives, res.MissedSpam, res.SuggestedMissedSpam, res.Decisions)
+	return l.sendBotResponse(bot.Response{Send: true, Text: text}, l.adminChatID)
+}
+
+// groups returns the list of all monitored groups, primary group first, duplicates and empty values removed
+func (l *TelegramListener) groups() []string {
+	res := []string{}
+	seen := map[string]bool{}
+	for _, g := range append([]string{l.Group}, l.Groups...) {
+		g = strings.TrimSpace(g)
+		if g == "" || seen[g] {
+			continue
+		}
+		seen[g] = true
+		res = append(res, g)
+	}
+	return res
+}
+
 func (l *TelegramListener) getChatID(group string) (int64, error) {
 	chatID, err := strconv.ParseInt(group, 10, 64)
 	if err == nil {
@@ -339,6 +665,7 @@ func (l *TelegramListener) getChatID(group string) (int64, error) {
 }
 
 // updateSupers updates the list of super-users based on the chat administrators fetched from the Telegram API.
+// administrators of all monitored groups are added.
 func (l *TelegramListener) updateSupers() error {
 	isSuper := func(username string) bool {
 		for _, super := range l.SuperUsers {
@@ -349,9 +676,20 @@ func (l *TelegramListener) updateSupers() error {
 		return false
 	}
 
-	admins, err := l.TbAPI.GetChatAdministrators(tbapi.ChatAdministratorsConfig{ChatConfig: tbapi.ChatConfig{ChatID: l.chatID}})
-	if err != nil {
-		return fmt.Errorf("failed to get chat administrators: %w", err)
+	chatIDs := []int64{l.chatID}
+	for chatID := range l.chatIDs {
+		if chatID != l.chatID {
+			chatIDs = append(chatIDs, chatID)
+		}
+	}
+
+	admins := []tbapi.ChatMember{}
+	for _, chatID := range chatIDs {
+		chatAdmins, err := l.TbAPI.GetChatAdministrators(tbapi.ChatAdministratorsConfig{ChatConfig: tbapi.ChatConfig{ChatID: chatID}})
+		if err != nil {
+			return fmt.Errorf("failed to get chat administrators for %d: %w", chatID, err)
+		}
+		admins = append(admins, chatAdmins...)
 	}
 
 	for _, admin := range admins {
@@ -365,7 +703,7 @@ func (l *TelegramListener) updateSupers() error {
 	}
 
 	log.Printf("[INFO] added admins, full list of supers: {%s}", strings.Join(l.SuperUsers, ", "))
-	return err
+	return nil
 }
 
 // SuperUsers for moderators
@@ -89,6 +89,172 @@ func TestTelegramListener_Do(t *testing.T) {
 
 }
 
+func TestTelegramListener_DoWithEditedMessage(t *testing.T) {
+	mockLogger := &mocks.SpamLoggerMock{SaveFunc: func(msg *bot.Message, response *bot.Response) {}}
+	mockAPI := &mocks.TbAPIMock{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+			return tbapi.Chat{ID: 123}, nil
+		},
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			return tbapi.Message{Text: c.(tbapi.MessageConfig).Text, From: &tbapi.User{UserName: "user"}}, nil
+		},
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+			return &tbapi.APIResponse{Ok: true}, nil
+		},
+		GetChatAdministratorsFunc: func(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error) { return nil, nil },
+	}
+	b := &mocks.BotMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+		t.Logf("on-message: %+v", msg)
+		if msg.Text == "buy now" && msg.Edited {
+			return bot.Response{Send: true, Text: "bot's answer", ReplyTo: msg.ID, DeleteReplyTo: true}
+		}
+		return bot.Response{}
+	}}
+
+	editedUpdate := func() tbapi.Update {
+		return tbapi.Update{EditedMessage: &tbapi.Message{MessageID: 321, Chat: &tbapi.Chat{ID: 123}, Text: "buy now",
+			From: &tbapi.User{ID: 1, UserName: "user"}}}
+	}
+
+	t.Run("edited messages checked", func(t *testing.T) {
+		locator, teardown := prepTestLocator(t)
+		defer teardown()
+		l := TelegramListener{SpamLogger: mockLogger, TbAPI: mockAPI, Bot: b, Group: "gr", Locator: locator, CheckEdited: true}
+
+		updChan := make(chan tbapi.Update, 1)
+		updChan <- editedUpdate()
+		close(updChan)
+		mockAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+		err := l.Do(context.Background())
+		assert.EqualError(t, err, "telegram update chan closed")
+		require.Len(t, b.OnMessageCalls(), 1)
+		assert.True(t, b.OnMessageCalls()[0].Msg.Edited)
+		require.Len(t, mockAPI.SendCalls(), 1)
+		assert.Equal(t, "bot's answer", mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
+		require.Len(t, mockAPI.RequestCalls(), 1)
+		assert.Equal(t, 321, mockAPI.RequestCalls()[0].C.(tbapi.DeleteMessageConfig).MessageID)
+
+		meta, found := locator.Message("buy now")
+		require.True(t, found, "edited text added to locator")
+		assert.Equal(t, 321, meta.MsgID)
+	})
+
+	t.Run("edited messages ignored", func(t *testing.T) {
+		b.ResetCalls()
+		mockAPI.ResetCalls()
+		locator, teardown := prepTestLocator(t)
+		defer teardown()
+		l := TelegramListener{SpamLogger: mockLogger, TbAPI: mockAPI, Bot: b, Group: "gr", Locator: locator}
+
+		updChan := make(chan tbapi.Update, 1)
+		updChan <- editedUpdate()
+		close(updChan)
+		mockAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+		err := l.Do(context.Background())
+		assert.EqualError(t, err, "telegram update chan closed")
+		assert.Empty(t, b.OnMessageCalls())
+		assert.Empty(t, mockAPI.SendCalls())
+	})
+}
+
+func TestTelegramListener_DoWithImageHash(t *testing.T) {
+	ts := testImageServer(t)
+	mockLogger := &mocks.SpamLoggerMock{SaveFunc: func(msg *bot.Message, response *bot.Response) {}}
+	mockAPI := &mocks.TbAPIMock{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) { return tbapi.Chat{ID: 123}, nil },
+		GetChatAdministratorsFunc: func(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error) {
+			return nil, nil
+		},
+		GetFileDirectURLFunc: func(fileID string) (string, error) { return ts.URL + "/" + fileID, nil },
+	}
+	b := &mocks.BotMock{OnMessageFunc: func(msg bot.Message) bot.Response { return bot.Response{} },
+		IsApprovedUserFunc: func(chatID, userID int64) bool { return userID == 2 }}
+
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+
+	l := TelegramListener{
+		SpamLogger: mockLogger,
+		TbAPI:      mockAPI,
+		Bot:        b,
+		Group:      "gr",
+		Locator:    locator,
+		SpamImages: &mocks.SpamImagesMock{},
+		SuperUsers: SuperUsers{"admin"},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Minute)
+	defer cancel()
+
+	updChan := make(chan tbapi.Update, 4)
+	updChan <- tbapi.Update{Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 123}, Caption: "buy now",
+		From: &tbapi.User{ID: 1, UserName: "user"}, Photo: []tbapi.PhotoSize{{FileID: "img.png"}}}}
+	updChan <- tbapi.Update{Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 123}, Caption: "broken image",
+		From: &tbapi.User{ID: 1, UserName: "user"}, Photo: []tbapi.PhotoSize{{FileID: "bad.png"}}}}
+	updChan <- tbapi.Update{Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 123}, Caption: "approved user",
+		From: &tbapi.User{ID: 2, UserName: "approved"}, Photo: []tbapi.PhotoSize{{FileID: "img.png"}}}}
+	updChan <- tbapi.Update{Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 123}, Caption: "superuser",
+		From: &tbapi.User{ID: 3, UserName: "admin"}, Photo: []tbapi.PhotoSize{{FileID: "img.png"}}}}
+	close(updChan)
+	mockAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+	err := l.Do(ctx)
+	assert.EqualError(t, err, "telegram update chan closed")
+
+	require.Len(t, b.OnMessageCalls(), 4, "all messages checked")
+	require.NotNil(t, b.OnMessageCalls()[0].Msg.Image)
+	assert.NotNil(t, b.OnMessageCalls()[0].Msg.Image.Hash)
+	require.NotNil(t, b.OnMessageCalls()[1].Msg.Image)
+	assert.Nil(t, b.OnMessageCalls()[1].Msg.Image.Hash, "failed to download, not hashed")
+	require.NotNil(t, b.OnMessageCalls()[2].Msg.Image)
+	assert.Nil(t, b.OnMessageCalls()[2].Msg.Image.Hash, "approved user, not hashed")
+	require.NotNil(t, b.OnMessageCalls()[3].Msg.Image)
+	assert.Nil(t, b.OnMessageCalls()[3].Msg.Image.Hash, "superuser, not hashed")
+	assert.Len(t, mockAPI.GetFileDirectURLCalls(), 2, "only messages of regular users downloaded")
+	require.Len(t, b.IsApprovedUserCalls(), 3, "approval checked for the chat of the message")
+	assert.Equal(t, int64(123), b.IsApprovedUserCalls()[2].ChatID)
+}
+
+func TestTelegramListener_DoWithMedia(t *testing.T) {
+	mockLogger := &mocks.SpamLoggerMock{SaveFunc: func(msg *bot.Message, response *bot.Response) {}}
+	mockAPI := &mocks.TbAPIMock{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) { return tbapi.Chat{ID: 123}, nil },
+		GetChatAdministratorsFunc: func(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error) {
+			return nil, nil
+		},
+	}
+	b := &mocks.BotMock{OnMessageFunc: func(msg bot.Message) bot.Response { return bot.Response{} }}
+
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+
+	l := TelegramListener{SpamLogger: mockLogger, TbAPI: mockAPI, Bot: b, Group: "gr", Locator: locator}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Minute)
+	defer cancel()
+
+	from := &tbapi.User{ID: 1, UserName: "user"}
+	updChan := make(chan tbapi.Update, 3)
+	updChan <- tbapi.Update{Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 123}, From: from,
+		Poll: &tbapi.Poll{Question: "earn?", Options: []tbapi.PollOption{{Text: "dm me"}}}}}
+	updChan <- tbapi.Update{Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 123}, From: from, Caption: "see video",
+		Video: &tbapi.Video{FileID: "v1"}}}
+	updChan <- tbapi.Update{Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 123}, From: from,
+		VideoNote: &tbapi.VideoNote{FileID: "vn1"}}} // nothing to check
+	close(updChan)
+	mockAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+	err := l.Do(ctx)
+	assert.EqualError(t, err, "telegram update chan closed")
+
+	require.Len(t, b.OnMessageCalls(), 2)
+	assert.Equal(t, "earn?\ndm me", b.OnMessageCalls()[0].Msg.Text)
+	assert.Equal(t, "see video", b.OnMessageCalls()[1].Msg.Text)
+	assert.Equal(t, "video", b.OnMessageCalls()[1].Msg.Document.Type)
+}
+
 func TestTelegramListener_DoWithBotBan(t *testing.T) {
 	mockLogger := &mocks.SpamLoggerMock{SaveFunc: func(msg *bot.Message, response *bot.Response) {}}
 	mockAPI := &mocks.TbAPIMock{
@@ -310,6 +476,280 @@ func TestTelegramListener_DoWithBotSoftBan(t *testing.T) {
 		CanSendPolls: false}, mockAPI.RequestCalls()[0].C.(tbapi.RestrictChatMemberConfig).Permissions)
 }
 
+func TestTelegramListener_DoWithPolicy(t *testing.T) {
+	mockLogger := &mocks.SpamLoggerMock{SaveFunc: func(msg *bot.Message, response *bot.Response) {}}
+	mockAPI := &mocks.TbAPIMock{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+			return tbapi.Chat{ID: 123}, nil
+		},
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			return tbapi.Message{Text: c.(tbapi.MessageConfig).Text, From: &tbapi.User{UserName: "user"}}, nil
+		},
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+			return &tbapi.APIResponse{Ok: true}, nil
+		},
+		GetChatAdministratorsFunc: func(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error) {
+			return nil, nil
+		},
+	}
+	b := &mocks.BotMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+		score := 1.0
+		if msg.From.Username == "low" {
+			score = 0.5
+		}
+		return bot.Response{Send: true, Text: "bot's answer", BanInterval: bot.PermanentBanDuration, ReplyTo: msg.ID,
+			DeleteReplyTo: true, Score: score, User: bot.User{Username: msg.From.Username, ID: msg.From.ID},
+			CheckResults: []spamcheck.Response{{Name: "Check1", Spam: true, Details: "Details 1"}}}
+	}}
+
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+
+	l := TelegramListener{
+		SpamLogger: mockLogger,
+		TbAPI:      mockAPI,
+		Bot:        b,
+		Group:      "gr",
+		Locator:    locator,
+		Policy: &bot.Policy{RestrictScore: 1, TempBanScore: 2, BanScore: 3,
+			RestrictDuration: time.Hour, TempBanDuration: 24 * time.Hour},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Minute)
+	defer cancel()
+
+	updChan := make(chan tbapi.Update, 3)
+	updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 10, Chat: &tbapi.Chat{ID: 123}, Text: "spam 1",
+		From: &tbapi.User{UserName: "user", ID: 1}}}
+	updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 11, Chat: &tbapi.Chat{ID: 123}, Text: "spam 2",
+		From: &tbapi.User{UserName: "user", ID: 1}}}
+	updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 12, Chat: &tbapi.Chat{ID: 123}, Text: "spam 3",
+		From: &tbapi.User{UserName: "low", ID: 2}}}
+	close(updChan)
+	mockAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+	err := l.Do(ctx)
+	assert.EqualError(t, err, "telegram update chan closed")
+	require.Equal(t, 5, len(mockAPI.RequestCalls()))
+
+	// first offense, restricted for an hour
+	restrict := mockAPI.RequestCalls()[0].C.(tbapi.RestrictChatMemberConfig)
+	assert.Equal(t, int64(1), restrict.UserID)
+	assert.InDelta(t, time.Now().Add(time.Hour).Unix(), restrict.UntilDate, 10)
+	assert.Equal(t, 10, mockAPI.RequestCalls()[1].C.(tbapi.DeleteMessageConfig).MessageID)
+
+	// second offense, escalated to temporary ban
+	ban := mockAPI.RequestCalls()[2].C.(tbapi.BanChatMemberConfig)
+	assert.Equal(t, int64(1), ban.UserID)
+	assert.InDelta(t, time.Now().Add(24*time.Hour).Unix(), ban.UntilDate, 10)
+	assert.Equal(t, 11, mockAPI.RequestCalls()[3].C.(tbapi.DeleteMessageConfig).MessageID)
+
+	// low score, message deleted only
+	assert.Equal(t, 12, mockAPI.RequestCalls()[4].C.(tbapi.DeleteMessageConfig).MessageID)
+}
+
+func TestTelegramListener_DoWithDeferredLLM(t *testing.T) {
+	prep := func(t *testing.T) (*mocks.TbAPIMock, *mocks.SpamLoggerMock, *mocks.BotMock, *storage.Locator) {
+		mockLogger := &mocks.SpamLoggerMock{SaveFunc: func(msg *bot.Message, response *bot.Response) {}}
+		mockAPI := &mocks.TbAPIMock{
+			GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+				return tbapi.Chat{ID: 123, Permissions: &tbapi.ChatPermissions{CanSendMessages: true, CanInviteUsers: true}}, nil
+			},
+			SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+				return tbapi.Message{Text: c.(tbapi.MessageConfig).Text, From: &tbapi.User{UserName: "user"}}, nil
+			},
+			RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+				return &tbapi.APIResponse{Ok: true}, nil
+			},
+			GetChatAdministratorsFunc: func(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error) {
+				return nil, nil
+			},
+		}
+		spamResp := func(msg bot.Message) bot.Response {
+			return bot.Response{Send: true, Text: "bot's answer", BanInterval: bot.PermanentBanDuration, ReplyTo: msg.ID,
+				DeleteReplyTo: true, User: bot.User{Username: msg.From.Username, ID: msg.From.ID}}
+		}
+		b := &mocks.BotMock{
+			OnMessageFunc: func(msg bot.Message) bot.Response {
+				if msg.Text == "vetoed spam" || msg.Text == "confirmed spam" {
+					resp := spamResp(msg)
+					resp.PendingLLM = true
+					return resp
+				}
+				return bot.Response{PendingLLM: true}
+			},
+			VerifyLLMFunc: func(msg bot.Message, resp bot.Response) bot.Response {
+				if msg.Text == "llm spam" || msg.Text == "confirmed spam" {
+					return spamResp(msg)
+				}
+				return bot.Response{}
+			},
+		}
+		locator, teardown := prepTestLocator(t)
+		t.Cleanup(teardown)
+		return mockAPI, mockLogger, b, locator
+	}
+
+	t.Run("inline", func(t *testing.T) {
+		mockAPI, mockLogger, b, locator := prep(t)
+		l := TelegramListener{SpamLogger: mockLogger, TbAPI: mockAPI, Bot: b, Group: "gr", Locator: locator}
+
+		updChan := make(chan tbapi.Update, 3)
+		updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 10, Chat: &tbapi.Chat{ID: 123}, Text: "llm spam",
+			From: &tbapi.User{UserName: "user", ID: 1}}}
+		updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 11, Chat: &tbapi.Chat{ID: 123}, Text: "vetoed spam",
+			From: &tbapi.User{UserName: "user2", ID: 2}}}
+		updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 12, Chat: &tbapi.Chat{ID: 123}, Text: "ham",
+			From: &tbapi.User{UserName: "user3", ID: 3}}}
+		close(updChan)
+		mockAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+		err := l.Do(context.Background())
+		assert.EqualError(t, err, "telegram update chan closed")
+		require.Len(t, b.VerifyLLMCalls(), 3)
+		assert.True(t, b.VerifyLLMCalls()[1].Resp.Send, "fast checks verdict passed to verification")
+
+		// spam detected by openai, saved, banned and deleted
+		require.Len(t, mockLogger.SaveCalls(), 1)
+		assert.Equal(t, "llm spam", mockLogger.SaveCalls()[0].Msg.Text)
+		require.Len(t, mockAPI.SendCalls(), 1)
+		assert.Equal(t, "bot's answer", mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
+		require.Len(t, mockAPI.RequestCalls(), 2, "spam vetoed by openai inline, not restricted")
+		assert.Equal(t, int64(1), mockAPI.RequestCalls()[0].C.(tbapi.BanChatMemberConfig).UserID)
+		assert.Equal(t, 10, mockAPI.RequestCalls()[1].C.(tbapi.DeleteMessageConfig).MessageID)
+	})
+
+	t.Run("workers", func(t *testing.T) {
+		mockAPI, mockLogger, b, locator := prep(t)
+		verified := make(chan struct{})
+		verify := b.VerifyLLMFunc
+		b.VerifyLLMFunc = func(msg bot.Message, resp bot.Response) bot.Response {
+			<-verified // slow check doesn't block the update loop
+			return verify(msg, resp)
+		}
+		l := TelegramListener{SpamLogger: mockLogger, TbAPI: mockAPI, Bot: b, Group: "gr", Locator: locator,
+			LLMWorkers: 2, LLMTimeout: 10 * time.Second}
+
+		updChan := make(chan tbapi.Update, 3)
+		updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 10, Chat: &tbapi.Chat{ID: 123}, Text: "llm spam",
+			From: &tbapi.User{UserName: "user", ID: 1}}}
+		updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 11, Chat: &tbapi.Chat{ID: 123}, Text: "vetoed spam",
+			From: &tbapi.User{UserName: "user2", ID: 2}}}
+		updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 12, Chat: &tbapi.Chat{ID: 123}, Text: "ham",
+			From: &tbapi.User{UserName: "user3", ID: 3}}}
+		mockAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		done := make(chan error)
+		go func() { done <- l.Do(ctx) }()
+
+		assert.Eventually(t, func() bool { return len(b.OnMessageCalls()) == 3 }, time.Second, 10*time.Millisecond)
+		assert.Empty(t, mockLogger.SaveCalls())
+
+		// spam by the fast checks restricted until the verdict, for the time of all queued checks
+		require.Eventually(t, func() bool { return len(mockAPI.RequestCalls()) == 1 }, time.Second, 10*time.Millisecond)
+		restrict := mockAPI.RequestCalls()[0].C.(tbapi.RestrictChatMemberConfig)
+		assert.Equal(t, int64(2), restrict.UserID)
+		assert.InDelta(t, time.Now().Add(51*10*time.Second+llmRestrictionMargin).Unix(), restrict.UntilDate, 10)
+		assert.False(t, restrict.Permissions.CanSendMessages)
+
+		close(verified)
+		assert.Eventually(t, func() bool { return len(mockLogger.SaveCalls()) == 1 }, time.Second, 10*time.Millisecond)
+		assert.Eventually(t, func() bool { return len(mockAPI.RequestCalls()) == 4 }, time.Second, 10*time.Millisecond)
+		assert.Equal(t, "llm spam", mockLogger.SaveCalls()[0].Msg.Text)
+		assert.Len(t, b.VerifyLLMCalls(), 3)
+
+		// spam banned and deleted, vetoed spam released, in any order
+		var deleted, released bool
+		for _, c := range mockAPI.RequestCalls()[1:] {
+			switch req := c.C.(type) {
+			case tbapi.DeleteMessageConfig:
+				deleted = req.MessageID == 10
+			case tbapi.RestrictChatMemberConfig:
+				released = req.UserID == 2 && req.Permissions.CanSendMessages && req.Permissions.CanInviteUsers
+			}
+		}
+		assert.True(t, deleted)
+		assert.True(t, released, "released with the chat's permissions")
+
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+	})
+
+	t.Run("spam confirmed, policy deletes only", func(t *testing.T) {
+		mockAPI, mockLogger, b, locator := prep(t)
+		l := TelegramListener{SpamLogger: mockLogger, TbAPI: mockAPI, Bot: b, Group: "gr", Locator: locator,
+			LLMWorkers: 1, LLMTimeout: 10 * time.Second,
+			Policy: &bot.Policy{RestrictScore: 1, TempBanScore: 2, BanScore: 3, RestrictDuration: time.Hour}}
+
+		updChan := make(chan tbapi.Update, 1)
+		updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 11, Chat: &tbapi.Chat{ID: 123}, Text: "confirmed spam",
+			From: &tbapi.User{UserName: "user2", ID: 2}}}
+		mockAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		done := make(chan error)
+		go func() { done <- l.Do(ctx) }()
+
+		// restricted until the verdict, then the message deleted and the restriction released, as the user is not banned
+		require.Eventually(t, func() bool { return len(mockAPI.RequestCalls()) == 3 }, time.Second, 10*time.Millisecond)
+		require.Len(t, mockLogger.SaveCalls(), 1)
+		restrict := mockAPI.RequestCalls()[0].C.(tbapi.RestrictChatMemberConfig)
+		assert.False(t, restrict.Permissions.CanSendMessages)
+		assert.Equal(t, 11, mockAPI.RequestCalls()[1].C.(tbapi.DeleteMessageConfig).MessageID)
+		release := mockAPI.RequestCalls()[2].C.(tbapi.RestrictChatMemberConfig)
+		assert.Equal(t, int64(2), release.UserID)
+		assert.Equal(t, &tbapi.ChatPermissions{CanSendMessages: true, CanInviteUsers: true}, release.Permissions)
+		require.Len(t, mockAPI.GetChatCalls(), 2, "group lookup and chat permissions")
+		assert.Equal(t, int64(123), mockAPI.GetChatCalls()[1].Config.ChatID)
+
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+	})
+
+	t.Run("queue full", func(t *testing.T) {
+		mockAPI, mockLogger, b, locator := prep(t)
+		verified := make(chan struct{})
+		verify := b.VerifyLLMFunc
+		b.VerifyLLMFunc = func(msg bot.Message, resp bot.Response) bot.Response {
+			<-verified
+			return verify(msg, resp)
+		}
+		l := TelegramListener{SpamLogger: mockLogger, TbAPI: mockAPI, Bot: b, Group: "gr", Locator: locator,
+			LLMWorkers: 1, LLMTimeout: time.Second}
+
+		// one message taken by the worker, the queue filled up, and the last one doesn't fit
+		updChan := make(chan tbapi.Update, llmQueueSize+2)
+		for i := 0; i < llmQueueSize+1; i++ {
+			updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 100 + i, Chat: &tbapi.Chat{ID: 123}, Text: "ham",
+				From: &tbapi.User{UserName: "user3", ID: 3}}}
+		}
+		updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 11, Chat: &tbapi.Chat{ID: 123}, Text: "vetoed spam",
+			From: &tbapi.User{UserName: "user2", ID: 2}}}
+		mockAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		done := make(chan error)
+		go func() { done <- l.Do(ctx) }()
+
+		// the verdict of the fast checks kept, without waiting for the check
+		require.Eventually(t, func() bool { return len(mockAPI.RequestCalls()) == 2 }, time.Second, 10*time.Millisecond)
+		require.Len(t, mockLogger.SaveCalls(), 1)
+		assert.Equal(t, "vetoed spam", mockLogger.SaveCalls()[0].Msg.Text)
+		assert.Equal(t, int64(2), mockAPI.RequestCalls()[0].C.(tbapi.BanChatMemberConfig).UserID)
+		assert.Equal(t, 11, mockAPI.RequestCalls()[1].C.(tbapi.DeleteMessageConfig).MessageID)
+		assert.Eventually(t, func() bool { return len(b.VerifyLLMCalls()) == 1 }, time.Second, 10*time.Millisecond,
+			"only the message taken by the worker is being verified")
+
+		close(verified)
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+	})
+}
+
 func TestTelegramListener_DoWithTraining(t *testing.T) {
 	mockLogger := &mocks.SpamLoggerMock{SaveFunc: func(msg *bot.Message, response *bot.Response) {}}
 	mockAPI := &mocks.TbAPIMock{
@@ -446,6 +886,78 @@ func TestTelegramListener_DoDeleteMessages(t *testing.T) {
 	assert.Equal(t, int64(123), mockAPI.RequestCalls()[1].C.(tbapi.DeleteMessageConfig).ChatID)
 }
 
+func TestTelegramListener_DoMultipleGroups(t *testing.T) {
+	mockLogger := &mocks.SpamLoggerMock{SaveFunc: func(msg *bot.Message, response *bot.Response) {}}
+	mockAPI := &mocks.TbAPIMock{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+			if config.SuperGroupUsername == "@gr2" {
+				return tbapi.Chat{ID: 456}, nil
+			}
+			return tbapi.Chat{ID: 123}, nil
+		},
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			return tbapi.Message{}, nil
+		},
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+			return &tbapi.APIResponse{Ok: true}, nil
+		},
+		GetChatAdministratorsFunc: func(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error) {
+			if config.ChatID == 456 {
+				return []tbapi.ChatMember{{User: &tbapi.User{UserName: "admin2"}}}, nil
+			}
+			return []tbapi.ChatMember{{User: &tbapi.User{UserName: "admin1"}}}, nil
+		},
+	}
+	b := &mocks.BotMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+		if msg.Text == "spam text" {
+			return bot.Response{DeleteReplyTo: true, ReplyTo: msg.ID, BanInterval: time.Hour, Send: true, Text: "bot's answer",
+				User: bot.User{Username: "user", ID: 1}}
+		}
+		return bot.Response{}
+	}}
+
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+
+	l := TelegramListener{
+		SpamLogger: mockLogger,
+		TbAPI:      mockAPI,
+		Bot:        b,
+		Group:      "gr",
+		Groups:     []string{"gr2", "gr", ""},
+		Locator:    locator,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Minute)
+	defer cancel()
+
+	updChan := make(chan tbapi.Update, 3)
+	updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 321, Chat: &tbapi.Chat{ID: 456}, Text: "spam text",
+		From: &tbapi.User{UserName: "user", ID: 1}}}
+	updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 322, Chat: &tbapi.Chat{ID: 789}, Text: "spam text",
+		From: &tbapi.User{UserName: "user", ID: 1}}}
+	close(updChan)
+	mockAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+	err := l.Do(ctx)
+	assert.EqualError(t, err, "telegram update chan closed")
+	assert.Equal(t, map[int64]string{123: "gr", 456: "gr2"}, l.chatIDs)
+	assert.Equal(t, int64(123), l.chatID)
+	assert.ElementsMatch(t, SuperUsers{"admin1", "admin2"}, l.SuperUsers)
+
+	// only the message from the second monitored group processed, the one from unknown chat ignored
+	require.Equal(t, 1, len(mockLogger.SaveCalls()))
+	assert.Equal(t, int64(456), mockLogger.SaveCalls()[0].Msg.ChatID)
+	require.Equal(t, 1, len(mockAPI.SendCalls()))
+	assert.Equal(t, int64(456), mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).ChatID)
+
+	// ban and delete routed to the chat the message came from
+	require.Equal(t, 2, len(mockAPI.RequestCalls()))
+	assert.Equal(t, int64(456), mockAPI.RequestCalls()[0].C.(tbapi.BanChatMemberConfig).ChatID)
+	assert.Equal(t, 321, mockAPI.RequestCalls()[1].C.(tbapi.DeleteMessageConfig).MessageID)
+	assert.Equal(t, int64(456), mockAPI.RequestCalls()[1].C.(tbapi.DeleteMessageConfig).ChatID)
+}
+
 func TestTelegramListener_DoWithForwarded(t *testing.T) {
 	mockLogger := &mocks.SpamLoggerMock{SaveFunc: func(msg *bot.Message, response *bot.Response) {}}
 	mockAPI := &mocks.TbAPIMock{
@@ -711,6 +1223,66 @@ func TestTelegramListener_DoWithDirectWarnReport(t *testing.T) {
 	assert.Equal(t, int(0), mockAPI.RequestCalls()[1].C.(tbapi.DeleteMessageConfig).MessageID)
 }
 
+func TestTelegramListener_DoWithCaptcha(t *testing.T) {
+	mockLogger := &mocks.SpamLoggerMock{SaveFunc: func(msg *bot.Message, response *bot.Response) {}}
+	mockAPI := &mocks.TbAPIMock{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+			return tbapi.Chat{ID: 123}, nil
+		},
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			return tbapi.Message{MessageID: 42}, nil
+		},
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+			return &tbapi.APIResponse{Ok: true}, nil
+		},
+		GetChatAdministratorsFunc: func(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error) { return nil, nil },
+	}
+	b := &mocks.BotMock{
+		OnMessageFunc:       func(msg bot.Message) bot.Response { return bot.Response{} },
+		IsApprovedUserFunc:  func(chatID, userID int64) bool { return userID == 3 },
+		AddApprovedUserFunc: func(id int64, name string) error { return nil },
+	}
+
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+
+	l := TelegramListener{
+		SpamLogger:     mockLogger,
+		TbAPI:          mockAPI,
+		Bot:            b,
+		Group:          "gr",
+		SuperUsers:     SuperUsers{"super"},
+		Locator:        locator,
+		CaptchaTimeout: time.Minute,
+		CaptchaApprove: true,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Minute)
+	defer cancel()
+
+	updChan := make(chan tbapi.Update, 2)
+	updChan <- tbapi.Update{Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 123}, From: &tbapi.User{ID: 1, UserName: "user1"},
+		NewChatMembers: []tbapi.User{{ID: 1, UserName: "user1"}, {ID: 2, UserName: "super"}, {ID: 3, UserName: "approved"}}}}
+	updChan <- tbapi.Update{CallbackQuery: &tbapi.CallbackQuery{ID: "q1", Data: "~1:ok", From: &tbapi.User{ID: 1},
+		Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 123}}}}
+	close(updChan)
+	mockAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+	err := l.Do(ctx)
+	assert.EqualError(t, err, "telegram update chan closed")
+
+	require.Len(t, mockAPI.SendCalls(), 1, "challenge sent to user1 only")
+	assert.Contains(t, mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text, "[user1](tg://user?id=1)")
+	require.Len(t, mockAPI.RequestCalls(), 4, "restrict, answer callback, lift restrictions, delete challenge")
+	assert.False(t, mockAPI.RequestCalls()[0].C.(tbapi.RestrictChatMemberConfig).Permissions.CanSendMessages)
+	assert.True(t, mockAPI.RequestCalls()[2].C.(tbapi.RestrictChatMemberConfig).Permissions.CanSendMessages)
+	require.Len(t, b.AddApprovedUserCalls(), 1)
+	assert.Equal(t, int64(1), b.AddApprovedUserCalls()[0].ID)
+	require.Len(t, b.IsApprovedUserCalls(), 2, "superuser not checked")
+	assert.Equal(t, int64(123), b.IsApprovedUserCalls()[0].ChatID)
+	assert.Empty(t, b.OnMessageCalls(), "new members message not checked for spam")
+}
+
 func TestTelegramListener_DoWithAdminUnBan(t *testing.T) {
 	mockLogger := &mocks.SpamLoggerMock{}
 	mockAPI := &mocks.TbAPIMock{
@@ -737,6 +1309,9 @@ func TestTelegramListener_DoWithAdminUnBan(t *testing.T) {
 
 	locator, teardown := prepTestLocator(t)
 	defer teardown()
+	checks := []spamcheck.Response{{Name: "similarity", Spam: true, Details: "0.55/0.50"}}
+	require.NoError(t, locator.AddSpam(777, checks))
+	decisions := &mocks.DecisionsMock{AddFunc: func(entry storage.DecisionInfo) error { return nil }}
 
 	l := TelegramListener{
 		SpamLogger: mockLogger,
@@ -746,6 +1321,7 @@ func TestTelegramListener_DoWithAdminUnBan(t *testing.T) {
 		Group:      "gr",
 		Locator:    locator,
 		AdminGroup: "123",
+		Decisions:  decisions,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Minute)
@@ -782,6 +1358,9 @@ func TestTelegramListener_DoWithAdminUnBan(t *testing.T) {
 	assert.Equal(t, "this was the ham, not spam", b.UpdateHamCalls()[0].Msg)
 	require.Equal(t, 1, len(b.AddApprovedUserCalls()))
 	assert.Equal(t, int64(777), b.AddApprovedUserCalls()[0].ID)
+	require.Equal(t, 1, len(decisions.AddCalls()))
+	assert.Equal(t, storage.DecisionInfo{UserID: 777, ChatID: 123, Text: "this was the ham, not spam", Spam: false,
+		AdminName: "admin", Checks: checks}, decisions.AddCalls()[0].Entry)
 }
 
 func TestTelegramListener_DoWithAdminSoftUnBan(t *testing.T) {
@@ -1027,6 +1606,7 @@ func TestTelegramListener_DoWithAdminUnbanDecline(t *testing.T) {
 
 	locator, teardown := prepTestLocator(t)
 	defer teardown()
+	decisions := &mocks.DecisionsMock{AddFunc: func(entry storage.DecisionInfo) error { return nil }}
 
 	l := TelegramListener{
 		SpamLogger: mockLogger,
@@ -1036,6 +1616,7 @@ func TestTelegramListener_DoWithAdminUnbanDecline(t *testing.T) {
 		Group:      "gr",
 		Locator:    locator,
 		AdminGroup: "123",
+		Decisions:  decisions,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Minute)
@@ -1070,6 +1651,9 @@ func TestTelegramListener_DoWithAdminUnbanDecline(t *testing.T) {
 	assert.Equal(t, 1, len(b.UpdateSpamCalls()))
 	assert.Equal(t, 0, len(b.UpdateHamCalls()))
 	require.Equal(t, 0, len(b.AddApprovedUserCalls()))
+	require.Equal(t, 1, len(decisions.AddCalls()))
+	assert.Equal(t, storage.DecisionInfo{UserID: 999, ChatID: 123, Text: "this was the ham, not spam", Spam: true,
+		AdminName: "admin"}, decisions.AddCalls()[0].Entry, "no checks found for the user")
 }
 
 func TestTelegramListener_DoWithAdminBanConfirmedTraining(t *testing.T) {
@@ -1218,6 +1802,42 @@ func TestTelegramListener_DoWithAdminShowInfo(t *testing.T) {
 	require.Equal(t, 0, len(b.AddApprovedUserCalls()))
 }
 
+func TestTelegramListener_tune(t *testing.T) {
+	checks := []spamcheck.Response{{Name: "similarity", Spam: true, Details: "0.55/0.50"}}
+	decisions := &mocks.DecisionsMock{ReadFunc: func() ([]storage.DecisionInfo, error) {
+		return []storage.DecisionInfo{{UserID: 1, ChatID: 123, Spam: false, Checks: checks}}, nil
+	}}
+	mockAPI := &mocks.TbAPIMock{SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{}, nil }}
+	res := bot.TuneResult{Decisions: 1, Current: bot.Thresholds{Similarity: 0.5, MinSpamProbability: 50},
+		Suggested: bot.Thresholds{Similarity: 0.56, MinSpamProbability: 50}, FalsePositives: 1}
+	isNew := true
+	tuner := &mocks.TunerMock{TuneFunc: func(decisions []bot.Decision) (bot.TuneResult, bool) { return res, isNew }}
+
+	l := TelegramListener{TbAPI: mockAPI, Decisions: decisions, Tuner: tuner, adminChatID: 456}
+
+	require.NoError(t, l.tune())
+	require.Len(t, tuner.TuneCalls(), 1)
+	assert.Equal(t, []bot.Decision{{ChatID: 123, Spam: false, Checks: checks}}, tuner.TuneCalls()[0].Decisions)
+	require.Len(t, mockAPI.SendCalls(), 1)
+	msg := mockAPI.SendCalls()[0].C.(tbapi.MessageConfig)
+	assert.Equal(t, int64(456), msg.ChatID)
+	assert.Equal(t, "**suggested detector thresholds**\n\n- similarity threshold: 0.50 -> 0.56\n"+
+		"- min spam probability: 50% -> 50%\n- false positives: 1 -> 0\n- missed spam: 0 -> 0\n\n"+
+		"based on 1 moderator decisions", msg.Text)
+
+	res.Applied = true
+	require.NoError(t, l.tune())
+	require.Len(t, mockAPI.SendCalls(), 2)
+	assert.Contains(t, mockAPI.SendCalls()[1].C.(tbapi.MessageConfig).Text, "**applied detector thresholds**")
+
+	isNew = false
+	require.NoError(t, l.tune())
+	assert.Len(t, mockAPI.SendCalls(), 2, "nothing new to report")
+
+	decisions.ReadFunc = func() ([]storage.DecisionInfo, error) { return nil, errors.New("db error") }
+	assert.EqualError(t, l.tune(), "failed to read decisions: db error")
+}
+
 func TestTelegramListener_isChatAllowed(t *testing.T) {
 	testCases := []struct {
 		name       string
@@ -1247,12 +1867,20 @@ func TestTelegramListener_isChatAllowed(t *testing.T) {
 			testingIDs: []int64{456},
 			expect:     false,
 		},
+		{
+			name:       "Chat is allowed - fromChat in additional groups",
+			fromChat:   555,
+			chatID:     123,
+			testingIDs: []int64{456},
+			expect:     true,
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			listener := TelegramListener{
 				chatID:     tc.chatID,
+				chatIDs:    map[int64]string{tc.chatID: "primary", 555: "additional"},
 				TestingIDs: tc.testingIDs,
 			}
 			result := listener.isChatAllowed(tc.fromChat)
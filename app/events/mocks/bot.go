@@ -17,7 +17,7 @@ import (
 //			AddApprovedUserFunc: func(id int64, name string) error {
 //				panic("mock out the AddApprovedUser method")
 //			},
-//			IsApprovedUserFunc: func(userID int64) bool {
+//			IsApprovedUserFunc: func(chatID int64, userID int64) bool {
 //				panic("mock out the IsApprovedUser method")
 //			},
 //			OnMessageFunc: func(msg bot.Message) bot.Response {
@@ -32,6 +32,9 @@ import (
 //			UpdateSpamFunc: func(msg string) error {
 //				panic("mock out the UpdateSpam method")
 //			},
+//			VerifyLLMFunc: func(msg bot.Message, resp bot.Response) bot.Response {
+//				panic("mock out the VerifyLLM method")
+//			},
 //		}
 //
 //		// use mockedBot in code that requires events.Bot
@@ -43,7 +46,7 @@ type BotMock struct {
 	AddApprovedUserFunc func(id int64, name string) error
 
 	// IsApprovedUserFunc mocks the IsApprovedUser method.
-	IsApprovedUserFunc func(userID int64) bool
+	IsApprovedUserFunc func(chatID int64, userID int64) bool
 
 	// OnMessageFunc mocks the OnMessage method.
 	OnMessageFunc func(msg bot.Message) bot.Response
@@ -57,6 +60,9 @@ type BotMock struct {
 	// UpdateSpamFunc mocks the UpdateSpam method.
 	UpdateSpamFunc func(msg string) error
 
+	// VerifyLLMFunc mocks the VerifyLLM method.
+	VerifyLLMFunc func(msg bot.Message, resp bot.Response) bot.Response
+
 	// calls tracks calls to the methods.
 	calls struct {
 		// AddApprovedUser holds details about calls to the AddApprovedUser method.
@@ -68,6 +74,8 @@ type BotMock struct {
 		}
 		// IsApprovedUser holds details about calls to the IsApprovedUser method.
 		IsApprovedUser []struct {
+			// ChatID is the chatID argument value.
+			ChatID int64
 			// UserID is the userID argument value.
 			UserID int64
 		}
@@ -91,6 +99,13 @@ type BotMock struct {
 			// Msg is the msg argument value.
 			Msg string
 		}
+		// VerifyLLM holds details about calls to the VerifyLLM method.
+		VerifyLLM []struct {
+			// Msg is the msg argument value.
+			Msg bot.Message
+			// Resp is the resp argument value.
+			Resp bot.Response
+		}
 	}
 	lockAddApprovedUser    sync.RWMutex
 	lockIsApprovedUser     sync.RWMutex
@@ -98,6 +113,7 @@ type BotMock struct {
 	lockRemoveApprovedUser sync.RWMutex
 	lockUpdateHam          sync.RWMutex
 	lockUpdateSpam         sync.RWMutex
+	lockVerifyLLM          sync.RWMutex
 }
 
 // AddApprovedUser calls AddApprovedUserFunc.
@@ -144,19 +160,21 @@ func (mock *BotMock) ResetAddApprovedUserCalls() {
 }
 
 // IsApprovedUser calls IsApprovedUserFunc.
-func (mock *BotMock) IsApprovedUser(userID int64) bool {
+func (mock *BotMock) IsApprovedUser(chatID int64, userID int64) bool {
 	if mock.IsApprovedUserFunc == nil {
 		panic("BotMock.IsApprovedUserFunc: method is nil but Bot.IsApprovedUser was just called")
 	}
 	callInfo := struct {
+		ChatID int64
 		UserID int64
 	}{
+		ChatID: chatID,
 		UserID: userID,
 	}
 	mock.lockIsApprovedUser.Lock()
 	mock.calls.IsApprovedUser = append(mock.calls.IsApprovedUser, callInfo)
 	mock.lockIsApprovedUser.Unlock()
-	return mock.IsApprovedUserFunc(userID)
+	return mock.IsApprovedUserFunc(chatID, userID)
 }
 
 // IsApprovedUserCalls gets all the calls that were made to IsApprovedUser.
@@ -164,9 +182,11 @@ func (mock *BotMock) IsApprovedUser(userID int64) bool {
 //
 //	len(mockedBot.IsApprovedUserCalls())
 func (mock *BotMock) IsApprovedUserCalls() []struct {
+	ChatID int64
 	UserID int64
 } {
 	var calls []struct {
+		ChatID int64
 		UserID int64
 	}
 	mock.lockIsApprovedUser.RLock()
@@ -338,6 +358,49 @@ func (mock *BotMock) ResetUpdateSpamCalls() {
 	mock.lockUpdateSpam.Unlock()
 }
 
+// VerifyLLM calls VerifyLLMFunc.
+func (mock *BotMock) VerifyLLM(msg bot.Message, resp bot.Response) bot.Response {
+	if mock.VerifyLLMFunc == nil {
+		panic("BotMock.VerifyLLMFunc: method is nil but Bot.VerifyLLM was just called")
+	}
+	callInfo := struct {
+		Msg  bot.Message
+		Resp bot.Response
+	}{
+		Msg:  msg,
+		Resp: resp,
+	}
+	mock.lockVerifyLLM.Lock()
+	mock.calls.VerifyLLM = append(mock.calls.VerifyLLM, callInfo)
+	mock.lockVerifyLLM.Unlock()
+	return mock.VerifyLLMFunc(msg, resp)
+}
+
+// VerifyLLMCalls gets all the calls that were made to VerifyLLM.
+// Check the length with:
+//
+//	len(mockedBot.VerifyLLMCalls())
+func (mock *BotMock) VerifyLLMCalls() []struct {
+	Msg  bot.Message
+	Resp bot.Response
+} {
+	var calls []struct {
+		Msg  bot.Message
+		Resp bot.Response
+	}
+	mock.lockVerifyLLM.RLock()
+	calls = mock.calls.VerifyLLM
+	mock.lockVerifyLLM.RUnlock()
+	return calls
+}
+
+// ResetVerifyLLMCalls reset all the calls that were made to VerifyLLM.
+func (mock *BotMock) ResetVerifyLLMCalls() {
+	mock.lockVerifyLLM.Lock()
+	mock.calls.VerifyLLM = nil
+	mock.lockVerifyLLM.Unlock()
+}
+
 // ResetCalls reset all the calls that were made to all mocked methods.
 func (mock *BotMock) ResetCalls() {
 	mock.lockAddApprovedUser.Lock()
@@ -363,4 +426,8 @@ func (mock *BotMock) ResetCalls() {
 	mock.lockUpdateSpam.Lock()
 	mock.calls.UpdateSpam = nil
 	mock.lockUpdateSpam.Unlock()
+
+	mock.lockVerifyLLM.Lock()
+	mock.calls.VerifyLLM = nil
+	mock.lockVerifyLLM.Unlock()
 }
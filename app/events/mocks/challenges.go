@@ -0,0 +1,200 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package mocks
+
+import (
+	"github.com/umputun/tg-spam/app/storage"
+	"sync"
+)
+
+// ChallengesMock is a mock implementation of events.Challenges.
+//
+//	func TestSomethingThatUsesChallenges(t *testing.T) {
+//
+//		// make and configure a mocked events.Challenges
+//		mockedChallenges := &ChallengesMock{
+//			AddFunc: func(entry storage.ChallengeInfo) error {
+//				panic("mock out the Add method")
+//			},
+//			DeleteFunc: func(chatID int64, userID int64, msgID int) error {
+//				panic("mock out the Delete method")
+//			},
+//			ReadFunc: func() ([]storage.ChallengeInfo, error) {
+//				panic("mock out the Read method")
+//			},
+//		}
+//
+//		// use mockedChallenges in code that requires events.Challenges
+//		// and then make assertions.
+//
+//	}
+type ChallengesMock struct {
+	// AddFunc mocks the Add method.
+	AddFunc func(entry storage.ChallengeInfo) error
+
+	// DeleteFunc mocks the Delete method.
+	DeleteFunc func(chatID int64, userID int64, msgID int) error
+
+	// ReadFunc mocks the Read method.
+	ReadFunc func() ([]storage.ChallengeInfo, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Add holds details about calls to the Add method.
+		Add []struct {
+			// Entry is the entry argument value.
+			Entry storage.ChallengeInfo
+		}
+		// Delete holds details about calls to the Delete method.
+		Delete []struct {
+			// ChatID is the chatID argument value.
+			ChatID int64
+			// UserID is the userID argument value.
+			UserID int64
+			// MsgID is the msgID argument value.
+			MsgID int
+		}
+		// Read holds details about calls to the Read method.
+		Read []struct {
+		}
+	}
+	lockAdd    sync.RWMutex
+	lockDelete sync.RWMutex
+	lockRead   sync.RWMutex
+}
+
+// Add calls AddFunc.
+func (mock *ChallengesMock) Add(entry storage.ChallengeInfo) error {
+	if mock.AddFunc == nil {
+		panic("ChallengesMock.AddFunc: method is nil but Challenges.Add was just called")
+	}
+	callInfo := struct {
+		Entry storage.ChallengeInfo
+	}{
+		Entry: entry,
+	}
+	mock.lockAdd.Lock()
+	mock.calls.Add = append(mock.calls.Add, callInfo)
+	mock.lockAdd.Unlock()
+	return mock.AddFunc(entry)
+}
+
+// AddCalls gets all the calls that were made to Add.
+// Check the length with:
+//
+//	len(mockedChallenges.AddCalls())
+func (mock *ChallengesMock) AddCalls() []struct {
+	Entry storage.ChallengeInfo
+} {
+	var calls []struct {
+		Entry storage.ChallengeInfo
+	}
+	mock.lockAdd.RLock()
+	calls = mock.calls.Add
+	mock.lockAdd.RUnlock()
+	return calls
+}
+
+// ResetAddCalls reset all the calls that were made to Add.
+func (mock *ChallengesMock) ResetAddCalls() {
+	mock.lockAdd.Lock()
+	mock.calls.Add = nil
+	mock.lockAdd.Unlock()
+}
+
+// Delete calls DeleteFunc.
+func (mock *ChallengesMock) Delete(chatID int64, userID int64, msgID int) error {
+	if mock.DeleteFunc == nil {
+		panic("ChallengesMock.DeleteFunc: method is nil but Challenges.Delete was just called")
+	}
+	callInfo := struct {
+		ChatID int64
+		UserID int64
+		MsgID  int
+	}{
+		ChatID: chatID,
+		UserID: userID,
+		MsgID:  msgID,
+	}
+	mock.lockDelete.Lock()
+	mock.calls.Delete = append(mock.calls.Delete, callInfo)
+	mock.lockDelete.Unlock()
+	return mock.DeleteFunc(chatID, userID, msgID)
+}
+
+// DeleteCalls gets all the calls that were made to Delete.
+// Check the length with:
+//
+//	len(mockedChallenges.DeleteCalls())
+func (mock *ChallengesMock) DeleteCalls() []struct {
+	ChatID int64
+	UserID int64
+	MsgID  int
+} {
+	var calls []struct {
+		ChatID int64
+		UserID int64
+		MsgID  int
+	}
+	mock.lockDelete.RLock()
+	calls = mock.calls.Delete
+	mock.lockDelete.RUnlock()
+	return calls
+}
+
+// ResetDeleteCalls reset all the calls that were made to Delete.
+func (mock *ChallengesMock) ResetDeleteCalls() {
+	mock.lockDelete.Lock()
+	mock.calls.Delete = nil
+	mock.lockDelete.Unlock()
+}
+
+// Read calls ReadFunc.
+func (mock *ChallengesMock) Read() ([]storage.ChallengeInfo, error) {
+	if mock.ReadFunc == nil {
+		panic("ChallengesMock.ReadFunc: method is nil but Challenges.Read was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockRead.Lock()
+	mock.calls.Read = append(mock.calls.Read, callInfo)
+	mock.lockRead.Unlock()
+	return mock.ReadFunc()
+}
+
+// ReadCalls gets all the calls that were made to Read.
+// Check the length with:
+//
+//	len(mockedChallenges.ReadCalls())
+func (mock *ChallengesMock) ReadCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockRead.RLock()
+	calls = mock.calls.Read
+	mock.lockRead.RUnlock()
+	return calls
+}
+
+// ResetReadCalls reset all the calls that were made to Read.
+func (mock *ChallengesMock) ResetReadCalls() {
+	mock.lockRead.Lock()
+	mock.calls.Read = nil
+	mock.lockRead.Unlock()
+}
+
+// ResetCalls reset all the calls that were made to all mocked methods.
+func (mock *ChallengesMock) ResetCalls() {
+	mock.lockAdd.Lock()
+	mock.calls.Add = nil
+	mock.lockAdd.Unlock()
+
+	mock.lockDelete.Lock()
+	mock.calls.Delete = nil
+	mock.lockDelete.Unlock()
+
+	mock.lockRead.Lock()
+	mock.calls.Read = nil
+	mock.lockRead.Unlock()
+}
@@ -0,0 +1,133 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package mocks
+
+import (
+	"github.com/umputun/tg-spam/app/storage"
+	"sync"
+)
+
+// DecisionsMock is a mock implementation of events.Decisions.
+//
+//	func TestSomethingThatUsesDecisions(t *testing.T) {
+//
+//		// make and configure a mocked events.Decisions
+//		mockedDecisions := &DecisionsMock{
+//			AddFunc: func(entry storage.DecisionInfo) error {
+//				panic("mock out the Add method")
+//			},
+//			ReadFunc: func() ([]storage.DecisionInfo, error) {
+//				panic("mock out the Read method")
+//			},
+//		}
+//
+//		// use mockedDecisions in code that requires events.Decisions
+//		// and then make assertions.
+//
+//	}
+type DecisionsMock struct {
+	// AddFunc mocks the Add method.
+	AddFunc func(entry storage.DecisionInfo) error
+
+	// ReadFunc mocks the Read method.
+	ReadFunc func() ([]storage.DecisionInfo, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Add holds details about calls to the Add method.
+		Add []struct {
+			// Entry is the entry argument value.
+			Entry storage.DecisionInfo
+		}
+		// Read holds details about calls to the Read method.
+		Read []struct {
+		}
+	}
+	lockAdd  sync.RWMutex
+	lockRead sync.RWMutex
+}
+
+// Add calls AddFunc.
+func (mock *DecisionsMock) Add(entry storage.DecisionInfo) error {
+	if mock.AddFunc == nil {
+		panic("DecisionsMock.AddFunc: method is nil but Decisions.Add was just called")
+	}
+	callInfo := struct {
+		Entry storage.DecisionInfo
+	}{
+		Entry: entry,
+	}
+	mock.lockAdd.Lock()
+	mock.calls.Add = append(mock.calls.Add, callInfo)
+	mock.lockAdd.Unlock()
+	return mock.AddFunc(entry)
+}
+
+// AddCalls gets all the calls that were made to Add.
+// Check the length with:
+//
+//	len(mockedDecisions.AddCalls())
+func (mock *DecisionsMock) AddCalls() []struct {
+	Entry storage.DecisionInfo
+} {
+	var calls []struct {
+		Entry storage.DecisionInfo
+	}
+	mock.lockAdd.RLock()
+	calls = mock.calls.Add
+	mock.lockAdd.RUnlock()
+	return calls
+}
+
+// ResetAddCalls reset all the calls that were made to Add.
+func (mock *DecisionsMock) ResetAddCalls() {
+	mock.lockAdd.Lock()
+	mock.calls.Add = nil
+	mock.lockAdd.Unlock()
+}
+
+// Read calls ReadFunc.
+func (mock *DecisionsMock) Read() ([]storage.DecisionInfo, error) {
+	if mock.ReadFunc == nil {
+		panic("DecisionsMock.ReadFunc: method is nil but Decisions.Read was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockRead.Lock()
+	mock.calls.Read = append(mock.calls.Read, callInfo)
+	mock.lockRead.Unlock()
+	return mock.ReadFunc()
+}
+
+// ReadCalls gets all the calls that were made to Read.
+// Check the length with:
+//
+//	len(mockedDecisions.ReadCalls())
+func (mock *DecisionsMock) ReadCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockRead.RLock()
+	calls = mock.calls.Read
+	mock.lockRead.RUnlock()
+	return calls
+}
+
+// ResetReadCalls reset all the calls that were made to Read.
+func (mock *DecisionsMock) ResetReadCalls() {
+	mock.lockRead.Lock()
+	mock.calls.Read = nil
+	mock.lockRead.Unlock()
+}
+
+// ResetCalls reset all the calls that were made to all mocked methods.
+func (mock *DecisionsMock) ResetCalls() {
+	mock.lockAdd.Lock()
+	mock.calls.Add = nil
+	mock.lockAdd.Unlock()
+
+	mock.lockRead.Lock()
+	mock.calls.Read = nil
+	mock.lockRead.Unlock()
+}
@@ -0,0 +1,96 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package mocks
+
+import (
+	"sync"
+)
+
+// SpamImagesMock is a mock implementation of events.SpamImages.
+//
+//	func TestSomethingThatUsesSpamImages(t *testing.T) {
+//
+//		// make and configure a mocked events.SpamImages
+//		mockedSpamImages := &SpamImagesMock{
+//			AddFunc: func(hash uint64, fileID string, userID int64) error {
+//				panic("mock out the Add method")
+//			},
+//		}
+//
+//		// use mockedSpamImages in code that requires events.SpamImages
+//		// and then make assertions.
+//
+//	}
+type SpamImagesMock struct {
+	// AddFunc mocks the Add method.
+	AddFunc func(hash uint64, fileID string, userID int64) error
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Add holds details about calls to the Add method.
+		Add []struct {
+			// Hash is the hash argument value.
+			Hash uint64
+			// FileID is the fileID argument value.
+			FileID string
+			// UserID is the userID argument value.
+			UserID int64
+		}
+	}
+	lockAdd sync.RWMutex
+}
+
+// Add calls AddFunc.
+func (mock *SpamImagesMock) Add(hash uint64, fileID string, userID int64) error {
+	if mock.AddFunc == nil {
+		panic("SpamImagesMock.AddFunc: method is nil but SpamImages.Add was just called")
+	}
+	callInfo := struct {
+		Hash   uint64
+		FileID string
+		UserID int64
+	}{
+		Hash:   hash,
+		FileID: fileID,
+		UserID: userID,
+	}
+	mock.lockAdd.Lock()
+	mock.calls.Add = append(mock.calls.Add, callInfo)
+	mock.lockAdd.Unlock()
+	return mock.AddFunc(hash, fileID, userID)
+}
+
+// AddCalls gets all the calls that were made to Add.
+// Check the length with:
+//
+//	len(mockedSpamImages.AddCalls())
+func (mock *SpamImagesMock) AddCalls() []struct {
+	Hash   uint64
+	FileID string
+	UserID int64
+} {
+	var calls []struct {
+		Hash   uint64
+		FileID string
+		UserID int64
+	}
+	mock.lockAdd.RLock()
+	calls = mock.calls.Add
+	mock.lockAdd.RUnlock()
+	return calls
+}
+
+// ResetAddCalls reset all the calls that were made to Add.
+func (mock *SpamImagesMock) ResetAddCalls() {
+	mock.lockAdd.Lock()
+	mock.calls.Add = nil
+	mock.lockAdd.Unlock()
+}
+
+// ResetCalls reset all the calls that were made to all mocked methods.
+func (mock *SpamImagesMock) ResetCalls() {
+	mock.lockAdd.Lock()
+	mock.calls.Add = nil
+	mock.lockAdd.Unlock()
+}
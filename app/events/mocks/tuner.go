@@ -0,0 +1,85 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package mocks
+
+import (
+	"github.com/umputun/tg-spam/app/bot"
+	"sync"
+)
+
+// TunerMock is a mock implementation of events.Tuner.
+//
+//	func TestSomethingThatUsesTuner(t *testing.T) {
+//
+//		// make and configure a mocked events.Tuner
+//		mockedTuner := &TunerMock{
+//			TuneFunc: func(decisions []bot.Decision) (bot.TuneResult, bool) {
+//				panic("mock out the Tune method")
+//			},
+//		}
+//
+//		// use mockedTuner in code that requires events.Tuner
+//		// and then make assertions.
+//
+//	}
+type TunerMock struct {
+	// TuneFunc mocks the Tune method.
+	TuneFunc func(decisions []bot.Decision) (bot.TuneResult, bool)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Tune holds details about calls to the Tune method.
+		Tune []struct {
+			// Decisions is the decisions argument value.
+			Decisions []bot.Decision
+		}
+	}
+	lockTune sync.RWMutex
+}
+
+// Tune calls TuneFunc.
+func (mock *TunerMock) Tune(decisions []bot.Decision) (bot.TuneResult, bool) {
+	if mock.TuneFunc == nil {
+		panic("TunerMock.TuneFunc: method is nil but Tuner.Tune was just called")
+	}
+	callInfo := struct {
+		Decisions []bot.Decision
+	}{
+		Decisions: decisions,
+	}
+	mock.lockTune.Lock()
+	mock.calls.Tune = append(mock.calls.Tune, callInfo)
+	mock.lockTune.Unlock()
+	return mock.TuneFunc(decisions)
+}
+
+// TuneCalls gets all the calls that were made to Tune.
+// Check the length with:
+//
+//	len(mockedTuner.TuneCalls())
+func (mock *TunerMock) TuneCalls() []struct {
+	Decisions []bot.Decision
+} {
+	var calls []struct {
+		Decisions []bot.Decision
+	}
+	mock.lockTune.RLock()
+	calls = mock.calls.Tune
+	mock.lockTune.RUnlock()
+	return calls
+}
+
+// ResetTuneCalls reset all the calls that were made to Tune.
+func (mock *TunerMock) ResetTuneCalls() {
+	mock.lockTune.Lock()
+	mock.calls.Tune = nil
+	mock.lockTune.Unlock()
+}
+
+// ResetCalls reset all the calls that were made to all mocked methods.
+func (mock *TunerMock) ResetCalls() {
+	mock.lockTune.Lock()
+	mock.calls.Tune = nil
+	mock.lockTune.Unlock()
+}
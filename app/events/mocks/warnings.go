@@ -0,0 +1,147 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package mocks
+
+import (
+	"github.com/umputun/tg-spam/app/storage"
+	"sync"
+	"time"
+)
+
+// WarningsMock is a mock implementation of events.Warnings.
+//
+//	func TestSomethingThatUsesWarnings(t *testing.T) {
+//
+//		// make and configure a mocked events.Warnings
+//		mockedWarnings := &WarningsMock{
+//			AddFunc: func(entry storage.WarningInfo) error {
+//				panic("mock out the Add method")
+//			},
+//			CountFunc: func(userID int64, since time.Time) (int, error) {
+//				panic("mock out the Count method")
+//			},
+//		}
+//
+//		// use mockedWarnings in code that requires events.Warnings
+//		// and then make assertions.
+//
+//	}
+type WarningsMock struct {
+	// AddFunc mocks the Add method.
+	AddFunc func(entry storage.WarningInfo) error
+
+	// CountFunc mocks the Count method.
+	CountFunc func(userID int64, since time.Time) (int, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Add holds details about calls to the Add method.
+		Add []struct {
+			// Entry is the entry argument value.
+			Entry storage.WarningInfo
+		}
+		// Count holds details about calls to the Count method.
+		Count []struct {
+			// UserID is the userID argument value.
+			UserID int64
+			// Since is the since argument value.
+			Since time.Time
+		}
+	}
+	lockAdd   sync.RWMutex
+	lockCount sync.RWMutex
+}
+
+// Add calls AddFunc.
+func (mock *WarningsMock) Add(entry storage.WarningInfo) error {
+	if mock.AddFunc == nil {
+		panic("WarningsMock.AddFunc: method is nil but Warnings.Add was just called")
+	}
+	callInfo := struct {
+		Entry storage.WarningInfo
+	}{
+		Entry: entry,
+	}
+	mock.lockAdd.Lock()
+	mock.calls.Add = append(mock.calls.Add, callInfo)
+	mock.lockAdd.Unlock()
+	return mock.AddFunc(entry)
+}
+
+// AddCalls gets all the calls that were made to Add.
+// Check the length with:
+//
+//	len(mockedWarnings.AddCalls())
+func (mock *WarningsMock) AddCalls() []struct {
+	Entry storage.WarningInfo
+} {
+	var calls []struct {
+		Entry storage.WarningInfo
+	}
+	mock.lockAdd.RLock()
+	calls = mock.calls.Add
+	mock.lockAdd.RUnlock()
+	return calls
+}
+
+// ResetAddCalls reset all the calls that were made to Add.
+func (mock *WarningsMock) ResetAddCalls() {
+	mock.lockAdd.Lock()
+	mock.calls.Add = nil
+	mock.lockAdd.Unlock()
+}
+
+// Count calls CountFunc.
+func (mock *WarningsMock) Count(userID int64, since time.Time) (int, error) {
+	if mock.CountFunc == nil {
+		panic("WarningsMock.CountFunc: method is nil but Warnings.Count was just called")
+	}
+	callInfo := struct {
+		UserID int64
+		Since  time.Time
+	}{
+		UserID: userID,
+		Since:  since,
+	}
+	mock.lockCount.Lock()
+	mock.calls.Count = append(mock.calls.Count, callInfo)
+	mock.lockCount.Unlock()
+	return mock.CountFunc(userID, since)
+}
+
+// CountCalls gets all the calls that were made to Count.
+// Check the length with:
+//
+//	len(mockedWarnings.CountCalls())
+func (mock *WarningsMock) CountCalls() []struct {
+	UserID int64
+	Since  time.Time
+} {
+	var calls []struct {
+		UserID int64
+		Since  time.Time
+	}
+	mock.lockCount.RLock()
+	calls = mock.calls.Count
+	mock.lockCount.RUnlock()
+	return calls
+}
+
+// ResetCountCalls reset all the calls that were made to Count.
+func (mock *WarningsMock) ResetCountCalls() {
+	mock.lockCount.Lock()
+	mock.calls.Count = nil
+	mock.lockCount.Unlock()
+}
+
+// ResetCalls reset all the calls that were made to all mocked methods.
+func (mock *WarningsMock) ResetCalls() {
+	mock.lockAdd.Lock()
+	mock.calls.Add = nil
+	mock.lockAdd.Unlock()
+
+	mock.lockCount.Lock()
+	mock.calls.Count = nil
+	mock.lockCount.Unlock()
+}
@@ -37,6 +37,7 @@ type options struct {
 	Telegram struct {
 		Token        string        `long:"token" env:"TOKEN" description:"telegram bot token"`
 		Group        string        `long:"group" env:"GROUP" description:"group name/id"`
+		Groups       []string      `long:"groups" env:"GROUPS" env-delim:"," description:"additional group names/ids to monitor"`
 		Timeout      time.Duration `long:"timeout" env:"TIMEOUT" default:"30s" description:"http client timeout for telegram" `
 		IdleDuration time.Duration `long:"idle" env:"IDLE" default:"30s" description:"idle duration"`
 	} `group:"telegram" namespace:"telegram" env-namespace:"TELEGRAM"`
@@ -68,22 +69,50 @@ type options struct {
 		LinksLimit int  `long:"links-limit" env:"LINKS_LIMIT" default:"-1" description:"max links in message, disabled by default"`
 		ImageOnly  bool `long:"image-only" env:"IMAGE_ONLY" description:"enable image only check"`
 		LinksOnly  bool `long:"links-only" env:"LINKS_ONLY" description:"enable links only check"`
+
+		HiddenLinksLimit int     `long:"hidden-links-limit" env:"HIDDEN_LINKS_LIMIT" default:"-1" description:"max hidden links (text links and buttons) in message, disabled by default"`
+		Forward          bool    `long:"forward" env:"FORWARD" description:"enable forwarded from channel check"`
+		ForwardChannels  []int64 `long:"forward-channel" env:"FORWARD_CHANNELS" env-delim:"," description:"channels to check forwards from, all if not set"`
+		Domains          bool    `long:"domains" env:"DOMAINS" description:"enable allowed/blocked domains check"`
 	} `group:"meta" namespace:"meta" env-namespace:"META"`
 
+	ImageHash struct {
+		Enabled  bool `long:"enabled" env:"ENABLED" description:"enable known spam images check by perceptual hash"`
+		Distance int  `long:"distance" env:"DISTANCE" default:"5" description:"max hash distance to known spam image, 0-64"`
+	} `group:"image-hash" namespace:"image-hash" env-namespace:"IMAGE_HASH"`
+
 	OpenAI struct {
-		Token                            string `long:"token" env:"TOKEN" description:"openai token, disabled if not set"`
-		Veto                             bool   `long:"veto" env:"VETO" description:"veto mode, confirm detected spam"`
-		Prompt                           string `long:"prompt" env:"PROMPT" default:"" description:"openai system prompt, if empty uses builtin default"`
-		Model                            string `long:"model" env:"MODEL" default:"gpt-4" description:"openai model"`
-		MaxTokensResponse                int    `long:"max-tokens-response" env:"MAX_TOKENS_RESPONSE" default:"1024" description:"openai max tokens in response"`
-		MaxTokensRequestMaxTokensRequest int    `long:"max-tokens-request" env:"MAX_TOKENS_REQUEST" default:"2048" description:"openai max tokens in request"`
-		MaxSymbolsRequest                int    `long:"max-symbols-request" env:"MAX_SYMBOLS_REQUEST" default:"16000" description:"openai max symbols in request, failback if tokenizer failed"`
+		Token                            string        `long:"token" env:"TOKEN" description:"openai token, disabled if not set"`
+		Provider                         string        `long:"provider" env:"PROVIDER" choice:"openai" choice:"anthropic" choice:"gemini" default:"openai" description:"llm api provider"`
+		BaseURL                          string        `long:"base-url" env:"BASE_URL" description:"llm api base url, provider's default if not set"`
+		Veto                             bool          `long:"veto" env:"VETO" description:"veto mode, confirm detected spam"`
+		Prompt                           string        `long:"prompt" env:"PROMPT" default:"" description:"openai system prompt, if empty uses builtin default"`
+		Model                            string        `long:"model" env:"MODEL" default:"gpt-4" description:"openai model"`
+		MaxTokensResponse                int           `long:"max-tokens-response" env:"MAX_TOKENS_RESPONSE" default:"1024" description:"openai max tokens in response"`
+		MaxTokensRequestMaxTokensRequest int           `long:"max-tokens-request" env:"MAX_TOKENS_REQUEST" default:"2048" description:"openai max tokens in request"`
+		MaxSymbolsRequest                int           `long:"max-symbols-request" env:"MAX_SYMBOLS_REQUEST" default:"16000" description:"openai max symbols in request, failback if tokenizer failed"`
+		Timeout                          time.Duration `long:"timeout" env:"TIMEOUT" default:"30s" description:"openai check timeout, including retries"`
+		Retries                          int           `long:"retries" env:"RETRIES" default:"2" description:"openai retries on rate limit and server errors"`
+		CacheSize                        int           `long:"cache-size" env:"CACHE_SIZE" default:"1000" description:"openai responses cache size, 0 to disable"`
+		MaxCallsPerDay                   int           `long:"max-calls-per-day" env:"MAX_CALLS_PER_DAY" default:"0" description:"openai daily calls limit, 0 for unlimited"`
+		MaxTokensPerDay                  int           `long:"max-tokens-per-day" env:"MAX_TOKENS_PER_DAY" default:"0" description:"openai daily tokens limit, 0 for unlimited"`
+		Structured                       bool          `long:"structured" env:"STRUCTURED" description:"ask for structured answer with function calling or json schema"`
+		MinConfidence                    int           `long:"min-confidence" env:"MIN_CONFIDENCE" default:"0" description:"openai min confidence of spam answer, 0-100"`
+		Examples                         int           `long:"examples" env:"EXAMPLES" default:"0" description:"number of recent dynamic spam and ham samples sent as examples"`
+		Context                          bool          `long:"context" env:"CONTEXT" description:"send user and chat context with the message, using the default template"`
+		Template                         string        `long:"template" env:"TEMPLATE" description:"custom template of the message with context, enables context"`
+		ChatDescription                  string        `long:"chat-description" env:"CHAT_DESCRIPTION" description:"description of the group topic, sent with context"`
+		History                          int           `long:"history" env:"HISTORY" default:"0" description:"number of user's previous messages sent with context"`
+		Async                            bool          `long:"async" env:"ASYNC" description:"check with openai asynchronously, act on the verdict when it arrives"`
+		AsyncWorkers                     int           `long:"async-workers" env:"ASYNC_WORKERS" default:"4" description:"number of workers making async openai checks"`
 	} `group:"openai" namespace:"openai" env-namespace:"OPENAI"`
 
 	Files struct {
 		SamplesDataPath string        `long:"samples" env:"SAMPLES" default:"data" description:"samples data path"`
 		DynamicDataPath string        `long:"dynamic" env:"DYNAMIC" default:"data" description:"dynamic data path"`
 		WatchInterval   time.Duration `long:"watch-interval" env:"WATCH_INTERVAL" default:"5s" description:"watch interval for dynamic files"`
+		Profiles        string        `long:"profiles" env:"PROFILES" description:"per-group detector profiles file (json)"`
+		Shadow          string        `long:"shadow" env:"SHADOW" description:"shadow detector profile file (json), checked without acting"`
 	} `group:"files" namespace:"files" env-namespace:"FILES"`
 
 	SimilarityThreshold float64 `long:"similarity-threshold" env:"SIMILARITY_THRESHOLD" default:"0.5" description:"spam threshold"`
@@ -91,29 +120,65 @@ type options struct {
 	MaxEmoji            int     `long:"max-emoji" env:"MAX_EMOJI" default:"2" description:"max emoji count in message, -1 to disable check"`
 	MinSpamProbability  float64 `long:"min-probability" env:"MIN_PROBABILITY" default:"50" description:"min spam probability percent to ban"`
 	MultiLangWords      int     `long:"multi-lang" env:"MULTI_LANG" default:"0" description:"number of words in different languages to consider as spam"`
+	Tokenizer           string  `long:"tokenizer" env:"TOKENIZER" choice:"words" choice:"stem" choice:"ngram" default:"words" description:"tokenizer for classifier and similarity check"`
 
-	ParanoidMode       bool `long:"paranoid" env:"PARANOID" description:"paranoid mode, check all messages"`
-	FirstMessagesCount int  `long:"first-messages-count" env:"FIRST_MESSAGES_COUNT" default:"1" description:"number of first messages to check"`
+	ScoreThreshold float64            `long:"score-threshold" env:"SCORE_THRESHOLD" default:"0" description:"weighted score of checks to consider as spam, 0 - any check detected spam"`
+	CheckWeights   map[string]float64 `long:"check-weight" env:"CHECK_WEIGHT" env-delim:"," description:"weight of a check in the score, name:weight"`
+
+	ParanoidMode        bool `long:"paranoid" env:"PARANOID" description:"paranoid mode, check all messages"`
+	FirstMessagesCount  int  `long:"first-messages-count" env:"FIRST_MESSAGES_COUNT" default:"1" description:"number of first messages to check"`
+	CheckEdited         bool `long:"check-edited" env:"CHECK_EDITED" description:"check edited messages"`
+	CheckEditedApproved bool `long:"check-edited-approved" env:"CHECK_EDITED_APPROVED" description:"check edited messages from approved users"`
 
 	Message struct {
 		Startup string `long:"startup" env:"STARTUP" default:"" description:"startup message"`
 		Spam    string `long:"spam" env:"SPAM" default:"this is spam" description:"spam message"`
 		Dry     string `long:"dry" env:"DRY" default:"this is spam (dry mode)" description:"spam dry message"`
-		Warn    string `long:"warn" env:"WARN" default:"You've violated our rules and this is your first and last warning. Further violations will lead to permanent access denial. Stay compliant or face the consequences!" description:"warning message"`
+		Warn    string `long:"warn" env:"WARN" default:"You've violated our rules and got a warning. Further violations may lead to permanent access denial. Stay compliant or face the consequences!" description:"warning message"`
 	} `group:"message" namespace:"message" env-namespace:"MESSAGE"`
 
+	Warn struct {
+		Max    int           `long:"max" env:"MAX" default:"0" description:"max active warnings, the next warning bans the user, 0 - never ban"`
+		Expiry time.Duration `long:"expiry" env:"EXPIRY" default:"720h" description:"warning expiry, 0 - never expires"`
+	} `group:"warn" namespace:"warn" env-namespace:"WARN"`
+
 	Server struct {
 		Enabled    bool   `long:"enabled" env:"ENABLED" description:"enable web server"`
 		ListenAddr string `long:"listen" env:"LISTEN" default:":8080" description:"listen address"`
 		AuthPasswd string `long:"auth" env:"AUTH" default:"auto" description:"basic auth password for user 'tg-spam'"`
 	} `group:"server" namespace:"server" env-namespace:"SERVER"`
 
+	Policy struct {
+		Enabled          bool          `long:"enabled" env:"ENABLED" description:"enable graduated enforcement policy"`
+		RestrictScore    float64       `long:"restrict-score" env:"RESTRICT_SCORE" default:"1" description:"min spam score to restrict user"`
+		TempBanScore     float64       `long:"temp-ban-score" env:"TEMP_BAN_SCORE" default:"2" description:"min spam score to ban user temporarily"`
+		BanScore         float64       `long:"ban-score" env:"BAN_SCORE" default:"3" description:"min spam score to ban user permanently"`
+		RestrictDuration time.Duration `long:"restrict-duration" env:"RESTRICT_DURATION" default:"1h" description:"restriction duration"`
+		TempBanDuration  time.Duration `long:"temp-ban-duration" env:"TEMP_BAN_DURATION" default:"24h" description:"temporary ban duration"`
+	} `group:"policy" namespace:"policy" env-namespace:"POLICY"`
+
+	Tune struct {
+		Enabled      bool          `long:"enabled" env:"ENABLED" description:"enable thresholds tuning from moderator decisions"`
+		Interval     time.Duration `long:"interval" env:"INTERVAL" default:"24h" description:"thresholds tuning interval"`
+		MinDecisions int           `long:"min-decisions" env:"MIN_DECISIONS" default:"20" description:"min moderator decisions to suggest thresholds"`
+		Apply        bool          `long:"apply" env:"APPLY" description:"apply suggested thresholds, report only if not set"`
+	} `group:"tune" namespace:"tune" env-namespace:"TUNE"`
+
+	Captcha struct {
+		Enabled bool          `long:"enabled" env:"ENABLED" description:"enable captcha challenge for new members"`
+		Timeout time.Duration `long:"timeout" env:"TIMEOUT" default:"2m" description:"time to answer captcha challenge"`
+		Math    bool          `long:"math" env:"MATH" description:"ask simple math question instead of button press"`
+		Approve bool          `long:"approve" env:"APPROVE" description:"add members passed captcha to approved users"`
+	} `group:"captcha" namespace:"captcha" env-namespace:"CAPTCHA"`
+
 	Training bool `long:"training" env:"TRAINING" description:"training mode, passive spam detection only"`
 	SoftBan  bool `long:"soft-ban" env:"SOFT_BAN" description:"soft ban mode, restrict user actions but not ban"`
 
 	Dry   bool `long:"dry" env:"DRY" description:"dry mode, no bans"`
 	Dbg   bool `long:"dbg" env:"DEBUG" description:"debug mode"`
 	TGDbg bool `long:"tg-dbg" env:"TG_DEBUG" description:"telegram debug mode"`
+
+	Eval evalCommand `command:"eval" description:"evaluate spam detection on labelled data and samples"`
 }
 
 // file names
@@ -124,6 +189,9 @@ const (
 	stopWordsFile     = "stop-words.txt"     //nolint:gosec // false positive
 	dynamicSpamFile   = "spam-dynamic.txt"
 	dynamicHamFile    = "ham-dynamic.txt"
+	allowedDomains    = "allowed-domains.txt"
+	blockedDomains    = "blocked-domains.txt"
+	modelFile         = "classifier.model"
 	dataFile          = "tg-spam.db"
 )
 
@@ -163,6 +231,16 @@ func main() {
 	// expand, make absolute paths
 	opts.Files.DynamicDataPath = expandPath(opts.Files.DynamicDataPath)
 	opts.Files.SamplesDataPath = expandPath(opts.Files.SamplesDataPath)
+	opts.Files.Profiles = expandPath(opts.Files.Profiles)
+	opts.Files.Shadow = expandPath(opts.Files.Shadow)
+
+	if p.Active != nil && p.Active.Name == "eval" {
+		if err := runEval(opts, os.Stdout); err != nil {
+			log.Printf("[ERROR] %v", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	if err := execute(ctx, opts); err != nil {
 		log.Printf("[ERROR] %v", err)
@@ -211,22 +289,65 @@ func execute(ctx context.Context, opts options) error {
 	}
 	log.Printf("[DEBUG] approved users from: %s, loaded: %d", dataFile, count)
 
+	// make known spam images store and check images against it if enabled
+	var spamImagesStore *storage.SpamImages
+	extraChecks := []tgspam.MetaCheck{}
+	if opts.ImageHash.Enabled {
+		if spamImagesStore, err = storage.NewSpamImages(dataDB); err != nil {
+			return fmt.Errorf("can't make spam images store, %w", err)
+		}
+		log.Printf("[INFO] image hash check enabled, max distance: %d", opts.ImageHash.Distance)
+		extraChecks = append(extraChecks, tgspam.ImageHashCheck(spamImagesStore, opts.ImageHash.Distance))
+		detector.WithMetaChecks(extraChecks...)
+	}
+
 	// make spam bot
 	spamBot, err := makeSpamBot(ctx, opts, detector)
 	if err != nil {
 		return fmt.Errorf("can't make spam bot, %w", err)
 	}
 
+	// make per-group profiles, if any
+	if opts.Files.Profiles != "" {
+		if err := makeProfiles(opts, spamBot, approvedUsersStore, extraChecks...); err != nil {
+			return fmt.Errorf("can't make group profiles, %w", err)
+		}
+	}
+
+	// make shadow detector, if set
+	if opts.Files.Shadow != "" {
+		if err := makeShadow(opts, spamBot, dataDB, extraChecks...); err != nil {
+			return fmt.Errorf("can't make shadow detector, %w", err)
+		}
+	}
+
+	// make thresholds tuner, if enabled
+	var tuner *bot.Tuner
+	if opts.Tune.Enabled {
+		tuner = bot.NewTuner(spamBot, bot.TunerConfig{MinDecisions: opts.Tune.MinDecisions, Apply: opts.Tune.Apply,
+			ScoreThreshold: opts.ScoreThreshold})
+		log.Printf("[INFO] thresholds tuning enabled, interval: %v, min decisions: %d, apply: %v",
+			opts.Tune.Interval, opts.Tune.MinDecisions, opts.Tune.Apply)
+		if opts.ScoreThreshold > 0 {
+			log.Printf("[WARN] thresholds tuning is not supported with score threshold %.2f, nothing will be tuned",
+				opts.ScoreThreshold)
+		}
+	}
+
 	// make locator
 	locator, err := storage.NewLocator(opts.HistoryDuration, opts.HistoryMinSize, dataDB)
 	if err != nil {
 		return fmt.Errorf("can't make locator, %w", err)
 	}
+	if opts.OpenAI.Token != "" && opts.OpenAI.History > 0 {
+		log.Printf("[INFO] openai context includes %d previous messages of the user", opts.OpenAI.History)
+		spamBot.WithHistory(locator, opts.OpenAI.History)
+	}
 
 	// activate web server if enabled
 	if opts.Server.Enabled {
 		// server starts in background goroutine
-		if srvErr := activateServer(ctx, opts, spamBot, locator, dataDB); srvErr != nil {
+		if srvErr := activateServer(ctx, opts, spamBot, tuner, locator, dataDB); srvErr != nil {
 			return fmt.Errorf("can't activate web server, %w", srvErr)
 		}
 		// if no telegram token and group set, just run the server
@@ -257,15 +378,32 @@ func execute(ctx context.Context, opts options) error {
 		return fmt.Errorf("can't make spam logger, %w", err)
 	}
 
+	// make warnings store
+	warningsStore, err := storage.NewWarnings(dataDB)
+	if err != nil {
+		return fmt.Errorf("can't make warnings store, %w", err)
+	}
+
+	// make moderator decisions store
+	decisionsStore, err := storage.NewDecisions(dataDB)
+	if err != nil {
+		return fmt.Errorf("can't make decisions store, %w", err)
+	}
+
 	// make telegram listener
 	tgListener := events.TelegramListener{
 		TbAPI:                   tbAPI,
 		Group:                   opts.Telegram.Group,
+		Groups:                  opts.Telegram.Groups,
 		IdleDuration:            opts.Telegram.IdleDuration,
 		SuperUsers:              opts.SuperUsers,
 		Bot:                     spamBot,
 		StartupMsg:              opts.Message.Startup,
 		WarnMsg:                 opts.Message.Warn,
+		Warnings:                warningsStore,
+		Decisions:               decisionsStore,
+		MaxWarnings:             opts.Warn.Max,
+		WarnExpiry:              opts.Warn.Expiry,
 		NoSpamReply:             opts.NoSpamReply,
 		SpamLogger:              spamLogger,
 		AdminGroup:              opts.AdminGroup,
@@ -273,13 +411,50 @@ func execute(ctx context.Context, opts options) error {
 		Locator:                 locator,
 		TrainingMode:            opts.Training,
 		SoftBanMode:             opts.SoftBan,
+		CheckEdited:             opts.CheckEdited,
 		DisableAdminSpamForward: opts.DisableAdminSpamForward,
 		Dry:                     opts.Dry,
 	}
 
-	log.Printf("[DEBUG] telegram listener config: {group: %s, idle: %v, super: %v, admin: %s, testing: %v, no-reply: %v,"+
+	if spamImagesStore != nil {
+		tgListener.SpamImages = spamImagesStore
+	}
+
+	if tuner != nil {
+		tgListener.Tuner = tuner
+		tgListener.TuneInterval = opts.Tune.Interval
+	}
+
+	if opts.OpenAI.Async {
+		tgListener.LLMWorkers = opts.OpenAI.AsyncWorkers
+		tgListener.LLMTimeout = opts.OpenAI.Timeout
+	}
+
+	if opts.Captcha.Enabled {
+		tgListener.CaptchaTimeout = opts.Captcha.Timeout
+		tgListener.CaptchaMath = opts.Captcha.Math
+		tgListener.CaptchaApprove = opts.Captcha.Approve
+		challengesStore, err := storage.NewChallenges(dataDB)
+		if err != nil {
+			return fmt.Errorf("can't make captcha challenges store, %w", err)
+		}
+		tgListener.Challenges = challengesStore
+	}
+
+	if opts.Policy.Enabled {
+		tgListener.Policy = &bot.Policy{
+			RestrictScore:    opts.Policy.RestrictScore,
+			TempBanScore:     opts.Policy.TempBanScore,
+			BanScore:         opts.Policy.BanScore,
+			RestrictDuration: opts.Policy.RestrictDuration,
+			TempBanDuration:  opts.Policy.TempBanDuration,
+		}
+		log.Printf("[INFO] graduated enforcement policy enabled: %+v", *tgListener.Policy)
+	}
+
+	log.Printf("[DEBUG] telegram listener config: {group: %s, groups: %v, idle: %v, super: %v, admin: %s, testing: %v, no-reply: %v,"+
 		" dry: %v, training: %v}",
-		tgListener.Group, tgListener.IdleDuration, tgListener.SuperUsers, tgListener.AdminGroup,
+		tgListener.Group, tgListener.Groups, tgListener.IdleDuration, tgListener.SuperUsers, tgListener.AdminGroup,
 		tgListener.TestingIDs, tgListener.NoSpamReply, tgListener.Dry, tgListener.TrainingMode)
 
 	// run telegram listener and event processor loop
@@ -328,7 +503,8 @@ func checkVolumeMount(opts options) (ok bool) {
 	return false
 }
 
-func activateServer(ctx context.Context, opts options, sf *bot.SpamFilter, loc *storage.Locator, dataDB *sqlx.DB) (err error) {
+func activateServer(ctx context.Context, opts options, sf *bot.SpamFilter, tuner *bot.Tuner, loc *storage.Locator,
+	dataDB *sqlx.DB) (err error) {
 	authPassswd := opts.Server.AuthPasswd
 	if opts.Server.AuthPasswd == "auto" {
 		authPassswd, err = webapi.GenerateRandomPassword(20)
@@ -344,45 +520,103 @@ func activateServer(ctx context.Context, opts options, sf *bot.SpamFilter, loc *
 		return fmt.Errorf("can't make approved users store, %w", auErr)
 	}
 
+	// make warnings store, used to list warnings
+	warningsStore, err := storage.NewWarnings(dataDB)
+	if err != nil {
+		return fmt.Errorf("can't make warnings store, %w", err)
+	}
+
 	settings := webapi.Settings{
 		PrimaryGroup:            opts.Telegram.Group,
+		AdditionalGroups:        opts.Telegram.Groups,
 		AdminGroup:              opts.AdminGroup,
 		DisableAdminSpamForward: opts.DisableAdminSpamForward,
 		LoggerEnabled:           opts.Logger.Enabled,
 		SuperUsers:              opts.SuperUsers,
 		NoSpamReply:             opts.NoSpamReply,
 		CasEnabled:              opts.CAS.API != "",
-		MetaEnabled:             opts.Meta.ImageOnly || opts.Meta.LinksLimit >= 0 || opts.Meta.LinksOnly,
-		MetaLinksLimit:          opts.Meta.LinksLimit,
-		MetaLinksOnly:           opts.Meta.LinksOnly,
-		MetaImageOnly:           opts.Meta.ImageOnly,
-		MultiLangLimit:          opts.MultiLangWords,
-		OpenAIEnabled:           opts.OpenAI.Token != "",
-		SamplesDataPath:         opts.Files.SamplesDataPath,
-		DynamicDataPath:         opts.Files.DynamicDataPath,
-		WatchIntervalSecs:       int(opts.Files.WatchInterval.Seconds()),
-		SimilarityThreshold:     opts.SimilarityThreshold,
-		MinMsgLen:               opts.MinMsgLen,
-		MaxEmoji:                opts.MaxEmoji,
-		MinSpamProbability:      opts.MinSpamProbability,
-		ParanoidMode:            opts.ParanoidMode,
-		FirstMessagesCount:      opts.FirstMessagesCount,
-		StartupMessageEnabled:   opts.Message.Startup != "",
-		TrainingEnabled:         opts.Training,
+		MetaEnabled: opts.Meta.ImageOnly || opts.Meta.LinksLimit >= 0 || opts.Meta.LinksOnly ||
+			opts.Meta.HiddenLinksLimit >= 0 || opts.Meta.Forward || opts.Meta.Domains,
+		MetaLinksLimit:         opts.Meta.LinksLimit,
+		MetaLinksOnly:          opts.Meta.LinksOnly,
+		MetaImageOnly:          opts.Meta.ImageOnly,
+		MetaHiddenLinksLimit:   opts.Meta.HiddenLinksLimit,
+		MetaForward:            opts.Meta.Forward,
+		MetaForwardChannels:    opts.Meta.ForwardChannels,
+		MetaDomains:            opts.Meta.Domains,
+		MultiLangLimit:         opts.MultiLangWords,
+		Tokenizer:              opts.Tokenizer,
+		OpenAIEnabled:          opts.OpenAI.Token != "",
+		OpenAIProvider:         opts.OpenAI.Provider,
+		SamplesDataPath:        opts.Files.SamplesDataPath,
+		DynamicDataPath:        opts.Files.DynamicDataPath,
+		ProfilesFile:           opts.Files.Profiles,
+		ShadowFile:             opts.Files.Shadow,
+		WatchIntervalSecs:      int(opts.Files.WatchInterval.Seconds()),
+		SimilarityThreshold:    opts.SimilarityThreshold,
+		MinMsgLen:              opts.MinMsgLen,
+		MaxEmoji:               opts.MaxEmoji,
+		MinSpamProbability:     opts.MinSpamProbability,
+		ScoreThreshold:         opts.ScoreThreshold,
+		CheckWeights:           opts.CheckWeights,
+		ParanoidMode:           opts.ParanoidMode,
+		FirstMessagesCount:     opts.FirstMessagesCount,
+		CheckEdited:            opts.CheckEdited,
+		CheckEditedApproved:    opts.CheckEditedApproved,
+		StartupMessageEnabled:  opts.Message.Startup != "",
+		TrainingEnabled:        opts.Training,
+		PolicyEnabled:          opts.Policy.Enabled,
+		PolicyRestrictScore:    opts.Policy.RestrictScore,
+		PolicyTempBanScore:     opts.Policy.TempBanScore,
+		PolicyBanScore:         opts.Policy.BanScore,
+		PolicyRestrictDuration: opts.Policy.RestrictDuration.String(),
+		PolicyTempBanDuration:  opts.Policy.TempBanDuration.String(),
+		MaxWarnings:            opts.Warn.Max,
+		WarnExpiry:             opts.Warn.Expiry.String(),
+		CaptchaEnabled:         opts.Captcha.Enabled,
+		CaptchaTimeout:         opts.Captcha.Timeout.String(),
+		CaptchaMath:            opts.Captcha.Math,
+		CaptchaApprove:         opts.Captcha.Approve,
+		ImageHashEnabled:       opts.ImageHash.Enabled,
+		ImageHashDistance:      opts.ImageHash.Distance,
+		TuneEnabled:            opts.Tune.Enabled,
+		TuneInterval:           opts.Tune.Interval.String(),
+		TuneMinDecisions:       opts.Tune.MinDecisions,
+		TuneApply:              opts.Tune.Apply,
+	}
+
+	profiles := map[int64]webapi.Detector{}
+	for chatID, p := range sf.Profiles() {
+		profiles[chatID] = p.Detector
 	}
 
 	srv := webapi.Server{Config: webapi.Config{
 		ListenAddr:   opts.Server.ListenAddr,
 		Detector:     sf.Detector,
+		Profiles:     profiles,
 		SpamFilter:   sf,
 		Locator:      loc,
 		DetectedSpam: detectedSpamStore,
+		Warnings:     warningsStore,
 		AuthPasswd:   authPassswd,
 		Version:      revision,
 		Dbg:          opts.Dbg,
 		Settings:     settings,
 	}}
 
+	if tuner != nil {
+		srv.Tuner = tuner
+	}
+
+	if opts.Files.Shadow != "" {
+		// make disagreements store, used to list messages the shadow detector disagreed on
+		disagreementsStore, err := storage.NewDisagreements(dataDB)
+		if err != nil {
+			return fmt.Errorf("can't make disagreements store, %w", err)
+		}
+		srv.Disagreements = disagreementsStore
+	}
+
 	go func() {
 		if err := srv.Run(ctx); err != nil {
 			log.Printf("[ERROR] web server failed, %v", err)
@@ -405,6 +639,9 @@ func makeDetector(opts options) *tgspam.Detector {
 		FirstMessagesCount:  opts.FirstMessagesCount,
 		OpenAIVeto:          opts.OpenAI.Veto,
 		MultiLangWords:      opts.MultiLangWords,
+		Tokenizer:           tgspam.TokenizerType(opts.Tokenizer),
+		ScoreThreshold:      opts.ScoreThreshold,
+		CheckWeights:        opts.CheckWeights,
 	}
 
 	// FirstMessagesCount and ParanoidMode are mutually exclusive.
@@ -421,16 +658,29 @@ func makeDetector(opts options) *tgspam.Detector {
 	log.Printf("[DEBUG] detector config: %+v", detectorConfig)
 
 	if opts.OpenAI.Token != "" {
-		log.Printf("[WARN] openai enabled")
+		log.Printf("[WARN] openai enabled, provider: %s", opts.OpenAI.Provider)
 		openAIConfig := tgspam.OpenAIConfig{
 			SystemPrompt:      opts.OpenAI.Prompt,
 			Model:             opts.OpenAI.Model,
 			MaxTokensResponse: opts.OpenAI.MaxTokensResponse,
 			MaxTokensRequest:  opts.OpenAI.MaxTokensRequestMaxTokensRequest,
 			MaxSymbolsRequest: opts.OpenAI.MaxSymbolsRequest,
+			Timeout:           opts.OpenAI.Timeout,
+			Retries:           opts.OpenAI.Retries,
+			CacheSize:         opts.OpenAI.CacheSize,
+			MaxCallsPerDay:    opts.OpenAI.MaxCallsPerDay,
+			MaxTokensPerDay:   opts.OpenAI.MaxTokensPerDay,
+			Structured:        opts.OpenAI.Structured,
+			MinConfidence:     opts.OpenAI.MinConfidence,
+			Examples:          opts.OpenAI.Examples,
+			MessageTemplate:   opts.OpenAI.Template,
+			ChatDescription:   opts.OpenAI.ChatDescription,
+		}
+		if openAIConfig.MessageTemplate == "" && opts.OpenAI.Context {
+			openAIConfig.MessageTemplate = tgspam.DefaultMessageTemplate
 		}
 		log.Printf("[DEBUG] openai  config: %+v", openAIConfig)
-		detector.WithOpenAIChecker(openai.NewClient(opts.OpenAI.Token), openAIConfig)
+		detector.WithLLMChecker(makeLLMChecker(opts), openAIConfig)
 	}
 
 	metaChecks := []tgspam.MetaCheck{}
@@ -446,6 +696,18 @@ func makeDetector(opts options) *tgspam.Detector {
 		log.Printf("[INFO] links only check enabled")
 		metaChecks = append(metaChecks, tgspam.LinkOnlyCheck())
 	}
+	if opts.Meta.HiddenLinksLimit >= 0 {
+		log.Printf("[INFO] hidden links check enabled, limit: %d", opts.Meta.HiddenLinksLimit)
+		metaChecks = append(metaChecks, tgspam.HiddenLinksCheck(opts.Meta.HiddenLinksLimit))
+	}
+	if opts.Meta.Forward {
+		log.Printf("[INFO] forward check enabled, channels: %v", opts.Meta.ForwardChannels)
+		metaChecks = append(metaChecks, tgspam.ForwardCheck(opts.Meta.ForwardChannels...))
+	}
+	if opts.Meta.Domains {
+		log.Printf("[INFO] domains check enabled")
+		metaChecks = append(metaChecks, tgspam.DomainsCheck(detector.Domains()))
+	}
 	detector.WithMetaChecks(metaChecks...)
 
 	dynSpamFile := filepath.Join(opts.Files.DynamicDataPath, dynamicSpamFile)
@@ -459,19 +721,25 @@ func makeDetector(opts options) *tgspam.Detector {
 	return detector
 }
 
-func makeSpamBot(ctx context.Context, opts options, detector *tgspam.Detector) (*bot.SpamFilter, error) {
-	spamBotParams := bot.SpamConfig{
-		SpamSamplesFile:    filepath.Join(opts.Files.SamplesDataPath, samplesSpamFile),
-		HamSamplesFile:     filepath.Join(opts.Files.SamplesDataPath, samplesHamFile),
-		StopWordsFile:      filepath.Join(opts.Files.SamplesDataPath, stopWordsFile),
-		ExcludedTokensFile: filepath.Join(opts.Files.SamplesDataPath, excludeTokensFile),
-		SpamDynamicFile:    filepath.Join(opts.Files.DynamicDataPath, dynamicSpamFile),
-		HamDynamicFile:     filepath.Join(opts.Files.DynamicDataPath, dynamicHamFile),
-		WatchDelay:         opts.Files.WatchInterval,
-		SpamMsg:            opts.Message.Spam,
-		SpamDryMsg:         opts.Message.Dry,
-		Dry:                opts.Dry,
+// makeLLMChecker makes a language model backend for the openai check, selected by the provider.
+// The base URL allows using OpenAI-compatible servers, like llama.cpp or Ollama, with openai provider.
+func makeLLMChecker(opts options) tgspam.LLMChecker {
+	switch opts.OpenAI.Provider {
+	case "anthropic":
+		return tgspam.NewAnthropicLLM(&http.Client{}, opts.OpenAI.BaseURL, opts.OpenAI.Token)
+	case "gemini":
+		return tgspam.NewGeminiLLM(&http.Client{}, opts.OpenAI.BaseURL, opts.OpenAI.Token)
+	default:
+		config := openai.DefaultConfig(opts.OpenAI.Token)
+		if opts.OpenAI.BaseURL != "" {
+			config.BaseURL = opts.OpenAI.BaseURL
+		}
+		return tgspam.NewOpenAILLM(openai.NewClientWithConfig(config))
 	}
+}
+
+func makeSpamBot(ctx context.Context, opts options, detector *tgspam.Detector) (*bot.SpamFilter, error) {
+	spamBotParams := makeSpamConfig(opts)
 	spamBot := bot.NewSpamFilter(ctx, detector, spamBotParams)
 	log.Printf("[DEBUG] spam bot config: %+v", spamBotParams)
 
@@ -481,6 +749,248 @@ func makeSpamBot(ctx context.Context, opts options, detector *tgspam.Detector) (
 	return spamBot, nil
 }
 
+// makeSpamConfig creates spam filter config with all files located in samples and dynamic data paths
+func makeSpamConfig(opts options) bot.SpamConfig {
+	return bot.SpamConfig{
+		SpamSamplesFile:     filepath.Join(opts.Files.SamplesDataPath, samplesSpamFile),
+		HamSamplesFile:      filepath.Join(opts.Files.SamplesDataPath, samplesHamFile),
+		StopWordsFile:       filepath.Join(opts.Files.SamplesDataPath, stopWordsFile),
+		ExcludedTokensFile:  filepath.Join(opts.Files.SamplesDataPath, excludeTokensFile),
+		SpamDynamicFile:     filepath.Join(opts.Files.DynamicDataPath, dynamicSpamFile),
+		HamDynamicFile:      filepath.Join(opts.Files.DynamicDataPath, dynamicHamFile),
+		AllowedDomainsFile:  filepath.Join(opts.Files.SamplesDataPath, allowedDomains),
+		BlockedDomainsFile:  filepath.Join(opts.Files.SamplesDataPath, blockedDomains),
+		ModelFile:           filepath.Join(opts.Files.DynamicDataPath, modelFile),
+		WatchDelay:          opts.Files.WatchInterval,
+		SpamMsg:             opts.Message.Spam,
+		SpamDryMsg:          opts.Message.Dry,
+		CheckEditedApproved: opts.CheckEditedApproved,
+		AsyncLLM:            opts.OpenAI.Async,
+		Dry:                 opts.Dry,
+	}
+}
+
+// groupProfile defines detector settings for a particular group, loaded from the profiles file.
+// Unset fields inherit global options, sample files missing in the profile's samples location inherit global ones.
+type groupProfile struct {
+	ChatID              int64    `json:"chat_id"`
+	Samples             string   `json:"samples"`
+	SimilarityThreshold *float64 `json:"similarity_threshold"`
+	MinMsgLen           *int     `json:"min_msg_len"`
+	MaxEmoji            *int     `json:"max_emoji"`
+	MinSpamProbability  *float64 `json:"min_probability"`
+	MultiLangWords      *int     `json:"multi_lang"`
+	ScoreThreshold      *float64 `json:"score_threshold"`
+	ParanoidMode        *bool    `json:"paranoid"`
+	FirstMessagesCount  *int     `json:"first_messages_count"`
+	LinksLimit          *int     `json:"links_limit"`
+	ImageOnly           *bool    `json:"image_only"`
+	LinksOnly           *bool    `json:"links_only"`
+	HiddenLinksLimit    *int     `json:"hidden_links_limit"`
+	Forward             *bool    `json:"forward"`
+	Domains             *bool    `json:"domains"`
+	Tokenizer           *string  `json:"tokenizer"`
+	OpenAIPrompt        *string  `json:"openai_prompt"`
+	OpenAIChatDesc      *string  `json:"openai_chat_description"`
+}
+
+// loadProfiles reads group profiles from json file
+func loadProfiles(file string) ([]groupProfile, error) {
+	data, err := os.ReadFile(file) //nolint:gosec // file set by the user
+	if err != nil {
+		return nil, fmt.Errorf("can't read profiles file %s, %w", file, err)
+	}
+	res := []groupProfile{}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, fmt.Errorf("can't parse profiles file %s, %w", file, err)
+	}
+	seen := map[int64]bool{}
+	for i, p := range res {
+		if p.ChatID == 0 {
+			return nil, fmt.Errorf("profile #%d has no chat_id", i)
+		}
+		if seen[p.ChatID] {
+			return nil, fmt.Errorf("duplicate profile for chat %d", p.ChatID)
+		}
+		seen[p.ChatID] = true
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("profile for chat %d %w", p.ChatID, err)
+		}
+		res[i].Samples = expandPath(p.Samples)
+	}
+	return res, nil
+}
+
+// loadShadowProfile reads a single profile of the shadow detector from json file, chat_id is not used
+func loadShadowProfile(file string) (groupProfile, error) {
+	data, err := os.ReadFile(file) //nolint:gosec // file set by the user
+	if err != nil {
+		return groupProfile{}, fmt.Errorf("can't read shadow profile file %s, %w", file, err)
+	}
+	res := groupProfile{}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return groupProfile{}, fmt.Errorf("can't parse shadow profile file %s, %w", file, err)
+	}
+	if err := res.validate(); err != nil {
+		return groupProfile{}, fmt.Errorf("shadow profile %w", err)
+	}
+	res.Samples = expandPath(res.Samples)
+	return res, nil
+}
+
+// validate checks profile values not checked by json parsing
+func (p groupProfile) validate() error {
+	if p.Tokenizer != nil {
+		switch tgspam.TokenizerType(*p.Tokenizer) {
+		case tgspam.TokenizerWords, tgspam.TokenizerStem, tgspam.TokenizerNGrams:
+		default:
+			return fmt.Errorf("has unknown tokenizer %q", *p.Tokenizer)
+		}
+	}
+	return nil
+}
+
+// options returns a copy of global options with profile's overrides applied
+func (p groupProfile) options(opts options) options {
+	res := opts
+	setIf := func(dst *int, src *int) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+	setIf(&res.MinMsgLen, p.MinMsgLen)
+	setIf(&res.MaxEmoji, p.MaxEmoji)
+	setIf(&res.MultiLangWords, p.MultiLangWords)
+	setIf(&res.FirstMessagesCount, p.FirstMessagesCount)
+	setIf(&res.Meta.LinksLimit, p.LinksLimit)
+	setIf(&res.Meta.HiddenLinksLimit, p.HiddenLinksLimit)
+	if p.SimilarityThreshold != nil {
+		res.SimilarityThreshold = *p.SimilarityThreshold
+	}
+	if p.MinSpamProbability != nil {
+		res.MinSpamProbability = *p.MinSpamProbability
+	}
+	if p.ScoreThreshold != nil {
+		res.ScoreThreshold = *p.ScoreThreshold
+	}
+	if p.ParanoidMode != nil {
+		res.ParanoidMode = *p.ParanoidMode
+	}
+	if p.ImageOnly != nil {
+		res.Meta.ImageOnly = *p.ImageOnly
+	}
+	if p.LinksOnly != nil {
+		res.Meta.LinksOnly = *p.LinksOnly
+	}
+	if p.Forward != nil {
+		res.Meta.Forward = *p.Forward
+	}
+	if p.Domains != nil {
+		res.Meta.Domains = *p.Domains
+	}
+	if p.Tokenizer != nil {
+		res.Tokenizer = *p.Tokenizer
+	}
+	if p.OpenAIPrompt != nil {
+		res.OpenAI.Prompt = *p.OpenAIPrompt
+	}
+	if p.OpenAIChatDesc != nil {
+		res.OpenAI.ChatDescription = *p.OpenAIChatDesc
+	}
+	return res
+}
+
+// spamConfig returns spam filter config for the profile, with sample files taken from the profile's samples location
+// if present there, and from the global samples location otherwise. Dynamic files are shared with the global config,
+// except for the learned model file kept per profile.
+func (p groupProfile) spamConfig(opts options) bot.SpamConfig {
+	res := makeSpamConfig(opts)
+	res.ModelFile = filepath.Join(opts.Files.DynamicDataPath, fmt.Sprintf("classifier-%d.model", p.ChatID))
+	if p.Samples == "" {
+		return res
+	}
+	for _, file := range []*string{&res.SpamSamplesFile, &res.HamSamplesFile, &res.StopWordsFile, &res.ExcludedTokensFile,
+		&res.AllowedDomainsFile, &res.BlockedDomainsFile} {
+		profFile := filepath.Join(p.Samples, filepath.Base(*file))
+		if _, err := os.Stat(profFile); err == nil {
+			*file = profFile
+		}
+	}
+	return res
+}
+
+// makeProfiles loads group profiles and sets a spam filter with its own detector for each of them.
+// Extra meta checks, depending on the data storage, added to each profile's detector.
+// Profiles' samples files are watched and reloaded by the main spam filter.
+func makeProfiles(opts options, spamBot *bot.SpamFilter, usersStore tgspam.UserStorage,
+	extraChecks ...tgspam.MetaCheck) error {
+	profiles, err := loadProfiles(opts.Files.Profiles)
+	if err != nil {
+		return err
+	}
+	for _, p := range profiles {
+		profOpts := p.options(opts)
+		detector := makeDetector(profOpts)
+		detector.WithMetaChecks(extraChecks...)
+		if _, err := detector.WithUserStorage(usersStore); err != nil {
+			return fmt.Errorf("can't load approved users for profile %d, %w", p.ChatID, err)
+		}
+		params := p.spamConfig(profOpts)
+		sf := bot.NewChildSpamFilter(detector, params)
+		if err := sf.ReloadSamples(); err != nil {
+			return fmt.Errorf("can't load samples for profile %d, %w", p.ChatID, err)
+		}
+		spamBot.WithProfile(p.ChatID, sf)
+		log.Printf("[INFO] group profile for chat %d enabled, spam bot config: %+v", p.ChatID, params)
+	}
+	return nil
+}
+
+// makeShadow loads the shadow profile and sets a spam filter with the candidate detector checking messages along with
+// the default one. Messages the detectors disagree on are saved to the disagreements store. The shadow detector doesn't
+// use approved users storage, as it never approves users. Shadow's samples files are watched and reloaded by the main
+// spam filter, and with async openai check the shadow check is made by the main filter's worker.
+func makeShadow(opts options, spamBot *bot.SpamFilter, dataDB *sqlx.DB,
+	extraChecks ...tgspam.MetaCheck) error {
+	p, err := loadShadowProfile(opts.Files.Shadow)
+	if err != nil {
+		return err
+	}
+	profOpts := p.options(opts)
+	detector := makeDetector(profOpts)
+	detector.WithMetaChecks(extraChecks...)
+	params := p.spamConfig(profOpts)
+	params.ModelFile = filepath.Join(opts.Files.DynamicDataPath, "classifier-shadow.model")
+	sf := bot.NewChildSpamFilter(detector, params)
+	if err := sf.ReloadSamples(); err != nil {
+		return fmt.Errorf("can't load samples for shadow detector, %w", err)
+	}
+
+	disagreementsStore, err := storage.NewDisagreements(dataDB)
+	if err != nil {
+		return fmt.Errorf("can't make disagreements store, %w", err)
+	}
+	spamBot.WithShadow(sf, bot.ShadowLoggerFunc(func(msg bot.Message, active, shadow bot.Verdict) {
+		rec := storage.DisagreementInfo{
+			UserID:       msg.From.ID,
+			UserName:     msg.From.Username,
+			ChatID:       msg.ChatID,
+			Text:         strings.TrimSpace(strings.ReplaceAll(msg.Text, "\n", " ")),
+			ActiveSpam:   active.Spam,
+			ActiveScore:  active.Score,
+			ShadowSpam:   shadow.Spam,
+			ShadowScore:  shadow.Score,
+			ActiveChecks: active.Checks,
+			ShadowChecks: shadow.Checks,
+		}
+		if err := disagreementsStore.Add(rec); err != nil {
+			log.Printf("[WARN] can't save shadow disagreement, %v", err)
+		}
+	}))
+	log.Printf("[INFO] shadow detector enabled, spam bot config: %+v", params)
+	return nil
+}
+
 // expandPath expands ~ to home dir and makes the absolute path
 func expandPath(path string) string {
 	if path == "" {
@@ -523,12 +1033,14 @@ func makeSpamLogger(wr io.Writer, dataDB *sqlx.DB) (events.SpamLogger, error) {
 			DisplayName string `json:"display_name"`
 			UserName    string `json:"user_name"`
 			UserID      int64  `json:"user_id"`
+			ChatID      int64  `json:"chat_id"`
 			Text        string `json:"text"`
 		}{
 			TimeStamp:   time.Now().In(time.Local).Format(time.RFC3339),
 			DisplayName: msg.From.DisplayName,
 			UserName:    msg.From.Username,
 			UserID:      msg.From.ID,
+			ChatID:      msg.ChatID,
 			Text:        text,
 		}
 		line, err := json.Marshal(&m)
@@ -545,6 +1057,7 @@ func makeSpamLogger(wr io.Writer, dataDB *sqlx.DB) (events.SpamLogger, error) {
 			Text:      text,
 			UserID:    msg.From.ID,
 			UserName:  msg.From.Username,
+			ChatID:    msg.ChatID,
 			Timestamp: time.Now().In(time.Local),
 		}
 		if err := detectedSpamStore.Write(rec, response.CheckResults); err != nil {
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
@@ -19,6 +20,7 @@ import (
 	"github.com/umputun/tg-spam/app/bot"
 	"github.com/umputun/tg-spam/app/storage"
 	"github.com/umputun/tg-spam/lib/spamcheck"
+	"github.com/umputun/tg-spam/lib/tgspam"
 )
 
 func TestMakeSpamLogger(t *testing.T) {
@@ -171,6 +173,27 @@ func Test_makeDetector(t *testing.T) {
 	})
 }
 
+func Test_makeLLMChecker(t *testing.T) {
+	tests := []struct {
+		provider string
+		want     tgspam.LLMChecker
+	}{
+		{"openai", &tgspam.OpenAILLM{}},
+		{"", &tgspam.OpenAILLM{}},
+		{"anthropic", &tgspam.AnthropicLLM{}},
+		{"gemini", &tgspam.GeminiLLM{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider, func(t *testing.T) {
+			var opts options
+			opts.OpenAI.Token = "123"
+			opts.OpenAI.Provider = tt.provider
+			opts.OpenAI.BaseURL = "http://localhost:8080/v1"
+			assert.IsType(t, tt.want, makeLLMChecker(opts))
+		})
+	}
+}
+
 func Test_makeSpamBot(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -195,11 +218,187 @@ func Test_makeSpamBot(t *testing.T) {
 		require.NoError(t, err)
 
 		opts.Files.SamplesDataPath = tmpDir
+		opts.Files.DynamicDataPath = tmpDir
 		detector := makeDetector(opts)
 		res, err := makeSpamBot(ctx, opts, detector)
 		assert.NoError(t, err)
 		assert.NotNil(t, res)
 	})
+
+	t.Run("with blocked domains", func(t *testing.T) {
+		var opts options
+		tmpDir := t.TempDir()
+		for _, f := range []string{samplesSpamFile, samplesHamFile, excludeTokensFile} {
+			require.NoError(t, os.WriteFile(filepath.Join(tmpDir, f), []byte(""), 0o600))
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, blockedDomains), []byte("spam.com\n"), 0o600))
+
+		opts.Files.SamplesDataPath = tmpDir
+		opts.Files.DynamicDataPath = tmpDir
+		opts.Meta.Domains = true
+		opts.MinMsgLen = 1
+		detector := makeDetector(opts)
+		res, err := makeSpamBot(ctx, opts, detector)
+		require.NoError(t, err)
+		resp := res.OnMessage(bot.Message{From: bot.User{ID: 1}, Text: "buy now at https://spam.com"})
+		assert.True(t, resp.Send, "spam detected")
+	})
+}
+
+func Test_loadProfiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		data    string
+		wantLen int
+		wantErr string
+	}{
+		{"valid", `[{"chat_id":-100123,"similarity_threshold":0.3},{"chat_id":-100456,"max_emoji":0}]`, 2, ""},
+		{"empty", `[]`, 0, ""},
+		{"bad json", `[{"chat_id":`, 0, "can't parse profiles file"},
+		{"no chat id", `[{"max_emoji":0}]`, 0, "profile #0 has no chat_id"},
+		{"duplicate", `[{"chat_id":1},{"chat_id":1}]`, 0, "duplicate profile for chat 1"},
+		{"valid tokenizer", `[{"chat_id":1,"tokenizer":"stem"}]`, 1, ""},
+		{"unknown tokenizer", `[{"chat_id":1,"tokenizer":"bad"}]`, 0, `profile for chat 1 has unknown tokenizer "bad"`},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(tmpDir, fmt.Sprintf("profiles-%d.json", i))
+			require.NoError(t, os.WriteFile(file, []byte(tt.data), 0o600))
+			res, err := loadProfiles(file)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, res, tt.wantLen)
+		})
+	}
+
+	_, err := loadProfiles(filepath.Join(tmpDir, "not-found.json"))
+	assert.Error(t, err)
+}
+
+func Test_groupProfile(t *testing.T) {
+	var opts options
+	opts.Files.SamplesDataPath = t.TempDir()
+	opts.Files.DynamicDataPath = opts.Files.SamplesDataPath
+	opts.SimilarityThreshold = 0.5
+	opts.MaxEmoji = 2
+	opts.MinMsgLen = 50
+	opts.Meta.LinksLimit = -1
+
+	profDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(profDir, samplesSpamFile), []byte("spam"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(profDir, stopWordsFile), []byte("stop"), 0o600))
+
+	threshold, maxEmoji, imageOnly, tokenizer, prompt, chatDesc := 0.3, 0, true, "ngram", "custom prompt", "golang group"
+	p := groupProfile{ChatID: -100123, Samples: profDir, SimilarityThreshold: &threshold, MaxEmoji: &maxEmoji, ImageOnly: &imageOnly,
+		Tokenizer: &tokenizer, OpenAIPrompt: &prompt, OpenAIChatDesc: &chatDesc}
+
+	profOpts := p.options(opts)
+	assert.InDelta(t, 0.3, profOpts.SimilarityThreshold, 0.0001)
+	assert.Equal(t, 0, profOpts.MaxEmoji)
+	assert.True(t, profOpts.Meta.ImageOnly)
+	assert.Equal(t, "ngram", profOpts.Tokenizer)
+	assert.Equal(t, "custom prompt", profOpts.OpenAI.Prompt)
+	assert.Equal(t, "golang group", profOpts.OpenAI.ChatDescription)
+	assert.Equal(t, 50, profOpts.MinMsgLen, "not overridden")
+	assert.Equal(t, -1, profOpts.Meta.LinksLimit, "not overridden")
+	assert.InDelta(t, 0.5, opts.SimilarityThreshold, 0.0001, "global options not changed")
+
+	params := p.spamConfig(profOpts)
+	assert.Equal(t, filepath.Join(profDir, samplesSpamFile), params.SpamSamplesFile)
+	assert.Equal(t, filepath.Join(profDir, stopWordsFile), params.StopWordsFile)
+	assert.Equal(t, filepath.Join(opts.Files.SamplesDataPath, samplesHamFile), params.HamSamplesFile, "fallback to global")
+	assert.Equal(t, filepath.Join(opts.Files.SamplesDataPath, excludeTokensFile), params.ExcludedTokensFile, "fallback to global")
+	assert.Equal(t, filepath.Join(opts.Files.DynamicDataPath, dynamicSpamFile), params.SpamDynamicFile, "dynamic shared")
+	assert.Equal(t, filepath.Join(opts.Files.DynamicDataPath, "classifier--100123.model"), params.ModelFile, "model per profile")
+}
+
+func Test_loadShadowProfile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"valid", `{"similarity_threshold":0.3,"openai_prompt":"new prompt"}`, ""},
+		{"bad json", `{"similarity_threshold":`, "can't parse shadow profile file"},
+		{"unknown tokenizer", `{"tokenizer":"bad"}`, `shadow profile has unknown tokenizer "bad"`},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(tmpDir, fmt.Sprintf("shadow-%d.json", i))
+			require.NoError(t, os.WriteFile(file, []byte(tt.data), 0o600))
+			res, err := loadShadowProfile(file)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, res.SimilarityThreshold)
+			assert.InDelta(t, 0.3, *res.SimilarityThreshold, 0.0001)
+			require.NotNil(t, res.OpenAIPrompt)
+			assert.Equal(t, "new prompt", *res.OpenAIPrompt)
+		})
+	}
+
+	_, err := loadShadowProfile(filepath.Join(tmpDir, "not-found.json"))
+	assert.Error(t, err)
+}
+
+func Test_makeShadow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var opts options
+	opts.Files.SamplesDataPath = t.TempDir()
+	opts.Files.DynamicDataPath = opts.Files.SamplesDataPath
+	opts.Meta.LinksLimit = -1
+	opts.Meta.HiddenLinksLimit = -1
+	opts.MaxEmoji = -1
+	for _, f := range []string{samplesSpamFile, samplesHamFile, excludeTokensFile} {
+		require.NoError(t, os.WriteFile(filepath.Join(opts.Files.SamplesDataPath, f), []byte(""), 0o600))
+	}
+
+	// shadow profile with its own stop-words
+	shadowDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(shadowDir, stopWordsFile), []byte("cheap pills"), 0o600))
+	opts.Files.Shadow = filepath.Join(shadowDir, "shadow.json")
+	require.NoError(t, os.WriteFile(opts.Files.Shadow, []byte(`{"samples":"`+shadowDir+`"}`), 0o600))
+
+	db, err := sqlx.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	spamBot, err := makeSpamBot(ctx, opts, makeDetector(opts))
+	require.NoError(t, err)
+	require.NoError(t, makeShadow(opts, spamBot, db))
+
+	resp := spamBot.OnMessage(bot.Message{From: bot.User{ID: 1, Username: "user1"}, ChatID: 123, Text: "buy cheap pills\nhere"})
+	assert.False(t, resp.Send, "shadow verdict not acted on")
+	resp = spamBot.OnMessage(bot.Message{From: bot.User{ID: 2, Username: "user2"}, ChatID: 123, Text: "hello world"})
+	assert.False(t, resp.Send)
+
+	store, err := storage.NewDisagreements(db)
+	require.NoError(t, err)
+	entries, err := store.Read()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "buy cheap pills here", entries[0].Text)
+	assert.Equal(t, "user1", entries[0].UserName)
+	assert.Equal(t, int64(123), entries[0].ChatID)
+	assert.False(t, entries[0].ActiveSpam)
+	assert.True(t, entries[0].ShadowSpam)
+	assert.NotEmpty(t, entries[0].ShadowChecks)
+	assert.FileExists(t, filepath.Join(opts.Files.DynamicDataPath, "classifier-shadow.model"))
 }
 
 func Test_activateServerOnly(t *testing.T) {
@@ -212,6 +411,7 @@ func Test_activateServerOnly(t *testing.T) {
 	opts.Server.AuthPasswd = "auto"
 	opts.Files.SamplesDataPath = "webapi/testdata"
 	opts.Files.DynamicDataPath = "webapi/testdata"
+	defer os.Remove(filepath.Join(opts.Files.DynamicDataPath, modelFile))
 
 	done := make(chan struct{})
 	go func() {
@@ -219,10 +419,13 @@ func Test_activateServerOnly(t *testing.T) {
 		assert.NoError(t, err)
 		close(done)
 	}()
-	time.Sleep(time.Millisecond * 100)
-
-	resp, err := http.Get("http://localhost:9988/ping")
-	require.NoError(t, err)
+	// wait for the server to start, it makes data stores first
+	var resp *http.Response
+	require.Eventually(t, func() bool {
+		var err error
+		resp, err = http.Get("http://localhost:9988/ping")
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
 	defer resp.Body.Close()
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 	body, err := io.ReadAll(resp.Body)
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Challenges is a storage for pending captcha challenges, kept to finish them after restart
+type Challenges struct {
+	db *sqlx.DB
+}
+
+// ChallengeInfo represents a pending captcha challenge of a new member
+type ChallengeInfo struct {
+	ChatID   int64     `db:"chat_id"`
+	UserID   int64     `db:"user_id"`
+	UserName string    `db:"user_name"`
+	MsgID    int       `db:"msg_id"`  // challenge message
+	Answer   string    `db:"answer"`  // expected answer
+	Expires  time.Time `db:"expires"` // time the member is kicked if not answered
+}
+
+// NewChallenges creates a new Challenges storage
+func NewChallenges(db *sqlx.DB) (*Challenges, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS challenges (
+		chat_id INTEGER,
+		user_id INTEGER,
+		user_name TEXT,
+		msg_id INTEGER,
+		answer TEXT,
+		expires DATETIME,
+		PRIMARY KEY (chat_id, user_id)
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create challenges table: %w", err)
+	}
+	return &Challenges{db: db}, nil
+}
+
+// Add adds a pending challenge, replacing the previous one of the same user in the same chat
+func (c *Challenges) Add(entry ChallengeInfo) error {
+	query := `INSERT OR REPLACE INTO challenges (chat_id, user_id, user_name, msg_id, answer, expires) VALUES (?, ?, ?, ?, ?, ?)`
+	if _, err := c.db.Exec(query, entry.ChatID, entry.UserID, entry.UserName, entry.MsgID, entry.Answer, entry.Expires.UTC()); err != nil {
+		return fmt.Errorf("failed to insert challenge for user %d: %w", entry.UserID, err)
+	}
+	return nil
+}
+
+// Delete removes the challenge of the user in the chat, answered or expired. The challenge is identified by its
+// message as well, so the newer challenge of the rejoined user is kept.
+func (c *Challenges) Delete(chatID, userID int64, msgID int) error {
+	query := "DELETE FROM challenges WHERE chat_id = ? AND user_id = ? AND msg_id = ?"
+	if _, err := c.db.Exec(query, chatID, userID, msgID); err != nil {
+		return fmt.Errorf("failed to delete challenge for user %d: %w", userID, err)
+	}
+	return nil
+}
+
+// Read returns all pending challenges, the earliest expiring first
+func (c *Challenges) Read() ([]ChallengeInfo, error) {
+	var entries []ChallengeInfo
+	if err := c.db.Select(&entries, "SELECT * FROM challenges ORDER BY expires"); err != nil {
+		return nil, fmt.Errorf("failed to get challenges: %w", err)
+	}
+	for i, entry := range entries {
+		entries[i].Expires = entry.Expires.Local()
+	}
+	return entries, nil
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChallenges(t *testing.T) {
+	db, err := sqlx.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	c, err := NewChallenges(db)
+	require.NoError(t, err)
+	_, err = NewChallenges(db)
+	require.NoError(t, err, "second call on existing table should work")
+
+	now := time.Now().Truncate(time.Second)
+	require.NoError(t, c.Add(ChallengeInfo{ChatID: 123, UserID: 1, UserName: "user1", MsgID: 10, Answer: "ok",
+		Expires: now.Add(time.Minute)}))
+	require.NoError(t, c.Add(ChallengeInfo{ChatID: 123, UserID: 2, UserName: "user2", MsgID: 11, Answer: "5",
+		Expires: now.Add(-time.Minute)}))
+	require.NoError(t, c.Add(ChallengeInfo{ChatID: 456, UserID: 1, UserName: "user1", MsgID: 12, Answer: "ok",
+		Expires: now.Add(2 * time.Minute)}))
+
+	res, err := c.Read()
+	require.NoError(t, err)
+	require.Len(t, res, 3)
+	assert.Equal(t, int64(2), res[0].UserID, "earliest expiring first")
+	assert.Equal(t, 11, res[0].MsgID)
+	assert.Equal(t, "5", res[0].Answer)
+	assert.True(t, now.Add(-time.Minute).Equal(res[0].Expires))
+
+	// rejoined user's challenge replaced
+	require.NoError(t, c.Add(ChallengeInfo{ChatID: 123, UserID: 1, UserName: "user1", MsgID: 13, Answer: "ok",
+		Expires: now.Add(3 * time.Minute)}))
+	require.NoError(t, c.Delete(123, 2, 11))
+	require.NoError(t, c.Delete(123, 1, 10), "replaced challenge, nothing deleted")
+	res, err = c.Read()
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, int64(456), res[0].ChatID)
+	assert.Equal(t, 13, res[1].MsgID)
+}
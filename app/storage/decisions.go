@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+const maxDecisionsEntries = 1000
+
+// Decisions is a storage for moderator decisions on detected spam
+type Decisions struct {
+	db *sqlx.DB
+}
+
+// DecisionInfo represents a moderator decision on the detected spam message, with the original check results.
+// Spam is true if the ban was confirmed (kept), and false if the user was unbanned, i.e., it was a false positive.
+type DecisionInfo struct {
+	ID         int64                `db:"id"`
+	UserID     int64                `db:"user_id"`
+	UserName   string               `db:"user_name"`
+	ChatID     int64                `db:"chat_id"` // originating chat (group)
+	Text       string               `db:"text"`
+	Spam       bool                 `db:"spam"`       // decision, true if spam confirmed
+	AdminName  string               `db:"admin_name"` // name of the admin made the decision
+	Timestamp  time.Time            `db:"timestamp"`
+	ChecksJSON string               `db:"checks"` // Store as JSON
+	Checks     []spamcheck.Response `db:"-"`      // Don't store in DB
+}
+
+// NewDecisions creates a new Decisions storage
+func NewDecisions(db *sqlx.DB) (*Decisions, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS decisions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER,
+		user_name TEXT,
+		chat_id INTEGER DEFAULT 0,
+		text TEXT,
+		spam BOOLEAN DEFAULT 0,
+		admin_name TEXT,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+		checks TEXT
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create decisions table: %w", err)
+	}
+
+	if _, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_decisions_timestamp ON decisions(timestamp)`); err != nil {
+		return nil, fmt.Errorf("failed to create index on timestamp: %w", err)
+	}
+
+	return &Decisions{db: db}, nil
+}
+
+// Add adds a new decision, the current time used if the timestamp is not set.
+// Timestamps stored in UTC to keep them comparable.
+func (d *Decisions) Add(entry DecisionInfo) error {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	checksJSON, err := json.Marshal(entry.Checks)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checks: %w", err)
+	}
+
+	query := `INSERT INTO decisions (user_id, user_name, chat_id, text, spam, admin_name, timestamp, checks)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	if _, err := d.db.Exec(query, entry.UserID, entry.UserName, entry.ChatID, entry.Text, entry.Spam, entry.AdminName,
+		entry.Timestamp.UTC(), checksJSON); err != nil {
+		return fmt.Errorf("failed to insert decision for user %d: %w", entry.UserID, err)
+	}
+	log.Printf("[INFO] decision added for user_id:%d, name:%s, chat_id:%d, spam:%v, by:%s",
+		entry.UserID, entry.UserName, entry.ChatID, entry.Spam, entry.AdminName)
+	return nil
+}
+
+// Read returns the latest decisions, newest first
+func (d *Decisions) Read() ([]DecisionInfo, error) {
+	var entries []DecisionInfo
+	err := d.db.Select(&entries, "SELECT * FROM decisions ORDER BY timestamp DESC LIMIT ?", maxDecisionsEntries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get decisions: %w", err)
+	}
+
+	for i, entry := range entries {
+		var checks []spamcheck.Response
+		if err := json.Unmarshal([]byte(entry.ChecksJSON), &checks); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal checks for decision %d: %w", entry.ID, err)
+		}
+		entries[i].Checks = checks
+		entries[i].Timestamp = entry.Timestamp.Local()
+	}
+	return entries, nil
+}
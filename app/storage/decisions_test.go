@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+func TestDecisions_NewDecisions(t *testing.T) {
+	db, err := sqlx.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = NewDecisions(db)
+	require.NoError(t, err)
+
+	var exists int
+	err = db.Get(&exists, "SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='decisions'")
+	require.NoError(t, err)
+	assert.Equal(t, 1, exists)
+
+	// second call on existing table should work
+	_, err = NewDecisions(db)
+	require.NoError(t, err)
+}
+
+func TestDecisions_AddAndRead(t *testing.T) {
+	db, err := sqlx.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	d, err := NewDecisions(db)
+	require.NoError(t, err)
+
+	entries, err := d.Read()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	checks := []spamcheck.Response{{Name: "similarity", Spam: true, Details: "0.62/0.50", Score: 1}}
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, d.Add(DecisionInfo{UserID: 1, UserName: "user1", ChatID: 123, Text: "msg1", Spam: true,
+		AdminName: "admin", Timestamp: ts, Checks: checks}))
+	require.NoError(t, d.Add(DecisionInfo{UserID: 2, UserName: "user2", ChatID: 123, Text: "msg2", Spam: false,
+		AdminName: "admin"}))
+
+	entries, err = d.Read()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, int64(2), entries[0].UserID, "newest first")
+	assert.False(t, entries[0].Spam)
+	assert.Empty(t, entries[0].Checks)
+	assert.WithinDuration(t, time.Now(), entries[0].Timestamp, time.Minute, "current time set")
+
+	assert.Equal(t, int64(1), entries[1].UserID)
+	assert.Equal(t, "user1", entries[1].UserName)
+	assert.Equal(t, int64(123), entries[1].ChatID)
+	assert.Equal(t, "msg1", entries[1].Text)
+	assert.True(t, entries[1].Spam)
+	assert.Equal(t, "admin", entries[1].AdminName)
+	assert.Equal(t, checks, entries[1].Checks)
+	assert.True(t, ts.Equal(entries[1].Timestamp))
+}
@@ -25,6 +25,7 @@ type DetectedSpamInfo struct {
 	Text       string               `db:"text"`
 	UserID     int64                `db:"user_id"`
 	UserName   string               `db:"user_name"`
+	ChatID     int64                `db:"chat_id"` // originating chat (group)
 	Timestamp  time.Time            `db:"timestamp"`
 	Added      bool                 `db:"added"`  // added to samples
 	ChecksJSON string               `db:"checks"` // Store as JSON
@@ -40,7 +41,8 @@ func NewDetectedSpam(db *sqlx.DB) (*DetectedSpam, error) {
 		user_name TEXT,
 		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
 		added BOOLEAN DEFAULT 0,
-		checks TEXT
+		checks TEXT,
+		chat_id INTEGER DEFAULT 0
 	)`)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create detected_spam table: %w", err)
@@ -52,6 +54,13 @@ func NewDetectedSpam(db *sqlx.DB) (*DetectedSpam, error) {
 			return nil, fmt.Errorf("failed to alter detected_spam table: %w", err)
 		}
 	}
+	_, err = db.Exec(`ALTER TABLE detected_spam ADD COLUMN chat_id INTEGER DEFAULT 0`)
+	if err != nil {
+		if !strings.Contains(err.Error(), "duplicate column name") {
+			return nil, fmt.Errorf("failed to alter detected_spam table: %w", err)
+		}
+	}
+
 	// add index on timestamp
 	if _, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_detected_spam_timestamp ON detected_spam(timestamp)`); err != nil {
 		return nil, fmt.Errorf("failed to create index on timestamp: %w", err)
@@ -67,12 +76,12 @@ func (ds *DetectedSpam) Write(entry DetectedSpamInfo, checks []spamcheck.Respons
 		return fmt.Errorf("failed to marshal checks: %w", err)
 	}
 
-	query := `INSERT INTO detected_spam (text, user_id, user_name, timestamp, checks) VALUES (?, ?, ?, ?, ?)`
-	if _, err := ds.db.Exec(query, entry.Text, entry.UserID, entry.UserName, entry.Timestamp, checksJSON); err != nil {
+	query := `INSERT INTO detected_spam (text, user_id, user_name, timestamp, checks, chat_id) VALUES (?, ?, ?, ?, ?, ?)`
+	if _, err := ds.db.Exec(query, entry.Text, entry.UserID, entry.UserName, entry.Timestamp, checksJSON, entry.ChatID); err != nil {
 		return fmt.Errorf("failed to insert detected spam entry: %w", err)
 	}
 
-	log.Printf("[INFO] detected spam entry added for user_id:%d, name:%s", entry.UserID, entry.UserName)
+	log.Printf("[INFO] detected spam entry added for user_id:%d, name:%s, chat_id:%d", entry.UserID, entry.UserName, entry.ChatID)
 	return nil
 }
 
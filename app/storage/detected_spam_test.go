@@ -38,6 +38,7 @@ func TestDetectedSpam_Write(t *testing.T) {
 		Text:      "spam message",
 		UserID:    1,
 		UserName:  "Spammer",
+		ChatID:    -100123,
 		Timestamp: time.Now(),
 	}
 
@@ -56,6 +57,11 @@ func TestDetectedSpam_Write(t *testing.T) {
 	err = db.Get(&count, "SELECT COUNT(*) FROM detected_spam")
 	require.NoError(t, err)
 	assert.Equal(t, 1, count)
+
+	entries, err := ds.Read()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, int64(-100123), entries[0].ChatID)
 }
 
 func TestSetAddedToSamplesFlag(t *testing.T) {
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+const maxDisagreementsEntries = 500
+
+// Disagreements is a storage for messages the shadow detector disagreed on with the active one
+type Disagreements struct {
+	db *sqlx.DB
+}
+
+// DisagreementInfo represents a message with different verdicts of the active and shadow detectors
+type DisagreementInfo struct {
+	ID               int64                `db:"id"`
+	UserID           int64                `db:"user_id"`
+	UserName         string               `db:"user_name"`
+	ChatID           int64                `db:"chat_id"` // originating chat (group)
+	Text             string               `db:"text"`
+	ActiveSpam       bool                 `db:"active_spam"` // verdict of the active detector
+	ActiveScore      float64              `db:"active_score"`
+	ShadowSpam       bool                 `db:"shadow_spam"` // verdict of the shadow detector
+	ShadowScore      float64              `db:"shadow_score"`
+	Timestamp        time.Time            `db:"timestamp"`
+	ActiveChecksJSON string               `db:"active_checks"` // Store as JSON
+	ShadowChecksJSON string               `db:"shadow_checks"` // Store as JSON
+	ActiveChecks     []spamcheck.Response `db:"-"`             // Don't store in DB
+	ShadowChecks     []spamcheck.Response `db:"-"`             // Don't store in DB
+}
+
+// NewDisagreements creates a new Disagreements storage
+func NewDisagreements(db *sqlx.DB) (*Disagreements, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS disagreements (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER,
+		user_name TEXT,
+		chat_id INTEGER DEFAULT 0,
+		text TEXT,
+		active_spam BOOLEAN DEFAULT 0,
+		active_score REAL DEFAULT 0,
+		shadow_spam BOOLEAN DEFAULT 0,
+		shadow_score REAL DEFAULT 0,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+		active_checks TEXT,
+		shadow_checks TEXT
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create disagreements table: %w", err)
+	}
+
+	if _, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_disagreements_timestamp ON disagreements(timestamp)`); err != nil {
+		return nil, fmt.Errorf("failed to create index on timestamp: %w", err)
+	}
+
+	return &Disagreements{db: db}, nil
+}
+
+// Add adds a new disagreement, the current time used if the timestamp is not set.
+// Timestamps stored in UTC to keep them comparable.
+func (d *Disagreements) Add(entry DisagreementInfo) error {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	activeJSON, err := json.Marshal(entry.ActiveChecks)
+	if err != nil {
+		return fmt.Errorf("failed to marshal active checks: %w", err)
+	}
+	shadowJSON, err := json.Marshal(entry.ShadowChecks)
+	if err != nil {
+		return fmt.Errorf("failed to marshal shadow checks: %w", err)
+	}
+
+	query := `INSERT INTO disagreements (user_id, user_name, chat_id, text, active_spam, active_score, shadow_spam,
+		shadow_score, timestamp, active_checks, shadow_checks) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	if _, err := d.db.Exec(query, entry.UserID, entry.UserName, entry.ChatID, entry.Text, entry.ActiveSpam, entry.ActiveScore,
+		entry.ShadowSpam, entry.ShadowScore, entry.Timestamp.UTC(), activeJSON, shadowJSON); err != nil {
+		return fmt.Errorf("failed to insert disagreement for user %d: %w", entry.UserID, err)
+	}
+	log.Printf("[INFO] disagreement added for user_id:%d, name:%s, chat_id:%d, active spam:%v, shadow spam:%v",
+		entry.UserID, entry.UserName, entry.ChatID, entry.ActiveSpam, entry.ShadowSpam)
+	return nil
+}
+
+// Read returns the latest disagreements, newest first
+func (d *Disagreements) Read() ([]DisagreementInfo, error) {
+	var entries []DisagreementInfo
+	err := d.db.Select(&entries, "SELECT * FROM disagreements ORDER BY timestamp DESC LIMIT ?", maxDisagreementsEntries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get disagreements: %w", err)
+	}
+
+	for i, entry := range entries {
+		if err := json.Unmarshal([]byte(entry.ActiveChecksJSON), &entries[i].ActiveChecks); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal active checks for disagreement %d: %w", entry.ID, err)
+		}
+		if err := json.Unmarshal([]byte(entry.ShadowChecksJSON), &entries[i].ShadowChecks); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal shadow checks for disagreement %d: %w", entry.ID, err)
+		}
+		entries[i].Timestamp = entry.Timestamp.Local()
+	}
+	return entries, nil
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+func TestDisagreements_NewDisagreements(t *testing.T) {
+	db, err := sqlx.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = NewDisagreements(db)
+	require.NoError(t, err)
+
+	var exists int
+	err = db.Get(&exists, "SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='disagreements'")
+	require.NoError(t, err)
+	assert.Equal(t, 1, exists)
+
+	// second call on existing table should work
+	_, err = NewDisagreements(db)
+	require.NoError(t, err)
+}
+
+func TestDisagreements_AddAndRead(t *testing.T) {
+	db, err := sqlx.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	d, err := NewDisagreements(db)
+	require.NoError(t, err)
+
+	entries, err := d.Read()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	activeChecks := []spamcheck.Response{{Name: "similarity", Spam: false, Details: "0.42/0.50"}}
+	shadowChecks := []spamcheck.Response{{Name: "similarity", Spam: true, Details: "0.42/0.40", Score: 1}}
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, d.Add(DisagreementInfo{UserID: 1, UserName: "user1", ChatID: 123, Text: "msg1", ActiveSpam: false,
+		ShadowSpam: true, ShadowScore: 1, Timestamp: ts, ActiveChecks: activeChecks, ShadowChecks: shadowChecks}))
+	require.NoError(t, d.Add(DisagreementInfo{UserID: 2, UserName: "user2", ChatID: 123, Text: "msg2", ActiveSpam: true,
+		ActiveScore: 2.5}))
+
+	entries, err = d.Read()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, int64(2), entries[0].UserID, "newest first")
+	assert.True(t, entries[0].ActiveSpam)
+	assert.InDelta(t, 2.5, entries[0].ActiveScore, 0.0001)
+	assert.False(t, entries[0].ShadowSpam)
+	assert.Empty(t, entries[0].ActiveChecks)
+	assert.WithinDuration(t, time.Now(), entries[0].Timestamp, time.Minute, "current time set")
+
+	assert.Equal(t, int64(1), entries[1].UserID)
+	assert.Equal(t, "user1", entries[1].UserName)
+	assert.Equal(t, int64(123), entries[1].ChatID)
+	assert.Equal(t, "msg1", entries[1].Text)
+	assert.False(t, entries[1].ActiveSpam)
+	assert.True(t, entries[1].ShadowSpam)
+	assert.InDelta(t, 1, entries[1].ShadowScore, 0.0001)
+	assert.Equal(t, activeChecks, entries[1].ActiveChecks)
+	assert.Equal(t, shadowChecks, entries[1].ShadowChecks)
+	assert.True(t, ts.Equal(entries[1].Timestamp))
+}
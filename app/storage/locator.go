@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -13,9 +14,12 @@ import (
 	"github.com/umputun/tg-spam/lib/spamcheck"
 )
 
+const maxLocatorMsgLen = 1024 // max length of message text kept by locator
+
 // Locator stores messages metadata and spam results for a given ttl period.
 // It is used to locate the message in the chat by its hash and to retrieve spam check results by userID.
 // Useful to match messages from admin chat (only text available) to the original message and to get spam results using UserID.
+// The beginning of each message text is kept as well, to provide the user's previous messages as a context for spam check.
 type Locator struct {
 	ttl     time.Duration
 	minSize int
@@ -35,6 +39,7 @@ type MsgMeta struct {
 type SpamData struct {
 	Time   time.Time `db:"time"`
 	Checks []spamcheck.Response
+	Count  int `db:"count"` // number of spam detections for the user, while the data kept
 }
 
 // NewLocator creates new Locator. ttl defines how long to keep messages in db, minSize defines the minimum number of messages to keep
@@ -70,6 +75,20 @@ func NewLocator(ttl time.Duration, minSize int, db *sqlx.DB) (*Locator, error) {
 		return nil, fmt.Errorf("failed to create spam table: %w", err)
 	}
 
+	// add count column to spam table, ignore error if it already exists
+	if _, err = db.Exec(`ALTER TABLE spam ADD COLUMN count INTEGER DEFAULT 1`); err != nil {
+		if !strings.Contains(err.Error(), "duplicate column name") {
+			return nil, fmt.Errorf("failed to alter spam table: %w", err)
+		}
+	}
+
+	// add msg column to messages table, ignore error if it already exists
+	if _, err = db.Exec(`ALTER TABLE messages ADD COLUMN msg TEXT DEFAULT ''`); err != nil {
+		if !strings.Contains(err.Error(), "duplicate column name") {
+			return nil, fmt.Errorf("failed to alter messages table: %w", err)
+		}
+	}
+
 	return &Locator{
 		ttl:     ttl,
 		minSize: minSize,
@@ -87,11 +106,12 @@ func (l *Locator) AddMessage(msg string, chatID, userID int64, userName string,
 	hash := l.MsgHash(msg)
 	log.Printf("[DEBUG] add message to locator: %q, hash:%s, userID:%d, user name:%q, chatID:%d, msgID:%d",
 		msg, hash, userID, userName, chatID, msgID)
-	_, err := l.db.NamedExec(`INSERT OR REPLACE INTO messages (hash, time, chat_id, user_id, user_name, msg_id) 
-        VALUES (:hash, :time, :chat_id, :user_id, :user_name, :msg_id)`,
+	_, err := l.db.NamedExec(`INSERT OR REPLACE INTO messages (hash, time, chat_id, user_id, user_name, msg_id, msg) 
+        VALUES (:hash, :time, :chat_id, :user_id, :user_name, :msg_id, :msg)`,
 		struct {
 			MsgMeta
 			Hash string `db:"hash"`
+			Msg  string `db:"msg"`
 		}{
 			MsgMeta: MsgMeta{
 				Time:     time.Now(),
@@ -101,6 +121,7 @@ func (l *Locator) AddMessage(msg string, chatID, userID int64, userName string,
 				MsgID:    msgID,
 			},
 			Hash: hash,
+			Msg:  truncateMsg(msg),
 		})
 	if err != nil {
 		return fmt.Errorf("failed to insert message: %w", err)
@@ -109,13 +130,14 @@ func (l *Locator) AddMessage(msg string, chatID, userID int64, userName string,
 }
 
 // AddSpam adds spam data to the locator and also cleans up old spam data.
+// Repeated spam from the same user increments the user's spam count.
 func (l *Locator) AddSpam(userID int64, checks []spamcheck.Response) error {
 	checksStr, err := json.Marshal(checks)
 	if err != nil {
 		return fmt.Errorf("failed to marshal checks: %w", err)
 	}
-	_, err = l.db.NamedExec(`INSERT OR REPLACE INTO spam (user_id, time, checks) 
-        VALUES (:user_id, :time, :checks)`,
+	_, err = l.db.NamedExec(`INSERT INTO spam (user_id, time, checks, count) VALUES (:user_id, :time, :checks, 1)
+		ON CONFLICT(user_id) DO UPDATE SET time = excluded.time, checks = excluded.checks, count = spam.count + 1`,
 		map[string]interface{}{
 			"user_id": userID,
 			"time":    time.Now(),
@@ -162,11 +184,27 @@ func (l *Locator) UserIDByName(userName string) int64 {
 	return userID
 }
 
+// UserMessages returns up to limit latest messages of the user, oldest first.
+// Messages are truncated to maxLocatorMsgLen symbols.
+func (l *Locator) UserMessages(userID int64, limit int) []string {
+	var msgs []string
+	err := l.db.Select(&msgs, `SELECT msg FROM messages WHERE user_id = ? AND msg != '' ORDER BY time DESC, rowid DESC LIMIT ?`,
+		userID, limit)
+	if err != nil {
+		log.Printf("[DEBUG] failed to get messages of user %d: %v", userID, err)
+		return nil
+	}
+	for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+		msgs[i], msgs[j] = msgs[j], msgs[i]
+	}
+	return msgs
+}
+
 // Spam returns message SpamData for given msg
 func (l *Locator) Spam(userID int64) (SpamData, bool) {
 	var data SpamData
 	var checksStr string
-	err := l.db.QueryRow(`SELECT time, checks FROM spam WHERE user_id = ?`, userID).Scan(&data.Time, &checksStr)
+	err := l.db.QueryRow(`SELECT time, checks, count FROM spam WHERE user_id = ?`, userID).Scan(&data.Time, &checksStr, &data.Count)
 	if err != nil {
 		return SpamData{}, false
 	}
@@ -178,7 +216,7 @@ func (l *Locator) Spam(userID int64) (SpamData, bool) {
 }
 
 // MsgHash returns sha256 hash of a message
-// we use hash to avoid storing potentially long messages and all we need is just match
+// we use hash as a key to avoid indexing potentially long messages and all we need is just match
 func (l *Locator) MsgHash(msg string) string {
 	return fmt.Sprintf("%x", sha256.Sum256([]byte(msg)))
 }
@@ -204,11 +242,19 @@ func (l *Locator) cleanupSpam() error {
 	return nil
 }
 
+// truncateMsg cuts the message to maxLocatorMsgLen symbols, only the beginning of the message is kept
+func truncateMsg(msg string) string {
+	if r := []rune(msg); len(r) > maxLocatorMsgLen {
+		return string(r[:maxLocatorMsgLen])
+	}
+	return msg
+}
+
 func (m MsgMeta) String() string {
 	return fmt.Sprintf("{chatID: %d, user name: %s, userID: %d, msgID: %d, time: %s}",
 		m.ChatID, m.UserName, m.UserID, m.MsgID, m.Time.Format(time.RFC3339))
 }
 
 func (s SpamData) String() string {
-	return fmt.Sprintf("{time: %s, checks: %+v}", s.Time.Format(time.RFC3339), s.Checks)
+	return fmt.Sprintf("{time: %s, checks: %+v, count: %d}", s.Time.Format(time.RFC3339), s.Checks, s.Count)
 }
@@ -3,6 +3,7 @@ package storage
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -81,6 +82,14 @@ func TestLocator_AddAndRetrieveSpam(t *testing.T) {
 	retrievedSpam, found := locator.Spam(userID)
 	require.True(t, found)
 	assert.Equal(t, checks, retrievedSpam.Checks)
+	assert.Equal(t, 1, retrievedSpam.Count)
+
+	checks2 := []spamcheck.Response{{Name: "test2", Spam: true, Details: "more spam"}}
+	require.NoError(t, locator.AddSpam(userID, checks2))
+	retrievedSpam, found = locator.Spam(userID)
+	require.True(t, found)
+	assert.Equal(t, checks2, retrievedSpam.Checks)
+	assert.Equal(t, 2, retrievedSpam.Count)
 }
 
 func TestLocator_CleanupLogic(t *testing.T) {
@@ -156,3 +165,26 @@ func newTestLocator(t *testing.T) *Locator {
 
 	return locator
 }
+
+func TestLocator_UserMessages(t *testing.T) {
+	locator := newTestLocator(t)
+
+	assert.Empty(t, locator.UserMessages(1, 10))
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, locator.AddMessage(fmt.Sprintf("message %d", i), 1234, 1, "user1", i))
+	}
+	require.NoError(t, locator.AddMessage("other user message", 1234, 2, "user2", 10))
+	long := strings.Repeat("я", 2000)
+	require.NoError(t, locator.AddMessage(long, 1234, 3, "user3", 11))
+
+	assert.Equal(t, []string{"message 2", "message 3", "message 4"}, locator.UserMessages(1, 3), "latest, oldest first")
+	assert.Equal(t, []string{"message 0", "message 1", "message 2", "message 3", "message 4"}, locator.UserMessages(1, 10))
+	assert.Equal(t, []string{"other user message"}, locator.UserMessages(2, 10))
+
+	res := locator.UserMessages(3, 10)
+	require.Len(t, res, 1)
+	assert.Equal(t, strings.Repeat("я", maxLocatorMsgLen), res[0], "truncated")
+	_, found := locator.Message(long)
+	assert.True(t, found, "located by full text")
+}
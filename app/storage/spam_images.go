@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SpamImages is a storage for perceptual hashes of known spam images
+type SpamImages struct {
+	db *sqlx.DB
+}
+
+// SpamImageInfo represents information about a known spam image
+type SpamImageInfo struct {
+	ID        int64     `db:"id"`
+	Hash      int64     `db:"hash"`    // perceptual hash of the image, uint64 stored as int64
+	FileID    string    `db:"file_id"` // telegram file id of the image
+	UserID    int64     `db:"user_id"` // user posted the image
+	Timestamp time.Time `db:"timestamp"`
+}
+
+// NewSpamImages creates a new SpamImages storage
+func NewSpamImages(db *sqlx.DB) (*SpamImages, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS spam_images (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		hash INTEGER UNIQUE,
+		file_id TEXT,
+		user_id INTEGER DEFAULT 0,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spam_images table: %w", err)
+	}
+	return &SpamImages{db: db}, nil
+}
+
+// Add adds a hash of spam image, the same hash added again is ignored
+func (s *SpamImages) Add(hash uint64, fileID string, userID int64) error {
+	query := `INSERT OR IGNORE INTO spam_images (hash, file_id, user_id, timestamp) VALUES (?, ?, ?, ?)`
+	if _, err := s.db.Exec(query, int64(hash), fileID, userID, time.Now()); err != nil { //nolint:gosec // hash stored as is
+		return fmt.Errorf("failed to insert spam image %x: %w", hash, err)
+	}
+	log.Printf("[INFO] spam image added, hash:%016x, file_id:%s, user_id:%d", hash, fileID, userID)
+	return nil
+}
+
+// Hashes returns hashes of all known spam images
+func (s *SpamImages) Hashes() ([]uint64, error) {
+	var hashes []int64
+	if err := s.db.Select(&hashes, "SELECT hash FROM spam_images"); err != nil {
+		return nil, fmt.Errorf("failed to get spam images: %w", err)
+	}
+	res := make([]uint64, 0, len(hashes))
+	for _, h := range hashes {
+		res = append(res, uint64(h)) //nolint:gosec // hash stored as is
+	}
+	return res, nil
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpamImages_AddAndHashes(t *testing.T) {
+	db, err := sqlx.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	s, err := NewSpamImages(db)
+	require.NoError(t, err)
+
+	hashes, err := s.Hashes()
+	require.NoError(t, err)
+	assert.Empty(t, hashes)
+
+	require.NoError(t, s.Add(0xff00ff00, "file1", 1))
+	require.NoError(t, s.Add(0xfedcba9876543210, "file2", 2)) // high bit set, stored as negative int64
+	require.NoError(t, s.Add(0xff00ff00, "file3", 3), "duplicate ignored")
+
+	hashes, err = s.Hashes()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []uint64{0xff00ff00, 0xfedcba9876543210}, hashes)
+
+	// second call on existing table should work
+	_, err = NewSpamImages(db)
+	require.NoError(t, err)
+}
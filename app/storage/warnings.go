@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const maxWarningsEntries = 500
+
+// Warnings is a storage for warnings issued by admins
+type Warnings struct {
+	db *sqlx.DB
+}
+
+// WarningInfo represents information about a warning issued to a user
+type WarningInfo struct {
+	ID        int64     `db:"id"`
+	UserID    int64     `db:"user_id"`
+	UserName  string    `db:"user_name"`
+	ChatID    int64     `db:"chat_id"`    // chat (group) where the warned message was posted
+	Text      string    `db:"text"`       // text of the warned message
+	AdminName string    `db:"admin_name"` // name of the admin issued the warning
+	Timestamp time.Time `db:"timestamp"`
+}
+
+// NewWarnings creates a new Warnings storage
+func NewWarnings(db *sqlx.DB) (*Warnings, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS warnings (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER,
+		user_name TEXT,
+		chat_id INTEGER DEFAULT 0,
+		text TEXT,
+		admin_name TEXT,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create warnings table: %w", err)
+	}
+
+	if _, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_warnings_user_id_timestamp ON warnings(user_id, timestamp)`); err != nil {
+		return nil, fmt.Errorf("failed to create index on user_id and timestamp: %w", err)
+	}
+
+	return &Warnings{db: db}, nil
+}
+
+// Add adds a new warning, the current time used if the timestamp is not set.
+// Timestamps stored in UTC to keep them comparable.
+func (w *Warnings) Add(entry WarningInfo) error {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	query := `INSERT INTO warnings (user_id, user_name, chat_id, text, admin_name, timestamp) VALUES (?, ?, ?, ?, ?, ?)`
+	if _, err := w.db.Exec(query, entry.UserID, entry.UserName, entry.ChatID, entry.Text, entry.AdminName, entry.Timestamp.UTC()); err != nil {
+		return fmt.Errorf("failed to insert warning for user %d: %w", entry.UserID, err)
+	}
+	log.Printf("[INFO] warning added for user_id:%d, name:%s, chat_id:%d, by:%s", entry.UserID, entry.UserName, entry.ChatID, entry.AdminName)
+	return nil
+}
+
+// Count returns the number of warnings issued to the user since the given time.
+// Zero since counts all the warnings.
+func (w *Warnings) Count(userID int64, since time.Time) (int, error) {
+	var count int
+	if err := w.db.Get(&count, "SELECT COUNT(*) FROM warnings WHERE user_id = ? AND timestamp >= ?", userID, since.UTC()); err != nil {
+		return 0, fmt.Errorf("failed to count warnings for user %d: %w", userID, err)
+	}
+	return count, nil
+}
+
+// Read returns the latest warnings, newest first
+func (w *Warnings) Read() ([]WarningInfo, error) {
+	var entries []WarningInfo
+	err := w.db.Select(&entries, "SELECT * FROM warnings ORDER BY timestamp DESC LIMIT ?", maxWarningsEntries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get warnings: %w", err)
+	}
+	for i, entry := range entries {
+		entries[i].Timestamp = entry.Timestamp.Local()
+	}
+	return entries, nil
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarnings_NewWarnings(t *testing.T) {
+	db, err := sqlx.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = NewWarnings(db)
+	require.NoError(t, err)
+
+	var exists int
+	err = db.Get(&exists, "SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='warnings'")
+	require.NoError(t, err)
+	assert.Equal(t, 1, exists)
+
+	// second call on existing table should work
+	_, err = NewWarnings(db)
+	require.NoError(t, err)
+}
+
+func TestWarnings_AddAndCount(t *testing.T) {
+	db, err := sqlx.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	w, err := NewWarnings(db)
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, w.Add(WarningInfo{UserID: 1, UserName: "user1", ChatID: 123, Text: "msg1", AdminName: "admin",
+		Timestamp: now.Add(-48 * time.Hour)}))
+	require.NoError(t, w.Add(WarningInfo{UserID: 1, UserName: "user1", ChatID: 123, Text: "msg2", AdminName: "admin"}))
+	require.NoError(t, w.Add(WarningInfo{UserID: 2, UserName: "user2", ChatID: 123, Text: "msg3", AdminName: "admin"}))
+
+	count, err := w.Count(1, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count, "all warnings for user 1")
+
+	count, err = w.Count(1, now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, count, "old warning expired")
+
+	count, err = w.Count(2, now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	count, err = w.Count(3, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, count, "no warnings for unknown user")
+}
+
+func TestWarnings_Read(t *testing.T) {
+	db, err := sqlx.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	w, err := NewWarnings(db)
+	require.NoError(t, err)
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, w.Add(WarningInfo{UserID: 1, UserName: "user1", ChatID: 123, Text: "msg1", AdminName: "admin1", Timestamp: ts}))
+	require.NoError(t, w.Add(WarningInfo{UserID: 2, UserName: "user2", ChatID: 456, Text: "msg2", AdminName: "admin2",
+		Timestamp: ts.Add(time.Hour)}))
+
+	entries, err := w.Read()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, int64(2), entries[0].UserID, "newest first")
+	assert.Equal(t, "user2", entries[0].UserName)
+	assert.Equal(t, int64(456), entries[0].ChatID)
+	assert.Equal(t, "msg2", entries[0].Text)
+	assert.Equal(t, "admin2", entries[0].AdminName)
+	assert.True(t, ts.Add(time.Hour).Equal(entries[0].Timestamp))
+	assert.Equal(t, int64(1), entries[1].UserID)
+}
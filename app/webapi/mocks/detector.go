@@ -21,8 +21,8 @@ import (
 //			ApprovedUsersFunc: func() []approved.UserInfo {
 //				panic("mock out the ApprovedUsers method")
 //			},
-//			CheckFunc: func(req spamcheck.Request) (bool, []spamcheck.Response) {
-//				panic("mock out the Check method")
+//			CheckWithScoreFunc: func(req spamcheck.Request) (bool, float64, []spamcheck.Response) {
+//				panic("mock out the CheckWithScore method")
 //			},
 //			RemoveApprovedUserFunc: func(id string) error {
 //				panic("mock out the RemoveApprovedUser method")
@@ -40,8 +40,8 @@ type DetectorMock struct {
 	// ApprovedUsersFunc mocks the ApprovedUsers method.
 	ApprovedUsersFunc func() []approved.UserInfo
 
-	// CheckFunc mocks the Check method.
-	CheckFunc func(req spamcheck.Request) (bool, []spamcheck.Response)
+	// CheckWithScoreFunc mocks the CheckWithScore method.
+	CheckWithScoreFunc func(req spamcheck.Request) (bool, float64, []spamcheck.Response)
 
 	// RemoveApprovedUserFunc mocks the RemoveApprovedUser method.
 	RemoveApprovedUserFunc func(id string) error
@@ -56,8 +56,8 @@ type DetectorMock struct {
 		// ApprovedUsers holds details about calls to the ApprovedUsers method.
 		ApprovedUsers []struct {
 		}
-		// Check holds details about calls to the Check method.
-		Check []struct {
+		// CheckWithScore holds details about calls to the CheckWithScore method.
+		CheckWithScore []struct {
 			// Req is the req argument value.
 			Req spamcheck.Request
 		}
@@ -69,7 +69,7 @@ type DetectorMock struct {
 	}
 	lockAddApprovedUser    sync.RWMutex
 	lockApprovedUsers      sync.RWMutex
-	lockCheck              sync.RWMutex
+	lockCheckWithScore     sync.RWMutex
 	lockRemoveApprovedUser sync.RWMutex
 }
 
@@ -146,43 +146,43 @@ func (mock *DetectorMock) ResetApprovedUsersCalls() {
 	mock.lockApprovedUsers.Unlock()
 }
 
-// Check calls CheckFunc.
-func (mock *DetectorMock) Check(req spamcheck.Request) (bool, []spamcheck.Response) {
-	if mock.CheckFunc == nil {
-		panic("DetectorMock.CheckFunc: method is nil but Detector.Check was just called")
+// CheckWithScore calls CheckWithScoreFunc.
+func (mock *DetectorMock) CheckWithScore(req spamcheck.Request) (bool, float64, []spamcheck.Response) {
+	if mock.CheckWithScoreFunc == nil {
+		panic("DetectorMock.CheckWithScoreFunc: method is nil but Detector.CheckWithScore was just called")
 	}
 	callInfo := struct {
 		Req spamcheck.Request
 	}{
 		Req: req,
 	}
-	mock.lockCheck.Lock()
-	mock.calls.Check = append(mock.calls.Check, callInfo)
-	mock.lockCheck.Unlock()
-	return mock.CheckFunc(req)
+	mock.lockCheckWithScore.Lock()
+	mock.calls.CheckWithScore = append(mock.calls.CheckWithScore, callInfo)
+	mock.lockCheckWithScore.Unlock()
+	return mock.CheckWithScoreFunc(req)
 }
 
-// CheckCalls gets all the calls that were made to Check.
+// CheckWithScoreCalls gets all the calls that were made to CheckWithScore.
 // Check the length with:
 //
-//	len(mockedDetector.CheckCalls())
-func (mock *DetectorMock) CheckCalls() []struct {
+//	len(mockedDetector.CheckWithScoreCalls())
+func (mock *DetectorMock) CheckWithScoreCalls() []struct {
 	Req spamcheck.Request
 } {
 	var calls []struct {
 		Req spamcheck.Request
 	}
-	mock.lockCheck.RLock()
-	calls = mock.calls.Check
-	mock.lockCheck.RUnlock()
+	mock.lockCheckWithScore.RLock()
+	calls = mock.calls.CheckWithScore
+	mock.lockCheckWithScore.RUnlock()
 	return calls
 }
 
-// ResetCheckCalls reset all the calls that were made to Check.
-func (mock *DetectorMock) ResetCheckCalls() {
-	mock.lockCheck.Lock()
-	mock.calls.Check = nil
-	mock.lockCheck.Unlock()
+// ResetCheckWithScoreCalls reset all the calls that were made to CheckWithScore.
+func (mock *DetectorMock) ResetCheckWithScoreCalls() {
+	mock.lockCheckWithScore.Lock()
+	mock.calls.CheckWithScore = nil
+	mock.lockCheckWithScore.Unlock()
 }
 
 // RemoveApprovedUser calls RemoveApprovedUserFunc.
@@ -234,9 +234,9 @@ func (mock *DetectorMock) ResetCalls() {
 	mock.calls.ApprovedUsers = nil
 	mock.lockApprovedUsers.Unlock()
 
-	mock.lockCheck.Lock()
-	mock.calls.Check = nil
-	mock.lockCheck.Unlock()
+	mock.lockCheckWithScore.Lock()
+	mock.calls.CheckWithScore = nil
+	mock.lockCheckWithScore.Unlock()
 
 	mock.lockRemoveApprovedUser.Lock()
 	mock.calls.RemoveApprovedUser = nil
@@ -0,0 +1,78 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package mocks
+
+import (
+	"github.com/umputun/tg-spam/app/storage"
+	"sync"
+)
+
+// DisagreementsMock is a mock implementation of webapi.Disagreements.
+//
+//	func TestSomethingThatUsesDisagreements(t *testing.T) {
+//
+//		// make and configure a mocked webapi.Disagreements
+//		mockedDisagreements := &DisagreementsMock{
+//			ReadFunc: func() ([]storage.DisagreementInfo, error) {
+//				panic("mock out the Read method")
+//			},
+//		}
+//
+//		// use mockedDisagreements in code that requires webapi.Disagreements
+//		// and then make assertions.
+//
+//	}
+type DisagreementsMock struct {
+	// ReadFunc mocks the Read method.
+	ReadFunc func() ([]storage.DisagreementInfo, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Read holds details about calls to the Read method.
+		Read []struct {
+		}
+	}
+	lockRead sync.RWMutex
+}
+
+// Read calls ReadFunc.
+func (mock *DisagreementsMock) Read() ([]storage.DisagreementInfo, error) {
+	if mock.ReadFunc == nil {
+		panic("DisagreementsMock.ReadFunc: method is nil but Disagreements.Read was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockRead.Lock()
+	mock.calls.Read = append(mock.calls.Read, callInfo)
+	mock.lockRead.Unlock()
+	return mock.ReadFunc()
+}
+
+// ReadCalls gets all the calls that were made to Read.
+// Check the length with:
+//
+//	len(mockedDisagreements.ReadCalls())
+func (mock *DisagreementsMock) ReadCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockRead.RLock()
+	calls = mock.calls.Read
+	mock.lockRead.RUnlock()
+	return calls
+}
+
+// ResetReadCalls reset all the calls that were made to Read.
+func (mock *DisagreementsMock) ResetReadCalls() {
+	mock.lockRead.Lock()
+	mock.calls.Read = nil
+	mock.lockRead.Unlock()
+}
+
+// ResetCalls reset all the calls that were made to all mocked methods.
+func (mock *DisagreementsMock) ResetCalls() {
+	mock.lockRead.Lock()
+	mock.calls.Read = nil
+	mock.lockRead.Unlock()
+}
@@ -0,0 +1,78 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package mocks
+
+import (
+	"github.com/umputun/tg-spam/app/bot"
+	"sync"
+)
+
+// TunerMock is a mock implementation of webapi.Tuner.
+//
+//	func TestSomethingThatUsesTuner(t *testing.T) {
+//
+//		// make and configure a mocked webapi.Tuner
+//		mockedTuner := &TunerMock{
+//			LastFunc: func() (bot.TuneResult, bool) {
+//				panic("mock out the Last method")
+//			},
+//		}
+//
+//		// use mockedTuner in code that requires webapi.Tuner
+//		// and then make assertions.
+//
+//	}
+type TunerMock struct {
+	// LastFunc mocks the Last method.
+	LastFunc func() (bot.TuneResult, bool)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Last holds details about calls to the Last method.
+		Last []struct {
+		}
+	}
+	lockLast sync.RWMutex
+}
+
+// Last calls LastFunc.
+func (mock *TunerMock) Last() (bot.TuneResult, bool) {
+	if mock.LastFunc == nil {
+		panic("TunerMock.LastFunc: method is nil but Tuner.Last was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockLast.Lock()
+	mock.calls.Last = append(mock.calls.Last, callInfo)
+	mock.lockLast.Unlock()
+	return mock.LastFunc()
+}
+
+// LastCalls gets all the calls that were made to Last.
+// Check the length with:
+//
+//	len(mockedTuner.LastCalls())
+func (mock *TunerMock) LastCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockLast.RLock()
+	calls = mock.calls.Last
+	mock.lockLast.RUnlock()
+	return calls
+}
+
+// ResetLastCalls reset all the calls that were made to Last.
+func (mock *TunerMock) ResetLastCalls() {
+	mock.lockLast.Lock()
+	mock.calls.Last = nil
+	mock.lockLast.Unlock()
+}
+
+// ResetCalls reset all the calls that were made to all mocked methods.
+func (mock *TunerMock) ResetCalls() {
+	mock.lockLast.Lock()
+	mock.calls.Last = nil
+	mock.lockLast.Unlock()
+}
@@ -0,0 +1,78 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package mocks
+
+import (
+	"github.com/umputun/tg-spam/app/storage"
+	"sync"
+)
+
+// WarningsMock is a mock implementation of webapi.Warnings.
+//
+//	func TestSomethingThatUsesWarnings(t *testing.T) {
+//
+//		// make and configure a mocked webapi.Warnings
+//		mockedWarnings := &WarningsMock{
+//			ReadFunc: func() ([]storage.WarningInfo, error) {
+//				panic("mock out the Read method")
+//			},
+//		}
+//
+//		// use mockedWarnings in code that requires webapi.Warnings
+//		// and then make assertions.
+//
+//	}
+type WarningsMock struct {
+	// ReadFunc mocks the Read method.
+	ReadFunc func() ([]storage.WarningInfo, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Read holds details about calls to the Read method.
+		Read []struct {
+		}
+	}
+	lockRead sync.RWMutex
+}
+
+// Read calls ReadFunc.
+func (mock *WarningsMock) Read() ([]storage.WarningInfo, error) {
+	if mock.ReadFunc == nil {
+		panic("WarningsMock.ReadFunc: method is nil but Warnings.Read was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockRead.Lock()
+	mock.calls.Read = append(mock.calls.Read, callInfo)
+	mock.lockRead.Unlock()
+	return mock.ReadFunc()
+}
+
+// ReadCalls gets all the calls that were made to Read.
+// Check the length with:
+//
+//	len(mockedWarnings.ReadCalls())
+func (mock *WarningsMock) ReadCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockRead.RLock()
+	calls = mock.calls.Read
+	mock.lockRead.RUnlock()
+	return calls
+}
+
+// ResetReadCalls reset all the calls that were made to Read.
+func (mock *WarningsMock) ResetReadCalls() {
+	mock.lockRead.Lock()
+	mock.calls.Read = nil
+	mock.lockRead.Unlock()
+}
+
+// ResetCalls reset all the calls that were made to all mocked methods.
+func (mock *WarningsMock) ResetCalls() {
+	mock.lockRead.Lock()
+	mock.calls.Read = nil
+	mock.lockRead.Unlock()
+}
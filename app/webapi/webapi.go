@@ -13,6 +13,7 @@ import (
 	"log"
 	"math/big"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -24,6 +25,7 @@ import (
 	"github.com/go-pkgz/lgr"
 	"github.com/go-pkgz/rest"
 
+	"github.com/umputun/tg-spam/app/bot"
 	"github.com/umputun/tg-spam/app/storage"
 	"github.com/umputun/tg-spam/lib/approved"
 	"github.com/umputun/tg-spam/lib/spamcheck"
@@ -33,6 +35,9 @@ import (
 //go:generate moq --out mocks/spam_filter.go --pkg mocks --with-resets --skip-ensure . SpamFilter
 //go:generate moq --out mocks/locator.go --pkg mocks --with-resets --skip-ensure . Locator
 //go:generate moq --out mocks/detected_spam.go --pkg mocks --with-resets --skip-ensure . DetectedSpam
+//go:generate moq --out mocks/warnings.go --pkg mocks --with-resets --skip-ensure . Warnings
+//go:generate moq --out mocks/tuner.go --pkg mocks --with-resets --skip-ensure . Tuner
+//go:generate moq --out mocks/disagreements.go --pkg mocks --with-resets --skip-ensure . Disagreements
 
 //go:embed assets/* assets/components/*
 var templateFS embed.FS
@@ -45,48 +50,83 @@ type Server struct {
 
 // Config defines  server parameters
 type Config struct {
-	Version      string       // version to show in /ping
-	ListenAddr   string       // listen address
-	Detector     Detector     // spam detector
-	SpamFilter   SpamFilter   // spam filter (bot)
-	DetectedSpam DetectedSpam // detected spam accessor
-	Locator      Locator      // locator for user info
-	AuthPasswd   string       // basic auth password for user "tg-spam"
-	Dbg          bool         // debug mode
-	Settings     Settings     // application settings
+	Version       string             // version to show in /ping
+	ListenAddr    string             // listen address
+	Detector      Detector           // spam detector
+	Profiles      map[int64]Detector // per-group spam detectors, selected by chat_id in check request
+	SpamFilter    SpamFilter         // spam filter (bot)
+	DetectedSpam  DetectedSpam       // detected spam accessor
+	Warnings      Warnings           // warnings accessor
+	Tuner         Tuner              // thresholds tuner, optional
+	Disagreements Disagreements      // shadow detector disagreements accessor, optional
+	Locator       Locator            // locator for user info
+	AuthPasswd    string             // basic auth password for user "tg-spam"
+	Dbg           bool               // debug mode
+	Settings      Settings           // application settings
 }
 
 // Settings contains all application settings
 type Settings struct {
-	PrimaryGroup            string   `json:"primary_group"`
-	AdminGroup              string   `json:"admin_group"`
-	DisableAdminSpamForward bool     `json:"disable_admin_spam_forward"`
-	LoggerEnabled           bool     `json:"logger_enabled"`
-	SuperUsers              []string `json:"super_users"`
-	NoSpamReply             bool     `json:"no_spam_reply"`
-	CasEnabled              bool     `json:"cas_enabled"`
-	MetaEnabled             bool     `json:"meta_enabled"`
-	MetaLinksLimit          int      `json:"meta_links_limit"`
-	MetaLinksOnly           bool     `json:"meta_links_only"`
-	MetaImageOnly           bool     `json:"meta_image_only"`
-	MultiLangLimit          int      `json:"multi_lang_limit"`
-	OpenAIEnabled           bool     `json:"openai_enabled"`
-	SamplesDataPath         string   `json:"samples_data_path"`
-	DynamicDataPath         string   `json:"dynamic_data_path"`
-	WatchIntervalSecs       int      `json:"watch_interval_secs"`
-	SimilarityThreshold     float64  `json:"similarity_threshold"`
-	MinMsgLen               int      `json:"min_msg_len"`
-	MaxEmoji                int      `json:"max_emoji"`
-	MinSpamProbability      float64  `json:"min_spam_probability"`
-	ParanoidMode            bool     `json:"paranoid_mode"`
-	FirstMessagesCount      int      `json:"first_messages_count"`
-	StartupMessageEnabled   bool     `json:"startup_message_enabled"`
-	TrainingEnabled         bool     `json:"training_enabled"`
+	PrimaryGroup            string             `json:"primary_group"`
+	AdditionalGroups        []string           `json:"additional_groups"`
+	AdminGroup              string             `json:"admin_group"`
+	DisableAdminSpamForward bool               `json:"disable_admin_spam_forward"`
+	LoggerEnabled           bool               `json:"logger_enabled"`
+	SuperUsers              []string           `json:"super_users"`
+	NoSpamReply             bool               `json:"no_spam_reply"`
+	CasEnabled              bool               `json:"cas_enabled"`
+	MetaEnabled             bool               `json:"meta_enabled"`
+	MetaLinksLimit          int                `json:"meta_links_limit"`
+	MetaLinksOnly           bool               `json:"meta_links_only"`
+	MetaImageOnly           bool               `json:"meta_image_only"`
+	MetaHiddenLinksLimit    int                `json:"meta_hidden_links_limit"`
+	MetaForward             bool               `json:"meta_forward"`
+	MetaForwardChannels     []int64            `json:"meta_forward_channels"`
+	MetaDomains             bool               `json:"meta_domains"`
+	ImageHashEnabled        bool               `json:"image_hash_enabled"`
+	ImageHashDistance       int                `json:"image_hash_distance"`
+	MultiLangLimit          int                `json:"multi_lang_limit"`
+	Tokenizer               string             `json:"tokenizer"`
+	OpenAIEnabled           bool               `json:"openai_enabled"`
+	OpenAIProvider          string             `json:"openai_provider"`
+	SamplesDataPath         string             `json:"samples_data_path"`
+	DynamicDataPath         string             `json:"dynamic_data_path"`
+	ProfilesFile            string             `json:"profiles_file"`
+	ShadowFile              string             `json:"shadow_file"`
+	WatchIntervalSecs       int                `json:"watch_interval_secs"`
+	SimilarityThreshold     float64            `json:"similarity_threshold"`
+	MinMsgLen               int                `json:"min_msg_len"`
+	MaxEmoji                int                `json:"max_emoji"`
+	MinSpamProbability      float64            `json:"min_spam_probability"`
+	ScoreThreshold          float64            `json:"score_threshold"`
+	CheckWeights            map[string]float64 `json:"check_weights"`
+	ParanoidMode            bool               `json:"paranoid_mode"`
+	FirstMessagesCount      int                `json:"first_messages_count"`
+	CheckEdited             bool               `json:"check_edited"`
+	CheckEditedApproved     bool               `json:"check_edited_approved"`
+	StartupMessageEnabled   bool               `json:"startup_message_enabled"`
+	TrainingEnabled         bool               `json:"training_enabled"`
+	PolicyEnabled           bool               `json:"policy_enabled"`
+	PolicyRestrictScore     float64            `json:"policy_restrict_score"`
+	PolicyTempBanScore      float64            `json:"policy_temp_ban_score"`
+	PolicyBanScore          float64            `json:"policy_ban_score"`
+	PolicyRestrictDuration  string             `json:"policy_restrict_duration"`
+	PolicyTempBanDuration   string             `json:"policy_temp_ban_duration"`
+	MaxWarnings             int                `json:"max_warnings"`
+	WarnExpiry              string             `json:"warn_expiry"`
+	CaptchaEnabled          bool               `json:"captcha_enabled"`
+	CaptchaTimeout          string             `json:"captcha_timeout"`
+	CaptchaMath             bool               `json:"captcha_math"`
+	CaptchaApprove          bool               `json:"captcha_approve"`
+	TuneEnabled             bool               `json:"tune_enabled"`
+	TuneInterval            string             `json:"tune_interval"`
+	TuneMinDecisions        int                `json:"tune_min_decisions"`
+	TuneApply               bool               `json:"tune_apply"`
 }
 
 // Detector is a spam detector interface.
 type Detector interface {
-	Check(req spamcheck.Request) (spam bool, cr []spamcheck.Response)
+	CheckWithScore(req spamcheck.Request) (spam bool, score float64, cr []spamcheck.Response)
 	ApprovedUsers() []approved.UserInfo
 	AddApprovedUser(user approved.UserInfo) error
 	RemoveApprovedUser(id string) error
@@ -114,6 +154,21 @@ type DetectedSpam interface {
 	SetAddedToSamplesFlag(id int64) error
 }
 
+// Warnings is a storage interface used to get warnings issued to users
+type Warnings interface {
+	Read() ([]storage.WarningInfo, error)
+}
+
+// Tuner is a thresholds tuner interface used to get the last suggested thresholds
+type Tuner interface {
+	Last() (bot.TuneResult, bool)
+}
+
+// Disagreements is a storage interface used to get messages the shadow detector disagreed on with the active one
+type Disagreements interface {
+	Read() ([]storage.DisagreementInfo, error)
+}
+
 // NewServer creates a new web API server.
 func NewServer(config Config) *Server {
 	return &Server{Config: config}
@@ -199,6 +254,8 @@ func (s *Server) routes(router *chi.Mux) *chi.Mux {
 		webUI.Get("/manage_samples", s.htmlManageSamplesHandler)       // serve manage samples page
 		webUI.Get("/manage_users", s.htmlManageUsersHandler)           // serve manage users page
 		webUI.Get("/detected_spam", s.htmlDetectedSpamHandler)         // serve detected spam page
+		webUI.Get("/warnings", s.htmlWarningsHandler)                  // serve warnings page
+		webUI.Get("/shadow", s.htmlShadowHandler)                      // serve shadow detector disagreements page
 		webUI.Get("/list_settings", s.htmlSettingsHandler)             // serve settings
 		webUI.Get("/styles.css", s.stylesHandler)                      // serve styles.css
 		webUI.Get("/logo.png", s.logoHandler)                          // serve logo.png
@@ -215,12 +272,16 @@ func (s *Server) checkHandler(w http.ResponseWriter, r *http.Request) {
 
 	type CheckResultDisplay struct {
 		Spam   bool
+		Score  float64
 		Checks []spamcheck.Response
 	}
 
 	isHtmxRequest := r.Header.Get("HX-Request") == "true"
 
-	req := spamcheck.Request{}
+	req := struct {
+		spamcheck.Request
+		ChatID int64 `json:"chat_id"` // optional, selects per-group detector profile
+	}{}
 	if !isHtmxRequest {
 		// API request
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -234,12 +295,22 @@ func (s *Server) checkHandler(w http.ResponseWriter, r *http.Request) {
 		req.UserID = r.FormValue("user_id")
 		req.UserName = r.FormValue("user_name")
 		req.Msg = r.FormValue("msg")
+		if chatID := r.FormValue("chat_id"); chatID != "" {
+			id, err := strconv.ParseInt(chatID, 10, 64)
+			if err != nil {
+				w.Header().Set("HX-Retarget", "#error-message")
+				fmt.Fprintln(w, "<div class='alert alert-danger'>invalid group id.</div>")
+				return
+			}
+			req.ChatID = id
+		}
 	}
 
-	spam, cr := s.Detector.Check(req)
+	detector := s.detector(req.ChatID)
+	spam, score, cr := detector.CheckWithScore(req.Request)
 	if !isHtmxRequest {
 		// for API request return JSON
-		rest.RenderJSON(w, rest.JSON{"spam": spam, "checks": cr})
+		rest.RenderJSON(w, rest.JSON{"spam": spam, "score": score, "checks": cr})
 		return
 	}
 
@@ -252,6 +323,7 @@ func (s *Server) checkHandler(w http.ResponseWriter, r *http.Request) {
 	// render result for HTMX request
 	resultDisplay := CheckResultDisplay{
 		Spam:   spam,
+		Score:  score,
 		Checks: cr,
 	}
 
@@ -262,11 +334,19 @@ func (s *Server) checkHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// the successful check may add user to the approved list. we want to avoid it
-	if err := s.Detector.RemoveApprovedUser(req.UserID); err != nil {
+	if err := detector.RemoveApprovedUser(req.UserID); err != nil {
 		log.Printf("[DEBUG] failed to clenaup after check: %v", err)
 	}
 }
 
+// detector returns the detector for the given chat, the default one if no profile set for the chat
+func (s *Server) detector(chatID int64) Detector {
+	if d, ok := s.Profiles[chatID]; ok && d != nil {
+		return d
+	}
+	return s.Detector
+}
+
 // getDynamicSamplesHandler handles GET /samples request. It returns dynamic samples both for spam and ham.
 func (s *Server) getDynamicSamplesHandler(w http.ResponseWriter, _ *http.Request) {
 	spam, ham, err := s.SpamFilter.DynamicSamples()
@@ -446,10 +526,18 @@ func (s *Server) getApprovedUsersHandler(w http.ResponseWriter, _ *http.Request)
 // htmlSpamCheckHandler handles GET / request.
 // It returns rendered spam_check.html template with all the components.
 func (s *Server) htmlSpamCheckHandler(w http.ResponseWriter, _ *http.Request) {
+	profiles := make([]int64, 0, len(s.Profiles))
+	for chatID := range s.Profiles {
+		profiles = append(profiles, chatID)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i] < profiles[j] })
+
 	tmplData := struct {
-		Version string
+		Version  string
+		Profiles []int64
 	}{
-		Version: s.Version,
+		Version:  s.Version,
+		Profiles: profiles,
 	}
 
 	if err := tmpl.ExecuteTemplate(w, "spam_check.html", tmplData); err != nil {
@@ -517,6 +605,80 @@ func (s *Server) htmlDetectedSpamHandler(w http.ResponseWriter, _ *http.Request)
 	}
 }
 
+func (s *Server) htmlWarningsHandler(w http.ResponseWriter, _ *http.Request) {
+	warnings, err := s.Warnings.Read()
+	if err != nil {
+		log.Printf("[ERROR] Failed to fetch warnings: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	type warningDisplay struct {
+		storage.WarningInfo
+		Active bool // not expired yet
+	}
+
+	expiry, err := time.ParseDuration(s.Settings.WarnExpiry)
+	if err != nil {
+		expiry = 0 // never expires
+	}
+	entries := make([]warningDisplay, 0, len(warnings))
+	for _, wr := range warnings {
+		entries = append(entries, warningDisplay{WarningInfo: wr, Active: expiry == 0 || time.Since(wr.Timestamp) < expiry})
+	}
+
+	tmplData := struct {
+		Warnings      []warningDisplay
+		TotalWarnings int
+		MaxWarnings   int
+		WarnExpiry    string
+	}{
+		Warnings:      entries,
+		TotalWarnings: len(entries),
+		MaxWarnings:   s.Settings.MaxWarnings,
+		WarnExpiry:    s.Settings.WarnExpiry,
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "warnings.html", tmplData); err != nil {
+		log.Printf("[WARN] can't execute template: %v", err)
+		http.Error(w, "Error executing template", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) htmlShadowHandler(w http.ResponseWriter, _ *http.Request) {
+	tmplData := struct {
+		Enabled       bool
+		Disagreements []storage.DisagreementInfo
+		Total         int
+		ShadowSpam    int // detected as spam by the shadow detector only
+		ActiveSpam    int // detected as spam by the active detector only
+	}{Enabled: s.Disagreements != nil}
+
+	if s.Disagreements != nil {
+		entries, err := s.Disagreements.Read()
+		if err != nil {
+			log.Printf("[ERROR] Failed to fetch disagreements: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		tmplData.Disagreements, tmplData.Total = entries, len(entries)
+		for _, e := range entries {
+			if e.ShadowSpam {
+				tmplData.ShadowSpam++
+				continue
+			}
+			tmplData.ActiveSpam++
+		}
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "shadow.html", tmplData); err != nil {
+		log.Printf("[WARN] can't execute template: %v", err)
+		http.Error(w, "Error executing template", http.StatusInternalServerError)
+		return
+	}
+}
+
 func (s *Server) htmlAddDetectedSpamHandler(w http.ResponseWriter, r *http.Request) {
 	reportErr := func(err error, _ int) {
 		w.Header().Set("HX-Retarget", "#error-message")
@@ -549,10 +711,16 @@ func (s *Server) htmlSettingsHandler(w http.ResponseWriter, _ *http.Request) {
 	data := struct {
 		Settings
 		Version string
+		Tuning  *bot.TuneResult // last thresholds tuning result, nil if not tuned yet
 	}{
 		Settings: s.Settings,
 		Version:  s.Version,
 	}
+	if s.Tuner != nil {
+		if res, ok := s.Tuner.Last(); ok {
+			data.Tuning = &res
+		}
+	}
 
 	if err := tmpl.ExecuteTemplate(w, "settings.html", data); err != nil {
 		log.Printf("[WARN] can't execute template: %v", err)
@@ -17,6 +17,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/umputun/tg-spam/app/bot"
 	"github.com/umputun/tg-spam/app/storage"
 	"github.com/umputun/tg-spam/app/webapi/mocks"
 	"github.com/umputun/tg-spam/lib/approved"
@@ -57,8 +58,8 @@ func TestServer_RunAuth(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	mockDetector := &mocks.DetectorMock{
-		CheckFunc: func(req spamcheck.Request) (bool, []spamcheck.Response) {
-			return false, []spamcheck.Response{{Details: "not spam"}}
+		CheckWithScoreFunc: func(req spamcheck.Request) (bool, float64, []spamcheck.Response) {
+			return false, 0, []spamcheck.Response{{Details: "not spam"}}
 		},
 	}
 	mockSpamFilter := &mocks.SpamFilterMock{}
@@ -125,8 +126,8 @@ func TestServer_RunAuth(t *testing.T) {
 
 func TestServer_routes(t *testing.T) {
 	detectorMock := &mocks.DetectorMock{
-		CheckFunc: func(req spamcheck.Request) (bool, []spamcheck.Response) {
-			return false, []spamcheck.Response{{Details: "not spam"}}
+		CheckWithScoreFunc: func(req spamcheck.Request) (bool, float64, []spamcheck.Response) {
+			return false, 0, []spamcheck.Response{{Details: "not spam"}}
 		},
 		ApprovedUsersFunc: func() []approved.UserInfo {
 			return []approved.UserInfo{{UserID: "user1", UserName: "name1"}, {UserID: "user2", UserName: "name2"}}
@@ -168,9 +169,9 @@ func TestServer_routes(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusOK, resp.StatusCode)
 		assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
-		assert.Equal(t, 1, len(detectorMock.CheckCalls()))
-		assert.Equal(t, "spam example", detectorMock.CheckCalls()[0].Req.Msg)
-		assert.Equal(t, "user123", detectorMock.CheckCalls()[0].Req.UserID)
+		assert.Equal(t, 1, len(detectorMock.CheckWithScoreCalls()))
+		assert.Equal(t, "spam example", detectorMock.CheckWithScoreCalls()[0].Req.Msg)
+		assert.Equal(t, "user123", detectorMock.CheckWithScoreCalls()[0].Req.UserID)
 	})
 
 	t.Run("update spam", func(t *testing.T) {
@@ -339,11 +340,11 @@ func TestServer_routes(t *testing.T) {
 
 func TestServer_checkHandler(t *testing.T) {
 	mockDetector := &mocks.DetectorMock{
-		CheckFunc: func(req spamcheck.Request) (bool, []spamcheck.Response) {
+		CheckWithScoreFunc: func(req spamcheck.Request) (bool, float64, []spamcheck.Response) {
 			if req.Msg == "spam example" {
-				return true, []spamcheck.Response{{Spam: true, Name: "test", Details: "this was spam"}}
+				return true, 0.9, []spamcheck.Response{{Spam: true, Name: "test", Details: "this was spam"}}
 			}
-			return false, []spamcheck.Response{{Details: "not spam"}}
+			return false, 0, []spamcheck.Response{{Details: "not spam"}}
 		},
 	}
 	server := NewServer(Config{
@@ -368,11 +369,13 @@ func TestServer_checkHandler(t *testing.T) {
 
 		var response struct {
 			Spam   bool                 `json:"spam"`
+			Score  float64              `json:"score"`
 			Checks []spamcheck.Response `json:"checks"`
 		}
 		err = json.Unmarshal(rr.Body.Bytes(), &response)
 		assert.NoError(t, err, "error unmarshalling response")
 		assert.True(t, response.Spam, "expected spam")
+		assert.InDelta(t, 0.9, response.Score, 0.001, "unexpected score")
 		assert.Equal(t, "test", response.Checks[0].Name, "unexpected check name")
 		assert.Equal(t, "this was spam", response.Checks[0].Details, "unexpected check result")
 	})
@@ -417,6 +420,59 @@ func TestServer_checkHandler(t *testing.T) {
 
 }
 
+func TestServer_checkHandlerWithProfiles(t *testing.T) {
+	defaultDetector := &mocks.DetectorMock{
+		CheckWithScoreFunc: func(req spamcheck.Request) (bool, float64, []spamcheck.Response) {
+			return false, 0, []spamcheck.Response{{Name: "default", Details: "not spam"}}
+		},
+	}
+	profileDetector := &mocks.DetectorMock{
+		CheckWithScoreFunc: func(req spamcheck.Request) (bool, float64, []spamcheck.Response) {
+			return true, 0, []spamcheck.Response{{Name: "profile", Spam: true, Details: "spam"}}
+		},
+	}
+	server := NewServer(Config{
+		Detector: defaultDetector,
+		Profiles: map[int64]Detector{-100123: profileDetector},
+		Version:  "1.0",
+	})
+
+	tests := []struct {
+		name     string
+		body     string
+		spam     bool
+		check    string
+		defCalls int
+		prfCalls int
+	}{
+		{"no chat id", `{"msg":"some message","user_id":"123"}`, false, "default", 1, 0},
+		{"unknown chat id", `{"msg":"some message","user_id":"123","chat_id":-100999}`, false, "default", 2, 0},
+		{"profile chat id", `{"msg":"some message","user_id":"123","chat_id":-100123}`, true, "profile", 2, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/check", strings.NewReader(tt.body))
+			require.NoError(t, err)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(server.checkHandler).ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusOK, rr.Code)
+
+			var response struct {
+				Spam   bool                 `json:"spam"`
+				Checks []spamcheck.Response `json:"checks"`
+			}
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			assert.Equal(t, tt.spam, response.Spam)
+			require.Len(t, response.Checks, 1)
+			assert.Equal(t, tt.check, response.Checks[0].Name)
+			assert.Equal(t, tt.defCalls, len(defaultDetector.CheckWithScoreCalls()))
+			assert.Equal(t, tt.prfCalls, len(profileDetector.CheckWithScoreCalls()))
+			assert.Equal(t, "some message", defaultDetector.CheckWithScoreCalls()[0].Req.Msg)
+		})
+	}
+}
+
 func TestServer_updateSampleHandler(t *testing.T) {
 	spamFilterMock := &mocks.SpamFilterMock{
 		UpdateSpamFunc: func(msg string) error {
@@ -749,6 +805,109 @@ func TestServer_htmlDetectedSpamHandler(t *testing.T) {
 	})
 }
 
+func TestServer_htmlWarningsHandler(t *testing.T) {
+	calls := 0
+	wr := &mocks.WarningsMock{
+		ReadFunc: func() ([]storage.WarningInfo, error) {
+			calls++
+			if calls > 1 {
+				return nil, errors.New("test error")
+			}
+			return []storage.WarningInfo{
+				{UserID: 12345, UserName: "user1", ChatID: 100, Text: "bad text 1", AdminName: "admin1", Timestamp: time.Now()},
+				{UserID: 67890, UserName: "user2", ChatID: 100, Text: "bad text 2", AdminName: "admin2",
+					Timestamp: time.Now().Add(-48 * time.Hour)},
+			}, nil
+		},
+	}
+	server := NewServer(Config{Warnings: wr, Settings: Settings{MaxWarnings: 3, WarnExpiry: "24h0m0s"}})
+
+	t.Run("successful rendering", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/warnings", http.NoBody)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.htmlWarningsHandler)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		body := rr.Body.String()
+		assert.Contains(t, body, "<h4>Warnings (2)</h4>")
+		assert.Contains(t, body, "after 3 active warnings")
+		assert.Contains(t, body, "warnings expire in 24h0m0s")
+		assert.Contains(t, body, "bad text 1")
+		assert.Contains(t, body, "admin2")
+		assert.Equal(t, 1, strings.Count(body, ">active<"))
+		assert.Equal(t, 1, strings.Count(body, ">expired<"))
+	})
+
+	t.Run("warnings reading failure", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/warnings", http.NoBody)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.htmlWarningsHandler)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+func TestServer_htmlShadowHandler(t *testing.T) {
+	calls := 0
+	dm := &mocks.DisagreementsMock{
+		ReadFunc: func() ([]storage.DisagreementInfo, error) {
+			calls++
+			if calls > 1 {
+				return nil, errors.New("test error")
+			}
+			return []storage.DisagreementInfo{
+				{UserID: 12345, UserName: "user1", ChatID: 100, Text: "new spam text", ShadowSpam: true, ShadowScore: 1.5,
+					Timestamp: time.Now(), ShadowChecks: []spamcheck.Response{{Name: "similarity", Spam: true, Details: "0.45/0.40"}}},
+				{UserID: 67890, UserName: "user2", ChatID: 100, Text: "ham text", ActiveSpam: true, ActiveScore: 1,
+					Timestamp: time.Now(), ActiveChecks: []spamcheck.Response{{Name: "stopword", Spam: true, Details: "ham"}}},
+				{UserID: 67891, UserName: "user3", ChatID: 100, Text: "more spam", ShadowSpam: true, Timestamp: time.Now()},
+			}, nil
+		},
+	}
+	server := NewServer(Config{Disagreements: dm})
+
+	t.Run("successful rendering", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/shadow", http.NoBody)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.htmlShadowHandler)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		body := rr.Body.String()
+		assert.Contains(t, body, "<h4>Shadow Detector Disagreements (3)</h4>")
+		assert.Contains(t, body, "spam by shadow detector only: 2, spam by active detector only: 1")
+		assert.Contains(t, body, "new spam text")
+		assert.Contains(t, body, "<strong>similarity:</strong> 0.45/0.40")
+		assert.Contains(t, body, "(score 1.50)")
+	})
+
+	t.Run("disagreements reading failure", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/shadow", http.NoBody)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.htmlShadowHandler)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+
+	t.Run("shadow not enabled", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/shadow", http.NoBody)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(NewServer(Config{}).htmlShadowHandler)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "shadow detector is not enabled")
+	})
+}
+
 func TestServer_htmlAddDetectedSpamHandler(t *testing.T) {
 	ds := &mocks.DetectedSpamMock{
 		SetAddedToSamplesFlagFunc: func(id int64) error {
@@ -792,8 +951,8 @@ func TestServer_GenerateRandomPassword(t *testing.T) {
 
 func TestServer_checkHandler_HTMX(t *testing.T) {
 	mockDetector := &mocks.DetectorMock{
-		CheckFunc: func(req spamcheck.Request) (bool, []spamcheck.Response) {
-			return req.Msg == "spam example", []spamcheck.Response{{Spam: req.Msg == "spam example", Name: "test", Details: "result details"}}
+		CheckWithScoreFunc: func(req spamcheck.Request) (bool, float64, []spamcheck.Response) {
+			return req.Msg == "spam example", 0, []spamcheck.Response{{Spam: req.Msg == "spam example", Name: "test", Details: "result details"}}
 		},
 		RemoveApprovedUserFunc: func(id string) error {
 			return nil
@@ -824,9 +983,9 @@ func TestServer_checkHandler_HTMX(t *testing.T) {
 		assert.Contains(t, rr.Body.String(), "strong>Result:</strong> Spam detected", "response should contain spam result")
 		assert.Contains(t, rr.Body.String(), "result details")
 
-		assert.Equal(t, 1, len(mockDetector.CheckCalls()))
-		assert.Equal(t, "spam example", mockDetector.CheckCalls()[0].Req.Msg)
-		assert.Equal(t, "user123", mockDetector.CheckCalls()[0].Req.UserID)
+		assert.Equal(t, 1, len(mockDetector.CheckWithScoreCalls()))
+		assert.Equal(t, "spam example", mockDetector.CheckWithScoreCalls()[0].Req.Msg)
+		assert.Equal(t, "user123", mockDetector.CheckWithScoreCalls()[0].Req.UserID)
 
 		// check if id cleaned
 		assert.Equal(t, 1, len(mockDetector.RemoveApprovedUserCalls()))
@@ -909,6 +1068,31 @@ func TestServer_htmlSettingsHandler(t *testing.T) {
 	assert.Contains(t, body, "<tr><th>Min Message Length</th><td>150</td></tr>")
 }
 
+func TestServer_htmlSettingsHandlerWithTuning(t *testing.T) {
+	res := bot.TuneResult{Time: time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local), Decisions: 25,
+		Current: bot.Thresholds{Similarity: 0.5, MinSpamProbability: 50}, Suggested: bot.Thresholds{Similarity: 0.62, MinSpamProbability: 70},
+		FalsePositives: 4, SuggestedFalsePositives: 1, SuggestedMissedSpam: 1}
+	tuner := &mocks.TunerMock{LastFunc: func() (bot.TuneResult, bool) { return res, true }}
+	server := NewServer(Config{Version: "1.0", Tuner: tuner,
+		Settings: Settings{TuneEnabled: true, TuneInterval: "24h0m0s", TuneMinDecisions: 20}})
+	rr := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/settings", http.NoBody)
+	require.NoError(t, err)
+
+	handler := http.HandlerFunc(server.htmlSettingsHandler)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	body := rr.Body.String()
+	assert.Contains(t, body, "<tr><th>Thresholds Tuning</th><td>true (interval: 24h0m0s, min decisions: 20, apply: false)</td></tr>")
+	assert.Contains(t, body, "suggested at 2024-05-01 10:00:00")
+	assert.Contains(t, body, "similarity threshold: 0.50 &rarr; 0.62")
+	assert.Contains(t, body, "min spam probability: 50% &rarr; 70%")
+	assert.Contains(t, body, "false positives: 4 &rarr; 1, missed spam: 0 &rarr; 1")
+	assert.Contains(t, body, "moderator decisions: 25")
+	require.Len(t, tuner.LastCalls(), 1)
+}
+
 func TestServer_stylesHandler(t *testing.T) {
 	server := NewServer(Config{Version: "1.0"})
 	rr := httptest.NewRecorder()
@@ -14,6 +14,9 @@
 //     "word2"
 //     "hello world"
 //     "some phrase", "another phrase"
+//     Besides literal phrases, "word:", "glob:" and "re:" prefixed lines define whole-word phrases,
+//     glob patterns and regular expressions, optionally named with "[name] " prefix. Invalid ones
+//     are skipped and reported in LoadResult.StopWordsErrors.
 //
 //   - LoadSamples: This method loads samples of spam and ham (non-spam) messages. It also
 //     accepts a reader for a list of excluded tokens, often comprising words too common to aid
@@ -8,12 +8,33 @@ type Request struct {
 	UserID   string   `json:"user_id"`   // user id
 	UserName string   `json:"user_name"` // user name
 	Meta     MetaData `json:"meta"`      // meta-info, provided by the client
+
+	// optional context of the message, used by openai check only
+	DisplayName string   `json:"display_name,omitempty"` // user's display name, i.e. first and last name
+	History     []string `json:"history,omitempty"`      // previous messages of the user, oldest first
+
+	// CheckApproved forces the check for approved users as well, e.g., for edited messages.
+	// Approved users counter is not updated for such requests.
+	CheckApproved bool `json:"check_approved,omitempty"`
+
+	// SkipApproval excludes the message from the approved users counter, e.g., for edited messages,
+	// so a user can't get approved by editing the same message several times.
+	SkipApproval bool `json:"skip_approval,omitempty"`
+
+	// DeferLLM skips the slow language model check. If the check is needed, its response is marked as pending,
+	// and the caller is expected to make it separately.
+	DeferLLM bool `json:"-"`
 }
 
 // MetaData is a meta-info about the message, provided by the client.
 type MetaData struct {
-	Images int `json:"images"` // number of images in the message
-	Links  int `json:"links"`  // number of links in the message
+	Images        int      `json:"images"`                   // number of images in the message
+	Links         int      `json:"links"`                    // number of links in the message, including hidden ones
+	HiddenLinks   []string `json:"hidden_links,omitempty"`   // targets of text links, hidden behind the message text
+	URLs          []string `json:"urls,omitempty"`           // links in the message text marked by the client, may have no scheme
+	ButtonLinks   []string `json:"button_links,omitempty"`   // urls of inline keyboard buttons attached to the message
+	ForwardedFrom int64    `json:"forwarded_from,omitempty"` // id of the channel the message forwarded from, 0 if not from channel
+	ImageHash     *uint64  `json:"image_hash,omitempty"`     // perceptual hash of the image, nil if no image or not hashed
 }
 
 func (r *Request) String() string {
@@ -23,9 +44,12 @@ func (r *Request) String() string {
 
 // Response is a result of spam check.
 type Response struct {
-	Name    string `json:"name"`    // name of the check
-	Spam    bool   `json:"spam"`    // true if spam
-	Details string `json:"details"` // details of the check
+	Name    string  `json:"name"`              // name of the check
+	Spam    bool    `json:"spam"`              // true if spam
+	Details string  `json:"details"`           // details of the check
+	Score   float64 `json:"score,omitempty"`   // spam score of the check, 0.0 - 1.0, 1.0 if the check's threshold reached
+	Value   float64 `json:"value,omitempty"`   // measured value compared to the check's threshold, e.g., similarity
+	Pending bool    `json:"pending,omitempty"` // the check is deferred and not made yet, see Request.DeferLLM
 }
 
 func (r *Response) String() string {
@@ -48,17 +48,17 @@ func TestRequestString(t *testing.T) {
 	}{
 		{
 			name:     "Normal message",
-			request:  Request{"Hello, world!", "123", "Alice", MetaData{2, 1}},
+			request:  Request{Msg: "Hello, world!", UserID: "123", UserName: "Alice", Meta: MetaData{Images: 2, Links: 1}},
 			expected: `msg:"Hello, world!", user:"Alice", id:123, images:2, links:1`,
 		},
 		{
 			name:     "Spam message",
-			request:  Request{"Spam message", "456", "Bob", MetaData{0, 3}},
+			request:  Request{Msg: "Spam message", UserID: "456", UserName: "Bob", Meta: MetaData{Images: 0, Links: 3}},
 			expected: `msg:"Spam message", user:"Bob", id:456, images:0, links:3`,
 		},
 		{
 			name:     "Empty fields",
-			request:  Request{"", "", "", MetaData{0, 0}},
+			request:  Request{Msg: "", UserID: "", UserName: "", Meta: MetaData{Images: 0, Links: 0}},
 			expected: `msg:"", user:"", id:, images:0, links:0`,
 		},
 	}
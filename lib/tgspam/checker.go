@@ -0,0 +1,328 @@
+package tgspam
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+// Checker is a single spam check used by Detector. Checkers are called in the order of registration.
+type Checker interface {
+	Name() string                                   // unique name of the checker
+	Check(req spamcheck.Request) spamcheck.Response // check the request, Spam set in response if spam detected
+}
+
+// names of built-in checkers, registered by NewDetector in this order
+const (
+	CheckerStopWords  = "stopword"
+	CheckerEmoji      = "emoji"
+	CheckerMeta       = "meta"
+	CheckerCAS        = "cas"
+	CheckerMultiLang  = "multi-lingual"
+	CheckerSimilarity = "similarity"
+	CheckerClassifier = "classifier"
+	CheckerOpenAI     = "openai"
+	CheckerMsgLength  = "message length"
+)
+
+// checkerEntry is a registered checker with its calling parameters
+type checkerEntry struct {
+	Checker
+	shortMsgSafe bool // called for messages shorter than MinMsgLen as well
+}
+
+// activeChecker is implemented by built-in checkers which are skipped unless configured and have data loaded
+type activeChecker interface {
+	active() bool
+}
+
+// multiChecker is implemented by checkers returning a response per sub-check, like meta-checks
+type multiChecker interface {
+	checkAll(req spamcheck.Request) []spamcheck.Response
+}
+
+// arbiterChecker is implemented by checkers making the final decision based on the results of the previous checks.
+// It is called only if shouldCheck returns true for the current result, and its response overrides the result.
+type arbiterChecker interface {
+	shouldCheck(spam bool) bool
+}
+
+// AddChecker registers a checker, appending it after all registered checkers.
+// If shortMsgSafe is set, the checker is called for messages shorter than MinMsgLen as well.
+// Returns error if a checker with the same name is already registered.
+func (d *Detector) AddChecker(c Checker, shortMsgSafe bool) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for _, e := range d.checkers {
+		if e.Name() == c.Name() {
+			return fmt.Errorf("checker %q already registered", c.Name())
+		}
+	}
+	d.checkers = append(d.checkers, checkerEntry{Checker: c, shortMsgSafe: shortMsgSafe})
+	return nil
+}
+
+// RemoveChecker removes a checker by name, built-in checkers can be removed as well.
+// Returns false if the checker is not registered.
+func (d *Detector) RemoveChecker(name string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for i, e := range d.checkers {
+		if e.Name() == name {
+			d.checkers = append(d.checkers[:i], d.checkers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ReorderCheckers moves checkers with the given names to the beginning, in the given order.
+// Checkers not listed keep their relative order after the listed ones.
+func (d *Detector) ReorderCheckers(names ...string) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	res := make([]checkerEntry, 0, len(d.checkers))
+	used := make(map[string]bool, len(names))
+	for _, name := range names {
+		if used[name] {
+			return fmt.Errorf("checker %q listed more than once", name)
+		}
+		found := false
+		for _, e := range d.checkers {
+			if e.Name() == name {
+				res = append(res, e)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("checker %q not registered", name)
+		}
+		used[name] = true
+	}
+	for _, e := range d.checkers {
+		if !used[e.Name()] {
+			res = append(res, e)
+		}
+	}
+	d.checkers = res
+	return nil
+}
+
+// SetShortMsgSafe sets if the checker is called for messages shorter than MinMsgLen.
+// Returns error if the checker is not registered.
+func (d *Detector) SetShortMsgSafe(name string, safe bool) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for i, e := range d.checkers {
+		if e.Name() == name {
+			d.checkers[i].shortMsgSafe = safe
+			return nil
+		}
+	}
+	return fmt.Errorf("checker %q not registered", name)
+}
+
+// Checkers returns names of registered checkers in the order they are called.
+func (d *Detector) Checkers() []string {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	res := make([]string, 0, len(d.checkers))
+	for _, e := range d.checkers {
+		res = append(res, e.Name())
+	}
+	return res
+}
+
+// runCheckers calls registered checkers in order and returns collected responses, the spam decision and the score.
+// For short messages only short-message safe checkers are called. Should be called under the lock.
+func (d *Detector) runCheckers(req spamcheck.Request, shortMsg bool) (spam bool, score float64, cr []spamcheck.Response) {
+	anySpam := false
+	add := func(r spamcheck.Response) {
+		if r.Spam && r.Score == 0 {
+			r.Score = 1 // checker doesn't set score, spam means full score
+		}
+		cr = append(cr, r)
+		score += d.checkWeight(r.Name) * r.Score
+		anySpam = anySpam || r.Spam
+		spam = d.isSpamScore(anySpam, score)
+	}
+
+	for _, e := range d.checkers {
+		if shortMsg && !e.shortMsgSafe {
+			continue
+		}
+		if ac, ok := e.Checker.(activeChecker); ok && !ac.active() {
+			continue
+		}
+		if mc, ok := e.Checker.(multiChecker); ok {
+			for _, r := range mc.checkAll(req) {
+				add(r)
+			}
+			continue
+		}
+		if ac, ok := e.Checker.(arbiterChecker); ok {
+			if !ac.shouldCheck(spam) {
+				continue
+			}
+			if req.DeferLLM && e.Name() == CheckerOpenAI {
+				// the check is made later with CheckLLM, the decision of the previous checks is kept for now
+				cr = append(cr, spamcheck.Response{Name: CheckerOpenAI, Details: "pending", Pending: true})
+				continue
+			}
+			// arbiter's response overrides the decision and the score of all the previous checks
+			anySpam, score = false, 0
+			add(e.Check(req))
+			if spam != cr[len(cr)-1].Spam {
+				spam = cr[len(cr)-1].Spam
+				if spam {
+					score = math.Max(score, d.ScoreThreshold)
+				}
+			}
+			continue
+		}
+		add(e.Check(req))
+	}
+	return spam, score, cr
+}
+
+// CheckLLM makes the language model check deferred by CheckWithScore, see spamcheck.Request.DeferLLM.
+// The result overrides the decision of the previous checks the same way as the openai check does in CheckWithScore,
+// i.e. the returned spam and score are the final ones. Unlike CheckWithScore, the detector is not locked for the time
+// of the call, so a slow model doesn't block other checks. The user of the message found ham is counted
+// toward approval here, as CheckWithScore doesn't count messages with the pending check.
+func (d *Detector) CheckLLM(req spamcheck.Request) (spam bool, score float64, cr spamcheck.Response) {
+	if d.openaiChecker == nil {
+		return false, 0, spamcheck.Response{}
+	}
+	spam, cr = d.openaiChecker.check(req)
+	if spam && cr.Score == 0 {
+		cr.Score = 1
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	score = d.checkWeight(cr.Name) * cr.Score
+	if spam {
+		return spam, math.Max(score, d.ScoreThreshold), cr
+	}
+	d.countApproval(req)
+	return spam, score, cr
+}
+
+// isSpamScore makes the spam decision. With ScoreThreshold set, the score should reach the threshold,
+// otherwise any check detected spam is enough.
+func (d *Detector) isSpamScore(anySpam bool, score float64) bool {
+	if d.ScoreThreshold > 0 {
+		return score >= d.ScoreThreshold
+	}
+	return anySpam
+}
+
+// checkWeight returns the weight of the check by name, 1.0 if not set
+func (d *Detector) checkWeight(name string) float64 {
+	if w, ok := d.CheckWeights[name]; ok {
+		return w
+	}
+	return 1
+}
+
+// builtinChecker is a checker made of the Detector's check method, active only if isActive returns true
+type builtinChecker struct {
+	name     string
+	check    func(req spamcheck.Request) spamcheck.Response
+	isActive func() bool
+}
+
+// Name returns checker's name
+func (c *builtinChecker) Name() string { return c.name }
+
+// Check calls the checker's function
+func (c *builtinChecker) Check(req spamcheck.Request) spamcheck.Response { return c.check(req) }
+
+func (c *builtinChecker) active() bool { return c.isActive() }
+
+// metaChecker calls all meta-checks set with WithMetaChecks, each producing its own response
+type metaChecker struct {
+	d *Detector
+}
+
+// Name returns checker's name
+func (c *metaChecker) Name() string { return CheckerMeta }
+
+// Check calls all meta-checks and combines the results into a single response
+func (c *metaChecker) Check(req spamcheck.Request) spamcheck.Response {
+	res := spamcheck.Response{Name: CheckerMeta}
+	details := []string{}
+	for _, r := range c.checkAll(req) {
+		res.Spam = res.Spam || r.Spam
+		details = append(details, r.Name+": "+r.Details)
+	}
+	res.Details = strings.Join(details, ", ")
+	return res
+}
+
+func (c *metaChecker) checkAll(req spamcheck.Request) []spamcheck.Response {
+	res := make([]spamcheck.Response, 0, len(c.d.metaChecks))
+	for _, mc := range c.d.metaChecks {
+		res = append(res, mc(req))
+	}
+	return res
+}
+
+func (c *metaChecker) active() bool { return len(c.d.metaChecks) > 0 }
+
+// openAIArbiter calls openai checker to confirm spam (veto mode) or to detect spam missed by the previous checks
+type openAIArbiter struct {
+	d *Detector
+}
+
+// Name returns checker's name
+func (c *openAIArbiter) Name() string { return CheckerOpenAI }
+
+// Check sends the message to openai
+func (c *openAIArbiter) Check(req spamcheck.Request) spamcheck.Response {
+	_, resp := c.d.openaiChecker.check(req)
+	return resp
+}
+
+// active requires FirstMessageOnly or FirstMessagesCount, because openai is slow and expensive to run on all messages
+func (c *openAIArbiter) active() bool {
+	return c.d.openaiChecker != nil && (c.d.FirstMessageOnly || c.d.FirstMessagesCount > 0)
+}
+
+// shouldCheck returns true in two cases:
+//   - all other checks passed (ham result) and OpenAIVeto is false. In this case, openai primary used to improve false negative rate
+//   - one of the checks failed (spam result) and OpenAIVeto is true. In this case, openai primary used to improve false positive rate
+func (c *openAIArbiter) shouldCheck(spam bool) bool {
+	return !spam && !c.d.OpenAIVeto || spam && c.d.OpenAIVeto
+}
+
+// builtinCheckers returns the default set of checkers in the default order.
+// Stop words, emoji, meta, CAS and multi-lang checks are short-message safe.
+func (d *Detector) builtinCheckers() []checkerEntry {
+	msgCheck := func(fn func(msg string) spamcheck.Response) func(req spamcheck.Request) spamcheck.Response {
+		return func(req spamcheck.Request) spamcheck.Response { return fn(req.Msg) }
+	}
+	return []checkerEntry{
+		{Checker: &builtinChecker{name: CheckerStopWords, check: msgCheck(d.isStopWord),
+			isActive: func() bool { return len(d.stopWords) > 0 }}, shortMsgSafe: true},
+		{Checker: &builtinChecker{name: CheckerEmoji, check: msgCheck(d.isManyEmojis),
+			isActive: func() bool { return d.MaxAllowedEmoji >= 0 }}, shortMsgSafe: true},
+		{Checker: &metaChecker{d: d}, shortMsgSafe: true},
+		{Checker: &builtinChecker{name: CheckerCAS, check: func(req spamcheck.Request) spamcheck.Response { return d.isCasSpam(req.UserID) },
+			isActive: func() bool { return d.CasAPI != "" }}, shortMsgSafe: true},
+		{Checker: &builtinChecker{name: CheckerMultiLang, check: msgCheck(d.isMultiLang),
+			isActive: func() bool { return d.MultiLangWords > 0 }}, shortMsgSafe: true},
+		{Checker: &builtinChecker{name: CheckerSimilarity, check: msgCheck(d.isSpamSimilarityHigh),
+			isActive: func() bool { return d.SimilarityThreshold > 0 && len(d.tokenizedSpam) > 0 }}},
+		{Checker: &builtinChecker{name: CheckerClassifier, check: msgCheck(d.isSpamClassified),
+			isActive: func() bool {
+				return d.classifier.nAllDocument > 0 && d.classifier.nDocumentByClass["ham"] > 0 && d.classifier.nDocumentByClass["spam"] > 0
+			}}},
+		{Checker: &openAIArbiter{d: d}},
+	}
+}
@@ -0,0 +1,142 @@
+package tgspam
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+// testChecker reports spam if the message contains the given word
+type testChecker struct {
+	name string
+	word string
+}
+
+func (c *testChecker) Name() string { return c.name }
+
+func (c *testChecker) Check(req spamcheck.Request) spamcheck.Response {
+	return spamcheck.Response{Name: c.name, Spam: strings.Contains(req.Msg, c.word), Details: c.word}
+}
+
+func TestDetector_Checkers(t *testing.T) {
+	d := NewDetector(Config{})
+	assert.Equal(t, []string{CheckerStopWords, CheckerEmoji, CheckerMeta, CheckerCAS, CheckerMultiLang,
+		CheckerSimilarity, CheckerClassifier, CheckerOpenAI}, d.Checkers())
+
+	require.NoError(t, d.AddChecker(&testChecker{name: "custom", word: "bad"}, false))
+	assert.Equal(t, "custom", d.Checkers()[len(d.Checkers())-1])
+
+	err := d.AddChecker(&testChecker{name: "custom", word: "other"}, false)
+	assert.EqualError(t, err, `checker "custom" already registered`)
+
+	require.NoError(t, d.ReorderCheckers("custom", CheckerEmoji))
+	assert.Equal(t, []string{"custom", CheckerEmoji, CheckerStopWords, CheckerMeta, CheckerCAS, CheckerMultiLang,
+		CheckerSimilarity, CheckerClassifier, CheckerOpenAI}, d.Checkers())
+
+	assert.EqualError(t, d.ReorderCheckers("unknown"), `checker "unknown" not registered`)
+	assert.EqualError(t, d.ReorderCheckers("custom", "custom"), `checker "custom" listed more than once`)
+
+	assert.True(t, d.RemoveChecker(CheckerCAS))
+	assert.False(t, d.RemoveChecker(CheckerCAS))
+	assert.NotContains(t, d.Checkers(), CheckerCAS)
+
+	assert.NoError(t, d.SetShortMsgSafe("custom", true))
+	assert.EqualError(t, d.SetShortMsgSafe("unknown", true), `checker "unknown" not registered`)
+}
+
+func TestDetector_CheckWithCustomChecker(t *testing.T) {
+	d := NewDetector(Config{MaxAllowedEmoji: -1, MinMsgLen: 20})
+	_, err := d.LoadStopWords(bytes.NewBufferString("in private"))
+	require.NoError(t, err)
+	require.NoError(t, d.AddChecker(&testChecker{name: "custom", word: "bad"}, false))
+
+	t.Run("long message, custom spam", func(t *testing.T) {
+		spam, cr := d.Check(spamcheck.Request{Msg: "this is a long and bad message"})
+		assert.True(t, spam)
+		require.Len(t, cr, 2)
+		assert.Equal(t, spamcheck.Response{Name: "stopword", Spam: false, Details: "not found"}, cr[0])
+		assert.Equal(t, spamcheck.Response{Name: "custom", Spam: true, Details: "bad", Score: 1}, cr[1])
+	})
+
+	t.Run("short message, custom checker skipped", func(t *testing.T) {
+		spam, cr := d.Check(spamcheck.Request{Msg: "bad message"})
+		assert.False(t, spam)
+		require.Len(t, cr, 2)
+		assert.Equal(t, "stopword", cr[0].Name)
+		assert.Equal(t, "message length", cr[1].Name)
+	})
+
+	t.Run("short message, custom checker short-message safe", func(t *testing.T) {
+		require.NoError(t, d.SetShortMsgSafe("custom", true))
+		defer func() { require.NoError(t, d.SetShortMsgSafe("custom", false)) }()
+		spam, cr := d.Check(spamcheck.Request{Msg: "bad message"})
+		assert.True(t, spam)
+		require.Len(t, cr, 3)
+		assert.Equal(t, spamcheck.Response{Name: "custom", Spam: true, Details: "bad", Score: 1}, cr[1])
+		assert.Equal(t, "message length", cr[2].Name)
+	})
+
+	t.Run("reordered and built-in removed", func(t *testing.T) {
+		require.NoError(t, d.ReorderCheckers("custom"))
+		require.True(t, d.RemoveChecker(CheckerStopWords))
+		spam, cr := d.Check(spamcheck.Request{Msg: "this is a long message in private"})
+		assert.False(t, spam)
+		require.Len(t, cr, 1)
+		assert.Equal(t, "custom", cr[0].Name)
+	})
+}
+
+func TestMetaChecker_Check(t *testing.T) {
+	d := NewDetector(Config{})
+	d.WithMetaChecks(LinksCheck(1), ImagesCheck())
+	c := &metaChecker{d: d}
+	assert.True(t, c.active())
+
+	resp := c.Check(spamcheck.Request{Msg: "http://a.com http://b.com", Meta: spamcheck.MetaData{Images: 0}})
+	assert.Equal(t, CheckerMeta, resp.Name)
+	assert.True(t, resp.Spam)
+	assert.Equal(t, "links: too many links 2/1, images: no images without text", resp.Details)
+}
+
+func TestDetector_CheckWithScore(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold float64
+		weights   map[string]float64
+		msg       string
+		spam      bool
+		score     float64
+	}{
+		{"no threshold, emoji only", 0, nil, "hello 😀😀😀 world", true, 1},
+		{"no threshold, emoji below limit", 0, nil, "hello 😀 world", false, 0.5},
+		{"threshold, emoji only", 2, nil, "hello 😀😀😀 world", false, 1},
+		{"threshold, emoji and custom", 2, nil, "hello 😀😀😀 bad world", true, 2},
+		{"threshold, emoji with low weight", 1, map[string]float64{"emoji": 0.5}, "hello 😀😀😀 world", false, 0.5},
+		{"threshold, custom with high weight", 1.5, map[string]float64{"custom": 2}, "hello bad world", true, 2},
+		{"threshold, nothing", 1, nil, "hello world", false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDetector(Config{MaxAllowedEmoji: 1, ScoreThreshold: tt.threshold, CheckWeights: tt.weights})
+			require.NoError(t, d.AddChecker(&testChecker{name: "custom", word: "bad"}, true))
+			spam, score, cr := d.CheckWithScore(spamcheck.Request{Msg: tt.msg})
+			t.Logf("cr: %+v", cr)
+			assert.Equal(t, tt.spam, spam)
+			assert.InDelta(t, tt.score, score, 0.001)
+		})
+	}
+}
+
+func Test_scoreOf(t *testing.T) {
+	assert.InDelta(t, 0.5, scoreOf(1, 2), 0.001)
+	assert.InDelta(t, 1.0, scoreOf(3, 2), 0.001)
+	assert.InDelta(t, 0.0, scoreOf(0, 2), 0.001)
+	assert.InDelta(t, 1.0, scoreOf(1, 0), 0.001)
+	assert.InDelta(t, 0.0, scoreOf(0, 0), 0.001)
+}
@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"math"
 	"net/http"
@@ -25,16 +27,21 @@ import (
 //go:generate moq --out mocks/user_storage.go --pkg mocks --skip-ensure --with-resets . UserStorage
 
 // Detector is a spam detector, thread-safe.
-// It uses a set of checks to determine if a message is spam, and also keeps a list of approved users.
+// It uses a set of registered checkers to determine if a message is spam, and also keeps a list of approved users.
 type Detector struct {
 	Config
 	classifier     classifier
 	openaiChecker  *openAIChecker
 	metaChecks     []MetaCheck
+	checkers       []checkerEntry
 	tokenizedSpam  []map[string]int
+	spamIndex      similarityIndex // inverted index of tokenizedSpam for similarity check
 	approvedUsers  map[string]approved.UserInfo
-	stopWords      []string
-	excludedTokens []string
+	stopWords      []string   // stop words (rules) as loaded, lowercased
+	stopRules      []stopWord // parsed stop words, in the same order as stopWords
+	excludedTokens []string   // normalized excluded tokens
+	domains        *DomainLists
+	samplesResult  LoadResult // samples learned by the model, including dynamic updates
 
 	spamSamplesUpd SampleUpdater
 	hamSamplesUpd  SampleUpdater
@@ -46,16 +53,22 @@ type Detector struct {
 
 // Config is a set of parameters for Detector.
 type Config struct {
-	SimilarityThreshold float64    // threshold for spam similarity, 0.0 - 1.0
-	MinMsgLen           int        // minimum message length to check
-	MaxAllowedEmoji     int        // maximum number of emojis allowed in a message
-	CasAPI              string     // CAS API URL
-	FirstMessageOnly    bool       // if true, only the first message from a user is checked
-	FirstMessagesCount  int        // number of first messages to check for spam
-	HTTPClient          HTTPClient // http client to use for requests
-	MinSpamProbability  float64    // minimum spam probability to consider a message spam with classifier, if 0 - ignored
-	OpenAIVeto          bool       // if true, openai will be used to veto spam messages, otherwise it will be used to veto ham messages
-	MultiLangWords      int        // if true, check for number of multi-lingual words
+	SimilarityThreshold float64       // threshold for spam similarity, 0.0 - 1.0
+	MinMsgLen           int           // minimum message length to check
+	MaxAllowedEmoji     int           // maximum number of emojis allowed in a message
+	CasAPI              string        // CAS API URL
+	FirstMessageOnly    bool          // if true, only the first message from a user is checked
+	FirstMessagesCount  int           // number of first messages to check for spam
+	HTTPClient          HTTPClient    // http client to use for requests
+	MinSpamProbability  float64       // minimum spam probability to consider a message spam with classifier, if 0 - ignored
+	OpenAIVeto          bool          // if true, openai will be used to veto spam messages, otherwise it will be used to veto ham messages
+	MultiLangWords      int           // if true, check for number of multi-lingual words
+	Tokenizer           TokenizerType // tokenizer for classifier, similarity check and samples, TokenizerWords if empty
+
+	// ScoreThreshold is a threshold for the weighted sum of check scores to consider a message spam.
+	// If 0, a message is spam if any of the checks detected spam.
+	ScoreThreshold float64
+	CheckWeights   map[string]float64 // weights of checks in the score, by check name. Checks without weight have weight 1.0
 }
 
 // SampleUpdater is an interface for updating spam/ham samples on the fly.
@@ -82,6 +95,10 @@ type LoadResult struct {
 	SpamSamples    int // number of spam samples
 	HamSamples     int // number of ham samples
 	StopWords      int // number of stop words (phrases)
+	AllowedDomains int // number of allowed domains
+	BlockedDomains int // number of blocked domains
+
+	StopWordsErrors []string // invalid stop words, skipped on loading
 }
 
 // NewDetector makes a new Detector with the given config.
@@ -91,109 +108,75 @@ func NewDetector(p Config) *Detector {
 		classifier:    newClassifier(),
 		approvedUsers: make(map[string]approved.UserInfo),
 		tokenizedSpam: []map[string]int{},
+		spamIndex:     newSimilarityIndex(),
+		domains:       &DomainLists{},
 	}
+	res.checkers = res.builtinCheckers()
 	// if FirstMessagesCount is set, FirstMessageOnly enforced to true.
 	// this is to avoid confusion when FirstMessagesCount is set but FirstMessageOnly is false.
 	// the reason for the redundant FirstMessageOnly flag is to avoid breaking api compatibility.
 	if p.FirstMessagesCount > 0 {
 		res.FirstMessageOnly = true
 	}
+	if p.Tokenizer == "" {
+		res.Tokenizer = TokenizerWords
+	}
 	return res
 }
 
 // Check checks if a given message is spam. Returns true if spam and also returns a list of check results.
 func (d *Detector) Check(req spamcheck.Request) (spam bool, cr []spamcheck.Response) {
+	spam, _, cr = d.CheckWithScore(req)
+	return spam, cr
+}
 
-	isSpamDetected := func(cr []spamcheck.Response) bool {
-		for _, r := range cr {
-			if r.Spam {
-				return true
-			}
-		}
-		return false
-	}
-
+// CheckWithScore checks if a given message is spam. Returns true if spam, the weighted score of all the checks
+// and a list of check results.
+func (d *Detector) CheckWithScore(req spamcheck.Request) (spam bool, score float64, cr []spamcheck.Response) {
 	d.lock.RLock()
 	defer d.lock.RUnlock()
 
 	// approved user don't need to be checked
-	if d.FirstMessageOnly && d.approvedUsers[req.UserID].Count > d.FirstMessagesCount {
-		return false, []spamcheck.Response{{Name: "pre-approved", Spam: false, Details: "user already approved"}}
-	}
-
-	// all the checks are performed sequentially, so we can collect all the results
-
-	// check for stop words if any stop words are loaded
-	if len(d.stopWords) > 0 {
-		cr = append(cr, d.isStopWord(req.Msg))
-	}
-
-	// check for emojis if max allowed emojis is set
-	if d.MaxAllowedEmoji >= 0 {
-		cr = append(cr, d.isManyEmojis(req.Msg))
-	}
-
-	// check for spam with meta-checks
-	for _, mc := range d.metaChecks {
-		cr = append(cr, mc(req))
+	if d.FirstMessageOnly && !req.CheckApproved && d.approvedUsers[req.UserID].Count > d.FirstMessagesCount {
+		return false, 0, []spamcheck.Response{{Name: "pre-approved", Spam: false, Details: "user already approved"}}
 	}
 
-	// check for spam with CAS API if CAS API URL is set
-	if d.CasAPI != "" {
-		cr = append(cr, d.isCasSpam(req.UserID))
+	// all the checks are performed sequentially by registered checkers, so we can collect all the results.
+	// for messages shorter than the minimum size, if min message length is set, only short-message safe checkers are called,
+	// because stop words and emojis can be triggered by short messages as well.
+	shortMsg := len([]rune(req.Msg)) < d.MinMsgLen
+	spamDetected, score, cr := d.runCheckers(req, shortMsg)
+	if shortMsg {
+		cr = append(cr, spamcheck.Response{Name: CheckerMsgLength, Spam: false, Details: "too short"})
+		return spamDetected, score, cr
 	}
 
-	if d.MultiLangWords > 0 {
-		cr = append(cr, d.isMultiLang(req.Msg))
+	if spamDetected {
+		return true, score, cr
 	}
 
-	// check for message length exceed the minimum size, if min message length is set.
-	// the check is done after first simple checks, because stop words and emojis can be triggered by short messages as well.
-	if len([]rune(req.Msg)) < d.MinMsgLen {
-		cr = append(cr, spamcheck.Response{Name: "message length", Spam: false, Details: "too short"})
-		if isSpamDetected(cr) {
-			return true, cr // spam from the checks above
+	// the message with the pending language model check is counted by CheckLLM, if the final verdict is ham
+	for _, r := range cr {
+		if r.Pending {
+			return false, score, cr
 		}
-		return false, cr
 	}
+	d.countApproval(req)
+	return false, score, cr
+}
 
-	// check for spam similarity if a similarity threshold is set and spam samples are loaded
-	if d.SimilarityThreshold > 0 && len(d.tokenizedSpam) > 0 {
-		cr = append(cr, d.isSpamSimilarityHigh(req.Msg))
-	}
-
-	// check for spam with classifier if classifier is loaded
-	if d.classifier.nAllDocument > 0 && d.classifier.nDocumentByClass["ham"] > 0 && d.classifier.nDocumentByClass["spam"] > 0 {
-		cr = append(cr, d.isSpamClassified(req.Msg))
-	}
-
-	spamDetected := isSpamDetected(cr)
-
-	// we hit openai in two cases:
-	//  - all other checks passed (ham result) and OpenAIVeto is false. In this case, openai primary used to improve false negative rate
-	//  - one of the checks failed (spam result) and OpenAIVeto is true. In this case, openai primary used to improve false positive rate
-	// FirstMessageOnly or FirstMessagesCount has to be set to use openai, because it's slow and expensive to run on all messages
-	if d.openaiChecker != nil && (d.FirstMessageOnly || d.FirstMessagesCount > 0) {
-		if !spamDetected && !d.OpenAIVeto || spamDetected && d.OpenAIVeto {
-			spam, details := d.openaiChecker.check(req.Msg)
-			cr = append(cr, details)
-			spamDetected = spam
-		}
+// countApproval increments the approved users counter for the user of the ham message.
+// Should be called under the write lock.
+func (d *Detector) countApproval(req spamcheck.Request) {
+	if (!d.FirstMessageOnly && d.FirstMessagesCount == 0) || req.CheckApproved || req.SkipApproval {
+		return
 	}
-
-	if spamDetected {
-		return true, cr
-	}
-
-	if d.FirstMessageOnly || d.FirstMessagesCount > 0 {
-		au := approved.UserInfo{Count: d.approvedUsers[req.UserID].Count + 1, UserID: req.UserID,
-			UserName: req.UserName, Timestamp: time.Now()}
-		d.approvedUsers[req.UserID] = au
-		if d.userStorage != nil {
-			_ = d.userStorage.Write(au) // ignore error, failed to write to storage is not critical
-		}
+	au := approved.UserInfo{Count: d.approvedUsers[req.UserID].Count + 1, UserID: req.UserID,
+		UserName: req.UserName, Timestamp: time.Now()}
+	d.approvedUsers[req.UserID] = au
+	if d.userStorage != nil {
+		_ = d.userStorage.Write(au) // ignore error, failed to write to storage is not critical
 	}
-	return false, cr
 }
 
 // Reset resets spam samples/classifier, excluded tokens, stop words and approved users.
@@ -202,15 +185,28 @@ func (d *Detector) Reset() {
 	defer d.lock.Unlock()
 
 	d.tokenizedSpam = []map[string]int{}
+	d.spamIndex.reset()
 	d.excludedTokens = []string{}
 	d.classifier.reset()
+	d.samplesResult = LoadResult{}
 	d.approvedUsers = make(map[string]approved.UserInfo)
 	d.stopWords = []string{}
+	d.stopRules = []stopWord{}
 }
 
-// WithOpenAIChecker sets an openAIChecker for spam checking.
+// WithOpenAIChecker sets an openAIChecker for spam checking with OpenAI client.
 func (d *Detector) WithOpenAIChecker(client openAIClient, config OpenAIConfig) {
-	d.openaiChecker = newOpenAIChecker(client, config)
+	if client == nil {
+		d.WithLLMChecker(nil, config)
+		return
+	}
+	d.WithLLMChecker(NewOpenAILLM(client), config)
+}
+
+// WithLLMChecker sets an openAIChecker for spam checking with the given language model backend,
+// like OpenAILLM, AnthropicLLM or GeminiLLM.
+func (d *Detector) WithLLMChecker(llm LLMChecker, config OpenAIConfig) {
+	d.openaiChecker = newOpenAIChecker(llm, config)
 }
 
 // WithUserStorage sets a UserStorage for approved users and loads approved users from it.
@@ -271,6 +267,26 @@ func (d *Detector) IsApprovedUser(userID string) bool {
 func (d *Detector) AddApprovedUser(user approved.UserInfo) error {
 	d.lock.Lock()
 	defer d.lock.Unlock()
+	d.approveUser(user)
+
+	if d.userStorage != nil {
+		if err := d.userStorage.Write(user); err != nil {
+			return fmt.Errorf("failed to write approved user %+v to storage: %w", user, err)
+		}
+	}
+	return nil
+}
+
+// ApproveUser adds the user to the list of approved users in memory, without writing it to the storage.
+// It is used for detectors sharing the storage with another one, which has already written the user.
+func (d *Detector) ApproveUser(user approved.UserInfo) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.approveUser(user)
+}
+
+// approveUser adds the user to the list of approved users, should be called under the lock
+func (d *Detector) approveUser(user approved.UserInfo) {
 	ts := user.Timestamp
 	if ts.IsZero() {
 		ts = time.Now()
@@ -281,13 +297,14 @@ func (d *Detector) AddApprovedUser(user approved.UserInfo) error {
 		Count:     d.FirstMessagesCount + 1, // +1 to skip first message check if count is 0
 		Timestamp: ts,
 	}
+}
 
-	if d.userStorage != nil {
-		if err := d.userStorage.Write(user); err != nil {
-			return fmt.Errorf("failed to write approved user %+v to storage: %w", user, err)
-		}
-	}
-	return nil
+// DisapproveUser removes the user from the list of approved users in memory, without deleting it from the storage.
+// It is used for detectors sharing the storage with another one, which has already deleted the user.
+func (d *Detector) DisapproveUser(id string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.approvedUsers, id)
 }
 
 // RemoveApprovedUser removes approved user for given IDs
@@ -310,12 +327,13 @@ func (d *Detector) LoadSamples(exclReader io.Reader, spamReaders, hamReaders []i
 	defer d.lock.Unlock()
 
 	d.tokenizedSpam = []map[string]int{}
+	d.spamIndex.reset()
 	d.excludedTokens = []string{}
 	d.classifier.reset()
 
 	// excluded tokens should be loaded before spam samples to exclude them from spam tokenization
 	for t := range d.tokenChan(exclReader) {
-		d.excludedTokens = append(d.excludedTokens, strings.ToLower(t))
+		d.excludedTokens = append(d.excludedTokens, normalize(t))
 	}
 	lr := LoadResult{ExcludedTokens: len(d.excludedTokens)}
 
@@ -324,6 +342,7 @@ func (d *Detector) LoadSamples(exclReader io.Reader, spamReaders, hamReaders []i
 	for token := range d.tokenChan(spamReaders...) {
 		tokenizedSpam := d.tokenize(token)
 		d.tokenizedSpam = append(d.tokenizedSpam, tokenizedSpam) // add to list of samples
+		d.spamIndex.add(tokenizedSpam)
 		tokens := make([]string, 0, len(tokenizedSpam))
 		for token := range tokenizedSpam {
 			tokens = append(tokens, token)
@@ -344,19 +363,86 @@ func (d *Detector) LoadSamples(exclReader io.Reader, spamReaders, hamReaders []i
 	}
 
 	d.classifier.learn(docs...)
+	d.samplesResult = lr
+	d.loadLLMExamples()
 	return lr, nil
 }
 
+// loadLLMExamples sets few-shot examples of openai checker from the dynamic samples, i.e. confirmed spam and ham.
+// Does nothing if examples are not enabled or sample updaters are not set. Should be called under lock.
+func (d *Detector) loadLLMExamples() {
+	if d.openaiChecker == nil || d.openaiChecker.params.Examples <= 0 {
+		return
+	}
+	readSamples := func(upd SampleUpdater, sc spamClass) []string {
+		if upd == nil {
+			return nil
+		}
+		r, err := upd.Reader()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil // dynamic samples are optional
+		}
+		if err != nil {
+			log.Printf("[WARN] can't read dynamic %s samples for openai examples: %v", sc, err)
+			return nil
+		}
+		defer r.Close()
+		res := []string{}
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			res = append(res, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			log.Printf("[WARN] can't read dynamic %s samples for openai examples: %v", sc, err)
+		}
+		return res
+	}
+	d.openaiChecker.setExamples(readSamples(d.spamSamplesUpd, "spam"), readSamples(d.hamSamplesUpd, "ham"))
+}
+
 // LoadStopWords loads stop words from a reader. Reset stop words list before loading.
+// Stop words can be literal phrases, whole-word phrases, glob patterns or regular expressions, see parseStopWord.
+// Invalid stop words are skipped and reported in LoadResult.StopWordsErrors.
 func (d *Detector) LoadStopWords(readers ...io.Reader) (LoadResult, error) {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 
 	d.stopWords = []string{}
+	d.stopRules = []stopWord{}
+	res := LoadResult{}
 	for t := range d.tokenChan(readers...) {
+		rule, err := parseStopWord(t)
+		if err != nil {
+			res.StopWordsErrors = append(res.StopWordsErrors, fmt.Sprintf("%q: %v", t, err))
+			continue
+		}
 		d.stopWords = append(d.stopWords, strings.ToLower(t))
+		d.stopRules = append(d.stopRules, rule)
 	}
-	return LoadResult{StopWords: len(d.stopWords)}, nil
+	res.StopWords = len(d.stopWords)
+	return res, nil
+}
+
+// LoadDomains loads allowed and blocked domains used by DomainsCheck. Reset both lists before loading.
+func (d *Detector) LoadDomains(allowReader, blockReader io.Reader) (LoadResult, error) {
+	return d.domains.Load(allowReader, blockReader)
+}
+
+// Domains returns allowed and blocked domains lists of the detector, to be used with DomainsCheck
+func (d *Detector) Domains() *DomainLists { return d.domains }
+
+// Thresholds returns the similarity threshold and the min spam probability of the classifier.
+func (d *Detector) Thresholds() (similarity, minSpamProbability float64) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.SimilarityThreshold, d.MinSpamProbability
+}
+
+// SetThresholds changes the similarity threshold and the min spam probability of the classifier on the fly.
+func (d *Detector) SetThresholds(similarity, minSpamProbability float64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.SimilarityThreshold, d.MinSpamProbability = similarity, minSpamProbability
 }
 
 // UpdateSpam appends a message to the spam samples file and updates the classifier
@@ -379,7 +465,28 @@ func (d *Detector) updateSample(msg string, upd SampleUpdater, sc spamClass) err
 	if err := upd.Append(msg); err != nil {
 		return fmt.Errorf("can't update %s samples: %w", sc, err)
 	}
+	d.learnSample(msg, sc)
+	return nil
+}
 
+// LearnSpam updates the classifier with a spam message, without writing it to the dynamic samples storage.
+// It is used for detectors sharing the storage with another one, which has already written the message.
+func (d *Detector) LearnSpam(msg string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.learnSample(msg, "spam")
+}
+
+// LearnHam updates the classifier with a ham message, without writing it to the dynamic samples storage.
+// It is used for detectors sharing the storage with another one, which has already written the message.
+func (d *Detector) LearnHam(msg string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.learnSample(msg, "ham")
+}
+
+// learnSample updates the classifier with the message, should be called under the lock
+func (d *Detector) learnSample(msg string, sc spamClass) {
 	// load samples and update the classifier with them
 	docs := []document{}
 	for token := range d.tokenChan(bytes.NewBufferString(msg)) {
@@ -389,9 +496,20 @@ func (d *Detector) updateSample(msg string, upd SampleUpdater, sc spamClass) err
 			tokens = append(tokens, token)
 		}
 		docs = append(docs, document{spamClass: sc, tokens: tokens})
+		// spam sample added to the similarity check samples as well, the same way as on loading
+		if sc == "spam" {
+			d.tokenizedSpam = append(d.tokenizedSpam, tokenizedSample)
+			d.spamIndex.add(tokenizedSample)
+			d.samplesResult.SpamSamples++
+		} else {
+			d.samplesResult.HamSamples++
+		}
 	}
 	d.classifier.learn(docs...)
-	return nil
+	if d.openaiChecker != nil {
+		d.openaiChecker.addExample(msg, sc == "spam")
+		d.openaiChecker.forget(msg)
+	}
 }
 
 // tokenChan parses readers and returns a channel of tokens.
@@ -435,7 +553,8 @@ func (d *Detector) tokenChan(readers ...io.Reader) <-chan string {
 
 // tokenize takes a string and returns a map where the keys are unique words (tokens)
 // and the values are the frequencies of those words in the string.
-// exclude tokens representing common words.
+// exclude tokens representing common words. Tokens are normalized to match obfuscated variants of the same word,
+// and made from words by the tokenizer set in config, e.g., stems or n-grams.
 func (d *Detector) tokenize(inp string) map[string]int {
 	isExcludedToken := func(token string) bool {
 		for _, w := range d.excludedTokens {
@@ -448,17 +567,19 @@ func (d *Detector) tokenize(inp string) map[string]int {
 
 	tokenFrequency := make(map[string]int)
 	tokens := strings.Fields(inp)
-	for _, token := range tokens {
+	for _, word := range tokens {
+		word = cleanEmoji(word)
+		token := normalize(word)
 		if isExcludedToken(token) {
 			continue
 		}
-		token = cleanEmoji(token)
 		token = strings.Trim(token, ".,!?-:;()#")
-		token = strings.ToLower(token)
 		if len([]rune(token)) < 3 {
 			continue
 		}
-		tokenFrequency[strings.ToLower(token)]++
+		for _, t := range wordTokens(d.Tokenizer, token, word) {
+			tokenFrequency[t]++
+		}
 	}
 	return tokenFrequency
 }
@@ -467,18 +588,35 @@ func (d *Detector) tokenize(inp string) map[string]int {
 func (d *Detector) isSpamSimilarityHigh(msg string) spamcheck.Response {
 	// check for spam similarity
 	tokenizedMessage := d.tokenize(msg)
-	maxSimilarity := 0.0
+	var maxSimilarity float64
+	var found bool
+	if d.SimilarityThreshold > 0 {
+		maxSimilarity, found = d.spamIndex.maxSimilarity(tokenizedMessage, d.SimilarityThreshold)
+	} else {
+		// any sample matches non-positive threshold, including ones without common tokens not in the index
+		maxSimilarity, found = d.scanSimilarity(tokenizedMessage)
+	}
+	if found {
+		return spamcheck.Response{Spam: true, Name: "similarity", Score: 1, Value: maxSimilarity,
+			Details: fmt.Sprintf("%0.2f/%0.2f", maxSimilarity, d.SimilarityThreshold)}
+	}
+	return spamcheck.Response{Spam: false, Name: "similarity", Score: scoreOf(maxSimilarity, d.SimilarityThreshold),
+		Value: maxSimilarity, Details: fmt.Sprintf("%0.2f/%0.2f", maxSimilarity, d.SimilarityThreshold)}
+}
+
+// scanSimilarity compares the tokenized message with each spam sample, stops on the first sample with the similarity
+// not less than the threshold. Returns the highest similarity found so far and found flag.
+func (d *Detector) scanSimilarity(tokenizedMessage map[string]int) (maxSimilarity float64, found bool) {
 	for _, spam := range d.tokenizedSpam {
 		similarity := d.cosineSimilarity(tokenizedMessage, spam)
 		if similarity > maxSimilarity {
 			maxSimilarity = similarity
 		}
 		if similarity >= d.SimilarityThreshold {
-			return spamcheck.Response{Spam: true, Name: "similarity",
-				Details: fmt.Sprintf("%0.2f/%0.2f", maxSimilarity, d.SimilarityThreshold)}
+			return maxSimilarity, true
 		}
 	}
-	return spamcheck.Response{Spam: false, Name: "similarity", Details: fmt.Sprintf("%0.2f/%0.2f", maxSimilarity, d.SimilarityThreshold)}
+	return maxSimilarity, false
 }
 
 // cosineSimilarity calculates the cosine similarity between two token frequency maps.
@@ -539,7 +677,7 @@ func (d *Detector) isCasSpam(msgID string) spamcheck.Response {
 		if respData.Description == "" {
 			respData.Description = "spam detected"
 		}
-		return spamcheck.Response{Name: "cas", Spam: true, Details: respData.Description}
+		return spamcheck.Response{Name: "cas", Spam: true, Score: 1, Details: respData.Description}
 	}
 	details := respData.Description
 	if details == "" {
@@ -557,16 +695,28 @@ func (d *Detector) isSpamClassified(msg string) spamcheck.Response {
 	}
 	class, prob, certain := d.classifier.classify(tokens...)
 	isSpam := class == "spam" && certain && (d.MinSpamProbability == 0 || prob >= d.MinSpamProbability)
-	return spamcheck.Response{Name: "classifier", Spam: isSpam,
+	score := 1.0
+	if !isSpam {
+		score = prob / 100 // probability of spam below the threshold
+		if class != "spam" {
+			score = 1 - prob/100
+		}
+	}
+	value := 0.0 // probability of spam, set only if classified as spam, i.e., it can be detected with some threshold
+	if class == "spam" && certain {
+		value = prob
+	}
+	return spamcheck.Response{Name: "classifier", Spam: isSpam, Score: math.Min(score, 1), Value: value,
 		Details: fmt.Sprintf("probability of %s: %.2f%%", class, prob)}
 }
 
 // isStopWord checks if a given message contains any of the stop words.
 func (d *Detector) isStopWord(msg string) spamcheck.Response {
-	cleanMsg := cleanEmoji(strings.ToLower(msg))
-	for _, word := range d.stopWords { // stop words are already lowercased
-		if strings.Contains(cleanMsg, strings.ToLower(word)) {
-			return spamcheck.Response{Name: "stopword", Spam: true, Details: word}
+	cleanMsg := cleanEmoji(msg)
+	normMsg := normalize(cleanMsg)
+	for _, rule := range d.stopRules {
+		if rule.match(cleanMsg, normMsg) {
+			return spamcheck.Response{Name: "stopword", Spam: true, Score: 1, Details: rule.name}
 		}
 	}
 	return spamcheck.Response{Name: "stopword", Spam: false, Details: "not found"}
@@ -575,7 +725,8 @@ func (d *Detector) isStopWord(msg string) spamcheck.Response {
 // isManyEmojis checks if a given message contains more than MaxAllowedEmoji emojis.
 func (d *Detector) isManyEmojis(msg string) spamcheck.Response {
 	count := countEmoji(msg)
-	return spamcheck.Response{Name: "emoji", Spam: count > d.MaxAllowedEmoji, Details: fmt.Sprintf("%d/%d", count, d.MaxAllowedEmoji)}
+	return spamcheck.Response{Name: "emoji", Spam: count > d.MaxAllowedEmoji, Score: scoreOf(float64(count), float64(d.MaxAllowedEmoji+1)),
+		Details: fmt.Sprintf("%d/%d", count, d.MaxAllowedEmoji)}
 }
 
 // isMultiLang checks if a given message contains more than MultiLangWords multi-lingual words.
@@ -632,8 +783,20 @@ func (d *Detector) isMultiLang(msg string) spamcheck.Response {
 			count++
 		}
 	}
+	score := scoreOf(float64(count), float64(d.MultiLangWords))
 	if count >= d.MultiLangWords {
-		return spamcheck.Response{Name: "multi-lingual", Spam: true, Details: fmt.Sprintf("%d/%d", count, d.MultiLangWords)}
+		return spamcheck.Response{Name: "multi-lingual", Spam: true, Score: score, Details: fmt.Sprintf("%d/%d", count, d.MultiLangWords)}
+	}
+	return spamcheck.Response{Name: "multi-lingual", Spam: false, Score: score, Details: fmt.Sprintf("%d/%d", count, d.MultiLangWords)}
+}
+
+// scoreOf returns a score of the value relative to the check's threshold, capped at 1.0
+func scoreOf(val, threshold float64) float64 {
+	if threshold <= 0 {
+		if val > 0 {
+			return 1
+		}
+		return 0
 	}
-	return spamcheck.Response{Name: "multi-lingual", Spam: false, Details: fmt.Sprintf("%d/%d", count, d.MultiLangWords)}
+	return math.Min(val/threshold, 1)
 }
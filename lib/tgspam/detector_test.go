@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
+	"math/rand"
 	"net/http"
 	"sort"
 	"strings"
@@ -118,6 +120,16 @@ func TestDetector_CheckStopWords(t *testing.T) {
 			message:  "Hello, please send me a message В ЛИЧКУ",
 			expected: true,
 		},
+		{
+			name:     "Stop word with latin lookalikes",
+			message:  "ВСЕМ ПPИBЕT, есть работа", // latin P, B and T
+			expected: true,
+		},
+		{
+			name:     "Stop word with zero-width space",
+			message:  "пишите в лич\u200bку",
+			expected: true,
+		},
 	}
 
 	for _, test := range tests {
@@ -135,6 +147,39 @@ func TestDetector_CheckStopWords(t *testing.T) {
 }
 
 //nolint:stylecheck // it has unicode symbols purposely
+func TestDetector_CheckStopWordsRules(t *testing.T) {
+	d := NewDetector(Config{MaxAllowedEmoji: -1})
+	lr, err := d.LoadStopWords(bytes.NewBufferString("в личку\n[signals] re:crypto\\s+signals?\nre:bad(\nglob:заработ*в день\nword:bit\nglob:**"))
+	require.NoError(t, err)
+	assert.Equal(t, LoadResult{StopWords: 4, StopWordsErrors: []string{
+		`"re:bad(": invalid regular expression: error parsing regexp: missing closing ): ` + "`(?i)bad(`",
+		`"glob:**": glob pattern without text`,
+	}}, lr)
+
+	tests := []struct {
+		name    string
+		message string
+		spam    bool
+		details string
+	}{
+		{name: "literal", message: "пишите в личку", spam: true, details: "в личку"},
+		{name: "named regex", message: "Best CRYPTO  signals", spam: true, details: "signals"},
+		{name: "glob", message: "заработок от 100$ в день", spam: true, details: "glob:заработ*в день"},
+		{name: "whole word", message: "buy a bit now", spam: true, details: "word:bit"},
+		{name: "not a whole word", message: "buy bitcoin now", spam: false, details: "not found"},
+		{name: "invalid rule skipped", message: "bad(", spam: false, details: "not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spam, cr := d.Check(spamcheck.Request{Msg: tt.message})
+			assert.Equal(t, tt.spam, spam)
+			require.Len(t, cr, 1)
+			assert.Equal(t, spamcheck.Response{Name: "stopword", Spam: tt.spam, Score: cr[0].Score, Details: tt.details}, cr[0])
+		})
+	}
+}
+
 func TestDetector_CheckEmojis(t *testing.T) {
 	d := NewDetector(Config{MaxAllowedEmoji: 2})
 	tests := []struct {
@@ -279,6 +324,33 @@ func TestDetector_CheckSimilarity(t *testing.T) {
 			assert.Equal(t, test.expected, spam)
 			require.Len(t, cr, 1)
 			assert.Equal(t, "similarity", cr[0].Name)
+			assert.Equal(t, fmt.Sprintf("%0.2f/%0.2f", cr[0].Value, test.threshold), cr[0].Details, "similarity value")
+		})
+	}
+}
+
+func TestDetector_CheckSimilarityObfuscated(t *testing.T) {
+	d := NewDetector(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.9})
+	spamSamples := strings.NewReader("заработок на криптовалюте без вложений\nwin free iphone")
+	_, err := d.LoadSamples(strings.NewReader(""), []io.Reader{spamSamples}, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		msg  string
+	}{
+		{name: "mixed scripts", msg: "Зaрaбoтoк нa криптoвaлютe бeз влoжeний"},
+		{name: "fullwidth and leetspeak", msg: "ｗｉｎ fr33 iPh0ne"},
+		{name: "math alphanumeric", msg: "𝐰𝐢𝐧 𝐟𝐫𝐞𝐞 𝐢𝐩𝐡𝐨𝐧𝐞"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spam, cr := d.Check(spamcheck.Request{Msg: tt.msg})
+			assert.True(t, spam)
+			require.Len(t, cr, 1)
+			assert.Equal(t, "similarity", cr[0].Name)
+			assert.Equal(t, "1.00/0.90", cr[0].Details)
 		})
 	}
 }
@@ -302,13 +374,14 @@ func TestDetector_CheckClassificator(t *testing.T) {
 		message  string
 		expected bool
 		desc     string
+		value    float64
 	}{
-		{"clean ham", "Hello, how are you?", false, "probability of ham: 92.83%"},
-		{"clean spam", "Win a free iPhone now!", true, "probability of spam: 90.81%"},
-		{"a little bit spam", "You won a free lottery iphone good day", true, "probability of spam: 66.23%"},
-		{"spam below threshold", "You won a free lottery iphone have a good day", false, "probability of spam: 53.36%"},
-		{"mostly ham", "win a good day", false, "probability of ham: 65.39%"},
-		{"mostly spam", "free  blah another one user writes good things iPhone day", true, "probability of spam: 75.70%"},
+		{"clean ham", "Hello, how are you?", false, "probability of ham: 92.83%", 0},
+		{"clean spam", "Win a free iPhone now!", true, "probability of spam: 90.81%", 90.81},
+		{"a little bit spam", "You won a free lottery iphone good day", true, "probability of spam: 66.23%", 66.23},
+		{"spam below threshold", "You won a free lottery iphone have a good day", false, "probability of spam: 53.36%", 53.36},
+		{"mostly ham", "win a good day", false, "probability of ham: 65.39%", 0},
+		{"mostly spam", "free  blah another one user writes good things iPhone day", true, "probability of spam: 75.70%", 75.70},
 	}
 
 	for _, test := range tests {
@@ -320,6 +393,7 @@ func TestDetector_CheckClassificator(t *testing.T) {
 			assert.Equal(t, test.expected, cr[0].Spam)
 			t.Logf("%+v", cr[0].Details)
 			assert.Equal(t, test.desc, cr[0].Details)
+			assert.InDelta(t, test.value, cr[0].Value, 0.01, "probability of spam, if classified as spam")
 		})
 	}
 
@@ -404,6 +478,18 @@ func TestDetector_CheckOpenAI(t *testing.T) {
 		assert.Equal(t, 0, len(mockOpenAIClient.CreateChatCompletionCalls()))
 	})
 
+	t.Run("with llm checker and first-only", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, FirstMessageOnly: true})
+		d.WithLLMChecker(llmFunc(func(_ context.Context, req LLMRequest) (string, error) {
+			return `{"spam": true, "reason":"bad text", "confidence":95}`, nil
+		}), OpenAIConfig{Model: "gemini-1.5-flash"})
+		spam, cr := d.Check(spamcheck.Request{Msg: "some message 1234"})
+		assert.True(t, spam)
+		require.Len(t, cr, 1)
+		assert.Equal(t, "openai", cr[0].Name)
+		assert.Equal(t, "bad text, confidence: 95%", cr[0].Details)
+	})
+
 	t.Run("without openai", func(t *testing.T) {
 		d := NewDetector(Config{MaxAllowedEmoji: -1})
 		spam, cr := d.Check(spamcheck.Request{Msg: "some message 1234"})
@@ -518,6 +604,101 @@ func TestDetector_CheckOpenAI(t *testing.T) {
 	})
 }
 
+func TestDetector_CheckLLM(t *testing.T) {
+	newDetector := func(veto bool, answer string) (*Detector, *int) {
+		calls := 0
+		d := NewDetector(Config{MaxAllowedEmoji: -1, FirstMessageOnly: true, OpenAIVeto: veto, ScoreThreshold: 0.5})
+		d.WithLLMChecker(llmFunc(func(_ context.Context, req LLMRequest) (string, error) {
+			calls++
+			return answer, nil
+		}), OpenAIConfig{Model: "gpt4"})
+		d.LoadStopWords(strings.NewReader("some message"))
+		return d, &calls
+	}
+
+	t.Run("deferred ham, llm detects spam", func(t *testing.T) {
+		d, calls := newDetector(false, `{"spam": true, "reason":"bad text", "confidence":100}`)
+		req := spamcheck.Request{Msg: "1234", UserID: "1", DeferLLM: true}
+		spam, score, cr := d.CheckWithScore(req)
+		assert.False(t, spam)
+		assert.InDelta(t, 0, score, 0.001)
+		require.Len(t, cr, 2)
+		assert.Equal(t, spamcheck.Response{Name: "openai", Details: "pending", Pending: true}, cr[1])
+		assert.Equal(t, 0, *calls)
+		assert.False(t, d.IsApprovedUser("1"), "not approved before the verdict")
+
+		spam, score, resp := d.CheckLLM(req)
+		assert.True(t, spam)
+		assert.InDelta(t, 1, score, 0.001)
+		assert.Equal(t, spamcheck.Response{Name: "openai", Spam: true, Details: "bad text, confidence: 100%", Score: 1}, resp)
+		assert.Equal(t, 1, *calls)
+		assert.False(t, d.IsApprovedUser("1"))
+	})
+
+	t.Run("deferred ham, llm confirms ham", func(t *testing.T) {
+		d, calls := newDetector(false, `{"spam": false, "reason":"good text", "confidence":100}`)
+		req := spamcheck.Request{Msg: "1234", UserID: "1", DeferLLM: true}
+		_, _, cr := d.CheckWithScore(req)
+		require.Len(t, cr, 2)
+		assert.True(t, cr[1].Pending)
+		assert.False(t, d.IsApprovedUser("1"), "not approved before the verdict")
+
+		// the next message is checked as well, as the user is not approved yet
+		_, _, cr = d.CheckWithScore(spamcheck.Request{Msg: "5678", UserID: "1", DeferLLM: true})
+		require.Len(t, cr, 2)
+		assert.True(t, cr[1].Pending)
+
+		spam, _, _ := d.CheckLLM(req)
+		assert.False(t, spam)
+		assert.Equal(t, 1, *calls)
+		assert.True(t, d.IsApprovedUser("1"))
+	})
+
+	t.Run("deferred ham of edited message, not counted", func(t *testing.T) {
+		d, _ := newDetector(false, `{"spam": false, "reason":"good text", "confidence":100}`)
+		req := spamcheck.Request{Msg: "1234", UserID: "1", DeferLLM: true, SkipApproval: true}
+		d.CheckWithScore(req)
+		spam, _, _ := d.CheckLLM(req)
+		assert.False(t, spam)
+		assert.False(t, d.IsApprovedUser("1"))
+	})
+
+	t.Run("deferred spam, llm vetoes", func(t *testing.T) {
+		d, calls := newDetector(true, `{"spam": false, "reason":"good text", "confidence":100}`)
+		req := spamcheck.Request{Msg: "some message 1234", UserID: "1", DeferLLM: true}
+		spam, _, cr := d.CheckWithScore(req)
+		assert.True(t, spam)
+		require.Len(t, cr, 2)
+		assert.Equal(t, "stopword", cr[0].Name)
+		assert.True(t, cr[1].Pending)
+		assert.Equal(t, 0, *calls)
+
+		spam, score, resp := d.CheckLLM(req)
+		assert.False(t, spam)
+		assert.InDelta(t, 0, score, 0.001)
+		assert.Equal(t, "good text, confidence: 100%", resp.Details)
+		assert.Equal(t, 1, *calls)
+		assert.True(t, d.IsApprovedUser("1"), "approved after the veto")
+	})
+
+	t.Run("not deferred if not needed", func(t *testing.T) {
+		d, calls := newDetector(true, `{"spam": false, "reason":"good text", "confidence":100}`)
+		spam, _, cr := d.CheckWithScore(spamcheck.Request{Msg: "1234", UserID: "1", DeferLLM: true})
+		assert.False(t, spam)
+		require.Len(t, cr, 1)
+		assert.Equal(t, "stopword", cr[0].Name)
+		assert.Equal(t, 0, *calls)
+	})
+
+	t.Run("without openai", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, FirstMessageOnly: true})
+		spam, score, resp := d.CheckLLM(spamcheck.Request{Msg: "1234"})
+		assert.False(t, spam)
+		assert.InDelta(t, 0, score, 0.001)
+		assert.Equal(t, spamcheck.Response{}, resp)
+	})
+}
+
 func TestDetector_CheckWithMeta(t *testing.T) {
 	d := NewDetector(Config{MaxAllowedEmoji: -1})
 	d.WithMetaChecks(LinksCheck(1), ImagesCheck(), LinkOnlyCheck())
@@ -634,6 +815,7 @@ func TestDetector_CheckMultiLang(t *testing.T) {
 		{"WithCyrillic and i", "Привет  мiр", 0, false},
 		{"strange with cyrillic", "𝐇айди и𝐇𝐓и𝐦𝐇ы𝐞 ф𝐨𝐓𝐤и лю𝐛𝐨й д𝐞𝐁𝐲ш𝐤и ч𝐞𝐩𝐞𝟑 𝐛𝐨𝐓а", 7, true},
 		{"coptic capital leter", "✔️ⲠⲢⲞⳜⲈЙ-ⲖЮⳜⲨЮ-ⲆⲈⲂⲨⲰⲔⲨ...\n\nⲎⲀЙⲆⳘ ⲤⲔⲢЫⲦⲈ ⲂⳘⲆⲞⲤЫ-ⲪⲞⲦⲞⳠⲔⳘ ⳘⲎⲦⳘⲘⲎⲞⲄⲞ-ⲬⲀⲢⲀⲔⲦⲈⲢⲀ..\n@INTIM0CHKI110DE\n\n", 6, true},
+		{"normalized text not used", "Зaрaбoтoк нa криптe", 3, true},
 		{"mix with gothic, cyrillic and greek", "𐌿РОВЕРЬ ЛЮБУЮ НА НАЛИЧИЕ ПОШЛЫХ ΦΟͲΟ-ΒͶДξΟ, 🍑НАБЕРИ В Т𐌲 𐌿ОИСКЕ СЛОВО: 30GRL", 5, true},
 	}
 
@@ -704,6 +886,73 @@ func TestDetector_UpdateSpam(t *testing.T) {
 	})
 }
 
+func TestDetector_LearnSamples(t *testing.T) {
+	upd := &mocks.SampleUpdaterMock{AppendFunc: func(msg string) error { return nil }}
+	d := NewDetector(Config{MaxAllowedEmoji: -1})
+	d.WithSpamUpdater(upd)
+	d.WithHamUpdater(upd)
+	_, err := d.LoadSamples(strings.NewReader(""), []io.Reader{strings.NewReader("win free iPhone")},
+		[]io.Reader{strings.NewReader("hello world")})
+	require.NoError(t, err)
+	assert.Equal(t, 2, d.classifier.nAllDocument)
+
+	d.LearnSpam("lottery prize")
+	d.LearnHam("good day")
+	assert.Equal(t, 4, d.classifier.nAllDocument)
+	assert.Equal(t, map[spamClass]int{"spam": 1}, d.classifier.learningResults["lottery"])
+	assert.Equal(t, map[spamClass]int{"ham": 1}, d.classifier.learningResults["good"])
+	assert.Len(t, d.tokenizedSpam, 2, "spam sample added to similarity samples")
+	assert.Empty(t, upd.AppendCalls(), "samples not written to the storage")
+}
+
+func TestDetector_LLMExamples(t *testing.T) {
+	var reqs []LLMRequest
+	d := NewDetector(Config{MaxAllowedEmoji: -1, FirstMessageOnly: true})
+	d.WithLLMChecker(llmFunc(func(_ context.Context, req LLMRequest) (string, error) {
+		reqs = append(reqs, req)
+		return `{"spam": false, "reason":"good text", "confidence":90}`, nil
+	}), OpenAIConfig{Examples: 2, CacheSize: 10})
+	d.WithSpamUpdater(&mocks.SampleUpdaterMock{
+		AppendFunc: func(msg string) error { return nil },
+		ReaderFunc: func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("spam 1\nspam 2\n\nspam 3\n")), nil
+		},
+	})
+	d.WithHamUpdater(&mocks.SampleUpdaterMock{
+		AppendFunc: func(msg string) error { return nil },
+		ReaderFunc: func() (io.ReadCloser, error) { return nil, fs.ErrNotExist },
+	})
+
+	_, err := d.LoadSamples(strings.NewReader(""), []io.Reader{strings.NewReader("win free iPhone")},
+		[]io.Reader{strings.NewReader("hello world")})
+	require.NoError(t, err)
+	d.Check(spamcheck.Request{Msg: "some message 1", UserID: "1"})
+	require.Len(t, reqs, 1)
+	assert.Equal(t, []string{"spam 2", "spam 3"}, exampleMessages(reqs[0].Examples), "last spam samples, no ham file")
+
+	require.NoError(t, d.UpdateHam("ham 1"))
+	require.NoError(t, d.UpdateSpam("spam 4"))
+	d.Check(spamcheck.Request{Msg: "some message 2", UserID: "2"})
+	require.Len(t, reqs, 2)
+	assert.Equal(t, []string{"spam 3", "ham 1", "spam 4"}, exampleMessages(reqs[1].Examples), "updated samples added")
+	assert.JSONEq(t, `{"spam":false,"reason":"confirmed by admin","confidence":100}`, reqs[1].Examples[1].Answer)
+
+	d.Check(spamcheck.Request{Msg: "some message 2", UserID: "3"})
+	require.Len(t, reqs, 2, "cached")
+	require.NoError(t, d.UpdateHam("some message 2"))
+	d.Check(spamcheck.Request{Msg: "some message 2", UserID: "4"})
+	require.Len(t, reqs, 3, "updated sample removed from cache")
+}
+
+// exampleMessages returns messages of few-shot examples
+func exampleMessages(examples []LLMExample) []string {
+	res := make([]string, 0, len(examples))
+	for _, e := range examples {
+		res = append(res, e.Message)
+	}
+	return res
+}
+
 func TestDetector_UpdateHam(t *testing.T) {
 	upd := &mocks.SampleUpdaterMock{
 		AppendFunc: func(msg string) error {
@@ -774,6 +1023,30 @@ func TestDetector_Reset(t *testing.T) {
 	assert.Equal(t, 0, len(d.stopWords))
 }
 
+func TestDetector_SetThresholds(t *testing.T) {
+	d := NewDetector(Config{SimilarityThreshold: 0.9, MinSpamProbability: 50, MaxAllowedEmoji: -1})
+	_, err := d.LoadSamples(strings.NewReader(""), []io.Reader{strings.NewReader("win free iphone now")},
+		[]io.Reader{strings.NewReader("hello world")})
+	require.NoError(t, err)
+
+	sim, prob := d.Thresholds()
+	assert.InDelta(t, 0.9, sim, 0.0001)
+	assert.InDelta(t, 50, prob, 0.0001)
+
+	msg := spamcheck.Request{Msg: "win free iphone today"}
+	_, cr := d.Check(msg)
+	require.Equal(t, "similarity", cr[0].Name)
+	assert.False(t, cr[0].Spam)
+
+	d.SetThresholds(0.5, 70)
+	sim, prob = d.Thresholds()
+	assert.InDelta(t, 0.5, sim, 0.0001)
+	assert.InDelta(t, 70, prob, 0.0001)
+	_, cr = d.Check(msg)
+	assert.True(t, cr[0].Spam, "similarity threshold applied")
+	assert.Equal(t, "0.75/0.50", cr[0].Details)
+}
+
 func TestDetector_FirstMessagesCount(t *testing.T) {
 	t.Run("first message is spam", func(t *testing.T) {
 		d := NewDetector(Config{MaxAllowedEmoji: 1, MinMsgLen: 5, FirstMessagesCount: 2, FirstMessageOnly: true})
@@ -830,6 +1103,21 @@ func TestDetector_FirstMessagesCount(t *testing.T) {
 		spam, _ = d.Check(spamcheck.Request{Msg: "spam, too many emojis 🤣🤣🤣", UserID: "123"})
 		assert.Equal(t, false, spam)
 	})
+	t.Run("edits don't count toward approval", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: 1, MinMsgLen: 5, FirstMessagesCount: 2, FirstMessageOnly: true})
+
+		spam, _ := d.Check(spamcheck.Request{Msg: "ham, no emojis", UserID: "123"})
+		assert.Equal(t, false, spam)
+		for i := 0; i < 5; i++ { // the same message edited several times
+			spam, _ = d.Check(spamcheck.Request{Msg: "ham, no emojis", UserID: "123", SkipApproval: true})
+			assert.Equal(t, false, spam)
+		}
+		assert.Equal(t, 1, d.approvedUsers["123"].Count)
+		assert.False(t, d.IsApprovedUser("123"))
+
+		spam, _ = d.Check(spamcheck.Request{Msg: "spam, too many emojis 🤣🤣🤣", UserID: "123"})
+		assert.Equal(t, true, spam, "user is not approved by edits")
+	})
 }
 
 func TestDetector_ApprovedUsers(t *testing.T) {
@@ -859,6 +1147,19 @@ func TestDetector_ApprovedUsers(t *testing.T) {
 		assert.Equal(t, "test", mockUserStore.WriteCalls()[0].Au.UserName)
 	})
 
+	t.Run("approve and disapprove in memory", func(t *testing.T) {
+		mockUserStore.ResetCalls()
+		d := NewDetector(Config{MaxAllowedEmoji: -1, MinMsgLen: 5, FirstMessageOnly: true})
+		_, err := d.WithUserStorage(mockUserStore)
+		require.NoError(t, err)
+		d.ApproveUser(approved.UserInfo{UserID: "999", UserName: "test"})
+		assert.True(t, d.IsApprovedUser("999"))
+		d.DisapproveUser("123")
+		assert.False(t, d.IsApprovedUser("123"))
+		assert.Empty(t, mockUserStore.WriteCalls())
+		assert.Empty(t, mockUserStore.DeleteCalls())
+	})
+
 	t.Run("user not approved, spam detected", func(t *testing.T) {
 		mockUserStore.ResetCalls()
 		d := NewDetector(Config{MaxAllowedEmoji: -1, MinMsgLen: 5, FirstMessageOnly: true})
@@ -1002,6 +1303,27 @@ func TestDetector_ApprovedUsers(t *testing.T) {
 		assert.Equal(t, 0, len(mockUserStore.WriteCalls()))
 	})
 
+	t.Run("user pre-approved, check forced", func(t *testing.T) {
+		mockUserStore.ResetCalls()
+		d := NewDetector(Config{MaxAllowedEmoji: -1, MinMsgLen: 5, FirstMessagesCount: 1})
+		_, err := d.LoadStopWords(strings.NewReader("spam\nbuy cryptocurrency"))
+		require.NoError(t, err)
+		count, err := d.WithUserStorage(mockUserStore)
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+
+		isSpam, info := d.Check(spamcheck.Request{Msg: "Hello, how are you my friend? buy cryptocurrency now!", UserID: "123",
+			CheckApproved: true})
+		t.Logf("%+v", info)
+		assert.Equal(t, true, isSpam)
+		require.Len(t, info, 1)
+		assert.Equal(t, "stopword", info[0].Name)
+
+		isSpam, info = d.Check(spamcheck.Request{Msg: "Hello, how are you my friend?", UserID: "123", CheckApproved: true})
+		t.Logf("%+v", info)
+		assert.Equal(t, false, isSpam)
+		assert.Equal(t, 0, len(mockUserStore.WriteCalls()), "approved users not updated for forced check")
+	})
 }
 
 func TestDetector_tokenize(t *testing.T) {
@@ -1064,3 +1386,75 @@ func TestDetector_tokenChanMultipleReaders(t *testing.T) {
 	}
 	assert.Equal(t, []string{"hello", "world", "something, new"}, res)
 }
+
+func TestDetector_similarityIndexMatchesScan(t *testing.T) {
+	d := NewDetector(Config{})
+	spam, messages := makeSimilaritySamples(500, 100)
+	_, err := d.LoadSamples(strings.NewReader(""), []io.Reader{strings.NewReader(strings.Join(spam, "\n"))}, nil)
+	require.NoError(t, err)
+
+	for _, threshold := range []float64{0.3, 0.5, 0.8, 1} {
+		d.SimilarityThreshold = threshold
+		for _, msg := range messages {
+			tokenized := d.tokenize(msg)
+			expSimilarity, expFound := d.scanSimilarity(tokenized)
+			similarity, found := d.spamIndex.maxSimilarity(tokenized, threshold)
+			assert.Equal(t, expFound, found, "threshold %v, msg %q", threshold, msg)
+			assert.Equal(t, expSimilarity, similarity, "threshold %v, msg %q", threshold, msg)
+		}
+	}
+}
+
+func BenchmarkDetector_Similarity(b *testing.B) {
+	for _, size := range []int{1000, 10000, 60000} {
+		d := NewDetector(Config{SimilarityThreshold: 0.9})
+		spam, messages := makeSimilaritySamples(size, 100)
+		_, err := d.LoadSamples(strings.NewReader(""), []io.Reader{strings.NewReader(strings.Join(spam, "\n"))}, nil)
+		require.NoError(b, err)
+		tokenized := make([]map[string]int, 0, len(messages))
+		for _, msg := range messages {
+			tokenized = append(tokenized, d.tokenize(msg))
+		}
+
+		b.Run(fmt.Sprintf("scan-%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				d.scanSimilarity(tokenized[i%len(tokenized)])
+			}
+		})
+		b.Run(fmt.Sprintf("index-%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				d.spamIndex.maxSimilarity(tokenized[i%len(tokenized)], d.SimilarityThreshold)
+			}
+		})
+	}
+}
+
+// makeSimilaritySamples makes random spam samples and messages from a fixed vocabulary,
+// some messages are variations of spam samples
+func makeSimilaritySamples(samples, messages int) (spam, msgs []string) {
+	rnd := rand.New(rand.NewSource(42)) //nolint:gosec // test data
+	vocabulary := make([]string, 5000)
+	for i := range vocabulary {
+		vocabulary[i] = fmt.Sprintf("word%d", i)
+	}
+	makeText := func(words int) string {
+		res := make([]string, words)
+		for i := range res {
+			res[i] = vocabulary[rnd.Intn(len(vocabulary))]
+		}
+		return strings.Join(res, " ")
+	}
+
+	for i := 0; i < samples; i++ {
+		spam = append(spam, makeText(5+rnd.Intn(20)))
+	}
+	for i := 0; i < messages; i++ {
+		if i%2 == 0 {
+			// variation of a spam sample with a few extra words
+			msgs = append(msgs, spam[rnd.Intn(len(spam))]+" "+makeText(rnd.Intn(5)))
+			continue
+		}
+		msgs = append(msgs, makeText(5+rnd.Intn(30)))
+	}
+	return spam, msgs
+}
@@ -0,0 +1,151 @@
+package tgspam
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+// ShortenersClass is a special entry of domain lists matching all known link shorteners and telegram invite links
+const ShortenersClass = "@shorteners"
+
+// shorteners is a list of known link shorteners, matched with subdomains
+var shorteners = []string{"bit.ly", "bitly.com", "tinyurl.com", "goo.gl", "ow.ly", "is.gd", "v.gd", "t.co", "buff.ly",
+	"cutt.ly", "rebrand.ly", "shorturl.at", "tiny.cc", "rb.gy", "clck.ru", "u.to", "s.id", "t.ly", "surl.li", "lnkd.in"}
+
+// urlRe matches links with scheme, with www. prefix and telegram links without scheme
+var urlRe = regexp.MustCompile(`(?i)(?:https?://|\bwww\.|\bt\.me/|\btelegram\.me/)[^\s<>"]+`)
+
+// DomainLists keeps allowed and blocked domains used by DomainsCheck, thread-safe.
+// Each entry matches the domain itself and all its subdomains, ShortenersClass entry matches all known shorteners.
+type DomainLists struct {
+	allowed []string
+	blocked []string
+	lock    sync.RWMutex
+}
+
+// Load loads allowed and blocked domains, one per line, lines started with # are ignored.
+// Resets both lists before loading.
+func (l *DomainLists) Load(allowReader, blockReader io.Reader) (LoadResult, error) {
+	allowed, err := readDomains(allowReader)
+	if err != nil {
+		return LoadResult{}, fmt.Errorf("can't read allowed domains: %w", err)
+	}
+	blocked, err := readDomains(blockReader)
+	if err != nil {
+		return LoadResult{}, fmt.Errorf("can't read blocked domains: %w", err)
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.allowed, l.blocked = allowed, blocked
+	return LoadResult{AllowedDomains: len(allowed), BlockedDomains: len(blocked)}, nil
+}
+
+// readDomains reads normalized domains from the reader, skipping empty lines and comments
+func readDomains(r io.Reader) ([]string, error) {
+	res := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if line == ShortenersClass {
+			res = append(res, line)
+			continue
+		}
+		if d := linkDomain(line); d != "" {
+			res = append(res, d)
+		}
+	}
+	return res, scanner.Err()
+}
+
+// DomainsCheck is a function that returns a MetaCheck function that checks domains of links in the message,
+// including links marked by the client, hidden links and button links. The message is spam if it links to a blocked
+// domain, or, with allowed domains set, to any domain not in the allowed list.
+func DomainsCheck(lists *DomainLists) MetaCheck {
+	return func(req spamcheck.Request) spamcheck.Response {
+		links := urlRe.FindAllString(req.Msg, -1)
+		for _, link := range req.Meta.URLs {
+			// links found by the regex are marked by the client as well
+			if !slices.Contains(links, link) {
+				links = append(links, link)
+			}
+		}
+		links = append(links, req.Meta.HiddenLinks...)
+		links = append(links, req.Meta.ButtonLinks...)
+		if len(links) == 0 {
+			return spamcheck.Response{Spam: false, Name: "domains", Details: "no links"}
+		}
+
+		lists.lock.RLock()
+		defer lists.lock.RUnlock()
+		for _, link := range links {
+			domain := linkDomain(link)
+			if domain == "" {
+				continue
+			}
+			if lists.matches(lists.blocked, domain, link) {
+				return spamcheck.Response{Spam: true, Name: "domains", Details: fmt.Sprintf("blocked domain %s", domain)}
+			}
+			if len(lists.allowed) > 0 && !lists.matches(lists.allowed, domain, link) {
+				return spamcheck.Response{Spam: true, Name: "domains", Details: fmt.Sprintf("domain %s not allowed", domain)}
+			}
+		}
+		return spamcheck.Response{Spam: false, Name: "domains", Details: fmt.Sprintf("no blocked domains in %d links", len(links))}
+	}
+}
+
+// matches checks if the link's domain is in the list, either directly, as a subdomain or as a shortener
+func (l *DomainLists) matches(list []string, domain, link string) bool {
+	if slices.Contains(list, ShortenersClass) && isShortener(domain, link) {
+		return true
+	}
+	return slices.ContainsFunc(list, func(d string) bool { return matchDomain(domain, d) })
+}
+
+// matchDomain checks if domain is the same as the pattern or its subdomain
+func matchDomain(domain, pattern string) bool {
+	return domain == pattern || strings.HasSuffix(domain, "."+pattern)
+}
+
+// isShortener checks if the link is a known shortener or a telegram invite link
+func isShortener(domain, link string) bool {
+	if slices.ContainsFunc(shorteners, func(s string) bool { return matchDomain(domain, s) }) {
+		return true
+	}
+	if domain != "t.me" && domain != "telegram.me" {
+		return false
+	}
+	u, err := url.Parse(withScheme(link))
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(u.Path, "/+") || strings.HasPrefix(u.Path, "/joinchat/")
+}
+
+// linkDomain returns the lowercased domain of the link without www. prefix and port, empty if can't be parsed
+func linkDomain(link string) string {
+	u, err := url.Parse(withScheme(link))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// withScheme adds http scheme to the link if it has no scheme
+func withScheme(link string) string {
+	if strings.HasPrefix(strings.ToLower(link), "http://") || strings.HasPrefix(strings.ToLower(link), "https://") {
+		return link
+	}
+	return "http://" + link
+}
@@ -0,0 +1,154 @@
+package tgspam
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+func TestDomainLists_Load(t *testing.T) {
+	lists := &DomainLists{}
+	lr, err := lists.Load(strings.NewReader("example.com\n# comment\n\nWWW.Good.org\nhttps://docs.site.io/path\n"),
+		strings.NewReader("@shorteners\nspam.com:8080\n"))
+	require.NoError(t, err)
+	assert.Equal(t, LoadResult{AllowedDomains: 3, BlockedDomains: 2}, lr)
+	assert.Equal(t, []string{"example.com", "good.org", "docs.site.io"}, lists.allowed)
+	assert.Equal(t, []string{ShortenersClass, "spam.com"}, lists.blocked)
+
+	lr, err = lists.Load(strings.NewReader(""), strings.NewReader("other.com"))
+	require.NoError(t, err)
+	assert.Equal(t, LoadResult{AllowedDomains: 0, BlockedDomains: 1}, lr)
+	assert.Empty(t, lists.allowed, "reset on load")
+}
+
+func TestDomainsCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowed  string
+		blocked  string
+		req      spamcheck.Request
+		expected spamcheck.Response
+	}{
+		{
+			name:     "no links",
+			blocked:  "spam.com",
+			req:      spamcheck.Request{Msg: "hello world"},
+			expected: spamcheck.Response{Name: "domains", Spam: false, Details: "no links"},
+		},
+		{
+			name:     "blocked domain in text",
+			blocked:  "spam.com",
+			req:      spamcheck.Request{Msg: "visit https://www.Spam.com/offer now"},
+			expected: spamcheck.Response{Name: "domains", Spam: true, Details: "blocked domain spam.com"},
+		},
+		{
+			name:     "blocked subdomain",
+			blocked:  "spam.com",
+			req:      spamcheck.Request{Msg: "visit http://promo.spam.com now"},
+			expected: spamcheck.Response{Name: "domains", Spam: true, Details: "blocked domain promo.spam.com"},
+		},
+		{
+			name:     "similar domain not blocked",
+			blocked:  "spam.com",
+			req:      spamcheck.Request{Msg: "visit https://notspam.com now"},
+			expected: spamcheck.Response{Name: "domains", Spam: false, Details: "no blocked domains in 1 links"},
+		},
+		{
+			name:    "blocked domain in hidden link",
+			blocked: "spam.com",
+			req: spamcheck.Request{Msg: "click here",
+				Meta: spamcheck.MetaData{HiddenLinks: []string{"https://spam.com/x"}}},
+			expected: spamcheck.Response{Name: "domains", Spam: true, Details: "blocked domain spam.com"},
+		},
+		{
+			name:    "blocked domain in button",
+			blocked: "spam.com",
+			req: spamcheck.Request{Msg: "click the button",
+				Meta: spamcheck.MetaData{ButtonLinks: []string{"https://spam.com/x"}}},
+			expected: spamcheck.Response{Name: "domains", Spam: true, Details: "blocked domain spam.com"},
+		},
+		{
+			name:    "blocked domain in url without scheme",
+			blocked: "example.com",
+			req: spamcheck.Request{Msg: "see example.com/promo now",
+				Meta: spamcheck.MetaData{URLs: []string{"example.com/promo"}}},
+			expected: spamcheck.Response{Name: "domains", Spam: true, Details: "blocked domain example.com"},
+		},
+		{
+			name:     "shortener in url without scheme",
+			blocked:  ShortenersClass,
+			req:      spamcheck.Request{Msg: "get it bit.ly/x", Meta: spamcheck.MetaData{URLs: []string{"bit.ly/x"}}},
+			expected: spamcheck.Response{Name: "domains", Spam: true, Details: "blocked domain bit.ly"},
+		},
+		{
+			name:    "url matched by text not counted twice",
+			blocked: "spam.com",
+			req: spamcheck.Request{Msg: "visit https://ham.com now",
+				Meta: spamcheck.MetaData{URLs: []string{"https://ham.com"}}},
+			expected: spamcheck.Response{Name: "domains", Spam: false, Details: "no blocked domains in 1 links"},
+		},
+		{
+			name:     "blocked shortener",
+			blocked:  ShortenersClass,
+			req:      spamcheck.Request{Msg: "get it here https://bit.ly/abc"},
+			expected: spamcheck.Response{Name: "domains", Spam: true, Details: "blocked domain bit.ly"},
+		},
+		{
+			name:     "blocked telegram invite link",
+			blocked:  ShortenersClass,
+			req:      spamcheck.Request{Msg: "join t.me/+AbCdEf123"},
+			expected: spamcheck.Response{Name: "domains", Spam: true, Details: "blocked domain t.me"},
+		},
+		{
+			name:     "telegram channel link is not a shortener",
+			blocked:  ShortenersClass,
+			req:      spamcheck.Request{Msg: "see https://t.me/golang"},
+			expected: spamcheck.Response{Name: "domains", Spam: false, Details: "no blocked domains in 1 links"},
+		},
+		{
+			name:     "allowed domains only",
+			allowed:  "github.com\ngo.dev",
+			req:      spamcheck.Request{Msg: "see https://github.com/umputun and https://pkg.go.dev/fmt"},
+			expected: spamcheck.Response{Name: "domains", Spam: false, Details: "no blocked domains in 2 links"},
+		},
+		{
+			name:     "not allowed domain",
+			allowed:  "github.com",
+			req:      spamcheck.Request{Msg: "see https://github.com/umputun and www.example.com"},
+			expected: spamcheck.Response{Name: "domains", Spam: true, Details: "domain example.com not allowed"},
+		},
+		{
+			name:     "blocked wins over allowed",
+			allowed:  "example.com",
+			blocked:  "bad.example.com",
+			req:      spamcheck.Request{Msg: "see https://bad.example.com"},
+			expected: spamcheck.Response{Name: "domains", Spam: true, Details: "blocked domain bad.example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lists := &DomainLists{}
+			_, err := lists.Load(strings.NewReader(tt.allowed), strings.NewReader(tt.blocked))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, DomainsCheck(lists)(tt.req))
+		})
+	}
+}
+
+func TestDetector_LoadDomains(t *testing.T) {
+	d := NewDetector(Config{MaxAllowedEmoji: -1})
+	d.WithMetaChecks(DomainsCheck(d.Domains()))
+	lr, err := d.LoadDomains(strings.NewReader(""), strings.NewReader("spam.com"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, lr.BlockedDomains)
+
+	spam, cr := d.Check(spamcheck.Request{Msg: "buy at https://spam.com now"})
+	assert.True(t, spam)
+	require.NotEmpty(t, cr)
+	assert.Equal(t, spamcheck.Response{Name: "domains", Spam: true, Details: "blocked domain spam.com", Score: 1}, cr[len(cr)-1])
+}
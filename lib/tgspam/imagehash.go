@@ -0,0 +1,103 @@
+package tgspam
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"  // register gif decoder
+	_ "image/jpeg" // register jpeg decoder
+	_ "image/png"  // register png decoder
+	"io"
+	"math/bits"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+//go:generate moq --out mocks/image_hashes.go --pkg mocks --skip-ensure --with-resets . ImageHashes
+
+// ImageHashes is an interface for storage of known spam image hashes.
+type ImageHashes interface {
+	Hashes() ([]uint64, error) // return all known spam image hashes
+}
+
+// ImageHash calculates a perceptual (difference) hash of the image. The image is reduced to 9x8 grayscale
+// and each bit of the hash set if the pixel is darker than its right neighbour. Similar images, e.g., resized
+// or recompressed, have hashes with a small hamming distance.
+func ImageHash(r io.Reader) (uint64, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return 0, fmt.Errorf("can't decode image: %w", err)
+	}
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return 0, errors.New("empty image")
+	}
+
+	const w, h = 9, 8
+	var gray [h][w]float64
+	for y := 0; y < h; y++ {
+		y0, y1 := b.Min.Y+y*b.Dy()/h, b.Min.Y+(y+1)*b.Dy()/h
+		y1 = max(y1, y0+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := b.Min.X+x*b.Dx()/w, b.Min.X+(x+1)*b.Dx()/w
+			x1 = max(x1, x0+1)
+			// average luminance of the box
+			sum, n := 0.0, 0
+			for yy := y0; yy < y1 && yy < b.Max.Y; yy++ {
+				for xx := x0; xx < x1 && xx < b.Max.X; xx++ {
+					cr, cg, cb, _ := img.At(xx, yy).RGBA()
+					sum += 0.299*float64(cr) + 0.587*float64(cg) + 0.114*float64(cb)
+					n++
+				}
+			}
+			if n > 0 {
+				gray[y][x] = sum / float64(n)
+			}
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			hash <<= 1
+			if gray[y][x] < gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash, nil
+}
+
+// HashDistance returns the hamming distance between two image hashes, i.e. the number of different bits
+func HashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// ImageHashCheck is a function that returns a MetaCheck function that compares the image hash of the message
+// with known spam image hashes. The message is spam if the distance to any of them is not greater than maxDistance.
+func ImageHashCheck(hashes ImageHashes, maxDistance int) MetaCheck {
+	return func(req spamcheck.Request) spamcheck.Response {
+		if req.Meta.ImageHash == nil {
+			return spamcheck.Response{Spam: false, Name: "image-hash", Details: "no image hash"}
+		}
+		known, err := hashes.Hashes()
+		if err != nil {
+			return spamcheck.Response{Spam: false, Name: "image-hash", Details: fmt.Sprintf("can't get known spam images: %v", err)}
+		}
+		minDistance := -1
+		for _, h := range known {
+			if d := HashDistance(*req.Meta.ImageHash, h); minDistance < 0 || d < minDistance {
+				minDistance = d
+			}
+		}
+		if minDistance < 0 {
+			return spamcheck.Response{Spam: false, Name: "image-hash", Details: "no known spam images"}
+		}
+		if minDistance <= maxDistance {
+			return spamcheck.Response{Spam: true, Name: "image-hash",
+				Details: fmt.Sprintf("image matches known spam, distance %d/%d", minDistance, maxDistance)}
+		}
+		return spamcheck.Response{Spam: false, Name: "image-hash",
+			Details: fmt.Sprintf("closest known spam image distance %d/%d", minDistance, maxDistance)}
+	}
+}
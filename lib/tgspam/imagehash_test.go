@@ -0,0 +1,136 @@
+package tgspam
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+	"github.com/umputun/tg-spam/lib/tgspam/mocks"
+)
+
+func TestImageHash(t *testing.T) {
+	// makeImage makes an image with a horizontal gradient and a dark square, encoded as png or jpeg
+	makeImage := func(w, h int, squareX float64, asJPEG bool) []byte {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				c := uint8(255 * x / w)
+				if float64(x) > squareX*float64(w) && float64(x) < (squareX+0.3)*float64(w) && y > h/3 && y < 2*h/3 {
+					c = 0
+				}
+				img.Set(x, y, color.RGBA{R: c, G: c, B: 255 - c, A: 255})
+			}
+		}
+		buf := bytes.Buffer{}
+		if asJPEG {
+			require.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: 60}))
+		} else {
+			require.NoError(t, png.Encode(&buf, img))
+		}
+		return buf.Bytes()
+	}
+
+	orig, err := ImageHash(bytes.NewReader(makeImage(320, 240, 0.2, false)))
+	require.NoError(t, err)
+	assert.NotZero(t, orig)
+
+	t.Run("same image", func(t *testing.T) {
+		h, err := ImageHash(bytes.NewReader(makeImage(320, 240, 0.2, false)))
+		require.NoError(t, err)
+		assert.Equal(t, orig, h)
+	})
+
+	t.Run("resized and recompressed", func(t *testing.T) {
+		h, err := ImageHash(bytes.NewReader(makeImage(640, 480, 0.2, true)))
+		require.NoError(t, err)
+		assert.LessOrEqual(t, HashDistance(orig, h), 4)
+	})
+
+	t.Run("different image", func(t *testing.T) {
+		h, err := ImageHash(bytes.NewReader(makeImage(320, 240, 0.6, false)))
+		require.NoError(t, err)
+		assert.Greater(t, HashDistance(orig, h), 5)
+	})
+
+	t.Run("not an image", func(t *testing.T) {
+		_, err := ImageHash(strings.NewReader("not an image"))
+		assert.ErrorContains(t, err, "can't decode image")
+	})
+}
+
+func TestHashDistance(t *testing.T) {
+	assert.Equal(t, 0, HashDistance(0xff00, 0xff00))
+	assert.Equal(t, 1, HashDistance(0xff00, 0xff01))
+	assert.Equal(t, 64, HashDistance(0, ^uint64(0)))
+}
+
+func TestImageHashCheck(t *testing.T) {
+	hashes := &mocks.ImageHashesMock{HashesFunc: func() ([]uint64, error) { return []uint64{0xf0f0, 0xff00ff00, 0}, nil }}
+	hash := func(h uint64) *uint64 { return &h }
+
+	tests := []struct {
+		name     string
+		hashes   *mocks.ImageHashesMock
+		hash     *uint64
+		expected spamcheck.Response
+	}{
+		{
+			name:     "no image",
+			hashes:   hashes,
+			hash:     nil,
+			expected: spamcheck.Response{Name: "image-hash", Spam: false, Details: "no image hash"},
+		},
+		{
+			name:     "flat image, zero hash",
+			hashes:   hashes,
+			hash:     hash(0),
+			expected: spamcheck.Response{Name: "image-hash", Spam: true, Details: "image matches known spam, distance 0/2"},
+		},
+		{
+			name:     "exact match",
+			hashes:   hashes,
+			hash:     hash(0xff00ff00),
+			expected: spamcheck.Response{Name: "image-hash", Spam: true, Details: "image matches known spam, distance 0/2"},
+		},
+		{
+			name:     "close match",
+			hashes:   hashes,
+			hash:     hash(0xf0f3),
+			expected: spamcheck.Response{Name: "image-hash", Spam: true, Details: "image matches known spam, distance 2/2"},
+		},
+		{
+			name:     "no match",
+			hashes:   hashes,
+			hash:     hash(0xf0ff),
+			expected: spamcheck.Response{Name: "image-hash", Spam: false, Details: "closest known spam image distance 4/2"},
+		},
+		{
+			name:     "no known images",
+			hashes:   &mocks.ImageHashesMock{HashesFunc: func() ([]uint64, error) { return nil, nil }},
+			hash:     hash(0xf0f0),
+			expected: spamcheck.Response{Name: "image-hash", Spam: false, Details: "no known spam images"},
+		},
+		{
+			name:     "storage error",
+			hashes:   &mocks.ImageHashesMock{HashesFunc: func() ([]uint64, error) { return nil, errors.New("db error") }},
+			hash:     hash(0xf0f0),
+			expected: spamcheck.Response{Name: "image-hash", Spam: false, Details: "can't get known spam images: db error"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := ImageHashCheck(tt.hashes, 2)
+			assert.Equal(t, tt.expected, check(spamcheck.Request{Meta: spamcheck.MetaData{ImageHash: tt.hash}}))
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package tgspam
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	anthropicAPIURL  = "https://api.anthropic.com"
+	anthropicVersion = "2023-06-01"
+	geminiAPIURL     = "https://generativelanguage.googleapis.com"
+	maxLLMRespSize   = 1024 * 1024 // max size of the response body read from llm api
+	llmToolName      = "spam_check"
+)
+
+// llmResponseSchema is json schema of the model's answer, used for structured output
+const llmResponseSchema = `{"type":"object","properties":{` +
+	`"spam":{"type":"boolean","description":"true if the message is spam"},` +
+	`"reason":{"type":"string","description":"why this is spam or not"},` +
+	`"confidence":{"type":"integer","description":"confidence of the decision, 1-100"}},` +
+	`"required":["spam","reason","confidence"]}`
+
+// geminiResponseSchema is llmResponseSchema in the schema format of Gemini API, with upper-case types
+const geminiResponseSchema = `{"type":"OBJECT","properties":{` +
+	`"spam":{"type":"BOOLEAN","description":"true if the message is spam"},` +
+	`"reason":{"type":"STRING","description":"why this is spam or not"},` +
+	`"confidence":{"type":"INTEGER","description":"confidence of the decision, 1-100"}},` +
+	`"required":["spam","reason","confidence"]}`
+
+// LLMChecker is a language model backend of the openai check. It sends the system prompt and the message
+// to the model and returns the model's answer, expected to be a json with spam, reason and confidence fields.
+type LLMChecker interface {
+	Complete(ctx context.Context, req LLMRequest) (string, error)
+}
+
+// LLMRequest is a request to the language model
+type LLMRequest struct {
+	Model        string
+	SystemPrompt string
+	Message      string // user message, already reduced to the request limits
+	MaxTokens    int    // max tokens in the response
+	Examples     []LLMExample
+	Structured   bool // ask for the answer matching the response schema, with function calling or json schema
+}
+
+// LLMExample is a few-shot example, sent to the model as a previous message with the expected answer
+type LLMExample struct {
+	Message string
+	Answer  string
+}
+
+// OpenAILLM is an LLMChecker for OpenAI chat completions API and OpenAI-compatible servers, like llama.cpp or Ollama
+type OpenAILLM struct {
+	client openAIClient
+}
+
+// NewOpenAILLM makes an LLMChecker with OpenAI client. Base URL of the client should be set for OpenAI-compatible servers.
+func NewOpenAILLM(client openAIClient) *OpenAILLM {
+	return &OpenAILLM{client: client}
+}
+
+// Complete sends the request to chat completions API and returns the content of the first choice.
+// Structured request forces the call of spam_check function, and its arguments returned as the answer.
+func (o *OpenAILLM) Complete(ctx context.Context, req LLMRequest) (string, error) {
+	messages := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: req.SystemPrompt}}
+	for _, e := range req.Examples {
+		messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: e.Message},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: e.Answer})
+	}
+	messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: req.Message})
+
+	chatReq := openai.ChatCompletionRequest{Model: req.Model, MaxTokens: req.MaxTokens, Messages: messages}
+	if req.Structured {
+		chatReq.Tools = []openai.Tool{{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
+			Name: llmToolName, Description: "report the result of spam check", Parameters: json.RawMessage(llmResponseSchema)}}}
+		chatReq.ToolChoice = openai.ToolChoice{Type: openai.ToolTypeFunction, Function: openai.ToolFunction{Name: llmToolName}}
+	}
+
+	resp, err := o.client.CreateChatCompletion(ctx, chatReq)
+	if err != nil {
+		return "", err
+	}
+
+	// OpenAI platform supports returning multiple chat completion choices, but we use only the first one:
+	// https://platform.openai.com/docs/api-reference/chat/create#chat/create-n
+	if len(resp.Choices) == 0 {
+		return "", errors.New("no choices in response")
+	}
+	msg := resp.Choices[0].Message
+	if len(msg.ToolCalls) > 0 {
+		return msg.ToolCalls[0].Function.Arguments, nil
+	}
+	return msg.Content, nil
+}
+
+// AnthropicLLM is an LLMChecker for Anthropic messages API
+type AnthropicLLM struct {
+	client  HTTPClient
+	baseURL string
+	token   string
+}
+
+// NewAnthropicLLM makes an LLMChecker for Anthropic messages API. Empty base URL means the default API URL.
+func NewAnthropicLLM(client HTTPClient, baseURL, token string) *AnthropicLLM {
+	if baseURL == "" {
+		baseURL = anthropicAPIURL
+	}
+	return &AnthropicLLM{client: client, baseURL: strings.TrimSuffix(baseURL, "/"), token: token}
+}
+
+// Complete sends the request to messages API and returns the text of the response.
+// Structured request forces the use of spam_check tool, and its input returned as the answer.
+func (a *AnthropicLLM) Complete(ctx context.Context, req LLMRequest) (string, error) {
+	type message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	type tool struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description"`
+		InputSchema json.RawMessage `json:"input_schema"`
+	}
+	type toolChoice struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}
+	body := struct {
+		Model      string      `json:"model"`
+		MaxTokens  int         `json:"max_tokens"`
+		System     string      `json:"system,omitempty"`
+		Messages   []message   `json:"messages"`
+		Tools      []tool      `json:"tools,omitempty"`
+		ToolChoice *toolChoice `json:"tool_choice,omitempty"`
+	}{Model: req.Model, MaxTokens: req.MaxTokens, System: req.SystemPrompt}
+	for _, e := range req.Examples {
+		body.Messages = append(body.Messages, message{Role: "user", Content: e.Message}, message{Role: "assistant", Content: e.Answer})
+	}
+	body.Messages = append(body.Messages, message{Role: "user", Content: req.Message})
+	if req.Structured {
+		body.Tools = []tool{{Name: llmToolName, Description: "report the result of spam check",
+			InputSchema: json.RawMessage(llmResponseSchema)}}
+		body.ToolChoice = &toolChoice{Type: "tool", Name: llmToolName}
+	}
+
+	var resp struct {
+		Content []struct {
+			Type  string          `json:"type"`
+			Text  string          `json:"text"`
+			Input json.RawMessage `json:"input"`
+		} `json:"content"`
+	}
+	headers := map[string]string{"x-api-key": a.token, "anthropic-version": anthropicVersion}
+	if err := postJSON(ctx, a.client, a.baseURL+"/v1/messages", headers, body, &resp); err != nil {
+		return "", err
+	}
+
+	res := strings.Builder{}
+	for _, c := range resp.Content {
+		switch c.Type {
+		case "tool_use":
+			return string(c.Input), nil
+		case "text":
+			res.WriteString(c.Text)
+		}
+	}
+	if res.Len() == 0 {
+		return "", errors.New("no text in response")
+	}
+	return res.String(), nil
+}
+
+// GeminiLLM is an LLMChecker for Gemini generate content API
+type GeminiLLM struct {
+	client  HTTPClient
+	baseURL string
+	token   string
+}
+
+// NewGeminiLLM makes an LLMChecker for Gemini generate content API. Empty base URL means the default API URL.
+func NewGeminiLLM(client HTTPClient, baseURL, token string) *GeminiLLM {
+	if baseURL == "" {
+		baseURL = geminiAPIURL
+	}
+	return &GeminiLLM{client: client, baseURL: strings.TrimSuffix(baseURL, "/"), token: token}
+}
+
+// Complete sends the request to generate content API and returns the text of the first candidate.
+// Structured request asks for json response with the response schema.
+func (g *GeminiLLM) Complete(ctx context.Context, req LLMRequest) (string, error) {
+	type part struct {
+		Text string `json:"text"`
+	}
+	type content struct {
+		Role  string `json:"role,omitempty"`
+		Parts []part `json:"parts"`
+	}
+	body := struct {
+		SystemInstruction *content  `json:"system_instruction,omitempty"`
+		Contents          []content `json:"contents"`
+		GenerationConfig  struct {
+			MaxOutputTokens  int             `json:"maxOutputTokens,omitempty"`
+			ResponseMimeType string          `json:"responseMimeType,omitempty"`
+			ResponseSchema   json.RawMessage `json:"responseSchema,omitempty"`
+		} `json:"generationConfig"`
+	}{}
+	for _, e := range req.Examples {
+		body.Contents = append(body.Contents, content{Role: "user", Parts: []part{{Text: e.Message}}},
+			content{Role: "model", Parts: []part{{Text: e.Answer}}})
+	}
+	body.Contents = append(body.Contents, content{Role: "user", Parts: []part{{Text: req.Message}}})
+	if req.SystemPrompt != "" {
+		body.SystemInstruction = &content{Parts: []part{{Text: req.SystemPrompt}}}
+	}
+	body.GenerationConfig.MaxOutputTokens = req.MaxTokens
+	if req.Structured {
+		body.GenerationConfig.ResponseMimeType = "application/json"
+		body.GenerationConfig.ResponseSchema = json.RawMessage(geminiResponseSchema)
+	}
+
+	var resp struct {
+		Candidates []struct {
+			Content content `json:"content"`
+		} `json:"candidates"`
+	}
+	apiURL := fmt.Sprintf("%s/v1beta/models/%s:generateContent", g.baseURL, url.PathEscape(req.Model))
+	if err := postJSON(ctx, g.client, apiURL, map[string]string{"x-goog-api-key": g.token}, body, &resp); err != nil {
+		return "", err
+	}
+
+	if len(resp.Candidates) == 0 {
+		return "", errors.New("no candidates in response")
+	}
+	res := strings.Builder{}
+	for _, p := range resp.Candidates[0].Content.Parts {
+		res.WriteString(p.Text)
+	}
+	return res.String(), nil
+}
+
+// LLMStatusError is returned by LLMChecker on non-2xx response status of llm api
+type LLMStatusError struct {
+	StatusCode int
+	Message    string // response body, truncated
+}
+
+func (e *LLMStatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, e.Message)
+}
+
+// postJSON sends the request body as json to the url and decodes json response to resp.
+// Responses with non-2xx status returned as *LLMStatusError with the response body.
+func postJSON(ctx context.Context, client HTTPClient, apiURL string, headers map[string]string, body, resp any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("can't marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("can't make request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	httpResp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("can't send request: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	respData, err := io.ReadAll(io.LimitReader(httpResp.Body, maxLLMRespSize))
+	if err != nil {
+		return fmt.Errorf("can't read response: %w", err)
+	}
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 {
+		msg := strings.TrimSpace(string(respData))
+		if len(msg) > 256 {
+			msg = msg[:256] + "..."
+		}
+		return &LLMStatusError{StatusCode: httpResp.StatusCode, Message: msg}
+	}
+	if err := json.Unmarshal(respData, resp); err != nil {
+		return fmt.Errorf("can't unmarshal response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package tgspam
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+// DefaultMessageTemplate is a template of the message sent to the language model with the user and chat context.
+// See llmMessageData for the fields available in the template.
+const DefaultMessageTemplate = `{{if .ChatDescription}}Chat: {{.ChatDescription}}
+{{end}}User: {{.DisplayName}}{{if .UserName}} (@{{.UserName}}){{end}}
+{{- if .AccountYear}}, account registered around {{.AccountYear}}{{end}}
+{{if .Links}}Links in the message: {{.Links}}
+{{end}}{{if .Images}}Images in the message: {{.Images}}
+{{end}}{{if .Forwarded}}The message is forwarded from a channel
+{{end}}{{if .History}}Previous messages of the user:
+{{range .History}}- {{.}}
+{{end}}{{end}}Message to check:
+{{.Message}}`
+
+const maxHistorySymbols = 256 // max length of each previous message of the user sent to the language model
+
+// llmMessageData is the data of the message template
+type llmMessageData struct {
+	Message         string   // text of the message, reduced to the request limits
+	UserID          string   // user id
+	UserName        string   // user name, without @
+	DisplayName     string   // user's display name, i.e. first and last name
+	AccountYear     int      // estimated year of the account registration, 0 if unknown
+	Links           int      // number of links in the message
+	HiddenLinks     []string // targets of text links
+	ButtonLinks     []string // urls of inline keyboard buttons
+	Images          int      // number of images in the message
+	Forwarded       bool     // the message is forwarded from a channel
+	ChatDescription string   // description of the chat (group) topic
+	History         []string // previous messages of the user, oldest first
+}
+
+// accountYears maps the lower bound of telegram user ids to the year such ids were given out.
+// User ids are assigned sequentially, so the id is a rough estimate of the account age. Spammers often use new accounts.
+var accountYears = []struct {
+	minID int64
+	year  int
+}{
+	{8_000_000_000, 2025}, {7_000_000_000, 2024}, {6_000_000_000, 2023}, {5_000_000_000, 2022}, {2_000_000_000, 2021},
+	{1_500_000_000, 2020}, {1_000_000_000, 2019}, {500_000_000, 2018}, {300_000_000, 2017}, {200_000_000, 2016},
+	{100_000_000, 2015}, {1, 2014},
+}
+
+// accountYear returns estimated year of the account registration by telegram user id, 0 for non-numeric or non-user ids.
+// Accounts with ids below the first known bound are reported as registered in 2014, i.e. "2014 or earlier".
+func accountYear(userID string) int {
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil || id <= 0 {
+		return 0
+	}
+	for _, ay := range accountYears {
+		if id >= ay.minID {
+			return ay.year
+		}
+	}
+	return 0
+}
+
+// parseMessageTemplate parses the message template, empty template means the message sent without context
+func parseMessageTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	res, err := template.New("message").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse message template: %w", err)
+	}
+	return res, nil
+}
+
+// renderMessage makes the message for the language model from the request with the template.
+// The text of the message, already reduced to the request limits, is passed separately.
+func renderMessage(tmpl *template.Template, req spamcheck.Request, text, chatDescription string) (string, error) {
+	if tmpl == nil {
+		return text, nil
+	}
+	data := llmMessageData{
+		Message:         text,
+		UserID:          req.UserID,
+		UserName:        strings.TrimPrefix(req.UserName, "@"),
+		DisplayName:     req.DisplayName,
+		AccountYear:     accountYear(req.UserID),
+		Links:           req.Meta.Links,
+		HiddenLinks:     req.Meta.HiddenLinks,
+		ButtonLinks:     req.Meta.ButtonLinks,
+		Images:          req.Meta.Images,
+		Forwarded:       req.Meta.ForwardedFrom != 0,
+		ChatDescription: chatDescription,
+	}
+	for _, h := range req.History {
+		h = strings.Join(strings.Fields(h), " ") // one line per message
+		if r := []rune(h); len(r) > maxHistorySymbols {
+			h = string(r[:maxHistorySymbols]) + "..."
+		}
+		if h != "" {
+			data.History = append(data.History, h)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("can't execute message template: %w", err)
+	}
+	return buf.String(), nil
+}
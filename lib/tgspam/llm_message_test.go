@@ -0,0 +1,102 @@
+package tgspam
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+func Test_renderMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		tmpl        string
+		req         spamcheck.Request
+		description string
+		expected    string
+	}{
+		{name: "no template", req: spamcheck.Request{Msg: "full text", UserName: "user"}, expected: "reduced text"},
+		{name: "default template, no context", tmpl: DefaultMessageTemplate, req: spamcheck.Request{Msg: "full text"},
+			expected: "User: \nMessage to check:\nreduced text"},
+		{name: "default template, full context", tmpl: DefaultMessageTemplate,
+			req: spamcheck.Request{Msg: "full text", UserID: "7100000000", UserName: "user", DisplayName: "John Doe",
+				Meta:    spamcheck.MetaData{Links: 2, Images: 1, ForwardedFrom: -100123},
+				History: []string{"hello\n all", " ", strings.Repeat("a", 300)}},
+			description: "golang developers",
+			expected: "Chat: golang developers\nUser: John Doe (@user), account registered around 2024\n" +
+				"Links in the message: 2\nImages in the message: 1\nThe message is forwarded from a channel\n" +
+				"Previous messages of the user:\n- hello all\n- " + strings.Repeat("a", 256) + "...\n" +
+				"Message to check:\nreduced text"},
+		{name: "custom template", tmpl: `{{.UserID}} {{.UserName}} {{.AccountYear}} {{.HiddenLinks}} {{.ButtonLinks}}: {{.Message}}`,
+			req: spamcheck.Request{Msg: "full text", UserID: "12345", UserName: "@user",
+				Meta: spamcheck.MetaData{HiddenLinks: []string{"http://a.com"}, ButtonLinks: []string{"http://b.com"}}},
+			expected: "12345 user 2014 [http://a.com] [http://b.com]: reduced text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseMessageTemplate(tt.tmpl)
+			require.NoError(t, err)
+			res, err := renderMessage(tmpl, tt.req, "reduced text", tt.description)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, res)
+		})
+	}
+
+	t.Run("bad template", func(t *testing.T) {
+		_, err := parseMessageTemplate("{{.Message")
+		require.Error(t, err)
+		tmpl, err := parseMessageTemplate("{{.Unknown}}")
+		require.NoError(t, err)
+		_, err = renderMessage(tmpl, spamcheck.Request{}, "text", "")
+		require.Error(t, err)
+	})
+}
+
+func Test_accountYear(t *testing.T) {
+	tests := []struct {
+		id   string
+		year int
+	}{
+		{"", 0}, {"abc", 0}, {"-100123", 0}, {"0", 0}, {"1", 2014}, {"123456", 2014}, {"150000000", 2015},
+		{"1200000000", 2019}, {"5500000000", 2022}, {"7999999999", 2024}, {"8200000000", 2025},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.year, accountYear(tt.id), tt.id)
+	}
+}
+
+func TestOpenAIChecker_CheckWithContext(t *testing.T) {
+	var reqs []LLMRequest
+	llm := llmFunc(func(_ context.Context, req LLMRequest) (string, error) {
+		reqs = append(reqs, req)
+		return `{"spam": true, "reason":"bad text", "confidence":90}`, nil
+	})
+
+	checker := newOpenAIChecker(llm, OpenAIConfig{MessageTemplate: "{{.ChatDescription}}, {{.DisplayName}}: {{.Message}}",
+		ChatDescription: "cats"})
+	spam, _ := checker.check(spamcheck.Request{Msg: "some text", DisplayName: "John"})
+	assert.True(t, spam)
+	require.Len(t, reqs, 1)
+	assert.Equal(t, "cats, John: some text", reqs[0].Message)
+
+	t.Run("bad template", func(t *testing.T) {
+		reqs = nil
+		checker := newOpenAIChecker(llm, OpenAIConfig{MessageTemplate: "{{.Message"})
+		checker.check(spamcheck.Request{Msg: "some text", DisplayName: "John"})
+		require.Len(t, reqs, 1)
+		assert.Equal(t, "some text", reqs[0].Message, "sent without context")
+	})
+
+	t.Run("template execution failed", func(t *testing.T) {
+		reqs = nil
+		checker := newOpenAIChecker(llm, OpenAIConfig{MessageTemplate: "{{.Unknown}}"})
+		checker.check(spamcheck.Request{Msg: "some text"})
+		require.Len(t, reqs, 1)
+		assert.Equal(t, "some text", reqs[0].Message, "sent without context")
+	})
+}
@@ -0,0 +1,182 @@
+package tgspam
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/tgspam/mocks"
+)
+
+func TestOpenAILLM_Complete(t *testing.T) {
+	clientMock := &mocks.OpenAIClientMock{
+		CreateChatCompletionFunc: func(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+			return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+				Message: openai.ChatCompletionMessage{Content: `{"spam": true}`}}}}, nil
+		},
+	}
+	llm := NewOpenAILLM(clientMock)
+	res, err := llm.Complete(context.Background(), LLMRequest{Model: "gpt-4o", SystemPrompt: "prompt", Message: "text", MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, `{"spam": true}`, res)
+	require.Len(t, clientMock.CreateChatCompletionCalls(), 1)
+	req := clientMock.CreateChatCompletionCalls()[0].ChatCompletionRequest
+	assert.Equal(t, "gpt-4o", req.Model)
+	assert.Equal(t, 100, req.MaxTokens)
+	assert.Equal(t, []openai.ChatCompletionMessage{{Role: "system", Content: "prompt"}, {Role: "user", Content: "text"}}, req.Messages)
+
+	clientMock.CreateChatCompletionFunc = func(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+		return openai.ChatCompletionResponse{}, nil
+	}
+	_, err = llm.Complete(context.Background(), LLMRequest{})
+	require.EqualError(t, err, "no choices in response")
+
+	t.Run("structured with examples", func(t *testing.T) {
+		clientMock.CreateChatCompletionFunc = func(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+			return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{
+				ToolCalls: []openai.ToolCall{{Function: openai.FunctionCall{Name: llmToolName, Arguments: `{"spam":false}`}}}}}}}, nil
+		}
+		res, err := llm.Complete(context.Background(), LLMRequest{SystemPrompt: "prompt", Message: "text", Structured: true,
+			Examples: []LLMExample{{Message: "spam msg", Answer: `{"spam":true}`}}})
+		require.NoError(t, err)
+		assert.Equal(t, `{"spam":false}`, res)
+		calls := clientMock.CreateChatCompletionCalls()
+		req := calls[len(calls)-1].ChatCompletionRequest
+		assert.Equal(t, []openai.ChatCompletionMessage{{Role: "system", Content: "prompt"}, {Role: "user", Content: "spam msg"},
+			{Role: "assistant", Content: `{"spam":true}`}, {Role: "user", Content: "text"}}, req.Messages)
+		require.Len(t, req.Tools, 1)
+		assert.Equal(t, llmToolName, req.Tools[0].Function.Name)
+		assert.JSONEq(t, llmResponseSchema, string(req.Tools[0].Function.Parameters.(json.RawMessage)))
+		assert.Equal(t, openai.ToolChoice{Type: openai.ToolTypeFunction, Function: openai.ToolFunction{Name: llmToolName}}, req.ToolChoice)
+	})
+}
+
+func TestAnthropicLLM_Complete(t *testing.T) {
+	var reqBody map[string]any
+	var reqHeader http.Header
+	var reqPath string
+	status, respBody := http.StatusOK, `{"content":[{"type":"text","text":"{\"spam\": true}"}]}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqPath, reqHeader = r.URL.Path, r.Header
+		data, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(data, &reqBody)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(respBody))
+	}))
+	defer ts.Close()
+
+	llm := NewAnthropicLLM(http.DefaultClient, ts.URL+"/", "secret")
+	res, err := llm.Complete(context.Background(), LLMRequest{Model: "claude-3-haiku", SystemPrompt: "prompt", Message: "text",
+		MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, `{"spam": true}`, res)
+	assert.Equal(t, "/v1/messages", reqPath)
+	assert.Equal(t, "secret", reqHeader.Get("x-api-key"))
+	assert.Equal(t, anthropicVersion, reqHeader.Get("anthropic-version"))
+	assert.Equal(t, map[string]any{"model": "claude-3-haiku", "max_tokens": float64(100), "system": "prompt",
+		"messages": []any{map[string]any{"role": "user", "content": "text"}}}, reqBody)
+
+	t.Run("error status", func(t *testing.T) {
+		status, respBody = http.StatusUnauthorized, `{"type":"error","error":{"type":"authentication_error"}}`
+		_, err := llm.Complete(context.Background(), LLMRequest{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unexpected status 401")
+		assert.Contains(t, err.Error(), "authentication_error")
+	})
+
+	t.Run("no text", func(t *testing.T) {
+		status, respBody = http.StatusOK, `{"content":[]}`
+		_, err := llm.Complete(context.Background(), LLMRequest{})
+		require.EqualError(t, err, "no text in response")
+	})
+
+	t.Run("structured with examples", func(t *testing.T) {
+		status, respBody = http.StatusOK, `{"content":[{"type":"tool_use","name":"spam_check","input":{"spam":true,"confidence":90}}]}`
+		res, err := llm.Complete(context.Background(), LLMRequest{Message: "text", Structured: true,
+			Examples: []LLMExample{{Message: "ham msg", Answer: `{"spam":false}`}}})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"spam":true,"confidence":90}`, res)
+		assert.Equal(t, []any{map[string]any{"role": "user", "content": "ham msg"},
+			map[string]any{"role": "assistant", "content": `{"spam":false}`},
+			map[string]any{"role": "user", "content": "text"}}, reqBody["messages"])
+		assert.Equal(t, map[string]any{"type": "tool", "name": llmToolName}, reqBody["tool_choice"])
+		tools := reqBody["tools"].([]any)
+		require.Len(t, tools, 1)
+		assert.Equal(t, llmToolName, tools[0].(map[string]any)["name"])
+		assert.NotEmpty(t, tools[0].(map[string]any)["input_schema"])
+	})
+
+	assert.Equal(t, anthropicAPIURL, NewAnthropicLLM(http.DefaultClient, "", "secret").baseURL, "default url")
+}
+
+func TestGeminiLLM_Complete(t *testing.T) {
+	var reqBody map[string]any
+	var reqHeader http.Header
+	var reqPath string
+	status, respBody := http.StatusOK, `{"candidates":[{"content":{"role":"model","parts":[{"text":"{\"spam\":"},{"text":" false}"}]}}]}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqPath, reqHeader = r.URL.Path, r.Header
+		data, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(data, &reqBody)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(respBody))
+	}))
+	defer ts.Close()
+
+	llm := NewGeminiLLM(http.DefaultClient, ts.URL, "secret")
+	res, err := llm.Complete(context.Background(), LLMRequest{Model: "gemini-1.5-flash", SystemPrompt: "prompt", Message: "text",
+		MaxTokens: 100})
+	require.NoError(t, err)
+	assert.Equal(t, `{"spam": false}`, res)
+	assert.Equal(t, "/v1beta/models/gemini-1.5-flash:generateContent", reqPath)
+	assert.Equal(t, "secret", reqHeader.Get("x-goog-api-key"))
+	assert.Equal(t, map[string]any{
+		"system_instruction": map[string]any{"parts": []any{map[string]any{"text": "prompt"}}},
+		"contents":           []any{map[string]any{"role": "user", "parts": []any{map[string]any{"text": "text"}}}},
+		"generationConfig":   map[string]any{"maxOutputTokens": float64(100)},
+	}, reqBody)
+
+	t.Run("error status", func(t *testing.T) {
+		status, respBody = http.StatusBadRequest, `{"error":{"code":400,"message":"bad model"}}`
+		_, err := llm.Complete(context.Background(), LLMRequest{Model: "bad"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unexpected status 400")
+		assert.Contains(t, err.Error(), "bad model")
+	})
+
+	t.Run("no candidates", func(t *testing.T) {
+		status, respBody = http.StatusOK, `{"candidates":[]}`
+		_, err := llm.Complete(context.Background(), LLMRequest{})
+		require.EqualError(t, err, "no candidates in response")
+	})
+
+	t.Run("structured with examples", func(t *testing.T) {
+		status, respBody = http.StatusOK, `{"candidates":[{"content":{"role":"model","parts":[{"text":"{\"spam\":true}"}]}}]}`
+		res, err := llm.Complete(context.Background(), LLMRequest{Model: "gemini", Message: "text", Structured: true,
+			Examples: []LLMExample{{Message: "ham msg", Answer: `{"spam":false}`}}})
+		require.NoError(t, err)
+		assert.Equal(t, `{"spam":true}`, res)
+		assert.Equal(t, []any{
+			map[string]any{"role": "user", "parts": []any{map[string]any{"text": "ham msg"}}},
+			map[string]any{"role": "model", "parts": []any{map[string]any{"text": `{"spam":false}`}}},
+			map[string]any{"role": "user", "parts": []any{map[string]any{"text": "text"}}},
+		}, reqBody["contents"])
+		genConfig := reqBody["generationConfig"].(map[string]any)
+		assert.Equal(t, "application/json", genConfig["responseMimeType"])
+		assert.Equal(t, "OBJECT", genConfig["responseSchema"].(map[string]any)["type"])
+	})
+
+	t.Run("bad json", func(t *testing.T) {
+		status, respBody = http.StatusOK, `{"candidates":`
+		_, err := llm.Complete(context.Background(), LLMRequest{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "can't unmarshal response")
+	})
+}
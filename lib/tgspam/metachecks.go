@@ -3,6 +3,7 @@ package tgspam
 import (
 	"fmt"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/umputun/tg-spam/lib/spamcheck"
@@ -71,3 +72,38 @@ func ImagesCheck() MetaCheck {
 		return spamcheck.Response{Spam: false, Name: "images", Details: "no images without text"}
 	}
 }
+
+// HiddenLinksCheck is a function that returns a MetaCheck function that checks links not visible in the message text,
+// i.e. targets of text links and urls of inline keyboard buttons. The message is spam if there are more such links than the limit.
+func HiddenLinksCheck(limit int) MetaCheck {
+	return func(req spamcheck.Request) spamcheck.Response {
+		links := len(req.Meta.HiddenLinks) + len(req.Meta.ButtonLinks)
+		if links > limit {
+			return spamcheck.Response{
+				Name:    "hidden-links",
+				Spam:    true,
+				Details: fmt.Sprintf("too many hidden links %d/%d", links, limit),
+			}
+		}
+		return spamcheck.Response{Spam: false, Name: "hidden-links", Details: fmt.Sprintf("hidden links %d/%d", links, limit)}
+	}
+}
+
+// ForwardCheck is a function that returns a MetaCheck function that checks if the message forwarded from a channel.
+// If channels are provided, only forwards from these channels are spam, otherwise forward from any channel is.
+// Forwards from groups and users are not checked, the client sets MetaData.ForwardedFrom for channels only.
+func ForwardCheck(channels ...int64) MetaCheck {
+	return func(req spamcheck.Request) spamcheck.Response {
+		if req.Meta.ForwardedFrom == 0 {
+			return spamcheck.Response{Spam: false, Name: "forward", Details: "not forwarded"}
+		}
+		if len(channels) > 0 && !slices.Contains(channels, req.Meta.ForwardedFrom) {
+			return spamcheck.Response{Spam: false, Name: "forward", Details: fmt.Sprintf("forwarded from %d", req.Meta.ForwardedFrom)}
+		}
+		return spamcheck.Response{
+			Name:    "forward",
+			Spam:    true,
+			Details: fmt.Sprintf("forwarded from channel %d", req.Meta.ForwardedFrom),
+		}
+	}
+}
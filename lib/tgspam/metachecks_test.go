@@ -185,3 +185,83 @@ func TestImagesCheck(t *testing.T) {
 		})
 	}
 }
+
+func TestHiddenLinksCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		meta     spamcheck.MetaData
+		limit    int
+		expected spamcheck.Response
+	}{
+		{
+			name:     "no hidden links",
+			meta:     spamcheck.MetaData{Links: 2},
+			limit:    0,
+			expected: spamcheck.Response{Name: "hidden-links", Spam: false, Details: "hidden links 0/0"},
+		},
+		{
+			name:     "text link below limit",
+			meta:     spamcheck.MetaData{Links: 1, HiddenLinks: []string{"https://example.com"}},
+			limit:    1,
+			expected: spamcheck.Response{Name: "hidden-links", Spam: false, Details: "hidden links 1/1"},
+		},
+		{
+			name:     "text link and button above limit",
+			meta:     spamcheck.MetaData{HiddenLinks: []string{"https://example.com"}, ButtonLinks: []string{"https://t.me/spam"}},
+			limit:    1,
+			expected: spamcheck.Response{Name: "hidden-links", Spam: true, Details: "too many hidden links 2/1"},
+		},
+		{
+			name:     "button only",
+			meta:     spamcheck.MetaData{ButtonLinks: []string{"https://t.me/spam"}},
+			limit:    0,
+			expected: spamcheck.Response{Name: "hidden-links", Spam: true, Details: "too many hidden links 1/0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := HiddenLinksCheck(tt.limit)
+			assert.Equal(t, tt.expected, check(spamcheck.Request{Msg: "some text", Meta: tt.meta}))
+		})
+	}
+}
+
+func TestForwardCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels []int64
+		from     int64
+		expected spamcheck.Response
+	}{
+		{
+			name:     "not forwarded",
+			from:     0,
+			expected: spamcheck.Response{Name: "forward", Spam: false, Details: "not forwarded"},
+		},
+		{
+			name:     "forwarded from any channel",
+			from:     -100123,
+			expected: spamcheck.Response{Name: "forward", Spam: true, Details: "forwarded from channel -100123"},
+		},
+		{
+			name:     "forwarded from listed channel",
+			channels: []int64{-100456, -100123},
+			from:     -100123,
+			expected: spamcheck.Response{Name: "forward", Spam: true, Details: "forwarded from channel -100123"},
+		},
+		{
+			name:     "forwarded from not listed channel",
+			channels: []int64{-100456},
+			from:     -100123,
+			expected: spamcheck.Response{Name: "forward", Spam: false, Details: "forwarded from -100123"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := ForwardCheck(tt.channels...)
+			assert.Equal(t, tt.expected, check(spamcheck.Request{Msg: "some text", Meta: spamcheck.MetaData{ForwardedFrom: tt.from}}))
+		})
+	}
+}
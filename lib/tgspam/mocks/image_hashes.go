@@ -0,0 +1,77 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package mocks
+
+import (
+	"sync"
+)
+
+// ImageHashesMock is a mock implementation of tgspam.ImageHashes.
+//
+//	func TestSomethingThatUsesImageHashes(t *testing.T) {
+//
+//		// make and configure a mocked tgspam.ImageHashes
+//		mockedImageHashes := &ImageHashesMock{
+//			HashesFunc: func() ([]uint64, error) {
+//				panic("mock out the Hashes method")
+//			},
+//		}
+//
+//		// use mockedImageHashes in code that requires tgspam.ImageHashes
+//		// and then make assertions.
+//
+//	}
+type ImageHashesMock struct {
+	// HashesFunc mocks the Hashes method.
+	HashesFunc func() ([]uint64, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Hashes holds details about calls to the Hashes method.
+		Hashes []struct {
+		}
+	}
+	lockHashes sync.RWMutex
+}
+
+// Hashes calls HashesFunc.
+func (mock *ImageHashesMock) Hashes() ([]uint64, error) {
+	if mock.HashesFunc == nil {
+		panic("ImageHashesMock.HashesFunc: method is nil but ImageHashes.Hashes was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockHashes.Lock()
+	mock.calls.Hashes = append(mock.calls.Hashes, callInfo)
+	mock.lockHashes.Unlock()
+	return mock.HashesFunc()
+}
+
+// HashesCalls gets all the calls that were made to Hashes.
+// Check the length with:
+//
+//	len(mockedImageHashes.HashesCalls())
+func (mock *ImageHashesMock) HashesCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockHashes.RLock()
+	calls = mock.calls.Hashes
+	mock.lockHashes.RUnlock()
+	return calls
+}
+
+// ResetHashesCalls reset all the calls that were made to Hashes.
+func (mock *ImageHashesMock) ResetHashesCalls() {
+	mock.lockHashes.Lock()
+	mock.calls.Hashes = nil
+	mock.lockHashes.Unlock()
+}
+
+// ResetCalls reset all the calls that were made to all mocked methods.
+func (mock *ImageHashesMock) ResetCalls() {
+	mock.lockHashes.Lock()
+	mock.calls.Hashes = nil
+	mock.lockHashes.Unlock()
+}
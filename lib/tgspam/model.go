@@ -0,0 +1,109 @@
+package tgspam
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// modelVersion is a version of the model snapshot format, snapshots of other versions are ignored
+const modelVersion = 2
+
+// ErrModelOutdated is returned by LoadModel if the snapshot made by a different version or from different samples
+var ErrModelOutdated = errors.New("model snapshot outdated")
+
+// modelSnapshot is a serialized state of the detector learned from samples: tokenized spam samples
+// used by the similarity check, excluded tokens and the classifier's counts
+type modelSnapshot struct {
+	Version     int
+	Fingerprint string        // fingerprint of the samples the model learned from, set by the caller
+	Tokenizer   TokenizerType // tokenizer used for learning, the model can't be used with a different one
+	LoadResult  LoadResult
+
+	ExcludedTokens     []string
+	TokenizedSpam      []map[string]int
+	LearningResults    map[string]map[spamClass]int
+	PriorProbabilities map[spamClass]float64
+	NDocumentByClass   map[spamClass]int
+	NFrequencyByClass  map[spamClass]int
+	NAllDocument       int
+}
+
+// SaveModel writes a snapshot of the learned model to the writer. The fingerprint identifies the samples
+// the model learned from and checked by LoadModel, so the outdated snapshot is not loaded.
+func (d *Detector) SaveModel(w io.Writer, fingerprint string) error {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	snapshot := modelSnapshot{
+		Version:            modelVersion,
+		Fingerprint:        fingerprint,
+		Tokenizer:          d.Tokenizer,
+		LoadResult:         d.samplesResult,
+		ExcludedTokens:     d.excludedTokens,
+		TokenizedSpam:      d.tokenizedSpam,
+		LearningResults:    d.classifier.learningResults,
+		PriorProbabilities: d.classifier.priorProbabilities,
+		NDocumentByClass:   d.classifier.nDocumentByClass,
+		NFrequencyByClass:  d.classifier.nFrequencyByClass,
+		NAllDocument:       d.classifier.nAllDocument,
+	}
+	if err := gob.NewEncoder(w).Encode(snapshot); err != nil {
+		return fmt.Errorf("can't encode model: %w", err)
+	}
+	return nil
+}
+
+// LoadModel loads a snapshot of the learned model from the reader, replacing the one learned from samples.
+// Returns ErrModelOutdated if the snapshot's version or fingerprint doesn't match, the detector is not changed in this case.
+func (d *Detector) LoadModel(r io.Reader, fingerprint string) (LoadResult, error) {
+	var snapshot modelSnapshot
+	if err := gob.NewDecoder(r).Decode(&snapshot); err != nil {
+		return LoadResult{}, fmt.Errorf("can't decode model: %w", err)
+	}
+	if snapshot.Version != modelVersion {
+		return LoadResult{}, fmt.Errorf("%w: version %d, expected %d", ErrModelOutdated, snapshot.Version, modelVersion)
+	}
+	if snapshot.Fingerprint != fingerprint {
+		return LoadResult{}, fmt.Errorf("%w: fingerprint mismatch", ErrModelOutdated)
+	}
+	if snapshot.Tokenizer != d.Tokenizer {
+		return LoadResult{}, fmt.Errorf("%w: tokenizer %q, expected %q", ErrModelOutdated, snapshot.Tokenizer, d.Tokenizer)
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.excludedTokens = nonNil(snapshot.ExcludedTokens)
+	d.tokenizedSpam = nonNil(snapshot.TokenizedSpam)
+	d.spamIndex.reset()
+	for _, spam := range d.tokenizedSpam {
+		d.spamIndex.add(spam)
+	}
+	d.classifier = classifier{
+		learningResults:    nonNilMap(snapshot.LearningResults),
+		priorProbabilities: nonNilMap(snapshot.PriorProbabilities),
+		nDocumentByClass:   nonNilMap(snapshot.NDocumentByClass),
+		nFrequencyByClass:  nonNilMap(snapshot.NFrequencyByClass),
+		nAllDocument:       snapshot.NAllDocument,
+	}
+	d.samplesResult = snapshot.LoadResult
+	d.loadLLMExamples()
+	return snapshot.LoadResult, nil
+}
+
+// nonNil returns an empty slice for nil, gob decodes empty slices as nil
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+// nonNilMap returns an empty map for nil, gob decodes empty maps as nil
+func nonNilMap[K comparable, V any](m map[K]V) map[K]V {
+	if m == nil {
+		return map[K]V{}
+	}
+	return m
+}
@@ -0,0 +1,88 @@
+package tgspam
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+	"github.com/umputun/tg-spam/lib/tgspam/mocks"
+)
+
+func TestDetector_SaveLoadModel(t *testing.T) {
+	makeDetector := func() *Detector {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.5})
+		d.WithSpamUpdater(&mocks.SampleUpdaterMock{AppendFunc: func(msg string) error { return nil }})
+		return d
+	}
+
+	orig := makeDetector()
+	_, err := orig.LoadSamples(strings.NewReader("xyz"),
+		[]io.Reader{strings.NewReader("win free iPhone\nlottery prize xyz")},
+		[]io.Reader{strings.NewReader("hello world\nhow are you\nhave a good day")})
+	require.NoError(t, err)
+	require.NoError(t, orig.UpdateSpam("cheap crypto signals"))
+
+	buf := bytes.Buffer{}
+	require.NoError(t, orig.SaveModel(&buf, "fp1"))
+	data := buf.Bytes()
+
+	t.Run("loaded model matches the original", func(t *testing.T) {
+		d := makeDetector()
+		lr, err := d.LoadModel(bytes.NewReader(data), "fp1")
+		require.NoError(t, err)
+		assert.Equal(t, LoadResult{ExcludedTokens: 1, SpamSamples: 3, HamSamples: 3}, lr)
+		assert.Equal(t, orig.classifier, d.classifier)
+		assert.Equal(t, orig.tokenizedSpam, d.tokenizedSpam)
+		assert.Equal(t, orig.excludedTokens, d.excludedTokens)
+
+		for _, msg := range []string{"win free iphone now", "cheap crypto signals here", "how are you, have a good day"} {
+			origSpam, origCr := orig.Check(spamcheck.Request{Msg: msg})
+			spam, cr := d.Check(spamcheck.Request{Msg: msg})
+			assert.Equal(t, origSpam, spam, msg)
+			assert.Equal(t, origCr, cr, msg)
+		}
+	})
+
+	t.Run("fingerprint mismatch", func(t *testing.T) {
+		d := makeDetector()
+		_, err := d.LoadModel(bytes.NewReader(data), "fp2")
+		require.ErrorIs(t, err, ErrModelOutdated)
+		assert.Equal(t, 0, d.classifier.nAllDocument, "not loaded")
+	})
+
+	t.Run("tokenizer mismatch", func(t *testing.T) {
+		d := NewDetector(Config{Tokenizer: TokenizerStem})
+		_, err := d.LoadModel(bytes.NewReader(data), "fp1")
+		require.ErrorIs(t, err, ErrModelOutdated)
+		assert.Equal(t, 0, d.classifier.nAllDocument, "not loaded")
+	})
+
+	t.Run("version mismatch", func(t *testing.T) {
+		old := bytes.Buffer{}
+		require.NoError(t, gob.NewEncoder(&old).Encode(modelSnapshot{Version: modelVersion + 1, Fingerprint: "fp1"}))
+		_, err := makeDetector().LoadModel(&old, "fp1")
+		require.ErrorIs(t, err, ErrModelOutdated)
+	})
+
+	t.Run("bad data", func(t *testing.T) {
+		_, err := makeDetector().LoadModel(strings.NewReader("not a model"), "fp1")
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrModelOutdated)
+	})
+
+	t.Run("empty model", func(t *testing.T) {
+		empty := bytes.Buffer{}
+		require.NoError(t, NewDetector(Config{}).SaveModel(&empty, "fp0"))
+		d := makeDetector()
+		_, err := d.LoadModel(&empty, "fp0")
+		require.NoError(t, err)
+		require.NoError(t, d.UpdateSpam("some spam text"), "maps initialized")
+		assert.Len(t, d.tokenizedSpam, 1)
+	})
+}
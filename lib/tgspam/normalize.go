@@ -0,0 +1,58 @@
+package tgspam
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// confusables maps lowercase letters looking like latin ones to their latin counterparts.
+// Cyrillic and greek lookalikes are mixed with latin letters to evade matching, e.g. "зaрaбoтoк" with latin "a" and "o".
+// Folding them both ways to the same letter makes such words match regardless of the script used for each letter.
+var confusables = map[rune]rune{
+	// cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'с': 'c', 'т': 't',
+	'у': 'y', 'х': 'x', 'і': 'i', 'ї': 'i', 'ј': 'j', 'ѕ': 's', 'ԁ': 'd', 'һ': 'h', 'ԛ': 'q', 'ԝ': 'w',
+	// greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u',
+	'χ': 'x', 'ω': 'w', 'ς': 'c', 'ϲ': 'c',
+}
+
+// leetspeak maps digits and symbols used in place of letters, e.g. "fr33 m0n3y"
+var leetspeak = map[rune]rune{'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '$': 's'}
+
+// normalize folds text to a canonical lowercase form, so obfuscated variants of the same words match each other.
+// It applies NFKC normalization (fullwidth and math alphanumeric letters to regular ones), strips zero-width,
+// formatting and combining characters, folds confusable letters of other scripts to latin ones, and maps leetspeak
+// in words starting with a letter. Words not starting with a letter, like "100$" or "2024", are not changed by
+// the leetspeak mapping. The result is not meant to be shown, it is used for matching only.
+func normalize(s string) string {
+	s = norm.NFKC.String(s)
+
+	var sb strings.Builder
+	sb.Grow(len(s))
+	wordStart, leet := true, false
+	for _, r := range strings.ToLower(s) {
+		if unicode.Is(unicode.Cf, r) || unicode.Is(unicode.Mn, r) {
+			continue // zero-width, formatting and combining characters
+		}
+		if unicode.IsSpace(r) {
+			sb.WriteRune(r)
+			wordStart, leet = true, false
+			continue
+		}
+		if wordStart && (unicode.IsLetter(r) || unicode.IsDigit(r)) { // leading punctuation doesn't start a word
+			leet = unicode.IsLetter(r)
+			wordStart = false
+		}
+		if c, ok := confusables[r]; ok {
+			r = c
+		}
+		if l, ok := leetspeak[r]; ok && leet {
+			r = l
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
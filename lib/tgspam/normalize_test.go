@@ -0,0 +1,35 @@
+package tgspam
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "empty", input: "", expected: ""},
+		{name: "plain latin", input: "Hello World", expected: "hello world"},
+		{name: "mixed cyrillic and latin", input: "Зaрaбoтoк", expected: normalize("заработок")},
+		{name: "cyrillic folded to latin", input: "работа", expected: "paбota"},
+		{name: "zero-width characters", input: "sp\u200bam fr\u200dee\u00ad \ufeffwin", expected: "spam free win"},
+		{name: "fullwidth letters", input: "ｆｒｅｅ ｍｏｎｅｙ", expected: "free money"},
+		{name: "math alphanumeric", input: "𝐟𝐫𝐞𝐞 𝓶𝓸𝓷𝓮𝔂", expected: "free money"},
+		{name: "combining marks", input: "s\u0336p\u0336a\u0336m\u0336", expected: "spam"},
+		{name: "leetspeak", input: "fr33 m0n3y, c4$h", expected: "free money, cash"},
+		{name: "leetspeak after punctuation", input: "(fr33)", expected: "(free)"},
+		{name: "numbers not changed", input: "100$ 2024 5000руб", expected: "100$ 2024 5000pyб"},
+		{name: "whitespace kept", input: "a\tb\nc", expected: "a\tb\nc"},
+		{name: "greek lookalikes", input: "ϲrурtο", expected: "crypto"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, normalize(tt.input))
+		})
+	}
+}
@@ -2,10 +2,19 @@ package tgspam
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 
+	lru "github.com/hashicorp/golang-lru/v2"
 	tokenizer "github.com/sandwich-go/gpt3-encoder"
 	"github.com/sashabaranov/go-openai"
 
@@ -14,10 +23,28 @@ import (
 
 //go:generate moq --out mocks/openai_client.go --pkg mocks --skip-ensure . openAIClient:OpenAIClientMock
 
-// openAIChecker is a wrapper for OpenAI API to check if a text is spam
+// openAIChecker checks if a text is spam with a language model, OpenAI by default.
+// The request is reduced to the configured limits and sent with the system prompt to LLMChecker.
+// Responses are cached by normalized message, so repeated spam waves cost one call, and calls are
+// limited by the daily budget.
 type openAIChecker struct {
-	client openAIClient
+	llm    LLMChecker
 	params OpenAIConfig
+	cache  *lru.Cache[string, openAIResponse] // nil if caching disabled
+	tmpl   *template.Template                 // message template, nil if the message sent without context
+
+	encoderOnce sync.Once
+	encoder     *tokenizer.Encoder // nil if tokenizer failed to load
+
+	examplesLock sync.RWMutex
+	spamExamples []string // recent confirmed spam samples, up to params.Examples
+	hamExamples  []string // recent confirmed ham samples, up to params.Examples
+
+	budgetLock sync.Mutex
+	budgetDay  string // day of the current budget counters, YYYY-MM-DD
+	dayCalls   int
+	dayTokens  int
+	now        func() time.Time
 }
 
 // OpenAIConfig contains parameters for openAIChecker
@@ -29,6 +56,22 @@ type OpenAIConfig struct {
 	MaxSymbolsRequest int // Fallback: Max request length in symbols, if tokenizer was failed
 	Model             string
 	SystemPrompt      string
+
+	Timeout         time.Duration // deadline of llm call, including retries, 30s by default
+	Retries         int           // number of retries on rate limit (429) and server (5xx) errors
+	RetryDelay      time.Duration // delay before the first retry, doubled on each next one, 1s by default
+	CacheSize       int           // max number of cached responses, 0 disables caching
+	MaxCallsPerDay  int           // daily limit of llm calls, the check is skipped after it reached. 0 means no limit
+	MaxTokensPerDay int           // daily limit of request and response tokens, 0 means no limit
+
+	Structured    bool // ask for structured answer with function calling or json schema, if supported by the backend
+	MinConfidence int  // min confidence of spam answer, 1-100. Spam answers with lower confidence are treated as ham
+	Examples      int  // number of recent confirmed spam and ham samples sent as few-shot examples, 0 disables
+
+	// MessageTemplate is a text/template of the message sent to the model, with the user and chat context.
+	// Empty template means only the text of the message sent. See DefaultMessageTemplate.
+	MessageTemplate string
+	ChatDescription string // description of the chat (group) topic, available in the message template
 }
 
 type openAIClient interface {
@@ -43,8 +86,8 @@ type openAIResponse struct {
 	Confidence int    `json:"confidence"`
 }
 
-// newOpenAIChecker makes a bot for ChatGPT
-func newOpenAIChecker(client openAIClient, params OpenAIConfig) *openAIChecker {
+// newOpenAIChecker makes a checker with the given language model backend
+func newOpenAIChecker(llm LLMChecker, params OpenAIConfig) *openAIChecker {
 	if params.SystemPrompt == "" {
 		params.SystemPrompt = defaultPrompt
 	}
@@ -60,24 +103,196 @@ func newOpenAIChecker(client openAIClient, params OpenAIConfig) *openAIChecker {
 	if params.Model == "" {
 		params.Model = "gpt-4"
 	}
-	return &openAIChecker{client: client, params: params}
+	if params.Timeout == 0 {
+		params.Timeout = 30 * time.Second
+	}
+	if params.RetryDelay == 0 {
+		params.RetryDelay = time.Second
+	}
+	res := &openAIChecker{llm: llm, params: params, now: time.Now}
+	tmpl, err := parseMessageTemplate(params.MessageTemplate)
+	if err != nil {
+		log.Printf("[WARN] openai message sent without context, %v", err)
+	}
+	res.tmpl = tmpl
+	if params.CacheSize > 0 {
+		res.cache, _ = lru.New[string, openAIResponse](params.CacheSize) // error only for non-positive size
+	}
+	return res
 }
 
-// check checks if a text is spam
-func (o *openAIChecker) check(msg string) (spam bool, cr spamcheck.Response) {
-	if o.client == nil {
+// check checks if a message is spam. The message is sent with the context made by the message template, if set.
+// Responses are cached by the text of the message along with its context, as the verdict depends on both.
+func (o *openAIChecker) check(req spamcheck.Request) (spam bool, cr spamcheck.Response) {
+	if o.llm == nil {
 		return false, spamcheck.Response{}
 	}
 
+	// verdict makes the check result from the model's answer, with the confidence threshold applied
+	verdict := func(resp openAIResponse, suffix string) (bool, spamcheck.Response) {
+		details := strings.TrimSuffix(resp.Reason, ".") + ", confidence: " + fmt.Sprintf("%d%%", resp.Confidence)
+		isSpam := resp.IsSpam
+		if isSpam && resp.Confidence < o.params.MinConfidence {
+			isSpam = false
+			details += fmt.Sprintf(", below %d%%", o.params.MinConfidence)
+		}
+		return isSpam, spamcheck.Response{Spam: isSpam, Name: "openai", Details: details + suffix}
+	}
+
+	msg := o.message(req)
+	key := cacheKey(req.Msg)
+	if o.tmpl != nil {
+		key += "/" + cacheKey(msg) // the same text from different users or chats may get a different verdict
+	}
+	if o.cache != nil {
+		if resp, ok := o.cache.Get(key); ok {
+			return verdict(resp, " (cached)")
+		}
+	}
+
+	if err := o.reserveCall(); err != nil {
+		return false, spamcheck.Response{Spam: false, Name: "openai", Details: fmt.Sprintf("%v, check skipped", err)}
+	}
+
 	resp, err := o.sendRequest(msg)
 	if err != nil {
 		return false, spamcheck.Response{Spam: false, Name: "openai", Details: fmt.Sprintf("OpenAI error: %v", err)}
 	}
-	return resp.IsSpam, spamcheck.Response{Spam: resp.IsSpam, Name: "openai",
-		Details: strings.TrimSuffix(resp.Reason, ".") + ", confidence: " + fmt.Sprintf("%d%%", resp.Confidence)}
+	if o.cache != nil {
+		o.cache.Add(key, resp)
+	}
+	return verdict(resp, "")
 }
 
-func (o *openAIChecker) sendRequest(msg string) (response openAIResponse, err error) {
+// forget removes cached responses for the message, with any context, so the message confirmed by admin
+// as spam or ham is checked again instead of getting the previous verdict
+func (o *openAIChecker) forget(msg string) {
+	if o.cache == nil {
+		return
+	}
+	key := cacheKey(msg)
+	for _, k := range o.cache.Keys() {
+		if k == key || strings.HasPrefix(k, key+"/") {
+			o.cache.Remove(k)
+		}
+	}
+}
+
+// setExamples replaces few-shot examples with the last samples of the given spam and ham ones
+func (o *openAIChecker) setExamples(spam, ham []string) {
+	o.examplesLock.Lock()
+	defer o.examplesLock.Unlock()
+	o.spamExamples = lastSamples(nil, spam, o.params.Examples)
+	o.hamExamples = lastSamples(nil, ham, o.params.Examples)
+}
+
+// addExample adds a confirmed sample to few-shot examples, dropping the oldest one of the same class
+func (o *openAIChecker) addExample(msg string, spam bool) {
+	o.examplesLock.Lock()
+	defer o.examplesLock.Unlock()
+	if spam {
+		o.spamExamples = lastSamples(o.spamExamples, []string{msg}, o.params.Examples)
+		return
+	}
+	o.hamExamples = lastSamples(o.hamExamples, []string{msg}, o.params.Examples)
+}
+
+// examples returns few-shot examples with the expected answers, spam and ham interleaved
+func (o *openAIChecker) examples() []LLMExample {
+	o.examplesLock.RLock()
+	defer o.examplesLock.RUnlock()
+	if len(o.spamExamples) == 0 && len(o.hamExamples) == 0 {
+		return nil
+	}
+	answer := func(spam bool) string {
+		res, _ := json.Marshal(openAIResponse{IsSpam: spam, Reason: "confirmed by admin", Confidence: 100})
+		return string(res)
+	}
+	res := make([]LLMExample, 0, len(o.spamExamples)+len(o.hamExamples))
+	for i := 0; i < len(o.spamExamples) || i < len(o.hamExamples); i++ {
+		if i < len(o.spamExamples) {
+			res = append(res, LLMExample{Message: o.spamExamples[i], Answer: answer(true)})
+		}
+		if i < len(o.hamExamples) {
+			res = append(res, LLMExample{Message: o.hamExamples[i], Answer: answer(false)})
+		}
+	}
+	return res
+}
+
+// lastSamples appends non-empty samples to dst and keeps up to max last ones
+func lastSamples(dst, samples []string, max int) []string {
+	if max <= 0 {
+		return nil
+	}
+	for _, s := range samples {
+		if s = strings.TrimSpace(s); s != "" {
+			dst = append(dst, s)
+		}
+	}
+	if len(dst) > max {
+		dst = append([]string(nil), dst[len(dst)-max:]...)
+	}
+	return dst
+}
+
+// reserveCall counts a call in the daily budget. It returns error if the daily calls or tokens limit reached.
+// Counters are reset on the day change.
+func (o *openAIChecker) reserveCall() error {
+	o.budgetLock.Lock()
+	defer o.budgetLock.Unlock()
+	if day := o.now().Format("2006-01-02"); day != o.budgetDay {
+		o.budgetDay, o.dayCalls, o.dayTokens = day, 0, 0
+	}
+	if o.params.MaxCallsPerDay > 0 && o.dayCalls >= o.params.MaxCallsPerDay {
+		return fmt.Errorf("daily calls limit %d reached", o.params.MaxCallsPerDay)
+	}
+	if o.params.MaxTokensPerDay > 0 && o.dayTokens >= o.params.MaxTokensPerDay {
+		return fmt.Errorf("daily tokens limit %d reached", o.params.MaxTokensPerDay)
+	}
+	o.dayCalls++
+	return nil
+}
+
+// spendTokens adds tokens used by the call to the daily budget
+func (o *openAIChecker) spendTokens(texts ...string) {
+	if o.params.MaxTokensPerDay <= 0 {
+		return // no need to count
+	}
+	count := 0
+	for _, text := range texts {
+		count += o.countTokens(text)
+	}
+	o.budgetLock.Lock()
+	o.dayTokens += count
+	o.budgetLock.Unlock()
+}
+
+// countTokens returns the number of tokens in the text, estimated by length if tokenizer failed
+func (o *openAIChecker) countTokens(text string) int {
+	if enc := o.getEncoder(); enc != nil {
+		if tokens, err := enc.Encode(text); err == nil {
+			return len(tokens)
+		}
+	}
+	return len(text)/4 + 1 // ~4 symbols per token
+}
+
+// getEncoder returns the tokenizer, created once on the first use
+func (o *openAIChecker) getEncoder() *tokenizer.Encoder {
+	o.encoderOnce.Do(func() {
+		enc, err := tokenizer.NewEncoder()
+		if err != nil {
+			return
+		}
+		o.encoder = enc
+	})
+	return o.encoder
+}
+
+// message makes the message sent to the model from the request, reduced to the request limits and rendered
+// with the context by the message template, if set
+func (o *openAIChecker) message(req spamcheck.Request) string {
 	// Reduce the request size with tokenizer and fallback to default reducer if it fails
 	// The API supports 4097 tokens ~16000 characters (<=4 per token) for request + result together
 	// The response is limited to 1000 tokens and OpenAI always reserved it for the result
@@ -91,8 +306,8 @@ func (o *openAIChecker) sendRequest(msg string) (response openAIResponse, err er
 			return text[:o.params.MaxSymbolsRequest]
 		}
 
-		encoder, tokErr := tokenizer.NewEncoder()
-		if tokErr != nil {
+		encoder := o.getEncoder()
+		if encoder == nil {
 			return defaultReducer(text)
 		}
 
@@ -108,31 +323,105 @@ func (o *openAIChecker) sendRequest(msg string) (response openAIResponse, err er
 		return encoder.Decode(tokens[:o.params.MaxTokensRequest])
 	}
 
-	r := reduceRequest(msg)
-
-	data := []openai.ChatCompletionMessage{
-		{Role: openai.ChatMessageRoleSystem, Content: o.params.SystemPrompt},
-		{Role: openai.ChatMessageRoleUser, Content: r},
+	text := reduceRequest(req.Msg)
+	msg, err := renderMessage(o.tmpl, req, text, o.params.ChatDescription)
+	if err != nil {
+		log.Printf("[WARN] openai message sent without context, %v", err)
+		return text
 	}
+	return msg
+}
 
-	resp, err := o.client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{Model: o.params.Model, MaxTokens: o.params.MaxTokensResponse, Messages: data},
-	)
-
+// sendRequest sends the message to the model and parses the answer
+func (o *openAIChecker) sendRequest(msg string) (response openAIResponse, err error) {
+	llmReq := LLMRequest{Model: o.params.Model, SystemPrompt: o.params.SystemPrompt, Message: msg,
+		MaxTokens: o.params.MaxTokensResponse, Examples: o.examples(), Structured: o.params.Structured}
+	answer, err := o.complete(llmReq)
 	if err != nil {
 		return openAIResponse{}, err
 	}
-
-	// OpenAI platform supports returning multiple chat completion choices, but we use only the first one:
-	// https://platform.openai.com/docs/api-reference/chat/create#chat/create-n
-	if len(resp.Choices) == 0 {
-		return openAIResponse{}, fmt.Errorf("no choices in response")
+	spent := []string{llmReq.SystemPrompt, llmReq.Message, answer}
+	for _, e := range llmReq.Examples {
+		spent = append(spent, e.Message, e.Answer)
 	}
+	o.spendTokens(spent...)
 
-	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &response); err != nil {
+	if err := json.Unmarshal([]byte(extractJSON(answer)), &response); err != nil {
 		return openAIResponse{}, fmt.Errorf("can't unmarshal response: %w", err)
 	}
 
 	return response, nil
 }
+
+// complete sends the request to llm. Rate limit and server errors are retried with exponential backoff.
+// All the attempts share the same deadline, and no retry is made if the backoff doesn't fit into it,
+// as the check may be made under the detector's lock, blocking its updates.
+func (o *openAIChecker) complete(req LLMRequest) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), o.params.Timeout)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	delay := o.params.RetryDelay
+	for attempt := 0; ; attempt++ {
+		answer, err := o.llm.Complete(ctx, req)
+		if err == nil || attempt >= o.params.Retries || !isRetryable(err) || time.Until(deadline) <= delay {
+			return answer, err
+		}
+		select {
+		case <-ctx.Done():
+			return answer, err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// isRetryable checks if the llm error is a rate limit (429) or server (5xx) error
+func isRetryable(err error) bool {
+	code := 0
+	var statusErr *LLMStatusError
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &statusErr):
+		code = statusErr.StatusCode
+	case errors.As(err, &apiErr):
+		code = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		code = reqErr.HTTPStatusCode
+	}
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// cacheKey makes a key of the message for responses cache. The message is normalized and whitespace collapsed,
+// so obfuscated copies of the same spam share the key.
+func cacheKey(msg string) string {
+	h := sha256.Sum256([]byte(strings.Join(strings.Fields(normalize(msg)), " ")))
+	return hex.EncodeToString(h[:])
+}
+
+// extractJSON returns json object from the model's answer. Besides the code fence, models may add some text
+// around the json, like "Here is the result: {...}". In this case the text from the first "{" to the last "}" returned.
+func extractJSON(s string) string {
+	s = trimCodeFence(s)
+	if strings.HasPrefix(s, "{") {
+		return s
+	}
+	start, end := strings.Index(s, "{"), strings.LastIndex(s, "}")
+	if start < 0 || end < start {
+		return s
+	}
+	return s[start : end+1]
+}
+
+// trimCodeFence removes markdown code fence some models wrap json answers in, like ```json ... ```
+func trimCodeFence(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") || !strings.HasSuffix(s, "```") || len(s) < 6 {
+		return s
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "```"), "```")
+	if lang, rest, ok := strings.Cut(s, "\n"); ok && !strings.Contains(lang, "{") {
+		s = rest // skip language tag
+	}
+	return strings.TrimSpace(s)
+}
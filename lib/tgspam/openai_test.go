@@ -2,11 +2,16 @@ package tgspam
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/sashabaranov/go-openai"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/umputun/tg-spam/lib/spamcheck"
 	"github.com/umputun/tg-spam/lib/tgspam/mocks"
 )
 
@@ -23,7 +28,7 @@ func TestOpenAIChecker_Check(t *testing.T) {
 		},
 	}
 
-	checker := newOpenAIChecker(clientMock, OpenAIConfig{
+	checker := newOpenAIChecker(NewOpenAILLM(clientMock), OpenAIConfig{
 		MaxTokensResponse: 300,
 		MaxTokensRequest:  3000,
 		MaxSymbolsRequest: 12000,
@@ -39,7 +44,7 @@ func TestOpenAIChecker_Check(t *testing.T) {
 				}},
 			}, nil
 		}
-		spam, details := checker.check("some text")
+		spam, details := checker.check(spamcheck.Request{Msg: "some text"})
 		t.Logf("spam: %v, details: %+v", spam, details)
 		assert.True(t, spam)
 		assert.Equal(t, "openai", details.Name)
@@ -55,7 +60,7 @@ func TestOpenAIChecker_Check(t *testing.T) {
 				}},
 			}, nil
 		}
-		spam, details := checker.check("some text")
+		spam, details := checker.check(spamcheck.Request{Msg: "some text"})
 		t.Logf("spam: %v, details: %+v", spam, details)
 		assert.False(t, spam)
 		assert.Equal(t, "openai", details.Name)
@@ -67,7 +72,7 @@ func TestOpenAIChecker_Check(t *testing.T) {
 			contextMoqParam context.Context, chatCompletionRequest openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
 			return openai.ChatCompletionResponse{}, assert.AnError
 		}
-		spam, details := checker.check("some text")
+		spam, details := checker.check(spamcheck.Request{Msg: "some text"})
 		t.Logf("spam: %v, details: %+v", spam, details)
 		assert.False(t, spam)
 		assert.Equal(t, "openai", details.Name)
@@ -83,7 +88,7 @@ func TestOpenAIChecker_Check(t *testing.T) {
 				}},
 			}, nil
 		}
-		spam, details := checker.check("some text")
+		spam, details := checker.check(spamcheck.Request{Msg: "some text"})
 		t.Logf("spam: %v, details: %+v", spam, details)
 		assert.False(t, spam)
 		assert.Equal(t, "openai", details.Name)
@@ -95,10 +100,317 @@ func TestOpenAIChecker_Check(t *testing.T) {
 			contextMoqParam context.Context, chatCompletionRequest openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
 			return openai.ChatCompletionResponse{}, nil
 		}
-		spam, details := checker.check("some text")
+		spam, details := checker.check(spamcheck.Request{Msg: "some text"})
 		t.Logf("spam: %v, details: %+v", spam, details)
 		assert.False(t, spam)
 		assert.Equal(t, "openai", details.Name)
 		assert.Equal(t, "OpenAI error: no choices in response", details.Details)
 	})
 }
+
+func TestOpenAIChecker_CheckWithLLM(t *testing.T) {
+	var reqs []LLMRequest
+	llm := llmFunc(func(_ context.Context, req LLMRequest) (string, error) {
+		reqs = append(reqs, req)
+		return "```json\n{\"spam\": true, \"reason\":\"bad text\", \"confidence\":90}\n```", nil
+	})
+	checker := newOpenAIChecker(llm, OpenAIConfig{Model: "claude-3-haiku", MaxTokensResponse: 300, SystemPrompt: "prompt"})
+	spam, details := checker.check(spamcheck.Request{Msg: "some text"})
+	assert.True(t, spam)
+	assert.Equal(t, "bad text, confidence: 90%", details.Details)
+	assert.Equal(t, []LLMRequest{{Model: "claude-3-haiku", SystemPrompt: "prompt", Message: "some text", MaxTokens: 300}}, reqs)
+
+	t.Run("nil llm", func(t *testing.T) {
+		spam, details := newOpenAIChecker(nil, OpenAIConfig{}).check(spamcheck.Request{Msg: "some text"})
+		assert.False(t, spam)
+		assert.Equal(t, spamcheck.Response{}, details)
+	})
+}
+
+func TestOpenAIChecker_Retries(t *testing.T) {
+	tests := []struct {
+		name    string
+		errs    []error
+		calls   int
+		details string
+	}{
+		{name: "no errors", errs: nil, calls: 1, details: "bad text, confidence: 90%"},
+		{name: "rate limit retried", errs: []error{&LLMStatusError{StatusCode: 429}, &LLMStatusError{StatusCode: 503}},
+			calls: 3, details: "bad text, confidence: 90%"},
+		{name: "openai server error retried", errs: []error{&openai.APIError{HTTPStatusCode: 500}},
+			calls: 2, details: "bad text, confidence: 90%"},
+		{name: "retries exhausted", errs: []error{&LLMStatusError{StatusCode: 429, Message: "slow down"},
+			&LLMStatusError{StatusCode: 429, Message: "slow down"}, &LLMStatusError{StatusCode: 429, Message: "slow down"}},
+			calls: 3, details: "OpenAI error: unexpected status 429: slow down"},
+		{name: "bad request not retried", errs: []error{&LLMStatusError{StatusCode: 400, Message: "bad"}},
+			calls: 1, details: "OpenAI error: unexpected status 400: bad"},
+		{name: "other error not retried", errs: []error{assert.AnError},
+			calls: 1, details: "OpenAI error: assert.AnError general error for testing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			llm := llmFunc(func(ctx context.Context, _ LLMRequest) (string, error) {
+				_, ok := ctx.Deadline()
+				assert.True(t, ok, "deadline set")
+				calls++
+				if calls <= len(tt.errs) {
+					return "", tt.errs[calls-1]
+				}
+				return `{"spam": true, "reason":"bad text", "confidence":90}`, nil
+			})
+			checker := newOpenAIChecker(llm, OpenAIConfig{Retries: 2, RetryDelay: time.Millisecond})
+			_, details := checker.check(spamcheck.Request{Msg: "some text"})
+			assert.Equal(t, tt.details, details.Details)
+			assert.Equal(t, tt.calls, calls)
+		})
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		llm := llmFunc(func(ctx context.Context, _ LLMRequest) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		})
+		checker := newOpenAIChecker(llm, OpenAIConfig{Timeout: 10 * time.Millisecond, Retries: 2})
+		st := time.Now()
+		_, details := checker.check(spamcheck.Request{Msg: "some text"})
+		assert.Equal(t, "OpenAI error: context deadline exceeded", details.Details)
+		assert.Less(t, time.Since(st), time.Second, "timeout not retried")
+	})
+
+	t.Run("backoff beyond deadline", func(t *testing.T) {
+		calls := 0
+		llm := llmFunc(func(ctx context.Context, _ LLMRequest) (string, error) {
+			calls++
+			return "", &LLMStatusError{StatusCode: 429, Message: "slow down"}
+		})
+		checker := newOpenAIChecker(llm, OpenAIConfig{Timeout: 50 * time.Millisecond, Retries: 5, RetryDelay: time.Minute})
+		st := time.Now()
+		_, details := checker.check(spamcheck.Request{Msg: "some text"})
+		assert.Equal(t, "OpenAI error: unexpected status 429: slow down", details.Details)
+		assert.Equal(t, 1, calls)
+		assert.Less(t, time.Since(st), time.Second, "no sleep beyond the deadline")
+	})
+}
+
+func Test_isRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&LLMStatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{&LLMStatusError{StatusCode: http.StatusBadGateway}, true},
+		{&LLMStatusError{StatusCode: http.StatusUnauthorized}, false},
+		{fmt.Errorf("wrapped: %w", &LLMStatusError{StatusCode: 500}), true},
+		{&openai.APIError{HTTPStatusCode: 429}, true},
+		{&openai.APIError{HTTPStatusCode: 404}, false},
+		{&openai.RequestError{HTTPStatusCode: 502}, true},
+		{assert.AnError, false},
+		{context.DeadlineExceeded, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, isRetryable(tt.err), tt.err.Error())
+	}
+}
+
+func TestOpenAIChecker_Cache(t *testing.T) {
+	calls := 0
+	llm := llmFunc(func(_ context.Context, req LLMRequest) (string, error) {
+		calls++
+		if req.Message == "fail" {
+			return "", assert.AnError
+		}
+		return `{"spam": true, "reason":"bad text", "confidence":90}`, nil
+	})
+
+	checker := newOpenAIChecker(llm, OpenAIConfig{CacheSize: 2})
+	spam, details := checker.check(spamcheck.Request{Msg: "Buy crypto now"})
+	assert.True(t, spam)
+	assert.Equal(t, "bad text, confidence: 90%", details.Details)
+	assert.Equal(t, 1, calls)
+
+	spam, details = checker.check(spamcheck.Request{Msg: "  buy  CRYPT0 \u200bnow "})
+	assert.True(t, spam)
+	assert.Equal(t, "bad text, confidence: 90% (cached)", details.Details, "normalized message cached")
+	assert.Equal(t, 1, calls)
+
+	checker.check(spamcheck.Request{Msg: "fail"})
+	checker.check(spamcheck.Request{Msg: "fail"})
+	assert.Equal(t, 3, calls, "errors not cached")
+
+	checker.check(spamcheck.Request{Msg: "second"})
+	checker.check(spamcheck.Request{Msg: "third"})
+	checker.check(spamcheck.Request{Msg: "Buy crypto now"})
+	assert.Equal(t, 6, calls, "evicted from cache")
+
+	t.Run("with context", func(t *testing.T) {
+		calls = 0
+		checker := newOpenAIChecker(llm, OpenAIConfig{CacheSize: 10, MessageTemplate: DefaultMessageTemplate})
+		checker.check(spamcheck.Request{Msg: "hi", UserID: "7000000001", DisplayName: "Spammer"})
+		_, details := checker.check(spamcheck.Request{Msg: "hi", UserID: "100", DisplayName: "Old Friend"})
+		assert.Equal(t, "bad text, confidence: 90%", details.Details, "same text with different context not cached")
+		assert.Equal(t, 2, calls)
+		_, details = checker.check(spamcheck.Request{Msg: "hi", UserID: "100", DisplayName: "Old Friend"})
+		assert.Equal(t, "bad text, confidence: 90% (cached)", details.Details)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("forget", func(t *testing.T) {
+		calls = 0
+		checker := newOpenAIChecker(llm, OpenAIConfig{CacheSize: 10, MessageTemplate: DefaultMessageTemplate})
+		checker.check(spamcheck.Request{Msg: "Buy crypto now", UserID: "1", DisplayName: "John"})
+		checker.check(spamcheck.Request{Msg: "Buy crypto now", UserID: "2", DisplayName: "Jane"})
+		checker.check(spamcheck.Request{Msg: "other", UserID: "1", DisplayName: "John"})
+		assert.Equal(t, 3, checker.cache.Len())
+		checker.forget("buy  crypto now")
+		assert.Equal(t, 1, checker.cache.Len(), "all the contexts of the message removed")
+		checker.check(spamcheck.Request{Msg: "Buy crypto now", UserID: "1", DisplayName: "John"})
+		assert.Equal(t, 4, calls)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		calls = 0
+		checker := newOpenAIChecker(llm, OpenAIConfig{})
+		checker.check(spamcheck.Request{Msg: "Buy crypto now"})
+		checker.check(spamcheck.Request{Msg: "Buy crypto now"})
+		assert.Equal(t, 2, calls)
+	})
+}
+
+func TestOpenAIChecker_Budget(t *testing.T) {
+	calls := 0
+	llm := llmFunc(func(_ context.Context, _ LLMRequest) (string, error) {
+		calls++
+		return `{"spam": true, "reason":"bad text", "confidence":90}`, nil
+	})
+
+	t.Run("calls limit", func(t *testing.T) {
+		calls = 0
+		now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+		checker := newOpenAIChecker(llm, OpenAIConfig{MaxCallsPerDay: 2})
+		checker.now = func() time.Time { return now }
+		for i := 0; i < 2; i++ {
+			spam, _ := checker.check(spamcheck.Request{Msg: fmt.Sprintf("text %d", i)})
+			assert.True(t, spam)
+		}
+		spam, details := checker.check(spamcheck.Request{Msg: "text 3"})
+		assert.False(t, spam)
+		assert.Equal(t, spamcheck.Response{Name: "openai", Details: "daily calls limit 2 reached, check skipped"}, details)
+		assert.Equal(t, 2, calls)
+
+		now = now.Add(24 * time.Hour)
+		spam, _ = checker.check(spamcheck.Request{Msg: "text 3"})
+		assert.True(t, spam, "budget reset on the next day")
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("tokens limit", func(t *testing.T) {
+		calls = 0
+		checker := newOpenAIChecker(llm, OpenAIConfig{MaxTokensPerDay: 50, SystemPrompt: "short prompt"})
+		spam, _ := checker.check(spamcheck.Request{Msg: "some text"})
+		assert.True(t, spam)
+		require.Positive(t, checker.dayTokens)
+		assert.Less(t, checker.dayTokens, 50)
+		for i := 0; i < 5 && checker.dayTokens < 50; i++ {
+			checker.check(spamcheck.Request{Msg: fmt.Sprintf("some text %d", i)})
+		}
+		spam, details := checker.check(spamcheck.Request{Msg: "another text"})
+		assert.False(t, spam)
+		assert.Equal(t, "daily tokens limit 50 reached, check skipped", details.Details)
+	})
+}
+
+func TestOpenAIChecker_MinConfidence(t *testing.T) {
+	answer := ""
+	llm := llmFunc(func(_ context.Context, _ LLMRequest) (string, error) { return answer, nil })
+	checker := newOpenAIChecker(llm, OpenAIConfig{MinConfidence: 80})
+
+	tests := []struct {
+		answer  string
+		spam    bool
+		details string
+	}{
+		{`{"spam": true, "reason":"bad text", "confidence":90}`, true, "bad text, confidence: 90%"},
+		{`{"spam": true, "reason":"bad text", "confidence":80}`, true, "bad text, confidence: 80%"},
+		{`{"spam": true, "reason":"maybe bad", "confidence":60}`, false, "maybe bad, confidence: 60%, below 80%"},
+		{`{"spam": false, "reason":"good text", "confidence":60}`, false, "good text, confidence: 60%"},
+		{`Sure! {"spam": true, "reason":"bad text", "confidence":95} Hope it helps.`, true, "bad text, confidence: 95%"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.answer, func(t *testing.T) {
+			answer = tt.answer
+			spam, details := checker.check(spamcheck.Request{Msg: tt.answer}) // different messages to avoid cache
+			assert.Equal(t, tt.spam, spam)
+			assert.Equal(t, spamcheck.Response{Name: "openai", Spam: tt.spam, Details: tt.details}, details)
+		})
+	}
+}
+
+func TestOpenAIChecker_Examples(t *testing.T) {
+	var reqs []LLMRequest
+	llm := llmFunc(func(_ context.Context, req LLMRequest) (string, error) {
+		reqs = append(reqs, req)
+		return `{"spam": false, "reason":"good text", "confidence":90}`, nil
+	})
+
+	checker := newOpenAIChecker(llm, OpenAIConfig{Examples: 2, Structured: true})
+	checker.setExamples([]string{"spam 1", "spam 2", " ", "spam 3"}, []string{"ham 1"})
+	checker.addExample("ham 2", false)
+	checker.addExample("ham 3", false)
+	checker.check(spamcheck.Request{Msg: "some text"})
+	require.Len(t, reqs, 1)
+	assert.True(t, reqs[0].Structured)
+	spamAnswer := `{"spam":true,"reason":"confirmed by admin","confidence":100}`
+	hamAnswer := `{"spam":false,"reason":"confirmed by admin","confidence":100}`
+	assert.Equal(t, []LLMExample{{Message: "spam 2", Answer: spamAnswer}, {Message: "ham 2", Answer: hamAnswer},
+		{Message: "spam 3", Answer: spamAnswer}, {Message: "ham 3", Answer: hamAnswer}}, reqs[0].Examples)
+
+	t.Run("disabled", func(t *testing.T) {
+		reqs = nil
+		checker := newOpenAIChecker(llm, OpenAIConfig{})
+		checker.setExamples([]string{"spam 1"}, []string{"ham 1"})
+		checker.addExample("spam 2", true)
+		checker.check(spamcheck.Request{Msg: "some text"})
+		require.Len(t, reqs, 1)
+		assert.Empty(t, reqs[0].Examples)
+		assert.False(t, reqs[0].Structured)
+	})
+}
+
+func Test_extractJSON(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{`{"spam":true}`, `{"spam":true}`},
+		{"```json\n{\"spam\":true}\n```", `{"spam":true}`},
+		{`Here is the result: {"spam":true} Let me know if you need anything else.`, `{"spam":true}`},
+		{"Result:\n```json\n{\"spam\":true}\n```", `{"spam":true}`},
+		{"not a json", "not a json"},
+		{"} bad {", "} bad {"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.out, extractJSON(tt.in), tt.in)
+	}
+}
+
+func Test_trimCodeFence(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{`{"spam":true}`, `{"spam":true}`},
+		{" \n{\"spam\":true}\n", `{"spam":true}`},
+		{"```json\n{\"spam\":true}\n```", `{"spam":true}`},
+		{"```\n{\"spam\":true}\n```", `{"spam":true}`},
+		{"```{\"spam\":true}```", `{"spam":true}`},
+		{"```", "```"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.out, trimCodeFence(tt.in), tt.in)
+	}
+}
+
+// llmFunc is a function implementing LLMChecker
+type llmFunc func(ctx context.Context, req LLMRequest) (string, error)
+
+func (f llmFunc) Complete(ctx context.Context, req LLMRequest) (string, error) { return f(ctx, req) }
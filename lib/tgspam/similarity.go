@@ -0,0 +1,85 @@
+package tgspam
+
+import (
+	"math"
+	"slices"
+)
+
+// similarityIndex is an inverted index of tokenized spam samples. It maps each token to the samples containing it,
+// so the cosine similarity is calculated only for samples sharing at least one token with the message
+// instead of scanning all of them.
+type similarityIndex struct {
+	postings map[string][]posting // token -> samples with this token, in order of samples
+	norms    []int                // sum of squares of token frequencies, by sample id
+}
+
+// posting is a sample containing the token, with the token's frequency in it
+type posting struct {
+	id   int
+	freq int
+}
+
+// newSimilarityIndex returns an empty similarity index
+func newSimilarityIndex() similarityIndex {
+	return similarityIndex{postings: make(map[string][]posting), norms: []int{}}
+}
+
+// reset clears the index
+func (s *similarityIndex) reset() {
+	s.postings = make(map[string][]posting)
+	s.norms = []int{}
+}
+
+// add adds a tokenized sample to the index, the sample's id is its position in the order of adding
+func (s *similarityIndex) add(sample map[string]int) {
+	id := len(s.norms)
+	norm := 0
+	for token, freq := range sample {
+		s.postings[token] = append(s.postings[token], posting{id: id, freq: freq})
+		norm += freq * freq
+	}
+	s.norms = append(s.norms, norm)
+}
+
+// maxSimilarity returns the highest cosine similarity of the message with indexed samples. Samples are checked
+// in the order of adding and the search stops on the first one with the similarity not less than the threshold,
+// returning the highest similarity found so far and found flag. This is the same as a linear scan over samples,
+// as samples without common tokens have zero similarity and can't reach the positive threshold.
+func (s *similarityIndex) maxSimilarity(msg map[string]int, threshold float64) (similarity float64, found bool) {
+	normMsg := 0
+	for _, freq := range msg {
+		normMsg += freq * freq
+	}
+	if normMsg == 0 {
+		return 0, false
+	}
+
+	// accumulate dot products of the message with all samples sharing any token with it
+	dots := make(map[int]int)
+	for token, freq := range msg {
+		for _, p := range s.postings[token] {
+			dots[p.id] += freq * p.freq
+		}
+	}
+
+	ids := make([]int, 0, len(dots))
+	for id := range dots {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	maxSim := 0.0
+	for _, id := range ids {
+		if s.norms[id] == 0 {
+			continue
+		}
+		sim := float64(dots[id]) / (math.Sqrt(float64(normMsg)) * math.Sqrt(float64(s.norms[id])))
+		if sim > maxSim {
+			maxSim = sim
+		}
+		if sim >= threshold {
+			return maxSim, true
+		}
+	}
+	return maxSim, false
+}
@@ -0,0 +1,45 @@
+package tgspam
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimilarityIndex(t *testing.T) {
+	idx := newSimilarityIndex()
+	idx.add(map[string]int{"win": 1, "free": 1, "iphone": 1})
+	idx.add(map[string]int{})
+	idx.add(map[string]int{"lottery": 1, "prize": 1})
+	idx.add(map[string]int{"free": 2, "prize": 1})
+	assert.Equal(t, []int{3, 0, 2, 5}, idx.norms)
+	assert.Equal(t, []posting{{id: 0, freq: 1}, {id: 3, freq: 2}}, idx.postings["free"])
+
+	tests := []struct {
+		name       string
+		msg        map[string]int
+		threshold  float64
+		similarity float64
+		found      bool
+	}{
+		{name: "empty message", msg: map[string]int{}, threshold: 0.5, similarity: 0, found: false},
+		{name: "no common tokens", msg: map[string]int{"hello": 1}, threshold: 0.5, similarity: 0, found: false},
+		{name: "exact match", msg: map[string]int{"lottery": 1, "prize": 1}, threshold: 0.9, similarity: 1, found: true},
+		{name: "below threshold", msg: map[string]int{"prize": 1, "hello": 1}, threshold: 0.9, similarity: 0.5, found: false},
+		{name: "stops on first match", msg: map[string]int{"free": 1, "prize": 1}, threshold: 0.45, similarity: 0.5, found: true},
+		{name: "best of all", msg: map[string]int{"free": 1, "prize": 1}, threshold: 0.99, similarity: 0.95, found: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			similarity, found := idx.maxSimilarity(tt.msg, tt.threshold)
+			assert.InDelta(t, tt.similarity, similarity, 0.01)
+			assert.Equal(t, tt.found, found)
+		})
+	}
+
+	idx.reset()
+	similarity, found := idx.maxSimilarity(map[string]int{"free": 1}, 0.1)
+	assert.Zero(t, similarity)
+	assert.False(t, found)
+}
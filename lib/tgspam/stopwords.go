@@ -0,0 +1,116 @@
+package tgspam
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// stop word rule prefixes. A line without a known prefix is a literal phrase.
+const (
+	stopWordRegexPrefix = "re:"   // regular expression, matched against the original message text
+	stopWordGlobPrefix  = "glob:" // glob-style pattern with * and ? wildcards, matched against the normalized text
+	stopWordWordPrefix  = "word:" // literal phrase matched as whole words only, against the normalized text
+)
+
+// stopWordNameRe matches an optional rule name in square brackets at the beginning of the line, e.g. "[crypto] re:..."
+var stopWordNameRe = regexp.MustCompile(`^\[([^\]]+)\]\s+(.+)$`)
+
+// stopWord is a parsed stop-words rule
+type stopWord struct {
+	name   string         // rule name reported in details, the rule itself if not named
+	phrase string         // normalized phrase for literal rules
+	re     *regexp.Regexp // compiled pattern for regex, glob and whole-word rules
+	raw    bool           // match re against the original text instead of the normalized one
+}
+
+// parseStopWord parses a stop-words line. Supported forms:
+//   - "phrase" - literal phrase, matched anywhere in the normalized message
+//   - "word:phrase" - literal phrase matched as whole words only
+//   - "glob:pattern" - glob pattern, "*" matches any characters and "?" a single one
+//   - "re:pattern" - case-insensitive regular expression, matched against the original message
+//
+// Each rule can be named with "[name] " prefix, e.g. "[crypto] re:crypto\s+signals?", the name reported in details.
+func parseStopWord(line string) (stopWord, error) {
+	res := stopWord{name: strings.ToLower(line)}
+	rule := line
+	if m := stopWordNameRe.FindStringSubmatch(line); m != nil {
+		res.name, rule = strings.TrimSpace(m[1]), m[2]
+	}
+
+	switch {
+	case strings.HasPrefix(rule, stopWordRegexPrefix):
+		pattern := strings.TrimPrefix(rule, stopWordRegexPrefix)
+		if pattern == "" {
+			return stopWord{}, errors.New("empty regular expression")
+		}
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return stopWord{}, fmt.Errorf("invalid regular expression: %w", err)
+		}
+		if re.MatchString("") {
+			return stopWord{}, errors.New("regular expression matches empty text")
+		}
+		res.re, res.raw = re, true
+	case strings.HasPrefix(rule, stopWordGlobPrefix):
+		pattern := strings.TrimPrefix(rule, stopWordGlobPrefix)
+		if strings.Trim(pattern, "*? ") == "" {
+			return stopWord{}, errors.New("glob pattern without text")
+		}
+		res.re = regexp.MustCompile(globToRegex(pattern))
+	case strings.HasPrefix(rule, stopWordWordPrefix):
+		phrase := normalize(strings.TrimSpace(strings.TrimPrefix(rule, stopWordWordPrefix)))
+		if phrase == "" {
+			return stopWord{}, errors.New("empty phrase")
+		}
+		// RE2's \b is ascii-only, so word boundaries are set as any non-letter and non-digit character
+		res.re = regexp.MustCompile(`(?:^|[^\pL\pN])` + regexp.QuoteMeta(phrase) + `(?:$|[^\pL\pN])`)
+	default:
+		res.phrase = normalize(rule)
+	}
+	return res, nil
+}
+
+// globToRegex converts a glob pattern to a regular expression, literal parts normalized.
+// "*" matches any sequence of characters, including new lines, and "?" matches a single character.
+// The pattern is normalized as a whole, with wildcards kept as placeholders, so the words split by wildcards
+// are normalized the same way as in the message, e.g., "m*0ney" matches "money".
+func globToRegex(pattern string) string {
+	const anyPlaceholder, onePlaceholder = '\uE000', '\uE001' // private use runes, kept by normalize as is
+	pattern = strings.NewReplacer("*", string(anyPlaceholder), "?", string(onePlaceholder)).Replace(pattern)
+
+	var sb strings.Builder
+	sb.WriteString(`(?s)`)
+	literal := strings.Builder{}
+	flush := func() {
+		sb.WriteString(regexp.QuoteMeta(literal.String()))
+		literal.Reset()
+	}
+	for _, r := range normalize(pattern) {
+		switch r {
+		case anyPlaceholder:
+			flush()
+			sb.WriteString(`.*?`)
+		case onePlaceholder:
+			flush()
+			sb.WriteString(`.`)
+		default:
+			literal.WriteRune(r)
+		}
+	}
+	flush()
+	return sb.String()
+}
+
+// match checks if the rule matches the message, given as the original and normalized text
+func (s stopWord) match(orig, normalized string) bool {
+	switch {
+	case s.re != nil && s.raw:
+		return s.re.MatchString(orig)
+	case s.re != nil:
+		return s.re.MatchString(normalized)
+	default:
+		return strings.Contains(normalized, s.phrase)
+	}
+}
@@ -0,0 +1,105 @@
+package tgspam
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStopWord(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		ruleName  string
+		matches   []string
+		noMatches []string
+		err       string
+	}{
+		{
+			name:      "literal phrase",
+			line:      "В личку",
+			ruleName:  "в личку",
+			matches:   []string{"пишите в личку", "пишите В ЛИЧКУ!", "пишите в личкy"},
+			noMatches: []string{"пишите в лс"},
+		},
+		{
+			name:      "whole word",
+			line:      "word:bit",
+			ruleName:  "word:bit",
+			matches:   []string{"bit", "a bit more", "buy bit, now", "bit\nmore"},
+			noMatches: []string{"bitcoin", "orbit", "rabbit hole"},
+		},
+		{
+			name:      "whole word phrase with cyrillic",
+			line:      "word:в лс",
+			ruleName:  "word:в лс",
+			matches:   []string{"пишите в лс", "пишите в ЛС."},
+			noMatches: []string{"пишите в лсп"},
+		},
+		{
+			name:      "glob",
+			line:      "glob:зараб*удал?нно",
+			ruleName:  "glob:зараб*удал?нно",
+			matches:   []string{"заработок удаленно", "заработок удалённо", "зарабатывай\nудаленно", "ЗАРАБОТОК УДАЛЕННО"},
+			noMatches: []string{"заработок в сети", "удаленно заработок"},
+		},
+		{
+			name:      "glob with leetspeak split by wildcard",
+			line:      "glob:m*0ney f?st",
+			ruleName:  "glob:m*0ney f?st",
+			matches:   []string{"make money fast", "m0ney fast", "MONEY FAST"},
+			noMatches: []string{"money slow"},
+		},
+		{
+			name:      "regex",
+			line:      `re:crypto\s+signals?`,
+			ruleName:  `re:crypto\s+signals?`,
+			matches:   []string{"best crypto signal", "Crypto   Signals here"},
+			noMatches: []string{"cryptosignals", "crypto news"},
+		},
+		{
+			name:      "regex with cyrillic",
+			line:      `re:\d+\s*(руб|\$)\s+в\s+день`,
+			ruleName:  `re:\d+\s*(руб|\$)\s+в\s+день`,
+			matches:   []string{"от 5000 руб в день", "100$ в день"},
+			noMatches: []string{"5000 руб в месяц"},
+		},
+		{
+			name:      "named regex",
+			line:      `[crypto-signals] re:crypto\s+signals?`,
+			ruleName:  "crypto-signals",
+			matches:   []string{"best crypto signals"},
+			noMatches: []string{"crypto news"},
+		},
+		{
+			name:     "named literal",
+			line:     "[dm] в личку",
+			ruleName: "dm",
+			matches:  []string{"пишите в личку"},
+		},
+		{name: "invalid regex", line: "re:crypto(", err: "invalid regular expression: error parsing regexp: missing closing ): `(?i)crypto(`"},
+		{name: "empty regex", line: "re:", err: "empty regular expression"},
+		{name: "regex matching anything", line: "re:.*", err: "regular expression matches empty text"},
+		{name: "glob without text", line: "glob:* ?", err: "glob pattern without text"},
+		{name: "empty word", line: "word: ", err: "empty phrase"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sw, err := parseStopWord(tt.line)
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.ruleName, sw.name)
+			for _, msg := range tt.matches {
+				assert.True(t, sw.match(msg, normalize(msg)), "should match %q", msg)
+			}
+			for _, msg := range tt.noMatches {
+				assert.False(t, sw.match(msg, normalize(msg)), "should not match %q", msg)
+			}
+		})
+	}
+}
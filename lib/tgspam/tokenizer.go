@@ -0,0 +1,82 @@
+package tgspam
+
+import (
+	"unicode"
+
+	"github.com/kljensen/snowball/english"
+	"github.com/kljensen/snowball/russian"
+)
+
+// TokenizerType defines how messages and samples are split into tokens for the classifier and similarity check
+type TokenizerType string
+
+// enum of supported tokenizers
+const (
+	TokenizerWords  TokenizerType = "words" // normalized words, default
+	TokenizerStem   TokenizerType = "stem"  // words reduced to their stems, for russian and english
+	TokenizerNGrams TokenizerType = "ngram" // character n-grams of words, for languages without spaces between words
+)
+
+// ngramSize is the number of characters in n-grams made by TokenizerNGrams
+const ngramSize = 3
+
+// unfoldCyrillic maps latin letters back to cyrillic ones folded to them by normalize.
+// Used to restore words written mostly in cyrillic before passing them to the russian stemmer.
+var unfoldCyrillic = map[rune]rune{
+	'a': 'а', 'b': 'в', 'e': 'е', 'k': 'к', 'm': 'м', 'h': 'н', 'o': 'о', 'p': 'р', 'c': 'с', 't': 'т', 'y': 'у', 'x': 'х',
+}
+
+// wordTokens returns tokens of the normalized word for the given tokenizer. The original (not normalized) word
+// is used to detect the language for stemming.
+func wordTokens(tokenizer TokenizerType, word, orig string) []string {
+	switch tokenizer {
+	case TokenizerStem:
+		return []string{stemWord(word, isCyrillicWord(orig))}
+	case TokenizerNGrams:
+		return ngrams(word, ngramSize)
+	default:
+		return []string{word}
+	}
+}
+
+// stemWord reduces the normalized word to its stem, with the russian stemmer for cyrillic words
+// and the english one for others. The result is normalized the same way as the word.
+func stemWord(word string, cyrillic bool) string {
+	if !cyrillic {
+		return english.Stem(word, false)
+	}
+	runes := []rune(word)
+	for i, r := range runes {
+		if c, ok := unfoldCyrillic[r]; ok {
+			runes[i] = c
+		}
+	}
+	return normalize(russian.Stem(string(runes), false))
+}
+
+// isCyrillicWord checks if the word has cyrillic letters, and not less than latin ones
+func isCyrillicWord(word string) bool {
+	cyrillic, latin := 0, 0
+	for _, r := range word {
+		switch {
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+	return cyrillic > 0 && cyrillic >= latin
+}
+
+// ngrams returns character n-grams of the word, the word itself if it is not longer than n
+func ngrams(word string, n int) []string {
+	runes := []rune(word)
+	if len(runes) <= n {
+		return []string{word}
+	}
+	res := make([]string, 0, len(runes)-n+1)
+	for i := 0; i+n <= len(runes); i++ {
+		res = append(res, string(runes[i:i+n]))
+	}
+	return res
+}
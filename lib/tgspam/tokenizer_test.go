@@ -0,0 +1,70 @@
+package tgspam
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+func TestDetector_tokenizeWithTokenizer(t *testing.T) {
+	tests := []struct {
+		name      string
+		tokenizer TokenizerType
+		input     string
+		expected  map[string]int
+	}{
+		{name: "words by default", tokenizer: "", input: "running runs", expected: map[string]int{"running": 1, "runs": 1}},
+		{name: "words", tokenizer: TokenizerWords, input: "running runs", expected: map[string]int{"running": 1, "runs": 1}},
+		{name: "stem english", tokenizer: TokenizerStem, input: "Running runs, earnings earning",
+			expected: map[string]int{"run": 2, "earn": 2}},
+		{name: "stem russian", tokenizer: TokenizerStem, input: "работа работы работе",
+			expected: map[string]int{normalize("работ"): 3}},
+		{name: "stem russian with latin lookalikes", tokenizer: TokenizerStem, input: "рaбoтa рaбoты",
+			expected: map[string]int{normalize("работ"): 2}},
+		{name: "stem other language as is", tokenizer: TokenizerStem, input: "免费领取奖品",
+			expected: map[string]int{"免费领取奖品": 1}},
+		{name: "ngrams", tokenizer: TokenizerNGrams, input: "免费领取 hello",
+			expected: map[string]int{"免费领": 1, "费领取": 1, "hel": 1, "ell": 1, "llo": 1}},
+		{name: "ngrams, short word", tokenizer: TokenizerNGrams, input: "win",
+			expected: map[string]int{"win": 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDetector(Config{Tokenizer: tt.tokenizer})
+			assert.Equal(t, tt.expected, d.tokenize(tt.input))
+		})
+	}
+}
+
+func TestDetector_CheckWithStemTokenizer(t *testing.T) {
+	spamSamples := "ищем людей для удаленной работы\nwinning prizes for everyone"
+	hamSamples := "привет, как дела\nhello, how are you"
+
+	for _, tokenizer := range []TokenizerType{TokenizerWords, TokenizerStem} {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.9, Tokenizer: tokenizer})
+		_, err := d.LoadSamples(strings.NewReader(""), []io.Reader{strings.NewReader(spamSamples)},
+			[]io.Reader{strings.NewReader(hamSamples)})
+		require.NoError(t, err)
+
+		// different word forms, similar by stems only
+		for _, msg := range []string{"ищем людей для удаленной работе", "winning prize for everyone"} {
+			_, cr := d.Check(spamcheck.Request{Msg: msg})
+			require.NotEmpty(t, cr)
+			assert.Equal(t, "similarity", cr[0].Name)
+			assert.Equal(t, tokenizer == TokenizerStem, cr[0].Spam, "tokenizer %q, %+v", tokenizer, cr[0])
+		}
+	}
+}
+
+func TestNgrams(t *testing.T) {
+	assert.Equal(t, []string{"abc"}, ngrams("abc", 3))
+	assert.Equal(t, []string{"ab"}, ngrams("ab", 3))
+	assert.Equal(t, []string{"abc", "bcd", "cde"}, ngrams("abcde", 3))
+	assert.Equal(t, []string{"при", "рив", "иве", "вет"}, ngrams("привет", 3))
+}